@@ -2,25 +2,84 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/jo-hoe/gostwriter/internal/common"
 	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/ghwebhook"
+	"github.com/jo-hoe/gostwriter/internal/identity"
 	"github.com/jo-hoe/gostwriter/internal/jobs"
 	"github.com/jo-hoe/gostwriter/internal/llm"
 	"github.com/jo-hoe/gostwriter/internal/llm/aiproxy"
+	"github.com/jo-hoe/gostwriter/internal/llm/anthropic"
 	"github.com/jo-hoe/gostwriter/internal/llm/mock"
+	"github.com/jo-hoe/gostwriter/internal/llm/openai"
+	"github.com/jo-hoe/gostwriter/internal/llm/weighted"
 	"github.com/jo-hoe/gostwriter/internal/processor"
+	"github.com/jo-hoe/gostwriter/internal/schedule"
+	"github.com/jo-hoe/gostwriter/internal/secrets"
 	"github.com/jo-hoe/gostwriter/internal/server"
 	"github.com/jo-hoe/gostwriter/internal/storage"
 	"github.com/jo-hoe/gostwriter/internal/targets"
+	confluenceTarget "github.com/jo-hoe/gostwriter/internal/targets/confluence"
+	fsTarget "github.com/jo-hoe/gostwriter/internal/targets/fs"
 	githubTarget "github.com/jo-hoe/gostwriter/internal/targets/github"
+	gitlabTarget "github.com/jo-hoe/gostwriter/internal/targets/gitlab"
+	notionTarget "github.com/jo-hoe/gostwriter/internal/targets/notion"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
 )
 
+// targetValidationTimeout bounds the startup self-test of all targets.
+const targetValidationTimeout = 30 * time.Second
+
+// jwksFetchTimeout bounds fetching the identity provider's key set.
+const jwksFetchTimeout = 10 * time.Second
+
+// webhookFetchTimeout bounds downloading the attachment of a GitHub webhook delivery.
+const webhookFetchTimeout = 30 * time.Second
+
+// s3Timeout bounds a single request to the S3 upload bucket, including image transfers.
+const s3Timeout = 2 * time.Minute
+
+// archiveBatchPause is the pause between archive batches, leaving room for live traffic.
+const archiveBatchPause = 100 * time.Millisecond
+
+// jobStore is what main needs of a job store beyond jobs.Store.
+type jobStore interface {
+	jobs.ReaperStore
+	jobs.Pruner
+	jobs.IdempotencyStore
+	jobs.StageLister
+}
+
+// openStore opens the job store selected by server.databaseDriver. A SQLite store also
+// gets its archive enabled when configured.
+func openStore(sc appcfg.ServerConfig) (jobStore, error) {
+	if sc.DatabaseDriver == appcfg.DatabaseDriverPostgres {
+		return jobs.NewPostgresStore(sc.DatabaseDSN)
+	}
+	store, err := jobs.NewSQLiteStore(sc.DatabasePath)
+	if err != nil {
+		return nil, err
+	}
+	if ac := sc.Archive; ac.Enabled {
+		if err := store.EnableArchive(ac.Dir, ac.PartitionBy); err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("enable archive: %w", err)
+		}
+	}
+	return store, nil
+}
+
 func parseLogLevel(s string) slog.Level {
 	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "debug":
@@ -34,6 +93,35 @@ func parseLogLevel(s string) slog.Level {
 	}
 }
 
+// newLogHandler returns a JSON handler for format "json" and a text handler otherwise.
+func newLogHandler(format string, w io.Writer, lvl slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: lvl}
+	if strings.EqualFold(strings.TrimSpace(format), appcfg.LogFormatJSON) {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// openLogOutput returns the writer for "stdout", "stderr" or a file path (appended to,
+// created if missing) and a func that closes it.
+func openLogOutput(output string) (io.Writer, func(), error) {
+	switch strings.ToLower(strings.TrimSpace(output)) {
+	case "", appcfg.LogOutputStdout:
+		return os.Stdout, func() {}, nil
+	case appcfg.LogOutputStderr:
+		return os.Stderr, func() {}, nil
+	}
+	path := filepath.Clean(output)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640) // #nosec G304 - log path comes from operator config
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { _ = f.Close() }, nil
+}
+
 func main() {
 	// Provisional logger during early startup
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
@@ -46,36 +134,92 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Reconfigure logger with configured level
+	// Reconfigure logger with configured level, format and output
 	lvl := parseLogLevel(cfg.Server.LogLevel)
-	logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: lvl}))
+	logOut, closeLog, err := openLogOutput(cfg.Server.LogOutput)
+	if err != nil {
+		logger.Error("open log output", "err", err)
+		os.Exit(1)
+	}
+	defer closeLog()
+	logHandler := newLogHandler(cfg.Server.LogFormat, logOut, lvl)
+
+	// Optional tracing; log lines within a span carry its trace and span IDs
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Enabled {
+		tracer = tracing.New(os.Stdout)
+		logHandler = tracing.LogHandler(logHandler)
+	}
+	logger = slog.New(logHandler)
 	slog.SetDefault(logger)
 
-	// Store (SQLite)
-	store, err := jobs.NewSQLiteStore(cfg.Server.DatabasePath)
+	// Store (SQLite or PostgreSQL)
+	store, err := openStore(cfg.Server)
 	if err != nil {
-		logger.Error("sqlite open", "err", err)
+		logger.Error("open store", "driver", cfg.Server.DatabaseDriver, "err", err)
 		os.Exit(1)
 	}
 	defer func() { _ = store.Close() }()
 
-	// Uploader
-	uploader := storage.NewUploader(cfg.Server.StorageDir)
+	// Uploader, and the store the stored images are read back from
+	var uploader storage.Uploader
+	var images storage.ImageStore
+	if cfg.Server.Uploads.Backend == appcfg.UploadBackendS3 {
+		u := storage.NewS3Uploader(cfg.Server.Uploads.S3, &http.Client{Timeout: s3Timeout})
+		uploader, images = u, u
+	} else {
+		u := storage.NewLocalUploader(cfg.Server.StorageDir)
+		uploader, images = u, u
+	}
 
-	// Target (single)
+	// Targets
 	reg := targets.NewRegistry()
-	if cfg.Target.GitHub.Enabled {
-		t, err := githubTarget.New("github", cfg.Target.GitHub)
+	for _, e := range cfg.TargetEntries() {
+		var t targets.Target
+		var err error
+		switch e.Type {
+		case appcfg.TargetTypeGitHub:
+			t, err = githubTarget.New(e.Name, e.GitHub)
+		case appcfg.TargetTypeConfluence:
+			t, err = confluenceTarget.New(e.Name, e.Confluence)
+		case appcfg.TargetTypeNotion:
+			t, err = notionTarget.New(e.Name, e.Notion)
+		case appcfg.TargetTypeGitLab:
+			t, err = gitlabTarget.New(e.Name, e.GitLab)
+		case appcfg.TargetTypeFS:
+			t, err = fsTarget.New(e.Name, e.FS)
+		}
 		if err != nil {
-			logger.Error("init github target", "err", err)
+			logger.Error("init "+e.Type+" target", "target", e.Name, "err", err)
 			os.Exit(1)
 		}
 		reg.Add(t)
-	} else {
+	}
+	if len(reg.Names()) == 0 {
 		logger.Error("no enabled target configured")
 		os.Exit(1)
 	}
 
+	// Optional startup self-test of targets
+	if cfg.Server.ValidateTargets {
+		validateCtx, cancelValidate := context.WithTimeout(context.Background(), targetValidationTimeout)
+		results := reg.Validate(validateCtx)
+		cancelValidate()
+		failed := false
+		for name, err := range results {
+			if err != nil {
+				failed = true
+				logger.Error("target validation failed", "target", name, "err", err)
+				continue
+			}
+			logger.Info("target validated", "target", name)
+		}
+		if failed && cfg.Server.FailFastOnTargetError {
+			logger.Error("aborting startup due to target validation errors")
+			os.Exit(1)
+		}
+	}
+
 	// LLM client
 	var llmClient llm.Client
 	switch cfg.LLM.Provider {
@@ -83,6 +227,25 @@ func main() {
 		llmClient = mock.New(cfg.LLM.Mock)
 	case "aiproxy":
 		llmClient = aiproxy.New(cfg.LLM.AIProxy)
+	case "openai":
+		llmClient = openai.New(cfg.LLM.OpenAI)
+	case "anthropic":
+		llmClient = anthropic.New(cfg.LLM.Anthropic)
+	case "weighted":
+		var providers []weighted.Provider
+		for _, p := range cfg.LLM.Providers {
+			var c llm.Client = mock.New(p.Mock)
+			switch p.Type {
+			case "aiproxy":
+				c = aiproxy.New(p.AIProxy)
+			case "openai":
+				c = openai.New(p.OpenAI)
+			case "anthropic":
+				c = anthropic.New(p.Anthropic)
+			}
+			providers = append(providers, weighted.Provider{Name: p.Name, Weight: p.Weight, Client: c})
+		}
+		llmClient = weighted.New(providers, cfg.LLM.ProviderHealth, logger)
 	default:
 		logger.Error("unsupported llm provider", "provider", cfg.LLM.Provider)
 		os.Exit(1)
@@ -90,14 +253,143 @@ func main() {
 
 	// Worker and queue
 	worker := processor.New(logger, cfg, store, llmClient, reg)
-	queue := jobs.NewQueue(logger, common.DefaultQueueCapacity, cfg.Server.WorkerCount)
+	worker.Tracer = tracer
+	worker.Images = images
+	events := jobs.NewEvents()
+	worker.Events = events
+	var queue *jobs.Queue
+	if cfg.Server.QueueMode == appcfg.QueueModeSerial {
+		queue = jobs.NewSerialQueue(logger, common.DefaultQueueCapacity)
+	} else {
+		queue = jobs.NewQueue(logger, common.DefaultQueueCapacity, cfg.Server.WorkerCount)
+	}
 	rootCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
-	if err := queue.Start(rootCtx, worker); err != nil {
+	// Single-stage by default; optionally pipeline transcription and posting on separate pools.
+	var queueProcessor jobs.Processor = worker
+	var pipeline *processor.Pipeline
+	if cfg.Server.PostWorkerCount > 0 {
+		pipeline = processor.NewPipeline(worker, cfg.Server.PostWorkerCount, common.DefaultQueueCapacity)
+		if err := pipeline.Start(rootCtx); err != nil {
+			logger.Error("start pipeline", "err", err)
+			os.Exit(1)
+		}
+		queueProcessor = pipeline
+	}
+	// Optional quiet hours: posts outside the configured windows are deferred.
+	var scheduler *processor.Scheduler
+	if len(cfg.Server.PostWindows) > 0 {
+		sched, err := schedule.New(cfg.Server.PostWindows, cfg.Server.PostTimezone)
+		if err != nil {
+			logger.Error("post windows", "err", err)
+			os.Exit(1)
+		}
+		scheduler = processor.NewScheduler(worker, sched)
+		// Posts deferred before a restart are held in the store and go out with the next window.
+		if n, err := scheduler.Restore(); err != nil {
+			logger.Error("restore deferred posts", "err", err)
+			os.Exit(1)
+		} else if n > 0 {
+			logger.Info("deferred posts restored", "count", n)
+		}
+		go scheduler.Run(rootCtx)
+		queueProcessor = scheduler
+	}
+	if err := queue.Start(rootCtx, queueProcessor); err != nil {
 		logger.Error("start queue", "err", err)
 		os.Exit(1)
 	}
 
+	// Jobs that were queued or in progress when the server stopped are queued again.
+	// A shared postgres store also holds the jobs of other replicas, so only jobs older
+	// than the stuck job timeout are recovered there, and none without one.
+	recovery := jobs.RecoveryOptions{KeepImage: cfg.Server.KeepUploads, Images: images}
+	shared := cfg.Server.DatabaseDriver == appcfg.DatabaseDriverPostgres
+	if shared {
+		recovery.StaleAfter = cfg.Server.StuckJobTimeout
+	}
+	if shared && recovery.StaleAfter == 0 {
+		logger.Warn("in-flight job recovery skipped: set server.stuckJobTimeout to recover jobs of a shared postgres store")
+	} else {
+		requeued, failed, err := jobs.RecoverInFlight(logger, store, queue, recovery)
+		if err != nil {
+			logger.Error("recover in-flight jobs", "err", err)
+			os.Exit(1)
+		}
+		if requeued > 0 || failed > 0 {
+			logger.Info("in-flight jobs recovered", "requeued", requeued, "failed", failed)
+		}
+	}
+
+	// Optional retention cleanup of finished jobs and expired resumable uploads
+	if rc := cfg.Server.Retention; rc.MaxAge > 0 || rc.MaxStoredJobs > 0 || cfg.Server.ResumableUploads {
+		opts := jobs.JanitorOptions{
+			MaxAge:     rc.MaxAge,
+			MaxJobs:    rc.MaxStoredJobs,
+			Interval:   rc.Interval,
+			BatchSize:  rc.BatchSize,
+			BatchPause: rc.BatchPause,
+			Images:     images,
+		}
+		if cfg.Server.ResumableUploads {
+			opts.ExpireUploads = func(now time.Time) (int, error) {
+				return server.ExpireUploads(cfg.Server.StorageDir, cfg.Server.ResumableUploadExpiry, now)
+			}
+		}
+		go jobs.NewJanitor(logger, store, opts).Run(rootCtx)
+	}
+
+	// Expired Idempotency-Key headers no longer map to their jobs
+	go jobs.ReleaseIdempotencyKeys(rootCtx, logger, store)
+
+	// Optional reaping of jobs stuck in a non-terminal stage
+	if cfg.Server.StuckJobTimeout > 0 {
+		opts := jobs.ReaperOptions{
+			Timeout:   cfg.Server.StuckJobTimeout,
+			Requeue:   cfg.Server.StuckJobRequeue,
+			KeepImage: cfg.Server.KeepUploads,
+			Images:    images,
+		}
+		// Jobs still waiting in the queue or for a posting worker are not stuck.
+		if pipeline != nil {
+			opts.Busy = func(id string) bool { return queue.Holds(id) || pipeline.Holds(id) }
+		}
+		go jobs.NewReaper(logger, store, queue, opts).Run(rootCtx)
+	}
+
+	// Optional archival of finished jobs into date-partitioned files
+	if ac := cfg.Server.Archive; ac.Enabled {
+		// Config validation limits archives to the SQLite store.
+		archiver := jobs.NewArchiveRunner(logger, store.(jobs.Archiver), jobs.ArchiveOptions{
+			MinAge:     ac.MinAge,
+			Interval:   ac.Interval,
+			BatchSize:  ac.BatchSize,
+			BatchPause: archiveBatchPause,
+		})
+		go archiver.Run(rootCtx)
+	}
+
+	// Optional reload of rotated token files
+	if cfg.Server.SecretReloadInterval > 0 {
+		watcher := secrets.NewWatcher(logger, cfg.Server.SecretReloadInterval)
+		watched := false
+		for _, e := range cfg.TargetEntries() {
+			a := e.GitHub.Auth
+			if e.Type != appcfg.TargetTypeGitHub || a.TokenFile == "" {
+				continue
+			}
+			if t, ok := reg.Get(e.Name); ok {
+				if u, ok := t.(targets.TokenUpdater); ok {
+					watcher.Watch(a.TokenFile, a.Token, u.SetToken)
+					watched = true
+				}
+			}
+		}
+		if watched {
+			go watcher.Run(rootCtx)
+		}
+	}
+
 	// HTTP server
 	svc := &server.Service{
 		Log:       logger,
@@ -105,11 +397,24 @@ func main() {
 		Store:     store,
 		Queue:     queue,
 		Uploader:  uploader,
+		Images:    images,
 		Targets:   reg,
 		Processor: worker,
+		Reviews:   worker,
+		Identity:  identity.New(cfg.Server.Identity, &http.Client{Timeout: jwksFetchTimeout}),
+		Tracer:    tracer,
+		Events:    events,
+	}
+	if wh := cfg.Server.GitHubWebhook; wh.Secret != "" {
+		svc.GitHubWebhook = ghwebhook.NewClient(wh, &http.Client{Timeout: webhookFetchTimeout})
 	}
 	httpSrv := server.NewHTTPServer(svc)
 
+	// Optional jobs from image files dropped into a directory
+	if cfg.Server.IngestDir != "" {
+		go svc.NewIngestWatcher().Run(rootCtx)
+	}
+
 	// Run server in background
 	errCh := make(chan error, 1)
 	go func() {
@@ -129,6 +434,9 @@ func main() {
 			logger.Error("server error", "err", err)
 		}
 	}
+	// Stop the ingest watcher, reaper and other background loops on every path, so
+	// nothing enqueues while the queue shuts down.
+	cancel()
 
 	// Graceful shutdown
 	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownGrace)
@@ -138,5 +446,11 @@ func main() {
 	}
 	// Stop workers
 	queue.Shutdown(cfg.Server.ShutdownGrace)
+	if pipeline != nil {
+		pipeline.Shutdown()
+	}
+	if scheduler != nil {
+		scheduler.Shutdown()
+	}
 	logger.Info("server stopped")
 }
@@ -4,16 +4,30 @@ package common
 
 // HTTP headers and content types
 const (
-	HeaderAPIKey       = "X-API-Key" // #nosec G101 - header name constant, not a credential
-	HeaderPrefer       = "Prefer"
-	PreferRespondAsync = "respond-async"
-	ContentTypeJSON    = "application/json"
+	HeaderAPIKey           = "X-API-Key" // #nosec G101 - header name constant, not a credential
+	HeaderPrefer           = "Prefer"
+	HeaderRetryAfter       = "Retry-After"
+	HeaderRequestTimeout   = "Request-Timeout" // caps how long a sync request waits for its job
+	HeaderGitHubEvent      = "X-GitHub-Event"
+	HeaderIdempotencyKey   = "Idempotency-Key" // retries with the same key get the original job
+	HeaderIdempotentReplay = "Idempotent-Replayed"
+	HeaderGitHubSig256     = "X-Hub-Signature-256"
+	HeaderCallbackSig      = "X-Gostwriter-Signature" // sha256=<hex> HMAC of the callback, with server.callbackSecret
+	HeaderCallbackTime     = "X-Gostwriter-Timestamp" // unix seconds the callback signature was computed at
+	PreferRespondAsync     = "respond-async"
+	ContentTypeJSON        = "application/json"
 )
 
 // API paths
 const (
-	PathHealthz        = "/healthz"
+	PathHealthz        = "/healthz" // liveness: the process serves requests
+	PathReadyz         = "/readyz"  // readiness: database, queue and targets are usable
 	PathTranscriptions = "/v1/transcriptions"
+	PathGitHubWebhook  = "/v1/github/webhook"
+	PathUploads        = "/v1/uploads" // resumable (tus) uploads
+	PathAdminPurge     = "/v1/admin/purge"
+	PathAdminVacuum    = "/v1/admin/vacuum"
+	PathShared         = "/v1/shared" // job status by signed share token, without the API key
 )
 
 // Defaults and limits
@@ -39,11 +53,14 @@ const (
 // Subdirectory names
 const (
 	UploadsDirName = "uploads"
+	PartialDirName = "uploads-partial" // resumable uploads still being received
 	ReposDirName   = "repos"
+	DoneDirName    = "done" // ingested files, below the ingest directory
 )
 
-// Callback status strings
+// Callback status strings, which are also the events callbacks can be subscribed to
 const (
-	StatusCompleted = "completed"
-	StatusFailed    = "failed"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusNeedsReview = "needs_review" // held by the quality gate
 )
@@ -1,14 +1,27 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/imageproc"
+	"github.com/jo-hoe/gostwriter/internal/schedule"
 )
 
+// validGitHubConfig returns an enabled GitHub target that passes validation, for tests
+// of other settings.
+func validGitHubConfig() GitHubTargetConfig {
+	return GitHubTargetConfig{
+		Enabled: true, RepositoryOwner: "o", RepositoryName: "r", Branch: "main",
+		FilenameTemplate: "f", CommitMessageTemplate: "c", Auth: GitHubAuthConfig{Token: "t"},
+	}
+}
+
 func TestParseByteSize_K8sAndCommonUnits(t *testing.T) {
 	cases := []struct {
 		in   string
@@ -147,3 +160,817 @@ func escapeBackslashes(p string) string {
 	// On Windows, YAML literal may require escaping backslashes
 	return strings.ReplaceAll(p, `\`, `\\`)
 }
+
+// TestExecHelperProcess is not a real test; it is invoked as a subprocess by the exec expansion tests.
+func TestExecHelperProcess(t *testing.T) {
+	switch os.Getenv("GOSTWRITER_EXEC_HELPER") {
+	case "ok":
+		fmt.Print("  s3cret-token \n")
+		os.Exit(0)
+	case "fail":
+		fmt.Fprint(os.Stderr, "permission denied")
+		os.Exit(1)
+	}
+}
+
+func TestExpand_Exec(t *testing.T) {
+	helper := os.Args[0] + " -test.run=^TestExecHelperProcess$"
+	in := "token: ${exec:" + helper + "}\nhome: ${GOSTWRITER_TEST_VAR}"
+	t.Setenv("GOSTWRITER_TEST_VAR", "env-value")
+
+	// Disabled by default
+	t.Setenv(AllowExecEnv, "")
+	t.Setenv("GOSTWRITER_EXEC_HELPER", "ok")
+	if _, err := expand(in); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Fatalf("expected exec expansion to be rejected when not enabled, got %v", err)
+	}
+
+	t.Setenv(AllowExecEnv, "true")
+	out, err := expand(in)
+	if err != nil {
+		t.Fatalf("expand: %v", err)
+	}
+	if out != "token: s3cret-token\nhome: env-value" {
+		t.Fatalf("unexpected expansion: %q", out)
+	}
+
+	t.Setenv("GOSTWRITER_EXEC_HELPER", "fail")
+	_, err = expand(in)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected error with stderr, got %v", err)
+	}
+}
+
+func TestValidate_QueueMode(t *testing.T) {
+	base := func() *Config {
+		cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+		applyDefaults(cfg)
+		return cfg
+	}
+	cfg := base()
+	if cfg.Server.QueueMode != QueueModeParallel {
+		t.Fatalf("default queue mode = %q", cfg.Server.QueueMode)
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate default: %v", err)
+	}
+	cfg.Server.QueueMode = QueueModeSerial
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate serial: %v", err)
+	}
+	cfg.Server.PostWorkerCount = 2
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected serial mode with multiple post workers to be rejected")
+	}
+	cfg = base()
+	cfg.Server.QueueMode = QueueModeSerial
+	cfg.Server.DatabaseDriver = DatabaseDriverPostgres
+	cfg.Server.DatabaseDSN = "postgres://db/gostwriter"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected serial mode with a shared postgres store to be rejected")
+	}
+	cfg = base()
+	cfg.Server.QueueMode = QueueModeSerial
+	cfg.Server.StuckJobTimeout = time.Minute
+	cfg.Server.StuckJobRequeue = true
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected serial mode with stuck job requeue to be rejected")
+	}
+	cfg = base()
+	cfg.Server.QueueMode = "random"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown queue mode to be rejected")
+	}
+}
+
+func TestValidate_DatabaseDriver(t *testing.T) {
+	base := func() *Config {
+		cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+		applyDefaults(cfg)
+		return cfg
+	}
+	cfg := base()
+	if cfg.Server.DatabaseDriver != DatabaseDriverSQLite {
+		t.Fatalf("default database driver = %q", cfg.Server.DatabaseDriver)
+	}
+	cfg.Server.DatabaseDriver = DatabaseDriverPostgres
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected postgres without databaseDsn to be rejected")
+	}
+	cfg.Server.DatabaseDSN = "postgres://u:p@db/gostwriter"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate postgres: %v", err)
+	}
+	cfg.Server.Archive = ArchiveConfig{Enabled: true, PartitionBy: ArchivePartitionMonth}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected archive with postgres to be rejected")
+	}
+	cfg = base()
+	cfg.Server.DatabaseDriver = "mysql"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown database driver to be rejected")
+	}
+}
+
+func TestValidate_ImagePipeline(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	cfg.LLM.ImagePipeline = []imageproc.Transform{{Name: "grayscale"}, {Name: "contrast", Factor: 1.5}}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate pipeline: %v", err)
+	}
+	cfg.LLM.ImagePipeline = append(cfg.LLM.ImagePipeline, imageproc.Transform{Name: "resize"})
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "llm.imagePipeline") {
+		t.Fatalf("expected resize without bounds to be rejected, got %v", err)
+	}
+}
+
+func TestValidate_ConfluenceOnly(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{Confluence: ConfluenceTargetConfig{
+		Enabled: true, BaseURL: "https://wiki.example.com/", SpaceKey: "DOC",
+	}}}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if cfg.Target.Confluence.BaseURL != "https://wiki.example.com" {
+		t.Fatalf("base url not normalized: %q", cfg.Target.Confluence.BaseURL)
+	}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected missing token to be rejected")
+	}
+	cfg.Target.Confluence.Auth.Token = "t"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate confluence-only config: %v", err)
+	}
+}
+
+func TestValidate_GitLabTarget(t *testing.T) {
+	cfg := &Config{Targets: []TargetEntry{{Name: "notes", Type: " GitLab ", GitLab: GitLabTargetConfig{
+		ProjectID: "/group/notes/", Branch: "main", BasePath: "inbox",
+		FilenameTemplate: "f", CommitMessageTemplate: "c",
+	}}}}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	g := cfg.Targets[0].GitLab
+	if cfg.Targets[0].Type != TargetTypeGitLab || g.BaseURL != "https://gitlab.com" || g.ProjectID != "group/notes" || g.BasePath != "inbox/" {
+		t.Fatalf("gitlab target not normalized: %+v", cfg.Targets[0])
+	}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "targets notes: gitlab.auth.token is required") {
+		t.Fatalf("expected missing token to be rejected, got %v", err)
+	}
+	cfg.Targets[0].GitLab.Auth.Token = "t"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate gitlab config: %v", err)
+	}
+}
+
+func TestValidate_FSTarget(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{FS: FSTargetConfig{Enabled: true, BasePath: "../notes"}}}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "fs.rootDir is required") {
+		t.Fatalf("expected missing root dir to be rejected, got %v", err)
+	}
+	cfg.Target.FS.RootDir = "/srv/notes"
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "fs.basePath") {
+		t.Fatalf("expected escaping base path to be rejected, got %v", err)
+	}
+	cfg.Target.FS.BasePath = "notes/"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate fs config: %v", err)
+	}
+	if e := cfg.TargetEntries(); len(e) != 1 || e[0].Name != TargetTypeFS || e[0].FS.RootDir != "/srv/notes" {
+		t.Fatalf("unexpected entries %+v", e)
+	}
+}
+
+func TestValidate_TitleHeadingLevel(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{FS: FSTargetConfig{Enabled: true, RootDir: "/srv/notes"}}}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if cfg.Server.TitleHeadingLevel != 1 || !cfg.Server.PrependTitle() {
+		t.Fatalf("expected an H1 title by default, got level %d, enabled %v", cfg.Server.TitleHeadingLevel, cfg.Server.PrependTitle())
+	}
+	cfg.Server.TitleHeadingLevel = 7
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "server.titleHeadingLevel") {
+		t.Fatalf("expected level 7 to be rejected, got %v", err)
+	}
+	cfg.Server.TitleHeadingLevel = 6
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate level 6: %v", err)
+	}
+}
+
+func TestValidate_Consensus(t *testing.T) {
+	base := func() *Config {
+		cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+		applyDefaults(cfg)
+		return cfg
+	}
+	cfg := base()
+	if cfg.LLM.ConsensusStrategy != ConsensusMajority {
+		t.Fatalf("default consensus strategy = %q", cfg.LLM.ConsensusStrategy)
+	}
+	cfg.LLM.ConsensusRuns = 3
+	cfg.LLM.ConsensusMinAgreement = 0.8
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate consensus: %v", err)
+	}
+	for name, mutate := range map[string]func(*Config){
+		"negative runs":     func(c *Config) { c.LLM.ConsensusRuns = -1 },
+		"unknown strategy":  func(c *Config) { c.LLM.ConsensusStrategy = "vote" },
+		"agreement above 1": func(c *Config) { c.LLM.ConsensusMinAgreement = 1.5 },
+	} {
+		cfg := base()
+		mutate(cfg)
+		if err := validate(cfg); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestValidate_GitHubMaxFilenameLength(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if cfg.Target.GitHub.MaxFilenameLength != 255 {
+		t.Fatalf("default maxFilenameLength = %d", cfg.Target.GitHub.MaxFilenameLength)
+	}
+	for _, n := range []int{8, 256} {
+		cfg.Target.GitHub.MaxFilenameLength = n
+		if err := validate(cfg); err == nil {
+			t.Errorf("expected maxFilenameLength %d to be rejected", n)
+		}
+	}
+	cfg.Target.GitHub.MaxFilenameLength = 100
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestValidate_IdentityJWT(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.Server.Identity.JWT.Enabled = true
+	applyDefaults(cfg)
+	if j := cfg.Server.Identity.JWT; j.Header != "Authorization" || j.NameClaim != "name" || j.EmailClaim != "email" {
+		t.Fatalf("jwt defaults not applied: %+v", j)
+	}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected jwt without secret or jwksUrl to be rejected")
+	}
+	cfg.Server.Identity.JWT.JWKSURL = "https://idp.example/.well-known/jwks.json"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestValidate_GitHubWebhookComments(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.Server.GitHubWebhook = GitHubWebhookConfig{Secret: "s", CommentOnCompletion: true}
+	applyDefaults(cfg)
+	if cfg.Server.GitHubWebhook.APIURL != "https://api.github.com" {
+		t.Fatalf("apiUrl default not applied: %q", cfg.Server.GitHubWebhook.APIURL)
+	}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected commentOnCompletion without token to be rejected")
+	}
+	cfg.Server.GitHubWebhook.Token = "t"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestValidate_LanguageDetection(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.LLM.DetectLanguage = true
+	applyDefaults(cfg)
+	if cfg.LLM.LanguageDetection != LanguageDetectionLLM {
+		t.Fatalf("default language detection = %q", cfg.LLM.LanguageDetection)
+	}
+	cfg.LLM.LanguageDetection = "guess"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown language detection method to be rejected")
+	}
+	cfg.LLM.LanguageDetection = LanguageDetectionHeuristic
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestValidate_MinMarkdownLength(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.LLM.MinMarkdownLength = 40
+	applyDefaults(cfg)
+	if cfg.LLM.MinMarkdownAction != MinMarkdownWarn {
+		t.Fatalf("default min markdown action = %q", cfg.LLM.MinMarkdownAction)
+	}
+	cfg.LLM.MinMarkdownAction = "ignore"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown action to be rejected")
+	}
+	cfg.LLM.MinMarkdownAction = MinMarkdownRetry
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.LLM.MinMarkdownLength = -1
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected negative length to be rejected")
+	}
+}
+
+func TestValidate_ShareSecret(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	if cfg.Server.ShareExpiry != 24*time.Hour {
+		t.Fatalf("default share expiry = %s", cfg.Server.ShareExpiry)
+	}
+	cfg.Server.ShareSecret = "too-short"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected short share secret to be rejected")
+	}
+	cfg.Server.ShareSecret = strings.Repeat("s", 32)
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestValidate_QualityGate(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}, QualityGate: QualityGateConfig{Enabled: true}}
+	applyDefaults(cfg)
+	if len(cfg.QualityGate.RefusalPatterns) != len(DefaultRefusalPatterns) {
+		t.Fatalf("default refusal patterns not applied: %v", cfg.QualityGate.RefusalPatterns)
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.QualityGate.RefusalPatterns = []string{"("}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected invalid refusal pattern to be rejected")
+	}
+	cfg.QualityGate.RefusalPatterns = nil
+	cfg.QualityGate.MinLength = -1
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected negative minLength to be rejected")
+	}
+}
+
+func TestValidate_Uploads(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	if cfg.Server.Uploads.Backend != UploadBackendLocal {
+		t.Fatalf("default uploads backend = %q", cfg.Server.Uploads.Backend)
+	}
+
+	cfg.Server.Uploads = UploadsConfig{Backend: UploadBackendS3, S3: S3Config{Region: "eu-central-1", Bucket: "b"}}
+	applyDefaults(cfg)
+	if cfg.Server.Uploads.S3.Endpoint != "https://s3.eu-central-1.amazonaws.com" || cfg.Server.Uploads.S3.Prefix != "uploads/" {
+		t.Fatalf("s3 defaults not applied: %+v", cfg.Server.Uploads.S3)
+	}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected s3 without credentials to be rejected")
+	}
+	cfg.Server.Uploads.S3.AccessKeyID, cfg.Server.Uploads.S3.SecretAccessKey = "id", "secret"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.Server.Uploads.Backend = "nfs"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown backend to be rejected")
+	}
+}
+
+func TestValidate_LogFormat(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	if cfg.Server.LogFormat != LogFormatText || cfg.Server.LogOutput != LogOutputStdout {
+		t.Fatalf("log defaults not applied: %q %q", cfg.Server.LogFormat, cfg.Server.LogOutput)
+	}
+	cfg.Server.LogFormat = "JSON"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate json format: %v", err)
+	}
+	cfg.Server.LogFormat = "logfmt"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown log format to be rejected")
+	}
+}
+
+func TestValidate_DebugSampleRate(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	for _, rate := range []float64{0, 0.05, 1} {
+		cfg.LLM.DebugSampleRate = rate
+		if err := validate(cfg); err != nil {
+			t.Fatalf("rate %v: %v", rate, err)
+		}
+	}
+	for _, rate := range []float64{-0.1, 1.5} {
+		cfg.LLM.DebugSampleRate = rate
+		if err := validate(cfg); err == nil {
+			t.Fatalf("expected rate %v to be rejected", rate)
+		}
+	}
+}
+
+func TestValidate_CallbackMethod(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.Server.CallbackMethod = " put "
+	applyDefaults(cfg)
+	if err := validate(cfg); err != nil || cfg.Server.CallbackMethod != "PUT" {
+		t.Fatalf("method %q: %v", cfg.Server.CallbackMethod, err)
+	}
+	cfg.Server.CallbackMethod = "GET"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected GET to be rejected")
+	}
+}
+
+func TestValidate_Tracing(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.Tracing.Enabled = true
+	applyDefaults(cfg)
+	if cfg.Tracing.Exporter != TracingExporterStdout {
+		t.Fatalf("default exporter = %q", cfg.Tracing.Exporter)
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.Tracing.Exporter = "otlp"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unsupported exporter to be rejected")
+	}
+}
+
+func TestValidate_PostWindows(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.Server.PostWindows = []schedule.Window{{Start: "08:00", End: "18:00", Days: []string{"mon"}}}
+	cfg.Server.PostTimezone = "Europe/Berlin"
+	applyDefaults(cfg)
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.Server.PostWorkerCount = 2
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "postWorkerCount") {
+		t.Fatalf("expected post windows with post workers to be rejected, got %v", err)
+	}
+	cfg.Server.PostWorkerCount = 0
+	cfg.Server.PostWindows[0].End = "6pm"
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "server.postWindows") {
+		t.Fatalf("expected invalid window to be rejected, got %v", err)
+	}
+}
+
+func TestValidate_Archive(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.Server.StorageDir = t.TempDir()
+	cfg.Server.Archive.Enabled = true
+	applyDefaults(cfg)
+	a := cfg.Server.Archive
+	if a.Dir != filepath.Join(cfg.Server.StorageDir, "archive") || a.PartitionBy != ArchivePartitionMonth || a.MinAge != 720*time.Hour {
+		t.Fatalf("archive defaults not applied: %+v", a)
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.Server.Archive.PartitionBy = "day"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown partition to be rejected")
+	}
+}
+
+func TestValidate_GitHubBatching(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.Target.GitHub.BatchWindow = 30 * time.Second
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	// The default is capped by the posting workers, 4 by default.
+	if cfg.Target.GitHub.BatchSize != 4 {
+		t.Fatalf("default batchSize = %d", cfg.Target.GitHub.BatchSize)
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.Target.GitHub.BatchSize = 10
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected batchSize above the posting workers to be rejected")
+	}
+	cfg.Server.PostWorkerCount = 10
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate with postWorkerCount: %v", err)
+	}
+	if cfg.Target.GitHub.BatchPathCollision != PathCollisionSuffix {
+		t.Fatalf("default batchPathCollision = %q", cfg.Target.GitHub.BatchPathCollision)
+	}
+	cfg.Target.GitHub.BatchPathCollision = "overwrite"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown batchPathCollision to be rejected")
+	}
+	cfg.Target.GitHub.BatchPathCollision = PathCollisionFail
+	cfg.Target.GitHub.BatchWindow = -time.Second
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected negative batchWindow to be rejected")
+	}
+}
+
+func TestValidate_FrontmatterTemplates(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	cfg.Server.Frontmatter = "title: {{ quote .Title }}"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.Server.Frontmatter = "title: {{ .Title"
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "server.frontmatter") {
+		t.Fatalf("expected broken server.frontmatter to be rejected, got %v", err)
+	}
+	cfg.Server.Frontmatter = ""
+	cfg.Targets = []TargetEntry{{Name: "notes", Type: TargetTypeFS, FS: FSTargetConfig{RootDir: "out"}, FrontmatterTemplate: "id: {{ unknownFunc }}"}}
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "frontmatterTemplate") {
+		t.Fatalf("expected broken frontmatterTemplate to be rejected, got %v", err)
+	}
+}
+
+func TestValidate_WeightedProviders(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.LLM.Provider = "weighted"
+	applyDefaults(cfg)
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected weighted without providers to be rejected")
+	}
+	cfg.LLM.Providers = []ProviderConfig{{Type: "aiproxy", Weight: 3}, {Type: "Mock"}}
+	applyDefaults(cfg)
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	p := cfg.LLM.Providers
+	if p[0].Name != "aiproxy-1" || p[0].AIProxy.Model != "gpt-5" || p[1].Name != "mock-2" || p[1].Weight != 1 {
+		t.Fatalf("provider defaults = %+v", p)
+	}
+	if h := cfg.LLM.ProviderHealth; h.Window != 20 || h.MinCalls != 5 || h.MaxErrorRate != 0.5 || h.Cooldown != time.Minute {
+		t.Fatalf("health defaults = %+v", h)
+	}
+	cfg.LLM.Providers[1].Name = "aiproxy-1"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected duplicate provider names to be rejected")
+	}
+	cfg.LLM.Providers[1].Name = "b"
+	cfg.LLM.Providers[1].Type = "gemini"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown provider type to be rejected")
+	}
+	cfg.LLM.Providers[1].Type = "openai"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected openai provider without api key to be rejected")
+	}
+	cfg.LLM.Providers[1].Type = "mock"
+	cfg.LLM.ProviderHealth.MaxErrorRate = 1.5
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected maxErrorRate above 1 to be rejected")
+	}
+}
+
+func TestValidate_OpenAI(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.LLM.Provider = "openai"
+	applyDefaults(cfg)
+	if o := cfg.LLM.OpenAI; o.BaseURL != "https://api.openai.com/v1" || o.Model != "gpt-4o" {
+		t.Fatalf("openai defaults = %+v", o)
+	}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected missing api key to be rejected")
+	}
+	cfg.LLM.OpenAI.APIKey = "sk-1"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestValidate_Anthropic(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.LLM.Provider = "anthropic"
+	cfg.LLM.Anthropic.APIKey = "key"
+	applyDefaults(cfg)
+	if a := cfg.LLM.Anthropic; a.BaseURL != "https://api.anthropic.com" || a.MaxTokens != 4096 {
+		t.Fatalf("anthropic defaults = %+v", a)
+	}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "llm.anthropic.model") {
+		t.Fatalf("expected missing model to be rejected, got %v", err)
+	}
+	cfg.LLM.Anthropic.Model = "claude-x"
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestValidate_CostBudget(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.LLM.CostBudget.PerPeriod = 10
+	applyDefaults(cfg)
+	if cfg.LLM.CostBudget.Period != 24*time.Hour || cfg.LLM.CostBudget.Action != CostBudgetFail {
+		t.Fatalf("defaults = %+v", cfg.LLM.CostBudget)
+	}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "requires llm.pricing") {
+		t.Fatalf("expected budget without pricing to be rejected, got %v", err)
+	}
+	cfg.LLM.Pricing = map[string]ModelPricing{"gpt-5": {InputPer1K: 0.5, OutputPer1K: 2}}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.LLM.CostBudget.Action = CostBudgetHold
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected hold without the quality gate to be rejected")
+	}
+	cfg.QualityGate.Enabled = true
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate with quality gate: %v", err)
+	}
+	cfg.LLM.Pricing["gpt-5"] = ModelPricing{InputPer1K: -1}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected negative price to be rejected")
+	}
+}
+
+func TestValidate_MarkdownFlavor(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	cfg.PostProcess.MarkdownFlavor = " GFM "
+	applyDefaults(cfg)
+	if err := validate(cfg); err != nil || cfg.PostProcess.MarkdownFlavor != "gfm" {
+		t.Fatalf("validate: %v, flavor %q", err, cfg.PostProcess.MarkdownFlavor)
+	}
+	cfg.PostProcess.MarkdownFlavor = "asciidoc"
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected unknown markdownFlavor to be rejected")
+	}
+}
+
+func TestParseCallbackEvents(t *testing.T) {
+	got, err := ParseCallbackEvents(" Completed, failed,completed ")
+	if err != nil {
+		t.Fatalf("ParseCallbackEvents: %v", err)
+	}
+	if strings.Join(got, ",") != "completed,failed" {
+		t.Fatalf("events = %v", got)
+	}
+	if _, err := ParseCallbackEvents("completed,started"); err == nil {
+		t.Fatalf("expected unknown event to be rejected")
+	}
+	if got, err := ParseCallbackEvents(" , "); err != nil || len(got) != 0 {
+		t.Fatalf("empty list: %v %v", got, err)
+	}
+
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	if strings.Join(cfg.Server.CallbackEvents, ",") != "completed" {
+		t.Fatalf("default callbackEvents = %v", cfg.Server.CallbackEvents)
+	}
+	cfg.Server.CallbackEvents = []string{"needs_review", "bogus"}
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected invalid callbackEvents to be rejected")
+	}
+}
+
+func TestPostProcessTargets_GitHubRateLimitDefaults(t *testing.T) {
+	cfg := &Config{Target: TargetsConfig{GitHub: validGitHubConfig()}}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if g := cfg.Target.GitHub; g.RateLimitRetries != 3 || g.RateLimitMaxWait != time.Minute {
+		t.Fatalf("unexpected defaults: retries %d, max wait %v", g.RateLimitRetries, g.RateLimitMaxWait)
+	}
+	cfg.Target.GitHub.RateLimitMaxWait = -time.Second
+	if err := validate(cfg); err == nil {
+		t.Fatalf("expected negative rateLimitMaxWait to be rejected")
+	}
+}
+
+func TestLoadSecretFiles_GitHubTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("ghp_from_file\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := &Config{}
+	cfg.Target.GitHub.Auth.TokenFile = tokenFile
+	if err := loadSecretFiles(cfg); err != nil {
+		t.Fatalf("loadSecretFiles: %v", err)
+	}
+	if cfg.Target.GitHub.Auth.Token != "ghp_from_file" {
+		t.Fatalf("token = %q", cfg.Target.GitHub.Auth.Token)
+	}
+	if err := loadSecretFiles(cfg); err == nil {
+		t.Fatalf("expected token and tokenFile together to be rejected")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	_ = os.WriteFile(empty, []byte(" \n"), 0o600)
+	cfg = &Config{}
+	cfg.Target.GitHub.Auth.TokenFile = empty
+	if err := loadSecretFiles(cfg); err == nil {
+		t.Fatalf("expected empty token file to be rejected")
+	}
+}
+
+func TestLoadFewShotExamples(t *testing.T) {
+	dir := t.TempDir()
+	pngPath := filepath.Join(dir, "ex.png")
+	// The PNG signature is enough for content sniffing.
+	if err := os.WriteFile(pngPath, []byte("\x89PNG\r\n\x1a\n0000"), 0o600); err != nil {
+		t.Fatalf("write png: %v", err)
+	}
+	txtPath := filepath.Join(dir, "ex.png.txt")
+	if err := os.WriteFile(txtPath, []byte("plain text"), 0o600); err != nil {
+		t.Fatalf("write txt: %v", err)
+	}
+
+	examples := []FewShotExample{{ImagePath: pngPath, Markdown: "# Notes"}}
+	if err := loadFewShotExamples(examples); err != nil {
+		t.Fatalf("loadFewShotExamples: %v", err)
+	}
+	if examples[0].MimeType != "image/png" || len(examples[0].Image) != 12 {
+		t.Fatalf("example not loaded: %q, %d bytes", examples[0].MimeType, len(examples[0].Image))
+	}
+
+	for name, bad := range map[string]FewShotExample{
+		"missing markdown": {ImagePath: pngPath},
+		"missing file":     {ImagePath: filepath.Join(dir, "nope.png"), Markdown: "x"},
+		"not an image":     {ImagePath: txtPath, Markdown: "x"},
+	} {
+		if err := loadFewShotExamples([]FewShotExample{bad}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	big := filepath.Join(dir, "big.png")
+	if err := os.WriteFile(big, append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, maxFewShotBytes)...), 0o600); err != nil {
+		t.Fatalf("write big png: %v", err)
+	}
+	if err := loadFewShotExamples([]FewShotExample{{ImagePath: big, Markdown: "x"}}); err == nil || !strings.Contains(err.Error(), "in total") {
+		t.Fatalf("expected the size limit to be enforced, got %v", err)
+	}
+}
+
+func TestValidate_TargetEntries(t *testing.T) {
+	gh := validGitHubConfig()
+	mirror := gh
+	mirror.Enabled = false
+	mirror.RepositoryName = "r.wiki"
+	cfg := &Config{
+		Target:  TargetsConfig{GitHub: gh},
+		Targets: []TargetEntry{{Name: "wiki", Type: "GitHub", GitHub: mirror}},
+	}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	entries := cfg.TargetEntries()
+	if len(entries) != 2 || entries[0].Name != "github" || entries[1].Name != "wiki" || entries[1].Type != TargetTypeGitHub {
+		t.Fatalf("target entries %+v, want github then wiki", entries)
+	}
+	if entries[1].GitHub.APIBaseURL != "https://api.github.com" || entries[1].GitHub.RepositoryName != "r.wiki" {
+		t.Fatalf("wiki entry not defaulted: %+v", entries[1].GitHub)
+	}
+
+	// An entry without a name is named after its type, which the single target already uses.
+	cfg.Targets = append(cfg.Targets, TargetEntry{Type: "github", GitHub: mirror})
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), `duplicate name "github"`) {
+		t.Fatalf("expected duplicate target name to be rejected, got %v", err)
+	}
+	cfg.Targets[1] = TargetEntry{Name: "ftp", Type: "ftp"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "targets ftp") {
+		t.Fatalf("expected unknown target type to be rejected, got %v", err)
+	}
+	cfg.Targets[1] = TargetEntry{Name: "mirror", Type: TargetTypeGitHub, GitHub: GitHubTargetConfig{RepositoryOwner: "o"}}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "targets mirror: github.repositoryName is required") {
+		t.Fatalf("expected incomplete entry to be rejected, got %v", err)
+	}
+
+	// The targets list alone is enough.
+	cfg = &Config{Targets: []TargetEntry{{Type: "github", GitHub: mirror}}}
+	applyDefaults(cfg)
+	if err := postProcessTargets(cfg); err != nil {
+		t.Fatalf("postProcessTargets: %v", err)
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate targets only: %v", err)
+	}
+}
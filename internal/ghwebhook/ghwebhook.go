@@ -0,0 +1,217 @@
+// Package ghwebhook turns GitHub issue and comment webhooks with an image attachment into
+// transcription submissions and reports finished jobs back as issue comments.
+package ghwebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+)
+
+// Event names handled by Parse, as sent in the X-GitHub-Event header.
+const (
+	EventPing         = "ping"
+	EventIssues       = "issues"
+	EventIssueComment = "issue_comment"
+)
+
+// VerifySignature reports whether sig, the X-Hub-Signature-256 header ("sha256=<hex>"),
+// is the HMAC-SHA256 of body keyed with secret.
+func VerifySignature(secret string, body []byte, sig string) bool {
+	hexSig, ok := strings.CutPrefix(strings.TrimSpace(sig), "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+	got, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), got)
+}
+
+// Submission is an image attached to a newly opened issue or a new issue comment.
+type Submission struct {
+	ImageURL    string
+	Title       string // issue title
+	Repository  string // owner/name
+	Issue       int
+	Sender      string // login of the user who opened the issue or wrote the comment
+	CommentsURL string // API URL of the issue comments, used to report the result
+}
+
+type payload struct {
+	Action string `json:"action"`
+	Issue  struct {
+		Number      int    `json:"number"`
+		Title       string `json:"title"`
+		Body        string `json:"body"`
+		CommentsURL string `json:"comments_url"`
+	} `json:"issue"`
+	Comment struct {
+		Body string `json:"body"`
+	} `json:"comment"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+		Type  string `json:"type"`
+	} `json:"sender"`
+}
+
+// Parse extracts the submission from a delivery of the given event type. It returns nil
+// without an error for deliveries that do not submit an image: other events and actions,
+// bot senders (including this service's own comments) and bodies without an attachment.
+func Parse(event string, body []byte) (*Submission, error) {
+	if event != EventIssues && event != EventIssueComment {
+		return nil, nil
+	}
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	text := p.Issue.Body
+	switch {
+	case event == EventIssues && p.Action == "opened":
+	case event == EventIssueComment && p.Action == "created":
+		text = p.Comment.Body
+	default:
+		return nil, nil
+	}
+	if strings.EqualFold(p.Sender.Type, "Bot") {
+		return nil, nil
+	}
+	img := firstImageURL(text)
+	if img == "" {
+		return nil, nil
+	}
+	return &Submission{
+		ImageURL:    img,
+		Title:       strings.TrimSpace(p.Issue.Title),
+		Repository:  p.Repository.FullName,
+		Issue:       p.Issue.Number,
+		Sender:      p.Sender.Login,
+		CommentsURL: p.Issue.CommentsURL,
+	}, nil
+}
+
+// imageRefPattern matches Markdown images and HTML img tags, which is how GitHub
+// renders drag-and-drop attachments in issue and comment bodies.
+var imageRefPattern = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?(https://[^)\s>]+)>?[^)]*\)|<img\s[^>]*?src\s*=\s*["'](https://[^"']+)["']`)
+
+// firstImageURL returns the first image reference in text hosted by GitHub.
+func firstImageURL(text string) string {
+	for _, m := range imageRefPattern.FindAllStringSubmatch(text, -1) {
+		raw := m[1]
+		if raw == "" {
+			raw = m[2]
+		}
+		if u, err := url.Parse(raw); err == nil && allowedImageHost(u) {
+			return raw
+		}
+	}
+	return ""
+}
+
+// allowedImageHost restricts downloads to GitHub attachment hosts, so a webhook payload
+// cannot make the server fetch arbitrary (e.g., internal) URLs.
+func allowedImageHost(u *url.URL) bool {
+	if u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "github.com" || strings.HasSuffix(host, ".githubusercontent.com")
+}
+
+// Client downloads attachments and writes issue comments.
+type Client struct {
+	http   *http.Client
+	token  string
+	apiURL string
+}
+
+// NewClient creates a Client for the webhook config. Requests are sent with c; redirects
+// are only followed to GitHub attachment hosts.
+func NewClient(cfg config.GitHubWebhookConfig, c *http.Client) *Client {
+	hc := *c
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("too many redirects")
+		}
+		if !allowedImageHost(req.URL) {
+			return fmt.Errorf("redirect to disallowed host %q", req.URL.Host)
+		}
+		return nil
+	}
+	return &Client{http: &hc, token: cfg.Token, apiURL: strings.TrimRight(cfg.APIURL, "/")}
+}
+
+// FetchImage starts downloading an attachment returned by Parse. The caller closes the body.
+func (c *Client) FetchImage(ctx context.Context, rawURL string) (io.ReadCloser, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !allowedImageHost(u) {
+		return nil, "", fmt.Errorf("image url not allowed: %q", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	// Attachments of private repositories need a token. The client drops the header when
+	// redirected to the storage host, whose signed URLs do not need it.
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch image: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, "", fmt.Errorf("fetch image: status %d", resp.StatusCode)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// Comment adds a comment to the issue behind commentsURL. Only URLs of the configured
+// API are accepted, so the token is never sent elsewhere.
+func (c *Client) Comment(ctx context.Context, commentsURL, body string) error {
+	if !strings.HasPrefix(commentsURL, c.apiURL+"/repos/") {
+		return fmt.Errorf("comments url %q is not on %s", commentsURL, c.apiURL)
+	}
+	b, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, commentsURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", common.ContentTypeJSON)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("comment: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("comment: status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package ghwebhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"zen":"Keep it logically awesome."}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !VerifySignature("s3cret", body, sig) {
+		t.Fatalf("valid signature rejected")
+	}
+	for name, tc := range map[string]struct{ secret, sig string }{
+		"wrong secret":   {"other", sig},
+		"missing prefix": {"s3cret", hex.EncodeToString(mac.Sum(nil))},
+		"not hex":        {"s3cret", "sha256=zz"},
+		"empty secret":   {"", sig},
+		"empty header":   {"s3cret", ""},
+	} {
+		if VerifySignature(tc.secret, body, tc.sig) {
+			t.Errorf("%s: signature accepted", name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	issue := func(action, body, senderType string) []byte {
+		b, _ := json.Marshal(map[string]any{
+			"action":     action,
+			"issue":      map[string]any{"number": 3, "title": " Receipt ", "body": body, "comments_url": "https://api.github.com/repos/o/r/issues/3/comments"},
+			"repository": map[string]any{"full_name": "o/r"},
+			"sender":     map[string]any{"login": "jane", "type": senderType},
+		})
+		return b
+	}
+	attachment := `Here: <img width="300" alt="scan" src="https://github.com/user-attachments/assets/1234" />`
+
+	sub, err := Parse(EventIssues, issue("opened", attachment, "User"))
+	if err != nil || sub == nil {
+		t.Fatalf("Parse: %v %v", sub, err)
+	}
+	want := Submission{
+		ImageURL: "https://github.com/user-attachments/assets/1234", Title: "Receipt", Repository: "o/r", Issue: 3,
+		Sender: "jane", CommentsURL: "https://api.github.com/repos/o/r/issues/3/comments",
+	}
+	if *sub != want {
+		t.Fatalf("got %+v, want %+v", *sub, want)
+	}
+
+	comment, _ := json.Marshal(map[string]any{
+		"action":  "created",
+		"issue":   map[string]any{"number": 3, "title": "Receipt", "body": attachment},
+		"comment": map[string]any{"body": "![a](http://example.com/a.png) ![b](https://user-images.githubusercontent.com/1/b.png)"},
+		"sender":  map[string]any{"login": "joe", "type": "User"},
+	})
+	sub, err = Parse(EventIssueComment, comment)
+	if err != nil || sub == nil || sub.ImageURL != "https://user-images.githubusercontent.com/1/b.png" {
+		t.Fatalf("expected the comment's GitHub hosted image, got %+v %v", sub, err)
+	}
+
+	for name, tc := range map[string]struct {
+		event string
+		body  []byte
+	}{
+		"ping":            {EventPing, []byte(`{"zen":"z"}`)},
+		"edited":          {EventIssues, issue("edited", attachment, "User")},
+		"bot":             {EventIssues, issue("opened", attachment, "Bot")},
+		"no image":        {EventIssues, issue("opened", "just text", "User")},
+		"foreign host":    {EventIssues, issue("opened", "![x](https://internal.example/x.png)", "User")},
+		"plain http link": {EventIssues, issue("opened", "![x](http://github.com/x.png)", "User")},
+	} {
+		if sub, err := Parse(tc.event, tc.body); sub != nil || err != nil {
+			t.Errorf("%s: expected delivery to be ignored, got %+v %v", name, sub, err)
+		}
+	}
+	if _, err := Parse(EventIssues, []byte("{")); err == nil {
+		t.Fatalf("expected invalid json to fail")
+	}
+}
+
+func TestClient_Comment(t *testing.T) {
+	var got map[string]string
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	c := NewClient(config.GitHubWebhookConfig{Token: "tok", APIURL: ts.URL + "/"}, ts.Client())
+	if err := c.Comment(context.Background(), ts.URL+"/repos/o/r/issues/3/comments", "done"); err != nil {
+		t.Fatalf("Comment: %v", err)
+	}
+	if got["body"] != "done" || auth != "Bearer tok" {
+		t.Fatalf("unexpected request: body %v, auth %q", got, auth)
+	}
+	if err := c.Comment(context.Background(), "https://evil.example/repos/o/r/issues/3/comments", "x"); err == nil {
+		t.Fatalf("expected comments url outside the api to be rejected")
+	}
+}
+
+func TestClient_FetchImageRejectsOtherHosts(t *testing.T) {
+	c := NewClient(config.GitHubWebhookConfig{}, http.DefaultClient)
+	if _, _, err := c.FetchImage(context.Background(), "https://169.254.169.254/latest/meta-data"); err == nil {
+		t.Fatalf("expected fetch outside GitHub hosts to be rejected")
+	}
+}
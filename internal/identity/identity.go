@@ -0,0 +1,94 @@
+// Package identity determines the user a request was made on behalf of, either from
+// headers set by an identity proxy or from the claims of a verified JWT.
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+)
+
+// Identity is the requesting user. Either field may be empty.
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// ErrInvalidToken is returned when a JWT is present but cannot be verified.
+var ErrInvalidToken = errors.New("invalid identity token")
+
+// Extractor reads the Identity from requests according to the identity config.
+type Extractor struct {
+	cfg      config.IdentityConfig
+	verifier *verifier // nil when JWTs are disabled
+}
+
+// New creates an Extractor. It returns nil when neither a header nor JWTs are configured.
+// The JWKS, if configured, is fetched with c on first use.
+func New(cfg config.IdentityConfig, c *http.Client) *Extractor {
+	if strings.TrimSpace(cfg.Header) == "" && strings.TrimSpace(cfg.EmailHeader) == "" && !cfg.JWT.Enabled {
+		return nil
+	}
+	e := &Extractor{cfg: cfg}
+	if cfg.JWT.Enabled {
+		v := &verifier{issuer: cfg.JWT.Issuer, audience: cfg.JWT.Audience, now: time.Now}
+		if cfg.JWT.Secret != "" {
+			v.secret = []byte(cfg.JWT.Secret)
+		}
+		if cfg.JWT.JWKSURL != "" {
+			v.keys = newKeySet(cfg.JWT.JWKSURL, c)
+		}
+		e.verifier = v
+	}
+	return e
+}
+
+// FromRequest returns the identity of r, or nil if the request carries none. A present
+// but invalid JWT is an error (wrapping ErrInvalidToken) rather than being ignored, so a
+// forged token cannot silently fall back to the proxy headers.
+func (e *Extractor) FromRequest(r *http.Request) (*Identity, error) {
+	if e == nil {
+		return nil, nil
+	}
+	if e.verifier != nil {
+		if token := bearerToken(r.Header.Get(e.cfg.JWT.Header)); token != "" {
+			claims, err := e.verifier.verify(r.Context(), token)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+			}
+			id := Identity{Name: stringClaim(claims, e.cfg.JWT.NameClaim), Email: stringClaim(claims, e.cfg.JWT.EmailClaim)}
+			if id.Name != "" || id.Email != "" {
+				return &id, nil
+			}
+		}
+	}
+	id := Identity{}
+	if e.cfg.Header != "" {
+		id.Name = strings.TrimSpace(r.Header.Get(e.cfg.Header))
+	}
+	if e.cfg.EmailHeader != "" {
+		id.Email = strings.TrimSpace(r.Header.Get(e.cfg.EmailHeader))
+	}
+	if id.Name == "" && id.Email == "" {
+		return nil, nil
+	}
+	return &id, nil
+}
+
+// bearerToken strips an optional "Bearer " scheme from an Authorization style value.
+func bearerToken(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+		return strings.TrimSpace(v[7:])
+	}
+	return v
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	s, _ := claims[name].(string)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,200 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func segment(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return b64(b)
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	signed := segment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + segment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + b64(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	signed := segment(t, map[string]string{"alg": "RS256", "kid": kid}) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	signed := segment(t, map[string]string{"alg": "ES256", "kid": kid}) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + b64(sig)
+}
+
+func requestWith(headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func jwtConfig(secret, jwksURL string) config.IdentityConfig {
+	return config.IdentityConfig{
+		Header: "X-Forwarded-User",
+		JWT: config.JWTConfig{
+			Enabled: true, Header: "Authorization", Secret: secret, JWKSURL: jwksURL,
+			Issuer: "https://idp.example", Audience: "gostwriter", NameClaim: "name", EmailClaim: "email",
+		},
+	}
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss": "https://idp.example", "aud": []string{"other", "gostwriter"},
+		"exp": time.Now().Add(time.Hour).Unix(), "name": "Jane Doe", "email": "jane@example.com",
+	}
+}
+
+func TestNew_DisabledReturnsNil(t *testing.T) {
+	e := New(config.IdentityConfig{}, http.DefaultClient)
+	if e != nil {
+		t.Fatalf("expected nil extractor")
+	}
+	if id, err := e.FromRequest(requestWith(nil)); id != nil || err != nil {
+		t.Fatalf("nil extractor should yield no identity, got %v %v", id, err)
+	}
+}
+
+func TestFromRequest_Headers(t *testing.T) {
+	e := New(config.IdentityConfig{Header: "X-Forwarded-User", EmailHeader: "X-Forwarded-Email"}, http.DefaultClient)
+	id, err := e.FromRequest(requestWith(map[string]string{"X-Forwarded-User": "jane", "X-Forwarded-Email": "jane@example.com"}))
+	if err != nil || id == nil || *id != (Identity{Name: "jane", Email: "jane@example.com"}) {
+		t.Fatalf("unexpected identity %+v, err %v", id, err)
+	}
+	if id, err := e.FromRequest(requestWith(nil)); id != nil || err != nil {
+		t.Fatalf("expected no identity without headers, got %v %v", id, err)
+	}
+}
+
+func TestFromRequest_HS256(t *testing.T) {
+	e := New(jwtConfig("s3cret", ""), http.DefaultClient)
+	token := signHS256(t, "s3cret", validClaims())
+	id, err := e.FromRequest(requestWith(map[string]string{"Authorization": "Bearer " + token, "X-Forwarded-User": "proxy-user"}))
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	if *id != (Identity{Name: "Jane Doe", Email: "jane@example.com"}) {
+		t.Fatalf("token claims should win over headers, got %+v", id)
+	}
+
+	// Without a token the header is used.
+	id, err = e.FromRequest(requestWith(map[string]string{"X-Forwarded-User": "proxy-user"}))
+	if err != nil || id == nil || id.Name != "proxy-user" {
+		t.Fatalf("header fallback failed: %+v %v", id, err)
+	}
+}
+
+func TestFromRequest_RejectsInvalidTokens(t *testing.T) {
+	e := New(jwtConfig("s3cret", ""), http.DefaultClient)
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAud := validClaims()
+	wrongAud["aud"] = "someone-else"
+	wrongIss := validClaims()
+	wrongIss["iss"] = "https://evil.example"
+	unsigned := segment(t, map[string]string{"alg": "none"}) + "." + segment(t, validClaims()) + "."
+
+	cases := map[string]string{
+		"forged signature": signHS256(t, "guessed", validClaims()),
+		"expired":          signHS256(t, "s3cret", expired),
+		"wrong audience":   signHS256(t, "s3cret", wrongAud),
+		"wrong issuer":     signHS256(t, "s3cret", wrongIss),
+		"alg none":         unsigned,
+		"malformed":        "not-a-jwt",
+	}
+	for name, token := range cases {
+		_, err := e.FromRequest(requestWith(map[string]string{"Authorization": "Bearer " + token, "X-Forwarded-User": "proxy-user"}))
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestFromRequest_JWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ec key: %v", err)
+	}
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	}))
+	defer ts.Close()
+
+	e := New(jwtConfig("", ts.URL), ts.Client())
+	for name, token := range map[string]string{
+		"RS256": signRS256(t, rsaKey, "rsa-1", validClaims()),
+		"ES256": signES256(t, ecKey, "ec-1", validClaims()),
+	} {
+		id, err := e.FromRequest(requestWith(map[string]string{"Authorization": "Bearer " + token}))
+		if err != nil || id == nil || id.Email != "jane@example.com" {
+			t.Fatalf("%s: unexpected identity %+v, err %v", name, id, err)
+		}
+	}
+
+	// HS256 is not accepted without a configured secret, even with a key id that exists.
+	if _, err := e.FromRequest(requestWith(map[string]string{"Authorization": signHS256(t, "", validClaims())})); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected HS256 to be rejected, got %v", err)
+	}
+	// Unknown key ids do not trigger a refetch within the refresh interval.
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := e.FromRequest(requestWith(map[string]string{"Authorization": signRS256(t, other, "rsa-2", validClaims())})); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected unknown kid to be rejected, got %v", err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", n)
+	}
+}
@@ -0,0 +1,174 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash.New
+	_ "crypto/sha512" // register SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is tolerated when checking the exp and nbf claims.
+const clockSkew = time.Minute
+
+// verifier checks JWT signatures and the registered time, issuer and audience claims.
+type verifier struct {
+	secret   []byte  // HMAC key; nil when not configured
+	keys     *keySet // JWKS; nil when not configured
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify parses token, checks its signature and claims and returns the claims.
+func (v *verifier) verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var hdr jwtHeader
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	if err := v.checkSignature(ctx, hdr, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *verifier) checkSignature(ctx context.Context, hdr jwtHeader, signed, sig []byte) error {
+	switch hdr.Alg {
+	case "HS256", "HS384", "HS512":
+		if v.secret == nil {
+			return fmt.Errorf("algorithm %s not accepted", hdr.Alg)
+		}
+		mac := hmac.New(hashFor(hdr.Alg).New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case "RS256", "RS384", "RS512", "ES256":
+		if v.keys == nil {
+			return fmt.Errorf("algorithm %s not accepted", hdr.Alg)
+		}
+		key, err := v.keys.get(ctx, hdr.Kid)
+		if err != nil {
+			return err
+		}
+		return verifyAsymmetric(hdr.Alg, key, signed, sig)
+	default:
+		// Includes "none": unsigned tokens are never accepted.
+		return fmt.Errorf("algorithm %q not supported", hdr.Alg)
+	}
+}
+
+func verifyAsymmetric(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	h := hashFor(alg)
+	hasher := h.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, h, digest, sig); err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return fmt.Errorf("algorithm %s does not match EC key", alg)
+		}
+		// JWS encodes ECDSA signatures as the fixed size concatenation r || s.
+		if len(sig) != 64 {
+			return errors.New("invalid signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return errors.New("unsupported key type")
+	}
+}
+
+func (v *verifier) checkClaims(claims map[string]any) error {
+	now := v.now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not yet valid")
+	}
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return errors.New("unexpected issuer")
+		}
+	}
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+// hasAudience reports whether aud, a string or a list of strings, contains want.
+func hasAudience(aud any, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []any:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hashFor(alg string) crypto.Hash {
+	switch alg[len(alg)-3:] {
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+func decodeSegment(seg string, out any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,264 @@
+// Package imageproc implements stdlib-only image preprocessing applied to uploads
+// before they are sent to the LLM (e.g., grayscale and contrast to help OCR).
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // register decoder
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Transform names accepted in Transform.Name.
+const (
+	Grayscale = "grayscale"
+	Contrast  = "contrast"
+	Resize    = "resize"
+	Sharpen   = "sharpen"
+	Downscale = "downscale"
+)
+
+// MaxDecodePixels is the largest image, in pixels, that is decoded. A small compressed
+// file can declare dimensions whose decoded form would exhaust memory, so the header is
+// checked first.
+const MaxDecodePixels = 100_000_000
+
+// ErrImageTooLarge is returned for images declaring more than MaxDecodePixels pixels.
+var ErrImageTooLarge = errors.New("image dimensions exceed the decode limit")
+
+// checkDimensions returns ErrImageTooLarge if cfg declares more than MaxDecodePixels pixels.
+func checkDimensions(cfg image.Config) error {
+	if int64(cfg.Width)*int64(cfg.Height) > MaxDecodePixels {
+		return fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// Transform is one step of a pipeline.
+type Transform struct {
+	Name           string  `yaml:"name"`           // grayscale | contrast | resize | sharpen | downscale
+	Factor         float64 `yaml:"factor"`         // contrast: > 0, 1 = unchanged; sharpen: > 0 strength
+	MaxWidth       int     `yaml:"maxWidth"`       // resize: bounding box width; 0 = unbounded
+	MaxHeight      int     `yaml:"maxHeight"`      // resize: bounding box height; 0 = unbounded
+	MaxLongestEdge int     `yaml:"maxLongestEdge"` // downscale: > 0 limit for the longer side, whatever the orientation
+}
+
+// Pipeline applies a validated sequence of steps in order.
+type Pipeline struct {
+	steps []Transform
+}
+
+// NewPipeline validates the transforms and returns a Pipeline. It returns nil for an empty list.
+func NewPipeline(steps []Transform) (*Pipeline, error) {
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	out := make([]Transform, len(steps))
+	for i, s := range steps {
+		s.Name = strings.ToLower(strings.TrimSpace(s.Name))
+		switch s.Name {
+		case Grayscale:
+		case Contrast, Sharpen:
+			if s.Factor <= 0 {
+				return nil, fmt.Errorf("step %d (%s): factor must be > 0", i, s.Name)
+			}
+		case Resize:
+			if s.MaxWidth < 0 || s.MaxHeight < 0 || (s.MaxWidth == 0 && s.MaxHeight == 0) {
+				return nil, fmt.Errorf("step %d (resize): maxWidth and/or maxHeight must be > 0", i)
+			}
+		case Downscale:
+			if s.MaxLongestEdge <= 0 {
+				return nil, fmt.Errorf("step %d (downscale): maxLongestEdge must be > 0", i)
+			}
+		default:
+			return nil, fmt.Errorf("step %d: unknown transform %q", i, s.Name)
+		}
+		out[i] = s
+	}
+	return &Pipeline{steps: out}, nil
+}
+
+// Apply runs all steps on img and returns the result.
+func (p *Pipeline) Apply(img image.Image) image.Image {
+	rgba := toRGBA(img)
+	for _, s := range p.steps {
+		switch s.Name {
+		case Grayscale:
+			rgba = grayscale(rgba)
+		case Contrast:
+			rgba = contrast(rgba, s.Factor)
+		case Resize:
+			rgba = fit(rgba, s.MaxWidth, s.MaxHeight)
+		case Sharpen:
+			rgba = sharpen(rgba, s.Factor)
+		case Downscale:
+			rgba = fit(rgba, s.MaxLongestEdge, s.MaxLongestEdge)
+		}
+	}
+	return rgba
+}
+
+// String returns a canonical description of the transforms, e.g. "grayscale|contrast:1.5".
+func (p *Pipeline) String() string {
+	parts := make([]string, len(p.steps))
+	for i, s := range p.steps {
+		switch s.Name {
+		case Contrast, Sharpen:
+			parts[i] = fmt.Sprintf("%s:%g", s.Name, s.Factor)
+		case Resize:
+			parts[i] = fmt.Sprintf("%s:%dx%d", s.Name, s.MaxWidth, s.MaxHeight)
+		case Downscale:
+			parts[i] = fmt.Sprintf("%s:%d", s.Name, s.MaxLongestEdge)
+		default:
+			parts[i] = s.Name
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+// Process decodes a PNG or JPEG image from r, applies the pipeline and returns the
+// result encoded as PNG (lossless, so transforms do not add compression artifacts).
+func (p *Pipeline) Process(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read image: %w", err)
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		if err := checkDimensions(cfg); err != nil {
+			return nil, err
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, p.Apply(img)); err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Rect, img, b.Min, draw.Src)
+	return out
+}
+
+func grayscale(src *image.RGBA) *image.RGBA {
+	out := image.NewRGBA(src.Rect)
+	for i := 0; i+3 < len(src.Pix); i += 4 {
+		// ITU-R BT.601 luma, same weights as color.GrayModel.
+		y := (19595*uint32(src.Pix[i]) + 38470*uint32(src.Pix[i+1]) + 7471*uint32(src.Pix[i+2]) + 1<<15) >> 16
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = uint8(y), uint8(y), uint8(y), src.Pix[i+3]
+	}
+	return out
+}
+
+func contrast(src *image.RGBA, factor float64) *image.RGBA {
+	var lut [256]uint8
+	for v := range lut {
+		lut[v] = clamp((float64(v)-128)*factor + 128)
+	}
+	out := image.NewRGBA(src.Rect)
+	for i := 0; i+3 < len(src.Pix); i += 4 {
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = lut[src.Pix[i]], lut[src.Pix[i+1]], lut[src.Pix[i+2]], src.Pix[i+3]
+	}
+	return out
+}
+
+// fit downscales src to fit into maxW x maxH (0 = unbounded) keeping the aspect ratio.
+// Images already within bounds are returned unchanged; images are never upscaled.
+func fit(src *image.RGBA, maxW, maxH int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && h > maxH {
+		scale = min(scale, float64(maxH)/float64(h))
+	}
+	if scale >= 1 {
+		return src
+	}
+	nw, nh := max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))
+	return boxResize(src, nw, nh)
+}
+
+// boxResize downsamples by averaging all source pixels covered by each target pixel,
+// which avoids the aliasing of nearest-neighbour sampling on text.
+func boxResize(src *image.RGBA, nw, nh int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := y*h/nh, max((y+1)*h/nh, y*h/nh+1)
+		for x := 0; x < nw; x++ {
+			x0, x1 := x*w/nw, max((x+1)*w/nw, x*w/nw+1)
+			var sum [4]uint32
+			for sy := y0; sy < y1; sy++ {
+				row := sy * src.Stride
+				for sx := x0; sx < x1; sx++ {
+					i := row + sx*4
+					sum[0] += uint32(src.Pix[i])
+					sum[1] += uint32(src.Pix[i+1])
+					sum[2] += uint32(src.Pix[i+2])
+					sum[3] += uint32(src.Pix[i+3])
+				}
+			}
+			n := uint32((y1 - y0) * (x1 - x0))
+			o := y*out.Stride + x*4
+			for c := 0; c < 4; c++ {
+				out.Pix[o+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return out
+}
+
+// sharpen applies an unsharp mask: each channel moves away from its 3x3 box blur by factor.
+func sharpen(src *image.RGBA, factor float64) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewRGBA(src.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			o := y*src.Stride + x*4
+			for c := 0; c < 3; c++ {
+				var sum, n float64
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						sx, sy := x+dx, y+dy
+						if sx < 0 || sy < 0 || sx >= w || sy >= h {
+							continue
+						}
+						sum += float64(src.Pix[sy*src.Stride+sx*4+c])
+						n++
+					}
+				}
+				v := float64(src.Pix[o+c])
+				out.Pix[o+c] = clamp(v + factor*(v-sum/n))
+			}
+			out.Pix[o+3] = src.Pix[o+3]
+		}
+	}
+	return out
+}
+
+func clamp(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
@@ -0,0 +1,251 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// synthetic returns a w x h image with a left half of c1 and a right half of c2.
+func synthetic(w, h int, c1, c2 color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.SetRGBA(x, y, c1)
+			} else {
+				img.SetRGBA(x, y, c2)
+			}
+		}
+	}
+	return img
+}
+
+func mustPipeline(t *testing.T, steps ...Transform) *Pipeline {
+	t.Helper()
+	p, err := NewPipeline(steps)
+	if err != nil {
+		t.Fatalf("NewPipeline: %v", err)
+	}
+	return p
+}
+
+func TestNewPipeline_Validation(t *testing.T) {
+	if p, err := NewPipeline(nil); p != nil || err != nil {
+		t.Fatalf("empty pipeline should be nil, got %v %v", p, err)
+	}
+	for _, bad := range [][]Transform{
+		{{Name: "blur"}},
+		{{Name: Contrast}},
+		{{Name: Sharpen, Factor: -1}},
+		{{Name: Resize}},
+		{{Name: Resize, MaxWidth: -5, MaxHeight: 10}},
+	} {
+		if _, err := NewPipeline(bad); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+	if _, err := NewPipeline([]Transform{{Name: " Grayscale "}, {Name: "resize", MaxWidth: 10}}); err != nil {
+		t.Fatalf("valid pipeline rejected: %v", err)
+	}
+}
+
+func TestPipeline_String(t *testing.T) {
+	p := mustPipeline(t, Transform{Name: "Grayscale"}, Transform{Name: Contrast, Factor: 1.5}, Transform{Name: Resize, MaxWidth: 800})
+	if got, want := p.String(), "grayscale|contrast:1.5|resize:800x0"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestGrayscale(t *testing.T) {
+	img := synthetic(4, 2, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255})
+	out := mustPipeline(t, Transform{Name: Grayscale}).Apply(img).(*image.RGBA)
+	for _, p := range []image.Point{{0, 0}, {3, 1}} {
+		c := out.RGBAAt(p.X, p.Y)
+		want := color.GrayModel.Convert(img.At(p.X, p.Y)).(color.Gray).Y
+		if c.R != c.G || c.G != c.B || c.R != want {
+			t.Fatalf("pixel %v = %+v, want gray %d", p, c, want)
+		}
+	}
+}
+
+func TestContrast(t *testing.T) {
+	img := synthetic(2, 1, color.RGBA{100, 100, 100, 255}, color.RGBA{200, 200, 200, 255})
+	out := mustPipeline(t, Transform{Name: Contrast, Factor: 2}).Apply(img).(*image.RGBA)
+	if c := out.RGBAAt(0, 0); c.R != 72 {
+		t.Fatalf("dark pixel = %d, want 72", c.R)
+	}
+	if c := out.RGBAAt(1, 0); c.R != 255 {
+		t.Fatalf("bright pixel = %d, want clamped 255", c.R)
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := synthetic(400, 200, color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255})
+	out := mustPipeline(t, Transform{Name: Resize, MaxWidth: 100, MaxHeight: 100}).Apply(img)
+	if b := out.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("resized to %v, want 100x50", b)
+	}
+	rgba := out.(*image.RGBA)
+	if c := rgba.RGBAAt(10, 10); c.R != 0 {
+		t.Fatalf("left half should stay black, got %+v", c)
+	}
+	if c := rgba.RGBAAt(90, 10); c.R != 255 {
+		t.Fatalf("right half should stay white, got %+v", c)
+	}
+
+	// Images within bounds are not upscaled.
+	small := synthetic(10, 10, color.RGBA{}, color.RGBA{})
+	if b := mustPipeline(t, Transform{Name: Resize, MaxWidth: 100}).Apply(small).Bounds(); b.Dx() != 10 {
+		t.Fatalf("small image changed size: %v", b)
+	}
+}
+
+func TestDownscale_LongestEdge(t *testing.T) {
+	p := mustPipeline(t, Transform{Name: Downscale, MaxLongestEdge: 100})
+	for _, tc := range []struct {
+		name         string
+		w, h         int
+		wantW, wantH int
+	}{
+		{"landscape", 400, 200, 100, 50},
+		{"portrait", 150, 600, 25, 100},
+		{"within limit", 80, 40, 80, 40},
+	} {
+		b := p.Apply(synthetic(tc.w, tc.h, color.RGBA{}, color.RGBA{})).Bounds()
+		if b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+			t.Errorf("%s: got %dx%d, want %dx%d", tc.name, b.Dx(), b.Dy(), tc.wantW, tc.wantH)
+		}
+	}
+	if _, err := NewPipeline([]Transform{{Name: Downscale}}); err == nil {
+		t.Fatalf("expected an error without maxLongestEdge")
+	}
+	if got := p.String(); got != "downscale:100" {
+		t.Fatalf("String() = %q", got)
+	}
+}
+
+func TestSharpen(t *testing.T) {
+	img := synthetic(6, 3, color.RGBA{100, 100, 100, 255}, color.RGBA{150, 150, 150, 255})
+	out := mustPipeline(t, Transform{Name: Sharpen, Factor: 1}).Apply(img).(*image.RGBA)
+	// The edge gets steeper: the dark side darker, the bright side brighter.
+	if c := out.RGBAAt(2, 1); c.R >= 100 {
+		t.Fatalf("dark edge pixel = %d, want < 100", c.R)
+	}
+	if c := out.RGBAAt(3, 1); c.R <= 150 {
+		t.Fatalf("bright edge pixel = %d, want > 150", c.R)
+	}
+	// Flat areas are unchanged.
+	if c := out.RGBAAt(0, 1); c.R != 100 {
+		t.Fatalf("flat pixel = %d, want 100", c.R)
+	}
+}
+
+func TestProcess_RoundTripsPNG(t *testing.T) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, synthetic(8, 8, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255})); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	out, err := mustPipeline(t, Transform{Name: Grayscale}, Transform{Name: Resize, MaxWidth: 4}).Process(&in)
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 4 {
+		t.Fatalf("output size %v, want 4x4", b)
+	}
+	if _, err := mustPipeline(t, Transform{Name: Grayscale}).Process(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Fatalf("expected decode error")
+	}
+}
+
+func TestLimit_Pixels(t *testing.T) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, synthetic(2000, 1500, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255})); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	r, mime, err := Limit(&in, "image/png", 300_000, 0)
+	if err != nil {
+		t.Fatalf("Limit: %v", err)
+	}
+	img, err := png.Decode(r)
+	if err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	b := img.Bounds()
+	if mime != "image/png" || b.Dx()*b.Dy() > 300_000 || b.Dx() < 600 || b.Dx()*3 != b.Dy()*4 {
+		t.Fatalf("output %s %v, want a 4:3 PNG of at most 300000 pixels", mime, b)
+	}
+}
+
+func TestLimit_Bytes(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 400))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7919 % 251) // noise, which JPEG cannot compress well
+	}
+	var in bytes.Buffer
+	if err := jpeg.Encode(&in, src, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	limit := int64(in.Len() / 4)
+	r, mime, err := Limit(bytes.NewReader(in.Bytes()), "image/jpeg", 0, limit)
+	if err != nil {
+		t.Fatalf("Limit: %v", err)
+	}
+	out, _ := io.ReadAll(r)
+	if mime != "image/jpeg" || int64(len(out)) > limit {
+		t.Fatalf("output %s of %d bytes, want JPEG of at most %d", mime, len(out), limit)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+}
+
+func TestLimit_RejectsHugeDimensions(t *testing.T) {
+	// A tiny PNG whose header declares 50000x50000 pixels, 10 GB once decoded.
+	var in bytes.Buffer
+	if err := png.Encode(&in, synthetic(1, 1, color.RGBA{A: 255}, color.RGBA{A: 255})); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	data := in.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 50000) // IHDR width
+	binary.BigEndian.PutUint32(data[20:], 50000) // IHDR height
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, _, err := Limit(bytes.NewReader(data), "image/png", 1_000_000, 0); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("Limit: expected ErrImageTooLarge, got %v", err)
+	}
+	if _, err := mustPipeline(t, Transform{Name: Grayscale}).Process(bytes.NewReader(data)); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("Process: expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func TestLimit_Unchanged(t *testing.T) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, synthetic(10, 10, color.RGBA{A: 255}, color.RGBA{A: 255})); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	check := func(data []byte, mime string, maxPixels int, maxBytes int64) {
+		t.Helper()
+		r, got, err := Limit(bytes.NewReader(data), mime, maxPixels, maxBytes)
+		if err != nil {
+			t.Fatalf("Limit(%s): %v", mime, err)
+		}
+		out, _ := io.ReadAll(r)
+		if got != mime || !bytes.Equal(out, data) {
+			t.Fatalf("Limit(%s) changed the image: %s, %d bytes", mime, got, len(out))
+		}
+	}
+	check(in.Bytes(), "image/png", 100, 1<<20)    // within the limits
+	check([]byte("GIF89a..."), "image/gif", 1, 1) // unsupported format
+}
@@ -0,0 +1,89 @@
+package imageproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+)
+
+const (
+	jpegQuality   = 90   // quality of re-encoded JPEG images
+	shrinkStep    = 0.75 // pixel count factor per attempt to get below a byte limit
+	shrinkRetries = 8    // attempts before the smallest result is returned as is
+)
+
+// Limit downscales a PNG or JPEG image to at most maxPixels pixels and, by shrinking
+// further, at most maxBytes bytes, keeping its aspect ratio and format. A limit of 0 is
+// no limit. Images within the limits and other formats are returned unchanged. If the
+// byte limit cannot be met, the smallest attempt is returned. Images to shrink that
+// declare more than MaxDecodePixels pixels fail with ErrImageTooLarge.
+func Limit(r io.Reader, mime string, maxPixels int, maxBytes int64) (io.Reader, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("read image: %w", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return bytes.NewReader(data), mime, nil
+	}
+	pixels := cfg.Width * cfg.Height
+	overPixels := maxPixels > 0 && pixels > maxPixels
+	overBytes := maxBytes > 0 && int64(len(data)) > maxBytes
+	if !overPixels && !overBytes {
+		return bytes.NewReader(data), mime, nil
+	}
+	if err := checkDimensions(cfg); err != nil {
+		return nil, "", err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+	src := toRGBA(img)
+	scale := 1.0
+	if overPixels {
+		scale = math.Sqrt(float64(maxPixels) / float64(pixels))
+	}
+	out := data
+	for range shrinkRetries {
+		// Rounding down keeps the result within maxPixels.
+		nw := max(1, int(float64(cfg.Width)*scale))
+		nh := max(1, int(float64(cfg.Height)*scale))
+		resized := src
+		if nw < cfg.Width || nh < cfg.Height {
+			resized = boxResize(src, nw, nh)
+		}
+		b, err := encode(resized, format)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(b) < len(out) || overPixels {
+			out, overPixels = b, false
+		}
+		if maxBytes <= 0 || int64(len(out)) <= maxBytes {
+			break
+		}
+		scale *= math.Sqrt(shrinkStep)
+	}
+	return bytes.NewReader(out), "image/" + format, nil
+}
+
+// encode writes img in format, "png" or "jpeg".
+func encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ArchiveOptions configures the archival of finished jobs.
+type ArchiveOptions struct {
+	MinAge     time.Duration // finished jobs older than this are archived
+	Interval   time.Duration // time between runs
+	BatchSize  int           // jobs moved per run of ArchiveFinishedBefore
+	BatchPause time.Duration // pause between batches to let live traffic through
+}
+
+// ArchiveRunner periodically moves finished jobs out of the primary jobs table so that
+// it stays small under high volume. Archived jobs remain available through GetJob.
+type ArchiveRunner struct {
+	log   *slog.Logger
+	store Archiver
+	opts  ArchiveOptions
+	now   func() time.Time
+}
+
+// NewArchiveRunner creates an ArchiveRunner. Non-positive batch size and interval fall
+// back to 500 and one hour.
+func NewArchiveRunner(logger *slog.Logger, store Archiver, opts ArchiveOptions) *ArchiveRunner {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+	return &ArchiveRunner{log: logger, store: store, opts: opts, now: time.Now}
+}
+
+// Run archives immediately and then every Interval until ctx is done.
+func (a *ArchiveRunner) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if n, err := a.RunOnce(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			a.log.Error("job archival failed", "archived", n, "err", err)
+		} else if n > 0 {
+			a.log.Info("job archival", "archived", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce archives all jobs past MinAge batch by batch and returns how many were moved.
+// It stops between batches when ctx is cancelled.
+func (a *ArchiveRunner) RunOnce(ctx context.Context) (int, error) {
+	before := a.now().Add(-a.opts.MinAge)
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := a.store.ArchiveFinishedBefore(before, a.opts.BatchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < a.opts.BatchSize {
+			return total, nil
+		}
+		if a.opts.BatchPause > 0 {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(a.opts.BatchPause):
+			}
+		}
+	}
+}
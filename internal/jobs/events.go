@@ -0,0 +1,59 @@
+package jobs
+
+import "sync"
+
+// eventBuffer is the number of stage changes a subscriber may fall behind before
+// further changes are dropped for it.
+const eventBuffer = 8
+
+// Events fans out job stage changes to subscribers within the process, e.g. for live
+// status streams. Publishing never blocks: a subscriber that falls behind misses
+// changes, so subscribers should re-read the job from the store on each change and
+// poll it as a fallback. A nil *Events publishes nothing.
+type Events struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Stage]struct{} // by job ID
+}
+
+// NewEvents creates an Events without subscribers.
+func NewEvents() *Events {
+	return &Events{subs: make(map[string]map[chan Stage]struct{})}
+}
+
+// Publish reports that job id entered stage.
+func (e *Events) Publish(id string, stage Stage) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs[id] {
+		select {
+		case ch <- stage:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the stage changes of job id published from now on, and a func that
+// ends the subscription.
+func (e *Events) Subscribe(id string) (<-chan Stage, func()) {
+	ch := make(chan Stage, eventBuffer)
+	e.mu.Lock()
+	if e.subs[id] == nil {
+		e.subs[id] = make(map[chan Stage]struct{})
+	}
+	e.subs[id][ch] = struct{}{}
+	e.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			delete(e.subs[id], ch)
+			if len(e.subs[id]) == 0 {
+				delete(e.subs, id)
+			}
+			e.mu.Unlock()
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// idempotencyReleaseInterval is the time between two releases of expired idempotency keys.
+const idempotencyReleaseInterval = time.Hour
+
+// ReleaseIdempotencyKeys releases expired idempotency keys immediately and then every
+// hour until ctx is done, so the key index only holds live keys.
+func ReleaseIdempotencyKeys(ctx context.Context, logger *slog.Logger, store IdempotencyStore) {
+	ticker := time.NewTicker(idempotencyReleaseInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := store.ReleaseExpiredIdempotencyKeys(time.Now()); err != nil {
+			logger.Error("release expired idempotency keys", "err", err)
+		} else if n > 0 {
+			logger.Info("expired idempotency keys released", "released", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
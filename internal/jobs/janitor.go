@@ -0,0 +1,134 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/storage"
+)
+
+// JanitorOptions configures retention cleanup.
+type JanitorOptions struct {
+	MaxAge     time.Duration      // finished jobs older than this are deleted; 0 keeps them regardless of age
+	MaxJobs    int                // oldest finished jobs are deleted while more are stored; 0 means no limit
+	Interval   time.Duration      // time between runs
+	BatchSize  int                // jobs deleted per transaction
+	BatchPause time.Duration      // pause between batches to let live traffic through
+	Images     storage.ImageStore // where upload files are deleted; nil means local disk
+	// ExpireUploads, if set, deletes the resumable uploads that expired before now on each
+	// run and returns how many it deleted.
+	ExpireUploads func(now time.Time) (int, error)
+}
+
+// Janitor periodically deletes finished jobs past their retention, and the oldest ones
+// beyond the job limit, together with any upload files still on disk. Deletion happens in small batches so a large backlog
+// does not hold the database lock for long.
+type Janitor struct {
+	log   *slog.Logger
+	store Pruner
+	opts  JanitorOptions
+	now   func() time.Time
+}
+
+// NewJanitor creates a Janitor. Non-positive batch size and interval fall back to 500
+// and one hour.
+func NewJanitor(logger *slog.Logger, store Pruner, opts JanitorOptions) *Janitor {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+	if opts.Images == nil {
+		opts.Images = storage.LocalImages{}
+	}
+	return &Janitor{log: logger, store: store, opts: opts, now: time.Now}
+}
+
+// Run executes a cleanup immediately and then every Interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if n, err := j.RunOnce(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			j.log.Error("retention cleanup failed", "deleted", n, "err", err)
+		} else if n > 0 {
+			j.log.Info("retention cleanup", "deleted", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce deletes expired uploads, all expired jobs and then the oldest finished jobs
+// beyond MaxJobs, batch by batch, and returns how many jobs were deleted. It stops
+// between batches when ctx is cancelled. The job limit needs a store implementing Evictor.
+func (j *Janitor) RunOnce(ctx context.Context) (int, error) {
+	if j.opts.ExpireUploads != nil {
+		if n, err := j.opts.ExpireUploads(j.now()); err != nil {
+			j.log.Error("expired upload cleanup failed", "deleted", n, "err", err)
+		} else if n > 0 {
+			j.log.Info("expired uploads deleted", "deleted", n)
+		}
+	}
+	total := 0
+	if j.opts.MaxAge > 0 {
+		before := j.now().Add(-j.opts.MaxAge)
+		n, err := j.deleteBatches(ctx, func() ([]string, error) {
+			return j.store.DeleteFinishedBefore(before, j.opts.BatchSize)
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	if ev, ok := j.store.(Evictor); ok && j.opts.MaxJobs > 0 {
+		n, err := j.deleteBatches(ctx, func() ([]string, error) {
+			return ev.EvictOldestFinished(j.opts.MaxJobs, j.opts.BatchSize)
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// deleteBatches calls del until it returns a partial batch, removing the returned upload
+// files, and returns how many jobs were deleted.
+func (j *Janitor) deleteBatches(ctx context.Context, del func() ([]string, error)) (int, error) {
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		paths, err := del()
+		if err != nil {
+			return total, err
+		}
+		total += len(paths)
+		for _, p := range paths {
+			if p == "" {
+				continue
+			}
+			if err := j.opts.Images.Delete(p); err != nil {
+				j.log.Warn("remove upload", "path", p, "err", err)
+			}
+		}
+		if len(paths) < j.opts.BatchSize {
+			return total, nil
+		}
+		if j.opts.BatchPause > 0 {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(j.opts.BatchPause):
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestJanitor_DeletesExpiredJobsInBatches(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	now := time.Now().UTC()
+	old := now.Add(-48 * time.Hour)
+	mk := func(id string, finished *time.Time, failed bool) string {
+		img := filepath.Join(dir, id+".png")
+		if err := os.WriteFile(img, []byte("x"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := store.CreateJob(&Job{ID: id, ImagePath: img, MimeType: "image/png", TargetName: "t", Stage: StageQueued}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		switch {
+		case finished == nil:
+		case failed:
+			_ = store.SaveError(id, "boom", *finished)
+		default:
+			_ = store.SaveResult(id, "loc", "c", *finished)
+		}
+		return img
+	}
+	var expired []string
+	for i := 0; i < 5; i++ {
+		expired = append(expired, mk(fmt.Sprintf("old-%d", i), &old, i%2 == 0))
+	}
+	recent := mk("recent", &now, false)
+	running := mk("running", nil, false)
+
+	j := NewJanitor(discardLogger(), store, JanitorOptions{MaxAge: 24 * time.Hour, BatchSize: 2})
+	n, err := j.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("deleted %d jobs, want 5", n)
+	}
+	for i, p := range expired {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("upload %s not removed", p)
+		}
+		if _, err := store.GetJob(fmt.Sprintf("old-%d", i)); err == nil {
+			t.Fatalf("job old-%d not deleted", i)
+		}
+	}
+	for _, id := range []string{"recent", "running"} {
+		if _, err := store.GetJob(id); err != nil {
+			t.Fatalf("job %s must be kept: %v", id, err)
+		}
+	}
+	for _, p := range []string{recent, running} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("upload %s must be kept: %v", p, err)
+		}
+	}
+}
+
+// cancellingPruner cancels the context after the first batch.
+type cancellingPruner struct {
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (p *cancellingPruner) DeleteFinishedBefore(before time.Time, limit int) ([]string, error) {
+	p.calls++
+	p.cancel()
+	return make([]string, limit), nil
+}
+
+func TestJanitor_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &cancellingPruner{cancel: cancel}
+	j := NewJanitor(discardLogger(), p, JanitorOptions{MaxAge: time.Hour, BatchSize: 3, BatchPause: time.Hour})
+	n, err := j.RunOnce(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if n != 3 || p.calls != 1 {
+		t.Fatalf("expected one batch before stopping, got n=%d calls=%d", n, p.calls)
+	}
+}
+
+func TestJanitor_EvictsOldestBeyondMaxJobs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	base := time.Now().UTC().Add(-time.Hour)
+	var imgs []string
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("job-%d", i)
+		img := filepath.Join(dir, id+".png")
+		if err := os.WriteFile(img, []byte("x"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		imgs = append(imgs, img)
+		created := base.Add(time.Duration(i) * time.Minute)
+		if err := store.CreateJob(&Job{ID: id, ImagePath: img, MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: created}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		// job-0 is still running and must survive although it is the oldest.
+		if i > 0 {
+			_ = store.SaveResult(id, "loc", "c", created)
+		}
+	}
+
+	j := NewJanitor(discardLogger(), store, JanitorOptions{MaxJobs: 3, BatchSize: 2})
+	n, err := j.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("evicted %d jobs, want 3", n)
+	}
+	for i := 0; i < 6; i++ {
+		_, err := store.GetJob(fmt.Sprintf("job-%d", i))
+		_, statErr := os.Stat(imgs[i])
+		evicted := i >= 1 && i <= 3
+		if evicted != (err != nil) || evicted != os.IsNotExist(statErr) {
+			t.Fatalf("job-%d: evicted=%v, get err %v, stat err %v", i, evicted, err, statErr)
+		}
+	}
+
+	// At the cap nothing more is deleted.
+	if n, err := j.RunOnce(context.Background()); err != nil || n != 0 {
+		t.Fatalf("second run: n=%d err=%v", n, err)
+	}
+}
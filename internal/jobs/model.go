@@ -1,6 +1,10 @@
 package jobs
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 )
 
@@ -10,6 +14,8 @@ type Stage string
 const (
 	StageQueued       Stage = "queued"
 	StageTranscribing Stage = "transcribing"
+	StagePendingPost  Stage = "pending_post" // transcribed, waiting for a post window
+	StageNeedsReview  Stage = "needs_review" // transcribed, held by the quality gate until approved or retried
 	StagePosting      Stage = "posting"
 	StageCompleted    Stage = "completed"
 	StageFailed       Stage = "failed"
@@ -17,33 +23,251 @@ const (
 
 // Job describes a single transcription and posting request.
 type Job struct {
-	ID             string         // UUIDv4
-	ImagePath      string         // absolute or storage-relative path to the uploaded image (temporary)
-	MimeType       string         // image mime (image/png, image/jpeg)
-	TargetName     string         // configured target name to post to
-	CallbackURL    *string        // optional callback
-	Title          *string        // optional suggested title
-	Metadata       map[string]any // optional arbitrary metadata
-	Stage          Stage          // current stage
-	ErrorMessage   *string        // last error, if any
-	TargetLocation *string        // result location string from target (e.g., path in repo)
-	TargetCommit   *string        // resulting commit hash if target supports it
-	CreatedAt      time.Time      // creation time
-	StartedAt      *time.Time     // when processing actually started
-	CompletedAt    *time.Time     // when finished (success or failure)
+	ID             string          // UUIDv4
+	ImagePath      string          // absolute or storage-relative path to the uploaded image (temporary)
+	MimeType       string          // image mime (image/png, image/jpeg)
+	TargetName     string          // configured target name to post to; the first of Targets
+	Targets        []string        // all targets to post to, in order, if more than one
+	CallbackURL    *string         // optional callback
+	CallbackEvents []string        // events the callback is sent for; nil uses server.callbackEvents
+	Title          *string         // optional suggested title
+	Metadata       map[string]any  // optional arbitrary metadata
+	Actor          *string         // name of the API key that created the job, if named
+	AuthorName     *string         // requesting user's name from the identity proxy or JWT, if any
+	AuthorEmail    *string         // requesting user's email from the identity proxy or JWT, if any
+	CommentsURL    *string         // GitHub issue comments API URL to report the result to (webhook jobs)
+	TargetBranch   *string         // per-request branch override, if allowed and given
+	TargetBasePath *string         // per-request base path override, if allowed and given
+	ParentJobID    *string         // job this one re-runs with other settings, if any
+	Model          *string         // LLM model override of a rerun; nil uses the configured model
+	Instructions   *string         // LLM instructions override of a rerun; nil uses the configured ones
+	Stage          Stage           // current stage
+	ErrorMessage   *string         // last error, if any
+	TargetLocation *string         // result location string from target (e.g., path in repo)
+	TargetCommit   *string         // resulting commit hash if target supports it
+	TargetResults  []TargetResult  // outcome per target of a job with several Targets
+	FinishReason   *string         // finish reason reported by the LLM provider, if any
+	Warnings       []string        // non-fatal issues detected while processing
+	ConsensusRuns  int             // number of transcription runs compared; 0 without consensus
+	Agreement      *float64        // mean pairwise similarity of the consensus runs (0..1)
+	Language       *string         // detected document language (ISO 639-1), if detection is enabled
+	MarkdownFlavor *string         // Markdown flavor the transcription was written in (postProcess.markdownFlavor), if any
+	EstimatedCost  *float64        // LLM cost estimated from token usage and llm.pricing, if priced
+	Debug          bool            // sampled for detailed LLM debug logging (llm.debugSampleRate)
+	ProviderMeta   json.RawMessage // LLM response metadata (llm.storeProviderMeta); nil if not stored
+	CreatedAt      time.Time       // creation time
+	StartedAt      *time.Time      // when processing actually started
+	CompletedAt    *time.Time      // when finished (success or failure)
 }
 
 // TargetResult represents the posting outcome returned by a target.
 type TargetResult struct {
-	TargetName string // e.g., "docs-main"
-	Location   string // e.g., "git:repo@branch:path/file.md"
-	Commit     string // commit hash if applicable
+	TargetName string `json:"target"`             // e.g., "docs-main"
+	Location   string `json:"location,omitempty"` // e.g., "git:repo@branch:path/file.md"
+	Commit     string `json:"commit,omitempty"`   // commit hash if applicable
+	Error      string `json:"error,omitempty"`    // why posting failed; empty on success
+}
+
+// PostTargets returns the targets job posts to, in order.
+func (job Job) PostTargets() []string {
+	if len(job.Targets) > 0 {
+		return job.Targets
+	}
+	return []string{job.TargetName}
+}
+
+// TranscriptionInfo holds details about the transcription step of a job.
+type TranscriptionInfo struct {
+	FinishReason  string
+	Warnings      []string
+	ConsensusRuns int             // 0 when consensus is disabled or the result came from the cache
+	Agreement     *float64        // set together with ConsensusRuns
+	Language      string          // detected document language (ISO 639-1); empty if unknown
+	Flavor        string          // Markdown flavor of the transcription; empty if none is configured
+	EstimatedCost *float64        // LLM cost estimated from token usage; nil without pricing
+	ProviderMeta  json.RawMessage // LLM response metadata as JSON; nil if not stored
+}
+
+// CachedTranscription is a transcription result stored under the image content hash.
+type CachedTranscription struct {
+	Markdown     string
+	FinishReason string
+	Language     string // language detected by the LLM call before the transcription; empty if none
+}
+
+// TranscriptionCache is optionally implemented by stores that can keep transcription
+// results by key so retries of the same image skip the LLM call.
+type TranscriptionCache interface {
+	GetCachedTranscription(key string) (*CachedTranscription, error) // nil if not cached
+	PutCachedTranscription(key string, t CachedTranscription) error
+}
+
+// Pruner is implemented by stores that can delete finished jobs for retention.
+type Pruner interface {
+	// DeleteFinishedBefore deletes at most limit completed or failed jobs that finished
+	// before the given time, oldest first, and returns their image paths.
+	DeleteFinishedBefore(before time.Time, limit int) ([]string, error)
+}
+
+// Evictor is implemented by stores that can bound the number of stored jobs.
+type Evictor interface {
+	// EvictOldestFinished deletes the oldest completed or failed jobs, by creation time,
+	// while more than keep jobs are stored, at most limit per call. It returns the image
+	// paths of the deleted jobs.
+	EvictOldestFinished(keep, limit int) ([]string, error)
+}
+
+// IdempotencyStore is implemented by stores that can deduplicate job creation by a
+// client-provided key, across restarts.
+type IdempotencyStore interface {
+	// CreateJobIdempotent creates job under key unless a job holds the key and the key
+	// has not expired; then that job is returned and nothing is created. The key of the
+	// new job expires at expiresAt.
+	CreateJobIdempotent(job *Job, key string, expiresAt time.Time) (existing *Job, err error)
+	// ReleaseExpiredIdempotencyKeys clears the keys that expired before now and returns
+	// how many were released.
+	ReleaseExpiredIdempotencyKeys(now time.Time) (int, error)
+}
+
+// Review is a transcription held by the quality gate until approved, or in pending_post
+// until a post window opens, with what it needs to be posted.
+type Review struct {
+	Markdown   string   `json:"markdown"`
+	Model      string   `json:"model,omitempty"`
+	TokenUsage int      `json:"token_usage,omitempty"`
+	DurationMs int64    `json:"duration_ms,omitempty"`
+	Language   string   `json:"language,omitempty"`
+	Flavor     string   `json:"flavor,omitempty"`
+	Title      string   `json:"title,omitempty"` // title derived from the Markdown, if any
+	Reasons    []string `json:"reasons"`         // failed quality checks
+}
+
+// ErrNotInReview reports that a job is not held in the needs_review stage.
+var ErrNotInReview = errors.New("job is not in needs_review")
+
+// RejectedPrefix starts the error of jobs rejected in review. Unlike other job errors,
+// which may expose internals, it and the reviewer's reason are shown to clients.
+const RejectedPrefix = "rejected in review"
+
+// PublicError returns the error of a failed job as shown to clients: the rejection of
+// a reviewer, or "internal error" for anything else.
+func PublicError(msg string) string {
+	if strings.HasPrefix(msg, RejectedPrefix) {
+		return msg
+	}
+	return "internal error"
+}
+
+// ReviewStore is implemented by stores that can hold transcriptions for review.
+type ReviewStore interface {
+	// HoldForReview moves the job to needs_review and stores its transcription.
+	HoldForReview(id string, review Review) error
+	// TakeReview moves a job in needs_review to stage and returns its held transcription,
+	// or nil if the job is not in needs_review. Only one caller can take a review.
+	TakeReview(id string, stage Stage) (*Review, error)
+	// ListByStage returns at most limit jobs in stage, oldest first.
+	ListByStage(stage Stage, limit int) ([]Job, error)
+}
+
+// ErrNotFailed reports that a job cannot be retried because it is not failed.
+var ErrNotFailed = errors.New("job is not failed")
+
+// RetryStore is implemented by stores that can put failed jobs back into the queue.
+type RetryStore interface {
+	// ResetForRetry moves a failed job back to queued, starting now, and clears its
+	// error, completion time and per-target results. It returns ErrNotFailed if the job
+	// is not failed.
+	ResetForRetry(id string) error
+}
+
+// CostReporter is implemented by stores that can sum the estimated cost of jobs, for
+// budgets over a period.
+type CostReporter interface {
+	// CostSince returns the total estimated cost of the jobs started at or after since.
+	CostSince(since time.Time) (float64, error)
+}
+
+// TargetResultStore is implemented by stores that keep the outcome per target of jobs
+// posting to several targets.
+type TargetResultStore interface {
+	// SaveTargetResults replaces the per-target results of a job.
+	SaveTargetResults(id string, results []TargetResult) error
+}
+
+// StuckLister is implemented by stores that can find jobs stuck in a non-terminal stage.
+type StuckLister interface {
+	// ListStuck returns the queued, transcribing and posting jobs that entered their
+	// stage (started_at, or created_at while queued) before the given time. Jobs in
+	// pending_post are excluded: they wait for a post window on purpose.
+	ListStuck(before time.Time) ([]Job, error)
+}
+
+// Starter is implemented by stores that can start a job only while it is queued, so that
+// a job failed or queued again meanwhile is not processed twice.
+type Starter interface {
+	// StartJob moves a queued job to stage, started at startedAt, and reports whether it
+	// did; a job in another stage is left unchanged.
+	StartJob(id string, stage Stage, startedAt time.Time) (bool, error)
+}
+
+// HeldPostStore is implemented by stores that keep the transcriptions of jobs waiting in
+// pending_post for a post window, so that they are still posted after a restart.
+type HeldPostStore interface {
+	StageLister
+	// HoldForPost moves the job to pending_post and stores its transcription.
+	HoldForPost(id string, held Review) error
+	// TakeHeldPost moves a job in pending_post to stage and returns its held
+	// transcription, or nil if the job is not in pending_post. Only one caller can take it.
+	TakeHeldPost(id string, stage Stage) (*Review, error)
+}
+
+// StageLister is implemented by stores that can list jobs by stage, e.g. to recover the
+// jobs that were in flight when the server stopped.
+type StageLister interface {
+	// ListByStages returns all jobs in one of stages, oldest first.
+	ListByStages(stages ...Stage) ([]Job, error)
+}
+
+// ErrVacuumRunning reports that a vacuum is already in progress.
+var ErrVacuumRunning = errors.New("vacuum already running")
+
+// VacuumResult reports the size in bytes of the database files around a vacuum.
+type VacuumResult struct {
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+// Pinger is implemented by stores that can check their connection, for readiness probes.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Vacuumer is implemented by stores that can reclaim the space of deleted rows.
+type Vacuumer interface {
+	// Vacuum rebuilds the database file while the store stays in use; checkpoint also
+	// truncates the write-ahead log. It returns ErrVacuumRunning while another vacuum runs.
+	Vacuum(checkpoint bool) (VacuumResult, error)
+}
+
+// Purger is implemented by stores that can be reset, e.g. between test runs.
+type Purger interface {
+	// PurgeAll deletes all jobs, whatever their stage, and returns how many were deleted.
+	PurgeAll() (int, error)
+}
+
+// Archiver is implemented by stores that can move finished jobs out of their primary
+// table while keeping them retrievable with GetJob.
+type Archiver interface {
+	// ArchiveFinishedBefore moves at most limit completed or failed jobs that finished
+	// before the given time, oldest first, and returns how many were moved.
+	ArchiveFinishedBefore(before time.Time, limit int) (int, error)
 }
 
 // Store defines persistence for Jobs and their lifecycle.
 type Store interface {
 	CreateJob(job *Job) error
 	UpdateStage(id string, stage Stage, startedAt *time.Time) error
+	SaveTranscriptionInfo(id string, info TranscriptionInfo) error
 	SaveResult(id string, location, commit string, completedAt time.Time) error
 	SaveError(id string, errMsg string, completedAt time.Time) error
 	GetJob(id string) (*Job, error)
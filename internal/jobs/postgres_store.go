@@ -0,0 +1,577 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgresStore keeps jobs in a PostgreSQL database, for deployments that run more than
+// one instance or already operate a database server. Archiving and vacuuming are
+// SQLite-specific and not supported.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+var (
+	_ TranscriptionCache = (*PostgresStore)(nil)
+	_ Pruner             = (*PostgresStore)(nil)
+	_ Evictor            = (*PostgresStore)(nil)
+	_ StuckLister        = (*PostgresStore)(nil)
+	_ Starter            = (*PostgresStore)(nil)
+	_ IdempotencyStore   = (*PostgresStore)(nil)
+	_ ReviewStore        = (*PostgresStore)(nil)
+	_ CostReporter       = (*PostgresStore)(nil)
+	_ TargetResultStore  = (*PostgresStore)(nil)
+	_ Purger             = (*PostgresStore)(nil)
+	_ Pinger             = (*PostgresStore)(nil)
+	_ StageLister        = (*PostgresStore)(nil)
+	_ RetryStore         = (*PostgresStore)(nil)
+	_ HeldPostStore      = (*PostgresStore)(nil)
+)
+
+// NewPostgresStore connects to the database at dsn and brings its schema up to date.
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres db: %w", err)
+	}
+	if err := migratePostgres(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// migratePostgres creates the tables and indexes. The columns match the SQLite schema
+// so that jobColumns and scanJob serve both stores.
+func migratePostgres(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		image_path TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		target_name TEXT NOT NULL,
+		callback_url TEXT,
+		title TEXT,
+		metadata_json JSONB,
+		stage TEXT NOT NULL,
+		error_message TEXT,
+		target_location TEXT,
+		target_commit TEXT,
+		created_at TIMESTAMPTZ NOT NULL,
+		started_at TIMESTAMPTZ,
+		completed_at TIMESTAMPTZ,
+		finish_reason TEXT,
+		warnings_json JSONB,
+		actor TEXT,
+		target_branch TEXT,
+		target_base_path TEXT,
+		consensus_runs INTEGER,
+		agreement DOUBLE PRECISION,
+		author_name TEXT,
+		author_email TEXT,
+		comments_url TEXT,
+		language TEXT,
+		debug BOOLEAN NOT NULL DEFAULT FALSE,
+		provider_meta JSONB,
+		idempotency_key TEXT,
+		idempotency_expires_at TIMESTAMPTZ,
+		parent_job_id TEXT,
+		model_override TEXT,
+		instructions_override TEXT,
+		review_json JSONB,
+		callback_events TEXT,
+		markdown_flavor TEXT,
+		estimated_cost DOUBLE PRECISION,
+		target_names JSONB,
+		target_results JSONB
+	);
+	CREATE TABLE IF NOT EXISTS transcription_cache (
+		cache_key TEXT PRIMARY KEY,
+		markdown TEXT NOT NULL,
+		finish_reason TEXT,
+		created_at TIMESTAMPTZ NOT NULL
+	);
+	ALTER TABLE transcription_cache ADD COLUMN IF NOT EXISTS language TEXT;
+	CREATE UNIQUE INDEX IF NOT EXISTS jobs_idempotency_key ON jobs(idempotency_key) WHERE idempotency_key IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS jobs_idempotency_expires_at ON jobs(idempotency_expires_at) WHERE idempotency_expires_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS jobs_stage_created_at ON jobs(stage, created_at);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		return fmt.Errorf("migrate schema: %w", err)
+	}
+	return nil
+}
+
+// pgExecer runs the ?-placeholder statements shared with the SQLite store, such as
+// insertJob, with PostgreSQL's $n placeholders.
+type pgExecer struct {
+	ex execer
+}
+
+func (p pgExecer) Exec(query string, args ...any) (sql.Result, error) {
+	return p.ex.Exec(rebind(query), args...)
+}
+
+// rebind numbers the ? placeholders of query as $1, $2, ...
+func rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *PostgresStore) CreateJob(job *Job) error {
+	return insertJob(pgExecer{s.db}, job, nil, nil)
+}
+
+func (s *PostgresStore) UpdateStage(id string, stage Stage, startedAt *time.Time) error {
+	// started_at is only changed when provided.
+	_, err := s.db.Exec(`UPDATE jobs SET stage = $1, started_at = COALESCE($2, started_at) WHERE id = $3`,
+		string(stage), utcTime(startedAt), id)
+	if err != nil {
+		return fmt.Errorf("update stage: %w", err)
+	}
+	return nil
+}
+
+// StartJob moves a queued job to stage, started at startedAt, and reports whether it did.
+func (s *PostgresStore) StartJob(id string, stage Stage, startedAt time.Time) (bool, error) {
+	res, err := s.db.Exec(`UPDATE jobs SET stage = $1, started_at = $2 WHERE id = $3 AND stage = $4`,
+		string(stage), startedAt.UTC(), id, string(StageQueued))
+	if err != nil {
+		return false, fmt.Errorf("start job: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("start job: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *PostgresStore) SaveTranscriptionInfo(id string, info TranscriptionInfo) error {
+	var finish *string
+	if info.FinishReason != "" {
+		finish = &info.FinishReason
+	}
+	var warnings *string
+	if len(info.Warnings) > 0 {
+		b, err := json.Marshal(info.Warnings)
+		if err != nil {
+			return fmt.Errorf("marshal warnings: %w", err)
+		}
+		w := string(b)
+		warnings = &w
+	}
+	var runs *int
+	if info.ConsensusRuns > 0 {
+		runs = &info.ConsensusRuns
+	}
+	var language *string
+	if info.Language != "" {
+		language = &info.Language
+	}
+	var flavor *string
+	if info.Flavor != "" {
+		flavor = &info.Flavor
+	}
+	var providerMeta *string
+	if len(info.ProviderMeta) > 0 {
+		v := string(info.ProviderMeta)
+		providerMeta = &v
+	}
+	_, err := s.db.Exec(`UPDATE jobs SET finish_reason = $1, warnings_json = $2, consensus_runs = $3, agreement = $4, language = $5, markdown_flavor = $6, provider_meta = $7, estimated_cost = $8 WHERE id = $9`,
+		finish, warnings, runs, info.Agreement, language, flavor, providerMeta, info.EstimatedCost, id)
+	if err != nil {
+		return fmt.Errorf("save transcription info: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) SaveResult(id string, location, commit string, completedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE jobs
+		SET target_location = $1, target_commit = $2, stage = $3, error_message = NULL, completed_at = $4
+		WHERE id = $5`,
+		location, commit, string(StageCompleted), completedAt.UTC(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("save result: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) SaveError(id string, errMsg string, completedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE jobs
+		SET error_message = $1, stage = $2, completed_at = $3
+		WHERE id = $4`,
+		errMsg, string(StageFailed), completedAt.UTC(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("save error: %w", err)
+	}
+	return nil
+}
+
+// ResetForRetry moves a failed job back to queued, starting now, and clears its error,
+// completion time and per-target results.
+func (s *PostgresStore) ResetForRetry(id string) error {
+	res, err := s.db.Exec(`UPDATE jobs
+		SET stage = $1, started_at = $2, error_message = NULL, completed_at = NULL, target_results = NULL
+		WHERE id = $3 AND stage = $4`,
+		string(StageQueued), time.Now().UTC(), id, string(StageFailed))
+	if err != nil {
+		return fmt.Errorf("reset for retry: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFailed
+	}
+	return nil
+}
+
+// SaveTargetResults replaces the per-target results of a job.
+func (s *PostgresStore) SaveTargetResults(id string, results []TargetResult) error {
+	b, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("marshal target results: %w", err)
+	}
+	if _, err := s.db.Exec(`UPDATE jobs SET target_results = $1 WHERE id = $2`, string(b), id); err != nil {
+		return fmt.Errorf("save target results: %w", err)
+	}
+	return nil
+}
+
+// GetJob returns the job with the given id.
+func (s *PostgresStore) GetJob(id string) (*Job, error) {
+	job, err := scanJob(s.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("job not found")
+	}
+	return job, err
+}
+
+// DeleteFinishedBefore deletes up to limit jobs that completed or failed before the
+// given time and returns their image paths.
+func (s *PostgresStore) DeleteFinishedBefore(before time.Time, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	return s.deleteReturningPaths(`DELETE FROM jobs WHERE id IN (
+		SELECT id FROM jobs WHERE stage IN ($1, $2) AND completed_at < $3
+		ORDER BY completed_at LIMIT $4 FOR UPDATE SKIP LOCKED)
+		RETURNING image_path`,
+		string(StageCompleted), string(StageFailed), before.UTC(), limit)
+}
+
+// EvictOldestFinished deletes the oldest completed or failed jobs while more than keep jobs
+// are stored, at most limit per call, and returns their image paths.
+func (s *PostgresStore) EvictOldestFinished(keep, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&count); err != nil {
+		return nil, fmt.Errorf("count jobs: %w", err)
+	}
+	excess := min(count-keep, limit)
+	if excess <= 0 {
+		return nil, nil
+	}
+	return s.deleteReturningPaths(`DELETE FROM jobs WHERE id IN (
+		SELECT id FROM jobs WHERE stage IN ($1, $2)
+		ORDER BY created_at, id LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING image_path`,
+		string(StageCompleted), string(StageFailed), excess)
+}
+
+// deleteReturningPaths runs a DELETE ... RETURNING image_path and collects the paths.
+func (s *PostgresStore) deleteReturningPaths(query string, args ...any) ([]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("delete finished jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("scan finished job: %w", err)
+		}
+		paths = append(paths, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate finished jobs: %w", err)
+	}
+	return paths, nil
+}
+
+// CreateJobIdempotent creates job under key, or returns the job already holding the key
+// without creating anything. A key past its expiry is taken over even if the periodic
+// release has not cleared it yet.
+func (s *PostgresStore) CreateJobIdempotent(job *Job, key string, expiresAt time.Time) (*Job, error) {
+	if job == nil {
+		return nil, errors.New("job is nil")
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Concurrent requests with the same key, on this or another instance, queue up on
+	// the lock instead of both missing the key below.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+		return nil, fmt.Errorf("lock idempotency key: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE jobs SET idempotency_key = NULL, idempotency_expires_at = NULL
+		WHERE idempotency_key = $1 AND idempotency_expires_at <= $2`,
+		key, job.CreatedAt.UTC()); err != nil {
+		return nil, fmt.Errorf("release expired key: %w", err)
+	}
+	existing, err := scanJob(tx.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE idempotency_key = $1`, key))
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("lookup idempotency key: %w", err)
+	}
+	expires := expiresAt.UTC().Format(time.RFC3339Nano)
+	if err := insertJob(pgExecer{tx}, job, &key, &expires); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return nil, nil
+}
+
+// ReleaseExpiredIdempotencyKeys clears the idempotency keys that expired before now and
+// returns how many were released. The jobs themselves are kept.
+func (s *PostgresStore) ReleaseExpiredIdempotencyKeys(now time.Time) (int, error) {
+	res, err := s.db.Exec(`UPDATE jobs SET idempotency_key = NULL, idempotency_expires_at = NULL
+		WHERE idempotency_expires_at IS NOT NULL AND idempotency_expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("release expired idempotency keys: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("release expired idempotency keys: %w", err)
+	}
+	return int(n), nil
+}
+
+// ListStuck returns the queued, transcribing and posting jobs that entered their stage
+// before the given time, oldest first.
+func (s *PostgresStore) ListStuck(before time.Time) ([]Job, error) {
+	return s.listJobs(`SELECT `+jobColumns+` FROM jobs
+		WHERE stage IN ($1, $2, $3) AND COALESCE(started_at, created_at) < $4
+		ORDER BY COALESCE(started_at, created_at)`,
+		string(StageQueued), string(StageTranscribing), string(StagePosting), before.UTC())
+}
+
+// HoldForReview moves the job to needs_review and stores the transcription to post if it
+// is approved.
+func (s *PostgresStore) HoldForReview(id string, review Review) error {
+	return s.hold(id, StageNeedsReview, review)
+}
+
+// TakeReview moves a job in needs_review to stage and returns its held transcription, or
+// nil if the job is not in needs_review. The held transcription is removed.
+func (s *PostgresStore) TakeReview(id string, stage Stage) (*Review, error) {
+	return s.take(id, StageNeedsReview, stage)
+}
+
+// HoldForPost moves the job to pending_post and stores the transcription to post once a
+// post window opens.
+func (s *PostgresStore) HoldForPost(id string, held Review) error {
+	return s.hold(id, StagePendingPost, held)
+}
+
+// TakeHeldPost moves a job in pending_post to stage and returns its held transcription,
+// or nil if the job is not in pending_post. The held transcription is removed.
+func (s *PostgresStore) TakeHeldPost(id string, stage Stage) (*Review, error) {
+	return s.take(id, StagePendingPost, stage)
+}
+
+// hold moves the job to stage and stores its transcription.
+func (s *PostgresStore) hold(id string, stage Stage, review Review) error {
+	b, err := json.Marshal(review)
+	if err != nil {
+		return fmt.Errorf("marshal review: %w", err)
+	}
+	res, err := s.db.Exec(`UPDATE jobs SET stage = $1, review_json = $2 WHERE id = $3`, string(stage), string(b), id)
+	if err != nil {
+		return fmt.Errorf("hold in %s: %w", stage, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job not found")
+	}
+	return nil
+}
+
+// take moves a job in from to stage and returns and removes its held transcription, or
+// returns nil if the job is not in from.
+func (s *PostgresStore) take(id string, from, stage Stage) (*Review, error) {
+	// The old review_json is read from the row before the update.
+	var raw sql.NullString
+	err := s.db.QueryRow(`UPDATE jobs SET stage = $1, review_json = NULL
+		FROM (SELECT id, review_json FROM jobs WHERE id = $2 AND stage = $3 FOR UPDATE) old
+		WHERE jobs.id = old.id
+		RETURNING old.review_json`,
+		string(stage), id, string(from)).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("take from %s: %w", from, err)
+	}
+	var review Review
+	if raw.Valid {
+		if err := json.Unmarshal([]byte(raw.String), &review); err != nil {
+			return nil, fmt.Errorf("unmarshal review: %w", err)
+		}
+	}
+	return &review, nil
+}
+
+// ListByStage returns at most limit jobs in stage, oldest first.
+func (s *PostgresStore) ListByStage(stage Stage, limit int) ([]Job, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	return s.listJobs(`SELECT `+jobColumns+` FROM jobs WHERE stage = $1 ORDER BY created_at LIMIT $2`, string(stage), limit)
+}
+
+// ListByStages returns all jobs in one of stages, oldest first.
+func (s *PostgresStore) ListByStages(stages ...Stage) ([]Job, error) {
+	names := make([]string, len(stages))
+	for i, st := range stages {
+		names[i] = string(st)
+	}
+	return s.listJobs(`SELECT `+jobColumns+` FROM jobs WHERE stage = ANY($1) ORDER BY created_at`, names)
+}
+
+// listJobs runs a query selecting jobColumns and scans the jobs.
+func (s *PostgresStore) listJobs(query string, args ...any) ([]Job, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var out []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan job: %w", err)
+		}
+		out = append(out, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate jobs: %w", err)
+	}
+	return out, nil
+}
+
+// PurgeAll deletes all jobs and cached transcriptions and returns the number of jobs
+// deleted.
+func (s *PostgresStore) PurgeAll() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.Exec(`DELETE FROM jobs`)
+	if err != nil {
+		return 0, fmt.Errorf("delete jobs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count deleted jobs: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM transcription_cache`); err != nil {
+		return 0, fmt.Errorf("delete cached transcriptions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return int(n), nil
+}
+
+// GetCachedTranscription returns the cached transcription for key, or nil if there is none.
+func (s *PostgresStore) GetCachedTranscription(key string) (*CachedTranscription, error) {
+	var md string
+	var finish, lang sql.NullString
+	err := s.db.QueryRow(`SELECT markdown, finish_reason, language FROM transcription_cache WHERE cache_key = $1`, key).Scan(&md, &finish, &lang)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get cached transcription: %w", err)
+	}
+	return &CachedTranscription{Markdown: md, FinishReason: finish.String, Language: lang.String}, nil
+}
+
+// PutCachedTranscription stores t under key, replacing any previous entry.
+func (s *PostgresStore) PutCachedTranscription(key string, t CachedTranscription) error {
+	var finish, lang *string
+	if t.FinishReason != "" {
+		finish = &t.FinishReason
+	}
+	if t.Language != "" {
+		lang = &t.Language
+	}
+	_, err := s.db.Exec(`INSERT INTO transcription_cache (cache_key, markdown, finish_reason, language, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (cache_key) DO UPDATE SET markdown = EXCLUDED.markdown, finish_reason = EXCLUDED.finish_reason,
+			language = EXCLUDED.language, created_at = EXCLUDED.created_at`,
+		key, t.Markdown, finish, lang, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("put cached transcription: %w", err)
+	}
+	return nil
+}
+
+// CostSince sums the estimated cost of the jobs started at or after since. Jobs deleted
+// by retention are not counted.
+func (s *PostgresStore) CostSince(since time.Time) (float64, error) {
+	var total float64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(estimated_cost), 0) FROM jobs WHERE started_at >= $1`, since.UTC()).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("sum estimated cost: %w", err)
+	}
+	return total, nil
+}
+
+// Ping checks that the database can be reached.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// utcTime returns t in UTC, or nil.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.UTC()
+	return &v
+}
@@ -0,0 +1,253 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postgresDSNEnv names a PostgreSQL database the PostgresStore tests may use; its
+// tables are emptied. The tests are skipped when it is not set.
+const postgresDSNEnv = "GOSTWRITER_TEST_POSTGRES_DSN"
+
+// newTestPostgresStore opens an empty store on the test database, or skips the test.
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSNEnv)
+	}
+	store, err := NewPostgresStore(dsn)
+	if err != nil {
+		t.Fatalf("NewPostgresStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if _, err := store.PurgeAll(); err != nil {
+		t.Fatalf("PurgeAll: %v", err)
+	}
+	return store
+}
+
+func TestRebind(t *testing.T) {
+	if got := rebind(`UPDATE jobs SET a = ?, b = ? WHERE id = ?`); got != `UPDATE jobs SET a = $1, b = $2 WHERE id = $3` {
+		t.Fatalf("rebind = %q", got)
+	}
+}
+
+func TestPostgresStore_JobLifecycle(t *testing.T) {
+	store := newTestPostgresStore(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	title := "Title"
+	job := &Job{
+		ID:             "job-1",
+		ImagePath:      "/tmp/img.png",
+		MimeType:       "image/png",
+		TargetName:     "docs",
+		Title:          &title,
+		Metadata:       map[string]any{"k": "v"},
+		CallbackEvents: []string{"completed", "failed"},
+		Targets:        []string{"github", "wiki"},
+		Debug:          true,
+		Stage:          StageQueued,
+		CreatedAt:      now,
+	}
+	if err := store.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	start := now.Add(time.Second)
+	if err := store.UpdateStage(job.ID, StageTranscribing, &start); err != nil {
+		t.Fatalf("UpdateStage: %v", err)
+	}
+	// A stage change without a start time keeps started_at.
+	if err := store.UpdateStage(job.ID, StagePosting, nil); err != nil {
+		t.Fatalf("UpdateStage: %v", err)
+	}
+	finish := "stop"
+	if err := store.SaveTranscriptionInfo(job.ID, TranscriptionInfo{FinishReason: finish, Warnings: []string{"w"}, ProviderMeta: []byte(`{"id":"x"}`)}); err != nil {
+		t.Fatalf("SaveTranscriptionInfo: %v", err)
+	}
+	results := []TargetResult{{TargetName: "github", Location: "git:loc", Commit: "deadbeef"}, {TargetName: "wiki", Error: "boom"}}
+	if err := store.SaveTargetResults(job.ID, results); err != nil {
+		t.Fatalf("SaveTargetResults: %v", err)
+	}
+	comp := now.Add(2 * time.Second)
+	if err := store.SaveResult(job.ID, "git:loc", "deadbeef", comp); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+
+	got, err := store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.Stage != StageCompleted || got.Title == nil || *got.Title != title || got.Metadata["k"] != "v" || !got.Debug {
+		t.Fatalf("job mismatch: %+v", got)
+	}
+	if !got.CreatedAt.Equal(now) || got.StartedAt == nil || !got.StartedAt.Equal(start) || got.CompletedAt == nil || !got.CompletedAt.Equal(comp) {
+		t.Fatalf("times mismatch: %v %v %v", got.CreatedAt, got.StartedAt, got.CompletedAt)
+	}
+	if strings.Join(got.CallbackEvents, ",") != "completed,failed" || strings.Join(got.Targets, ",") != "github,wiki" || len(got.TargetResults) != 2 || got.TargetResults[1] != results[1] {
+		t.Fatalf("events or targets mismatch: %v %v %+v", got.CallbackEvents, got.Targets, got.TargetResults)
+	}
+	if got.FinishReason == nil || *got.FinishReason != finish || len(got.Warnings) != 1 || len(got.ProviderMeta) == 0 {
+		t.Fatalf("transcription info mismatch: %+v", got)
+	}
+	if got.TargetLocation == nil || *got.TargetLocation != "git:loc" || got.TargetCommit == nil || *got.TargetCommit != "deadbeef" {
+		t.Fatalf("result mismatch: %+v %+v", got.TargetLocation, got.TargetCommit)
+	}
+
+	if err := store.SaveError(job.ID, "boom", comp); err != nil {
+		t.Fatalf("SaveError: %v", err)
+	}
+	if got, _ := store.GetJob(job.ID); got.Stage != StageFailed || got.ErrorMessage == nil || *got.ErrorMessage != "boom" {
+		t.Fatalf("error not saved: %+v", got)
+	}
+	if err := store.ResetForRetry(job.ID); err != nil {
+		t.Fatalf("ResetForRetry: %v", err)
+	}
+	if got, _ := store.GetJob(job.ID); got.Stage != StageQueued || got.ErrorMessage != nil || got.CompletedAt != nil || got.TargetResults != nil {
+		t.Fatalf("job not reset: %+v", got)
+	}
+	if err := store.ResetForRetry(job.ID); !errors.Is(err, ErrNotFailed) {
+		t.Fatalf("second ResetForRetry = %v, want ErrNotFailed", err)
+	}
+	if _, err := store.GetJob("missing"); err == nil {
+		t.Fatalf("expected not found")
+	}
+}
+
+func TestPostgresStore_TranscriptionCache(t *testing.T) {
+	store := newTestPostgresStore(t)
+	if got, err := store.GetCachedTranscription("k"); err != nil || got != nil {
+		t.Fatalf("empty cache = %+v, %v", got, err)
+	}
+	for _, md := range []string{"first", "second"} {
+		if err := store.PutCachedTranscription("k", CachedTranscription{Markdown: md, FinishReason: "stop", Language: "de"}); err != nil {
+			t.Fatalf("PutCachedTranscription: %v", err)
+		}
+	}
+	if got, err := store.GetCachedTranscription("k"); err != nil || got == nil || got.Markdown != "second" || got.FinishReason != "stop" || got.Language != "de" {
+		t.Fatalf("cached = %+v, %v", got, err)
+	}
+}
+
+func TestPostgresStore_CostSince(t *testing.T) {
+	store := newTestPostgresStore(t)
+	now := time.Now().UTC()
+	for i, j := range []struct {
+		started time.Duration
+		cost    float64
+	}{
+		{started: -2 * time.Hour, cost: 4},
+		{started: -30 * time.Minute, cost: 1.5},
+		{started: -time.Minute, cost: 0.25},
+	} {
+		id := fmt.Sprintf("job-%d", i)
+		if err := store.CreateJob(&Job{ID: id, Stage: StageQueued, ImagePath: "/tmp/" + id, CreatedAt: now}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		started := now.Add(j.started)
+		if err := store.UpdateStage(id, StageTranscribing, &started); err != nil {
+			t.Fatalf("UpdateStage: %v", err)
+		}
+		if err := store.SaveTranscriptionInfo(id, TranscriptionInfo{EstimatedCost: &j.cost}); err != nil {
+			t.Fatalf("SaveTranscriptionInfo: %v", err)
+		}
+	}
+	if total, err := store.CostSince(now.Add(-time.Hour)); err != nil || total != 1.75 {
+		t.Fatalf("CostSince(1h) = %v, %v; want 1.75", total, err)
+	}
+}
+
+func TestPostgresStore_RetentionAndStuck(t *testing.T) {
+	store := newTestPostgresStore(t)
+	now := time.Now().UTC()
+	for i, stage := range []Stage{StageCompleted, StageFailed, StageQueued} {
+		id := fmt.Sprintf("job-%d", i)
+		if err := store.CreateJob(&Job{ID: id, Stage: stage, ImagePath: "/tmp/" + id, CreatedAt: now.Add(time.Duration(i-10) * time.Hour)}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		if stage != StageQueued {
+			if err := store.SaveError(id, "x", now.Add(-time.Hour)); err != nil {
+				t.Fatalf("SaveError: %v", err)
+			}
+		}
+	}
+	stuck, err := store.ListStuck(now.Add(-time.Hour))
+	if err != nil || len(stuck) != 1 || stuck[0].ID != "job-2" {
+		t.Fatalf("ListStuck = %+v, %v", stuck, err)
+	}
+	paths, err := store.EvictOldestFinished(2, 10)
+	if err != nil || len(paths) != 1 || paths[0] != "/tmp/job-0" {
+		t.Fatalf("EvictOldestFinished = %v, %v", paths, err)
+	}
+	paths, err = store.DeleteFinishedBefore(now, 10)
+	if err != nil || len(paths) != 1 || paths[0] != "/tmp/job-1" {
+		t.Fatalf("DeleteFinishedBefore = %v, %v", paths, err)
+	}
+}
+
+func TestPostgresStore_Review(t *testing.T) {
+	store := newTestPostgresStore(t)
+	if err := store.CreateJob(&Job{ID: "r", Stage: StageTranscribing, ImagePath: "/tmp/r"}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := store.HoldForReview("r", Review{Markdown: "# Held"}); err != nil {
+		t.Fatalf("HoldForReview: %v", err)
+	}
+	if held, err := store.ListByStage(StageNeedsReview, 10); err != nil || len(held) != 1 {
+		t.Fatalf("ListByStage = %+v, %v", held, err)
+	}
+	review, err := store.TakeReview("r", StagePosting)
+	if err != nil || review == nil || review.Markdown != "# Held" {
+		t.Fatalf("TakeReview = %+v, %v", review, err)
+	}
+	if again, err := store.TakeReview("r", StagePosting); err != nil || again != nil {
+		t.Fatalf("second TakeReview = %+v, %v; want nil", again, err)
+	}
+}
+
+func TestPostgresStore_HeldPost(t *testing.T) {
+	store := newTestPostgresStore(t)
+	if err := store.CreateJob(&Job{ID: "p", Stage: StageTranscribing, ImagePath: "/tmp/p"}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := store.HoldForPost("p", Review{Markdown: "# Later"}); err != nil {
+		t.Fatalf("HoldForPost: %v", err)
+	}
+	if held, err := store.ListByStages(StagePendingPost); err != nil || len(held) != 1 {
+		t.Fatalf("ListByStages = %+v, %v", held, err)
+	}
+	if review, err := store.TakeReview("p", StagePosting); err != nil || review != nil {
+		t.Fatalf("TakeReview = %+v, %v; want nil", review, err)
+	}
+	held, err := store.TakeHeldPost("p", StagePosting)
+	if err != nil || held == nil || held.Markdown != "# Later" {
+		t.Fatalf("TakeHeldPost = %+v, %v", held, err)
+	}
+	if again, err := store.TakeHeldPost("p", StagePosting); err != nil || again != nil {
+		t.Fatalf("second TakeHeldPost = %+v, %v; want nil", again, err)
+	}
+}
+
+func TestPostgresStore_Idempotency(t *testing.T) {
+	store := newTestPostgresStore(t)
+	now := time.Now().UTC()
+	first := &Job{ID: "first", Stage: StageQueued, ImagePath: "/tmp/a", MimeType: "image/png", TargetName: "t", CreatedAt: now}
+	if existing, err := store.CreateJobIdempotent(first, "key", now.Add(time.Hour)); err != nil || existing != nil {
+		t.Fatalf("first create = %v, %v", existing, err)
+	}
+	retry := &Job{ID: "retry", Stage: StageQueued, ImagePath: "/tmp/b", MimeType: "image/png", TargetName: "t", CreatedAt: now.Add(time.Minute)}
+	if existing, err := store.CreateJobIdempotent(retry, "key", now.Add(time.Hour)); err != nil || existing == nil || existing.ID != "first" {
+		t.Fatalf("retry = %+v, %v; want the first job", existing, err)
+	}
+	late := &Job{ID: "late", Stage: StageQueued, ImagePath: "/tmp/d", MimeType: "image/png", TargetName: "t", CreatedAt: now.Add(2 * time.Hour)}
+	if existing, err := store.CreateJobIdempotent(late, "key", now.Add(3*time.Hour)); err != nil || existing != nil {
+		t.Fatalf("expired key = %v, %v; want a new job", existing, err)
+	}
+	if n, err := store.ReleaseExpiredIdempotencyKeys(now.Add(4 * time.Hour)); err != nil || n != 1 {
+		t.Fatalf("ReleaseExpiredIdempotencyKeys = %d, %v", n, err)
+	}
+}
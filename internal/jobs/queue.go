@@ -14,6 +14,9 @@ import (
 type WorkItem struct {
 	Job     Job
 	Cleanup func() error
+	// TraceParent is the W3C traceparent of the request that created the job, so its
+	// processing joins the request's trace; empty when tracing is off.
+	TraceParent string
 }
 
 // Processor defines how to process a WorkItem.
@@ -30,7 +33,9 @@ type Queue struct {
 	cancelOnce sync.Once
 	cancel     context.CancelFunc
 	started    bool
+	stopped    bool
 	mu         sync.Mutex
+	active     map[string]int // job id -> items waiting or being processed
 }
 
 // NewQueue creates a new Queue with the given capacity and worker count.
@@ -45,9 +50,19 @@ func NewQueue(logger *slog.Logger, capacity int, workers int) *Queue {
 		log:     logger,
 		ch:      make(chan WorkItem, capacity),
 		workers: workers,
+		active:  make(map[string]int),
 	}
 }
 
+// NewSerialQueue creates a Queue with a single worker so items are processed strictly
+// one at a time in the order they were enqueued. This trades throughput for ordering,
+// e.g., for pages of one document that must land in sequence. Jobs are stored before
+// they are enqueued, and RecoverInFlight queues the ones left in the store oldest first
+// before new jobs are accepted, so the order also holds across a restart.
+func NewSerialQueue(logger *slog.Logger, capacity int) *Queue {
+	return NewQueue(logger, capacity, 1)
+}
+
 // Start launches worker goroutines that consume WorkItems and process them using the provided Processor.
 func (q *Queue) Start(ctx context.Context, p Processor) error {
 	q.mu.Lock()
@@ -92,34 +107,77 @@ func (q *Queue) worker(ctx context.Context, p Processor, idx int) {
 					jobLog.Warn("cleanup failed", "err", err)
 				}
 			}
+			q.release(item.Job.ID)
 		}
 	}
 }
 
-// Enqueue adds a WorkItem to the queue (non-blocking if capacity allows).
+// Enqueue adds a WorkItem to the queue (non-blocking if capacity allows). It fails once
+// Shutdown was called.
 func (q *Queue) Enqueue(item WorkItem) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	if !q.started {
 		return errors.New("queue not started")
 	}
+	if q.stopped {
+		return errors.New("queue is shut down")
+	}
 	select {
 	case q.ch <- item:
+		q.active[item.Job.ID]++
 		return nil
 	default:
 		return errors.New("queue is full")
 	}
 }
 
+// Holds reports whether an item of the job waits in the queue or is being processed.
+func (q *Queue) Holds(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.active[id] > 0
+}
+
+// release forgets an item of the job once it was processed.
+func (q *Queue) release(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.active[id]--; q.active[id] <= 0 {
+		delete(q.active, id)
+	}
+}
+
+// Ready reports whether the queue has been started and not shut down.
+func (q *Queue) Ready() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.started && !q.stopped
+}
+
+// Depth returns the number of items waiting for a worker.
+func (q *Queue) Depth() int {
+	return len(q.ch)
+}
+
+// Capacity returns the maximum number of waiting items.
+func (q *Queue) Capacity() int {
+	return cap(q.ch)
+}
+
 // Shutdown gracefully stops accepting work and waits for workers to finish current items up to the provided deadline.
 func (q *Queue) Shutdown(deadline time.Duration) {
 	q.cancelOnce.Do(func() {
+		q.mu.Lock()
+		q.stopped = true
+		// close channel to unblock workers if they are waiting on receive; under the lock
+		// so a concurrent Enqueue either sends first or sees stopped
+		close(q.ch)
+		q.mu.Unlock()
 		// stop workers
 		if q.cancel != nil {
 			q.cancel()
 		}
-		// close channel to unblock workers if they are waiting on receive
-		close(q.ch)
 
 		// wait with deadline
 		done := make(chan struct{})
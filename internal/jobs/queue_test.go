@@ -3,6 +3,9 @@ package jobs
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -32,9 +35,15 @@ func TestQueue_StartEnqueueShutdown(t *testing.T) {
 	p := &noopProcessor{}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	if q.Ready() {
+		t.Fatalf("queue ready before start")
+	}
 	if err := q.Start(ctx, p); err != nil {
 		t.Fatalf("queue start: %v", err)
 	}
+	if !q.Ready() {
+		t.Fatalf("queue not ready after start")
+	}
 
 	item := WorkItem{Job: Job{ID: "id1"}}
 	if err := q.Enqueue(item); err != nil {
@@ -49,6 +58,9 @@ func TestQueue_StartEnqueueShutdown(t *testing.T) {
 
 	// shutdown should complete promptly
 	q.Shutdown(2 * time.Second)
+	if q.Ready() {
+		t.Fatalf("queue ready after shutdown")
+	}
 }
 
 func TestQueue_EnqueueBeforeStartFails(t *testing.T) {
@@ -59,3 +71,90 @@ func TestQueue_EnqueueBeforeStartFails(t *testing.T) {
 		t.Fatalf("enqueue before start should error")
 	}
 }
+
+func TestQueue_EnqueueAfterShutdownFails(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	q := NewQueue(logger, 1, 1)
+	if err := q.Start(context.Background(), &noopProcessor{}); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	q.Shutdown(time.Second)
+	if err := q.Enqueue(WorkItem{Job: Job{ID: "late"}}); err == nil {
+		t.Fatalf("enqueue after shutdown should error")
+	}
+}
+
+func TestQueue_DepthAndCapacity(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	q := NewQueue(logger, 3, 1)
+	if q.Capacity() != 3 || q.Depth() != 0 {
+		t.Fatalf("capacity=%d depth=%d", q.Capacity(), q.Depth())
+	}
+	// Items stay queued while no worker is running.
+	q.started = true
+	for i := 0; i < 2; i++ {
+		if err := q.Enqueue(WorkItem{Job: Job{ID: fmt.Sprint(i)}}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	if q.Depth() != 2 {
+		t.Fatalf("depth = %d, want 2", q.Depth())
+	}
+	if !q.Holds("0") || q.Holds("2") {
+		t.Fatalf("Holds does not match the waiting items")
+	}
+	q.release("0")
+	if q.Holds("0") {
+		t.Fatalf("released job still held")
+	}
+}
+
+type recordingProcessor struct {
+	mu    sync.Mutex
+	order []string
+	done  chan struct{}
+	want  int
+}
+
+func (p *recordingProcessor) Process(ctx context.Context, item WorkItem) error {
+	// Uneven processing times would reorder completions with parallel workers.
+	if id := item.Job.ID; id[len(id)-1]%2 == 0 {
+		time.Sleep(2 * time.Millisecond)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.order = append(p.order, item.Job.ID)
+	if len(p.order) == p.want {
+		close(p.done)
+	}
+	return nil
+}
+
+func TestSerialQueue_PreservesOrder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	const n = 20
+	q := NewSerialQueue(logger, n)
+	p := &recordingProcessor{done: make(chan struct{}), want: n}
+	if err := q.Start(context.Background(), p); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer q.Shutdown(time.Second)
+
+	for i := 0; i < n; i++ {
+		if err := q.Enqueue(WorkItem{Job: Job{ID: fmt.Sprintf("page-%02d", i)}}); err != nil {
+			t.Fatalf("enqueue %d: %v", i, err)
+		}
+	}
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for items")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, id := range p.order {
+		if want := fmt.Sprintf("page-%02d", i); id != want {
+			t.Fatalf("item %d processed out of order: got %s, want %s (order=%v)", i, id, want, p.order)
+		}
+	}
+}
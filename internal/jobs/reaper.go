@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/storage"
+)
+
+// reaperInterval is the time between two checks for stuck jobs.
+const reaperInterval = time.Minute
+
+// ReaperOptions configures the handling of stuck jobs.
+type ReaperOptions struct {
+	Timeout   time.Duration // jobs making no progress for this long are reaped
+	Requeue   bool          // queue reaped jobs once more if their image is still on disk
+	KeepImage bool          // keep the image of a requeued job after processing (server.keepUploads)
+	// Images is where job images are stored; nil means local disk.
+	Images storage.ImageStore
+	// Busy reports whether this process still holds the job, e.g. waiting in the queue or
+	// being transcribed; such jobs are not reaped however long they take. Defaults to
+	// the Holds method of the queue passed to NewReaper.
+	Busy func(id string) bool
+}
+
+// Reaper periodically fails jobs that stay in a non-terminal stage for longer than the
+// timeout, e.g. because the process crashed while working on them, so they do not
+// look in progress forever.
+type Reaper struct {
+	log   *slog.Logger
+	store ReaperStore
+	queue *Queue // nil unless requeueing
+	opts  ReaperOptions
+	now   func() time.Time
+
+	requeued map[string]bool // jobs queued again by this reaper; reaped a second time they fail
+}
+
+// ReaperStore is a Store that can list stuck jobs.
+type ReaperStore interface {
+	Store
+	StuckLister
+}
+
+// NewReaper creates a Reaper. Reaped jobs are queued again on queue when opts.Requeue
+// is set.
+func NewReaper(logger *slog.Logger, store ReaperStore, queue *Queue, opts ReaperOptions) *Reaper {
+	if opts.Busy == nil && queue != nil {
+		opts.Busy = queue.Holds
+	}
+	if !opts.Requeue {
+		queue = nil
+	}
+	if opts.Images == nil {
+		opts.Images = storage.LocalImages{}
+	}
+	return &Reaper{log: logger, store: store, queue: queue, opts: opts, now: time.Now, requeued: make(map[string]bool)}
+}
+
+// Run checks for stuck jobs immediately and then every minute until ctx is done.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := r.RunOnce(); err != nil {
+			r.log.Error("stuck job check failed", "reaped", n, "err", err)
+		} else if n > 0 {
+			r.log.Warn("stuck jobs reaped", "reaped", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce fails or requeues all jobs stuck for longer than the timeout and returns
+// how many were reaped. Jobs this process still holds are skipped.
+func (r *Reaper) RunOnce() (int, error) {
+	stuck, err := r.store.ListStuck(r.now().Add(-r.opts.Timeout))
+	if err != nil {
+		return 0, err
+	}
+	reaped := 0
+	for _, job := range stuck {
+		if r.opts.Busy != nil && r.opts.Busy(job.ID) {
+			continue
+		}
+		reaped++
+		if r.requeue(job) {
+			continue
+		}
+		msg := fmt.Sprintf("stuck: no progress in stage %s for %s, job abandoned", job.Stage, r.opts.Timeout)
+		if err := r.store.SaveError(job.ID, msg, r.now().UTC()); err != nil {
+			return reaped - 1, err
+		}
+		delete(r.requeued, job.ID)
+		r.log.Warn("stuck job failed", "job_id", job.ID, "stage", job.Stage)
+	}
+	return reaped, nil
+}
+
+// requeue queues the job again unless requeueing is off, the job was requeued before
+// or its image is gone. It reports whether the job was queued.
+func (r *Reaper) requeue(job Job) bool {
+	if r.queue == nil || r.requeued[job.ID] {
+		return false
+	}
+	img, err := r.opts.Images.Open(job.ImagePath)
+	if err != nil {
+		return false
+	}
+	_ = img.Close()
+	if err := enqueueAgain(r.store, r.queue, r.opts.Images, r.opts.KeepImage, job, r.now().UTC()); err != nil {
+		r.log.Warn("requeue stuck job", "job_id", job.ID, "err", err)
+		return false
+	}
+	r.requeued[job.ID] = true
+	r.log.Warn("stuck job queued again", "job_id", job.ID, "stage", job.Stage)
+	return true
+}
@@ -0,0 +1,245 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chanProcessor hands the processed items to the test.
+type chanProcessor chan WorkItem
+
+func (p chanProcessor) Process(ctx context.Context, item WorkItem) error {
+	p <- item
+	return nil
+}
+
+func TestReaper_FailsStuckJobs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	now := time.Now().UTC()
+	old := now.Add(-2 * time.Hour)
+	mk := func(id string, created time.Time, stage Stage, started *time.Time) {
+		if err := store.CreateJob(&Job{ID: id, ImagePath: filepath.Join(dir, id+".png"), MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: created}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		if stage != StageQueued {
+			if err := store.UpdateStage(id, stage, started); err != nil {
+				t.Fatalf("UpdateStage: %v", err)
+			}
+		}
+	}
+	recent := now.Add(-time.Minute)
+	mk("stale-transcribing", old, StageTranscribing, &old)
+	mk("stale-queued", old, StageQueued, nil)
+	mk("recent-posting", old, StagePosting, &recent)
+	mk("waiting-for-window", old, StagePendingPost, &old)
+	mk("done", old, StageQueued, nil)
+	_ = store.SaveResult("done", "loc", "c", old)
+
+	r := NewReaper(discardLogger(), store, nil, ReaperOptions{Timeout: time.Hour})
+	n, err := r.RunOnce()
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("reaped %d jobs, want 2", n)
+	}
+	for _, id := range []string{"stale-transcribing", "stale-queued"} {
+		got, _ := store.GetJob(id)
+		if got.Stage != StageFailed || got.ErrorMessage == nil || !strings.HasPrefix(*got.ErrorMessage, "stuck: ") || got.CompletedAt == nil {
+			t.Fatalf("%s not reaped: %+v", id, got)
+		}
+	}
+	for id, stage := range map[string]Stage{"recent-posting": StagePosting, "waiting-for-window": StagePendingPost, "done": StageCompleted} {
+		if got, _ := store.GetJob(id); got.Stage != stage {
+			t.Fatalf("%s: stage = %s, want %s", id, got.Stage, stage)
+		}
+	}
+}
+
+func TestReaper_RequeuesOnce(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	processed := make(chanProcessor, 1)
+	q := NewQueue(discardLogger(), 4, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx, processed); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer q.Shutdown(time.Second)
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	img := filepath.Join(dir, "img.png")
+	if err := os.WriteFile(img, []byte("x"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := store.CreateJob(&Job{ID: "stuck", ImagePath: img, MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: old}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	_ = store.UpdateStage("stuck", StagePosting, &old)
+
+	r := NewReaper(discardLogger(), store, q, ReaperOptions{Timeout: time.Hour, Requeue: true})
+	if n, err := r.RunOnce(); err != nil || n != 1 {
+		t.Fatalf("RunOnce = %d, %v", n, err)
+	}
+	item := <-processed
+	if item.Job.ID != "stuck" || item.Job.Stage != StageQueued {
+		t.Fatalf("unexpected requeued item %+v", item.Job)
+	}
+	if got, _ := store.GetJob("stuck"); got.Stage != StageQueued {
+		t.Fatalf("stage after requeue = %s", got.Stage)
+	}
+
+	// Stuck a second time, the job fails instead of looping even though the image is still there.
+	for q.Holds("stuck") {
+		time.Sleep(time.Millisecond) // the queue worker is still finishing the item
+	}
+	r.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if n, err := r.RunOnce(); err != nil || n != 1 {
+		t.Fatalf("second RunOnce = %d, %v", n, err)
+	}
+	if got, _ := store.GetJob("stuck"); got.Stage != StageFailed {
+		t.Fatalf("stage after second reap = %s", got.Stage)
+	}
+	if err := item.Cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if _, err := os.Stat(img); !os.IsNotExist(err) {
+		t.Fatalf("cleanup kept the image: %v", err)
+	}
+}
+
+// blockingProcessor reports each item and then waits until release is closed.
+type blockingProcessor struct {
+	started chan string
+	release chan struct{}
+}
+
+func (p blockingProcessor) Process(ctx context.Context, item WorkItem) error {
+	p.started <- item.Job.ID
+	<-p.release
+	return nil
+}
+
+func TestReaper_SkipsJobsHeldByQueue(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	proc := blockingProcessor{started: make(chan string, 2), release: make(chan struct{})}
+	q := NewSerialQueue(discardLogger(), 4)
+	if err := q.Start(context.Background(), proc); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer q.Shutdown(time.Second)
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	for _, id := range []string{"running", "waiting"} {
+		job := Job{ID: id, ImagePath: filepath.Join(dir, id+".png"), MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: old}
+		if err := store.CreateJob(&job); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		if err := q.Enqueue(WorkItem{Job: job}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if id := <-proc.started; id != "running" {
+		t.Fatalf("first processed job = %s", id)
+	}
+
+	// "waiting" is old but still in the channel behind "running"; neither is stuck.
+	r := NewReaper(discardLogger(), store, q, ReaperOptions{Timeout: time.Hour})
+	if n, err := r.RunOnce(); err != nil || n != 0 {
+		t.Fatalf("RunOnce = %d, %v; want nothing reaped", n, err)
+	}
+	for _, id := range []string{"running", "waiting"} {
+		if got, _ := store.GetJob(id); got.Stage != StageQueued {
+			t.Fatalf("%s: stage = %s, want queued", id, got.Stage)
+		}
+	}
+	close(proc.release)
+	<-proc.started
+}
+
+// memImages is an in-memory storage.ImageStore.
+type memImages map[string][]byte
+
+func (m memImages) Open(path string) (io.ReadCloser, error) {
+	b, ok := m[path]
+	if !ok {
+		return nil, fmt.Errorf("open %s: %w", path, fs.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m memImages) Delete(path string) error {
+	delete(m, path)
+	return nil
+}
+
+func TestReaper_RequeuesWithImageStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	processed := make(chanProcessor, 1)
+	q := NewQueue(discardLogger(), 4, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx, processed); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer q.Shutdown(time.Second)
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	images := memImages{"s3://b/stuck.png": []byte("x")}
+	for _, id := range []string{"stuck", "gone"} {
+		if err := store.CreateJob(&Job{ID: id, ImagePath: "s3://b/" + id + ".png", MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: old}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		_ = store.UpdateStage(id, StageTranscribing, &old)
+	}
+
+	r := NewReaper(discardLogger(), store, q, ReaperOptions{Timeout: time.Hour, Requeue: true, Images: images})
+	if n, err := r.RunOnce(); err != nil || n != 2 {
+		t.Fatalf("RunOnce = %d, %v", n, err)
+	}
+	item := <-processed
+	if item.Job.ID != "stuck" {
+		t.Fatalf("unexpected requeued item %+v", item.Job)
+	}
+	if got, _ := store.GetJob("gone"); got.Stage != StageFailed {
+		t.Fatalf("job without image: stage = %s, want failed", got.Stage)
+	}
+	if err := item.Cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if _, ok := images["s3://b/stuck.png"]; ok {
+		t.Fatalf("cleanup kept the image in the store")
+	}
+}
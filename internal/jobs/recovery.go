@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/storage"
+)
+
+// inFlightStages are the stages of jobs a worker was busy with, or that waited in the
+// in-memory queue, when the server stopped.
+var inFlightStages = []Stage{StageQueued, StageTranscribing, StagePosting}
+
+// RecoveryOptions configures the recovery of in-flight jobs at startup.
+type RecoveryOptions struct {
+	KeepImage bool // keep the image of a requeued job after processing (server.keepUploads)
+	// Images is where job images are stored; nil means local disk.
+	Images storage.ImageStore
+	// StaleAfter limits recovery to jobs that entered their stage longer ago, so that jobs
+	// other instances sharing the store are working on are left alone; 0 recovers all.
+	StaleAfter time.Duration
+}
+
+// RecoveryStore is a Store that can list jobs by stage.
+type RecoveryStore interface {
+	Store
+	StageLister
+}
+
+// RecoverInFlight queues the queued, transcribing and posting jobs of the store again,
+// as queued, so that jobs lost with the in-memory queue on a restart are processed.
+// Jobs whose image is gone, or that do not fit into the queue, fail. It must run after
+// queue.Start and before new jobs are accepted, and returns how many jobs were requeued
+// and failed. With opts.StaleAfter, more recent jobs are skipped.
+func RecoverInFlight(logger *slog.Logger, store RecoveryStore, queue *Queue, opts RecoveryOptions) (requeued, failed int, err error) {
+	if opts.Images == nil {
+		opts.Images = storage.LocalImages{}
+	}
+	inFlight, err := store.ListByStages(inFlightStages...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("list in-flight jobs: %w", err)
+	}
+	cutoff := time.Now().UTC().Add(-opts.StaleAfter)
+	for _, job := range inFlight {
+		if opts.StaleAfter > 0 && stageEntered(job).After(cutoff) {
+			continue
+		}
+		var msg string
+		if img, err := opts.Images.Open(job.ImagePath); err != nil {
+			msg = fmt.Sprintf("not resumed after restart: image no longer available (was %s)", job.Stage)
+		} else {
+			_ = img.Close()
+			if err := enqueueAgain(store, queue, opts.Images, opts.KeepImage, job, time.Now().UTC()); err != nil {
+				msg = fmt.Sprintf("not resumed after restart: %v (was %s)", err, job.Stage)
+			}
+		}
+		if msg == "" {
+			requeued++
+			logger.Info("in-flight job queued again", "job_id", job.ID, "stage", job.Stage)
+			continue
+		}
+		if err := store.SaveError(job.ID, msg, time.Now().UTC()); err != nil {
+			return requeued, failed, err
+		}
+		failed++
+		logger.Warn("in-flight job failed", "job_id", job.ID, "stage", job.Stage, "reason", msg)
+	}
+	return requeued, failed, nil
+}
+
+// stageEntered returns when job entered its current stage, as far as the store knows.
+func stageEntered(job Job) time.Time {
+	if job.StartedAt != nil {
+		return *job.StartedAt
+	}
+	return job.CreatedAt
+}
+
+// enqueueAgain moves job back to queued, with now as its start time so it is not reaped
+// while it waits, and puts it on queue. Unless keepImage is set, the image is deleted
+// once the job is processed.
+func enqueueAgain(store Store, queue *Queue, images storage.ImageStore, keepImage bool, job Job, now time.Time) error {
+	if err := store.UpdateStage(job.ID, StageQueued, &now); err != nil {
+		return err
+	}
+	path := job.ImagePath
+	job.Stage = StageQueued
+	item := WorkItem{Job: job}
+	if !keepImage {
+		item.Cleanup = func() error {
+			return images.Delete(path)
+		}
+	}
+	return queue.Enqueue(item)
+}
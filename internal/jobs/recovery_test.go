@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecoverInFlight(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	processed := make(chanProcessor, 4)
+	// A serial queue, whose order has to hold across the restart.
+	q := NewSerialQueue(discardLogger(), 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx, processed); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer q.Shutdown(time.Second)
+
+	// The store as a killed server left it.
+	old := time.Now().UTC().Add(-time.Hour)
+	images := memImages{}
+	for i, j := range []struct {
+		id    string
+		stage Stage
+		image bool
+	}{
+		{"queued", StageQueued, true},
+		{"transcribing", StageTranscribing, true},
+		{"posting", StagePosting, true},
+		{"image-gone", StageTranscribing, false},
+		{"review", StageNeedsReview, true},
+		{"done", StageCompleted, true},
+	} {
+		path := "mem://" + j.id + ".png"
+		if j.image {
+			images[path] = []byte("x")
+		}
+		created := old.Add(time.Duration(i) * time.Second)
+		if err := store.CreateJob(&Job{ID: j.id, ImagePath: path, MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: created}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		if j.stage != StageQueued {
+			if err := store.UpdateStage(j.id, j.stage, &created); err != nil {
+				t.Fatalf("UpdateStage: %v", err)
+			}
+		}
+	}
+
+	// A recent job may belong to another instance sharing the store and is left alone.
+	fresh := time.Now().UTC()
+	if err := store.CreateJob(&Job{ID: "fresh", ImagePath: "mem://queued.png", MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: fresh}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := store.UpdateStage("fresh", StageTranscribing, &fresh); err != nil {
+		t.Fatalf("UpdateStage: %v", err)
+	}
+
+	requeued, failed, err := RecoverInFlight(discardLogger(), store, q, RecoveryOptions{Images: images, StaleAfter: time.Minute})
+	if err != nil || requeued != 3 || failed != 1 {
+		t.Fatalf("RecoverInFlight = %d, %d, %v; want 3 requeued, 1 failed", requeued, failed, err)
+	}
+	for _, id := range []string{"queued", "transcribing", "posting"} {
+		item := <-processed
+		if item.Job.ID != id || item.Job.Stage != StageQueued {
+			t.Fatalf("processed %s (%s), want %s in order", item.Job.ID, item.Job.Stage, id)
+		}
+		if got, _ := store.GetJob(id); got.Stage != StageQueued {
+			t.Fatalf("%s: stage = %s, want queued", id, got.Stage)
+		}
+	}
+	if got, _ := store.GetJob("fresh"); got.Stage != StageTranscribing {
+		t.Fatalf("fresh: stage = %s, want transcribing", got.Stage)
+	}
+	got, _ := store.GetJob("image-gone")
+	if got.Stage != StageFailed || got.ErrorMessage == nil || !strings.Contains(*got.ErrorMessage, "image no longer available") {
+		t.Fatalf("job without image not failed: %+v", got)
+	}
+	for id, stage := range map[string]Stage{"review": StageNeedsReview, "done": StageCompleted} {
+		if got, _ := store.GetJob(id); got.Stage != stage {
+			t.Fatalf("%s: stage = %s, want %s", id, got.Stage, stage)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Archive partitions: finished jobs are moved into one SQLite file per month or year
+// of their completion time.
+const (
+	PartitionMonth = "month"
+	PartitionYear  = "year"
+)
+
+// archivePrefix and archiveSuffix frame the partition in archive file names,
+// e.g. jobs-2025-04.db.
+const (
+	archivePrefix = "jobs-"
+	archiveSuffix = ".db"
+)
+
+// EnableArchive makes ArchiveFinishedBefore move jobs into date-partitioned SQLite files
+// in dir and lets GetJob find them there. Call it before the store is used concurrently.
+func (s *SQLiteStore) EnableArchive(dir, partitionBy string) error {
+	if partitionBy != PartitionMonth && partitionBy != PartitionYear {
+		return fmt.Errorf("unknown archive partition %q", partitionBy)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create archive dir: %w", err)
+	}
+	s.archiveDir = dir
+	s.partitionBy = partitionBy
+	return nil
+}
+
+// archivePath returns the archive file for a job that completed at t.
+func (s *SQLiteStore) archivePath(t time.Time) string {
+	layout := "2006-01"
+	if s.partitionBy == PartitionYear {
+		layout = "2006"
+	}
+	return filepath.Join(s.archiveDir, archivePrefix+t.UTC().Format(layout)+archiveSuffix)
+}
+
+// ArchiveFinishedBefore moves up to limit finished jobs into their archive files. Each
+// archive file is filled in a single transaction that also deletes the rows from the
+// jobs table, so a job is never lost or visible twice; callers loop until fewer than
+// limit jobs are moved.
+func (s *SQLiteStore) ArchiveFinishedBefore(before time.Time, limit int) (int, error) {
+	if s.archiveDir == "" {
+		return 0, errors.New("archive is not enabled")
+	}
+	s.maint.RLock()
+	defer s.maint.RUnlock()
+	if limit <= 0 {
+		return 0, errors.New("limit must be positive")
+	}
+	rows, err := s.db.Query(`SELECT id, completed_at FROM jobs
+		WHERE stage IN (?, ?) AND completed_at IS NOT NULL AND julianday(completed_at) < julianday(?)
+		ORDER BY completed_at LIMIT ?`,
+		string(StageCompleted), string(StageFailed), before.UTC().Format(time.RFC3339Nano), limit)
+	if err != nil {
+		return 0, fmt.Errorf("select finished jobs: %w", err)
+	}
+	byFile := map[string][]any{}
+	for rows.Next() {
+		var id, completed string
+		if err := rows.Scan(&id, &completed); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("scan finished job: %w", err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, completed)
+		if err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("job %s: parse completed_at: %w", id, err)
+		}
+		p := s.archivePath(t)
+		byFile[p] = append(byFile[p], id)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return 0, fmt.Errorf("iterate finished jobs: %w", err)
+	}
+	_ = rows.Close()
+
+	moved := 0
+	for _, p := range slices.Sorted(maps.Keys(byFile)) {
+		if err := s.moveToArchive(p, byFile[p]); err != nil {
+			return moved, err
+		}
+		moved += len(byFile[p])
+	}
+	return moved, nil
+}
+
+// moveToArchive copies the jobs with the given ids into the archive file at path and
+// deletes them from the jobs table. The archive is attached to a dedicated connection
+// so both statements run in one transaction.
+func (s *SQLiteStore) moveToArchive(path string, ids []any) error {
+	// Opening the archive creates the file and its schema on first use.
+	if _, err := s.archiveDB(path); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("archive connection: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS archive`, path); err != nil {
+		return fmt.Errorf("attach archive %s: %w", path, err)
+	}
+	defer func() { _, _ = conn.ExecContext(ctx, `DETACH DATABASE archive`) }()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	in := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")"
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO archive.jobs (`+jobColumns+`)
+		SELECT `+jobColumns+` FROM main.jobs WHERE id IN `+in, ids...); err != nil {
+		return fmt.Errorf("copy jobs to %s: %w", path, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM main.jobs WHERE id IN `+in, ids...); err != nil {
+		return fmt.Errorf("delete archived jobs: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// archiveDB returns the open archive database at path, opening it on first use.
+func (s *SQLiteStore) archiveDB(path string) (*sql.DB, error) {
+	s.archiveMu.Lock()
+	defer s.archiveMu.Unlock()
+	if db, ok := s.archives[path]; ok {
+		return db, nil
+	}
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, fmt.Errorf("archive %s: %w", path, err)
+	}
+	if s.archives == nil {
+		s.archives = map[string]*sql.DB{}
+	}
+	s.archives[path] = db
+	return db, nil
+}
+
+// getArchivedJob looks up id in the archive files, newest partition first. It returns
+// sql.ErrNoRows if no archive holds the job.
+func (s *SQLiteStore) getArchivedJob(id string) (*Job, error) {
+	paths, err := filepath.Glob(filepath.Join(s.archiveDir, archivePrefix+"*"+archiveSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("list archives: %w", err)
+	}
+	slices.Sort(paths)
+	slices.Reverse(paths)
+	for _, p := range paths {
+		db, err := s.archiveDB(p)
+		if err != nil {
+			return nil, err
+		}
+		job, err := scanJob(db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+		if !errors.Is(err, sql.ErrNoRows) {
+			return job, err
+		}
+	}
+	return nil, sql.ErrNoRows
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore_ArchiveFinishedJobs(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "jobs.db")
+	archiveDir := filepath.Join(dir, "archive")
+	store, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	if err := store.EnableArchive(archiveDir, PartitionMonth); err != nil {
+		t.Fatalf("EnableArchive: %v", err)
+	}
+
+	march := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+	april := time.Date(2025, 4, 2, 18, 30, 0, 0, time.UTC)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	title := "Receipt"
+	mk := func(id string, finished *time.Time, failed bool) {
+		if err := store.CreateJob(&Job{ID: id, ImagePath: id + ".png", MimeType: "image/png", TargetName: "t", Title: &title, Stage: StageQueued}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		switch {
+		case finished == nil:
+		case failed:
+			_ = store.SaveError(id, "boom", *finished)
+		default:
+			_ = store.SaveResult(id, "notes/"+id+".md", "abc", *finished)
+		}
+	}
+	mk("march-ok", &march, false)
+	mk("march-failed", &march, true)
+	mk("april-ok", &april, false)
+	recent := now.Add(-time.Hour)
+	mk("recent", &recent, false)
+	mk("running", nil, false)
+
+	runner := NewArchiveRunner(discardLogger(), store, ArchiveOptions{MinAge: 24 * time.Hour, BatchSize: 2})
+	runner.now = func() time.Time { return now }
+	n, err := runner.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("archived %d jobs, want 3", n)
+	}
+	for _, name := range []string{"jobs-2025-03.db", "jobs-2025-04.db"} {
+		if _, err := os.Stat(filepath.Join(archiveDir, name)); err != nil {
+			t.Fatalf("archive file %s: %v", name, err)
+		}
+	}
+	var hot int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&hot); err != nil || hot != 2 {
+		t.Fatalf("jobs left in the primary table = %d (%v), want 2", hot, err)
+	}
+
+	// Archived jobs are still retrievable, also after a restart.
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	store, err = NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if err := store.EnableArchive(archiveDir, PartitionMonth); err != nil {
+		t.Fatalf("EnableArchive: %v", err)
+	}
+	got, err := store.GetJob("april-ok")
+	if err != nil {
+		t.Fatalf("GetJob archived: %v", err)
+	}
+	if got.Stage != StageCompleted || got.TargetLocation == nil || *got.TargetLocation != "notes/april-ok.md" ||
+		got.Title == nil || *got.Title != title || got.CompletedAt == nil || !got.CompletedAt.Equal(april) {
+		t.Fatalf("archived job not restored: %+v", got)
+	}
+	if got, err := store.GetJob("march-failed"); err != nil || got.Stage != StageFailed || got.ErrorMessage == nil {
+		t.Fatalf("archived failed job: %+v %v", got, err)
+	}
+	for _, id := range []string{"recent", "running"} {
+		if _, err := store.GetJob(id); err != nil {
+			t.Fatalf("GetJob %s: %v", id, err)
+		}
+	}
+	if _, err := store.GetJob("missing"); err == nil {
+		t.Fatalf("expected unknown job to be reported as not found")
+	}
+}
+
+func TestSQLiteStore_ArchivePartitionByYear(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if err := store.EnableArchive(dir, "week"); err == nil {
+		t.Fatalf("expected unknown partition to be rejected")
+	}
+	if err := store.EnableArchive(dir, PartitionYear); err != nil {
+		t.Fatalf("EnableArchive: %v", err)
+	}
+
+	for i, m := range []time.Month{time.January, time.November} {
+		id := []string{"jan", "nov"}[i]
+		if err := store.CreateJob(&Job{ID: id, ImagePath: "x", MimeType: "image/png", TargetName: "t", Stage: StageQueued}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		_ = store.SaveResult(id, "loc", "c", time.Date(2024, m, 1, 0, 0, 0, 0, time.UTC))
+	}
+	n, err := store.ArchiveFinishedBefore(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 10)
+	if err != nil || n != 2 {
+		t.Fatalf("ArchiveFinishedBefore = %d, %v; want 2", n, err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "jobs-*.db"))
+	if len(matches) != 1 || filepath.Base(matches[0]) != "jobs-2024.db" {
+		t.Fatalf("archive files = %v, want jobs-2024.db only", matches)
+	}
+	if _, err := store.GetJob("nov"); err != nil {
+		t.Fatalf("GetJob archived: %v", err)
+	}
+}
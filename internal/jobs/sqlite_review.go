@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// HoldForReview moves the job to needs_review and stores the transcription to post if it
+// is approved.
+func (s *SQLiteStore) HoldForReview(id string, review Review) error {
+	return s.hold(id, StageNeedsReview, review)
+}
+
+// TakeReview moves a job in needs_review to stage and returns its held transcription, or
+// nil if the job is not in needs_review. The held transcription is removed.
+func (s *SQLiteStore) TakeReview(id string, stage Stage) (*Review, error) {
+	return s.take(id, StageNeedsReview, stage)
+}
+
+// HoldForPost moves the job to pending_post and stores the transcription to post once a
+// post window opens.
+func (s *SQLiteStore) HoldForPost(id string, held Review) error {
+	return s.hold(id, StagePendingPost, held)
+}
+
+// TakeHeldPost moves a job in pending_post to stage and returns its held transcription,
+// or nil if the job is not in pending_post. The held transcription is removed.
+func (s *SQLiteStore) TakeHeldPost(id string, stage Stage) (*Review, error) {
+	return s.take(id, StagePendingPost, stage)
+}
+
+// hold moves the job to stage and stores its transcription.
+func (s *SQLiteStore) hold(id string, stage Stage, review Review) error {
+	b, err := json.Marshal(review)
+	if err != nil {
+		return fmt.Errorf("marshal review: %w", err)
+	}
+	res, err := s.db.Exec(`UPDATE jobs SET stage = ?, review_json = ? WHERE id = ?`, string(stage), string(b), id)
+	if err != nil {
+		return fmt.Errorf("hold in %s: %w", stage, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job not found")
+	}
+	return nil
+}
+
+// take moves a job in from to stage and returns and removes its held transcription, or
+// returns nil if the job is not in from.
+func (s *SQLiteStore) take(id string, from, stage Stage) (*Review, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	// The update comes first so the transaction holds the write lock before reading.
+	res, err := tx.Exec(`UPDATE jobs SET stage = ? WHERE id = ? AND stage = ?`, string(stage), id, string(from))
+	if err != nil {
+		return nil, fmt.Errorf("take from %s: %w", from, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	var raw sql.NullString
+	if err := tx.QueryRow(`SELECT review_json FROM jobs WHERE id = ?`, id).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("select review: %w", err)
+	}
+	var review Review
+	if raw.Valid {
+		if err := json.Unmarshal([]byte(raw.String), &review); err != nil {
+			return nil, fmt.Errorf("unmarshal review: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE jobs SET review_json = NULL WHERE id = ?`, id); err != nil {
+		return nil, fmt.Errorf("clear review: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &review, nil
+}
+
+// ListByStage returns at most limit jobs in stage, oldest first. Archived jobs are not
+// listed.
+func (s *SQLiteStore) ListByStage(stage Stage, limit int) ([]Job, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	return s.listJobs(`SELECT `+jobColumns+` FROM jobs WHERE stage = ? ORDER BY julianday(created_at) LIMIT ?`, string(stage), limit)
+}
+
+// ListByStages returns all jobs in one of stages, oldest first. Archived jobs are not
+// listed.
+func (s *SQLiteStore) ListByStages(stages ...Stage) ([]Job, error) {
+	if len(stages) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(stages))
+	for i, st := range stages {
+		args[i] = string(st)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(stages)), ", ")
+	return s.listJobs(`SELECT `+jobColumns+` FROM jobs WHERE stage IN (`+placeholders+`) ORDER BY julianday(created_at)`, args...)
+}
+
+// listJobs runs a query selecting jobColumns and scans the jobs.
+func (s *SQLiteStore) listJobs(query string, args ...any) ([]Job, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var out []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan job: %w", err)
+		}
+		out = append(out, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate jobs: %w", err)
+	}
+	return out, nil
+}
@@ -1,10 +1,14 @@
 package jobs
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jo-hoe/gostwriter/internal/common"
@@ -12,10 +16,47 @@ import (
 )
 
 type SQLiteStore struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
+
+	// maint serializes vacuums (write lock) with bulk deletions and moves (read lock).
+	maint     sync.RWMutex
+	vacuuming atomic.Bool
+
+	// Archive of finished jobs; see EnableArchive.
+	archiveDir  string
+	partitionBy string
+	archiveMu   sync.Mutex
+	archives    map[string]*sql.DB // open archive files by path
 }
 
+var (
+	_ TranscriptionCache = (*SQLiteStore)(nil)
+	_ Pruner             = (*SQLiteStore)(nil)
+	_ StuckLister        = (*SQLiteStore)(nil)
+	_ Starter            = (*SQLiteStore)(nil)
+	_ IdempotencyStore   = (*SQLiteStore)(nil)
+	_ Archiver           = (*SQLiteStore)(nil)
+	_ ReviewStore        = (*SQLiteStore)(nil)
+	_ Vacuumer           = (*SQLiteStore)(nil)
+	_ CostReporter       = (*SQLiteStore)(nil)
+	_ TargetResultStore  = (*SQLiteStore)(nil)
+	_ Pinger             = (*SQLiteStore)(nil)
+	_ StageLister        = (*SQLiteStore)(nil)
+	_ RetryStore         = (*SQLiteStore)(nil)
+	_ HeldPostStore      = (*SQLiteStore)(nil)
+)
+
 func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{db: db, path: path}, nil
+}
+
+// openSQLite opens the database at path and brings its schema up to date.
+func openSQLite(path string) (*sql.DB, error) {
 	// Busy timeout to avoid SQLITE_BUSY in concurrent access.
 	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)", path, common.SQLiteBusyTimeoutMS)
 	db, err := sql.Open("sqlite", dsn)
@@ -26,7 +67,7 @@ func NewSQLiteStore(path string) (*SQLiteStore, error) {
 		_ = db.Close()
 		return nil, err
 	}
-	return &SQLiteStore{db: db}, nil
+	return db, nil
 }
 
 func migrate(db *sql.DB) error {
@@ -45,16 +86,130 @@ func migrate(db *sql.DB) error {
 		target_commit TEXT,
 		created_at TEXT NOT NULL,
 		started_at TEXT,
-		completed_at TEXT
+		completed_at TEXT,
+		finish_reason TEXT,
+		warnings_json TEXT,
+		actor TEXT,
+		target_branch TEXT,
+		target_base_path TEXT,
+		consensus_runs INTEGER,
+		agreement REAL,
+		author_name TEXT,
+		author_email TEXT,
+		comments_url TEXT,
+		language TEXT,
+		debug INTEGER NOT NULL DEFAULT 0,
+		provider_meta TEXT,
+		idempotency_key TEXT,
+		idempotency_expires_at TEXT,
+		parent_job_id TEXT,
+		model_override TEXT,
+		instructions_override TEXT,
+		review_json TEXT,
+		callback_events TEXT,
+		markdown_flavor TEXT,
+		estimated_cost REAL,
+		target_names TEXT,
+		target_results TEXT
+	);
+	CREATE TABLE IF NOT EXISTS transcription_cache (
+		cache_key TEXT PRIMARY KEY,
+		markdown TEXT NOT NULL,
+		finish_reason TEXT,
+		created_at TEXT NOT NULL
 	);
 	`
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("migrate schema: %w", err)
 	}
+	// Columns added after the initial schema; existing databases are upgraded in place.
+	added := []struct{ name, decl string }{
+		{"finish_reason", "TEXT"},
+		{"warnings_json", "TEXT"},
+		{"actor", "TEXT"},
+		{"target_branch", "TEXT"},
+		{"target_base_path", "TEXT"},
+		{"consensus_runs", "INTEGER"},
+		{"agreement", "REAL"},
+		{"author_name", "TEXT"},
+		{"author_email", "TEXT"},
+		{"comments_url", "TEXT"},
+		{"language", "TEXT"},
+		{"debug", "INTEGER NOT NULL DEFAULT 0"},
+		{"provider_meta", "TEXT"},
+		{"idempotency_key", "TEXT"},
+		{"idempotency_expires_at", "TEXT"},
+		{"parent_job_id", "TEXT"},
+		{"model_override", "TEXT"},
+		{"instructions_override", "TEXT"},
+		{"review_json", "TEXT"},
+		{"callback_events", "TEXT"},
+		{"markdown_flavor", "TEXT"},
+		{"estimated_cost", "REAL"},
+		{"target_names", "TEXT"},
+		{"target_results", "TEXT"},
+	}
+	for _, c := range added {
+		if err := addColumnIfMissing(db, "jobs", c.name, c.decl); err != nil {
+			return err
+		}
+	}
+	if err := addColumnIfMissing(db, "transcription_cache", "language", "TEXT"); err != nil {
+		return err
+	}
+	// Indexes on added columns are created once the columns exist.
+	if _, err := db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS jobs_idempotency_key ON jobs(idempotency_key) WHERE idempotency_key IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS jobs_idempotency_expires_at ON jobs(idempotency_expires_at) WHERE idempotency_expires_at IS NOT NULL;
+	`); err != nil {
+		return fmt.Errorf("migrate indexes: %w", err)
+	}
+	return nil
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			ctype     string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("scan %s columns: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate %s columns: %w", table, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
 func (s *SQLiteStore) CreateJob(job *Job) error {
+	return insertJob(s.db, job, nil, nil)
+}
+
+// execer is a *sql.DB or *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertJob inserts job, with an idempotency key and its expiry (RFC3339Nano) if not nil.
+// The statement uses ? placeholders; see pgExecer for PostgreSQL.
+func insertJob(ex execer, job *Job, key, expires *string) error {
 	if job == nil {
 		return errors.New("job is nil")
 	}
@@ -64,13 +219,14 @@ func (s *SQLiteStore) CreateJob(job *Job) error {
 	if job.CreatedAt.IsZero() {
 		job.CreatedAt = time.Now().UTC()
 	}
-	meta := ""
+	var meta *string
 	if job.Metadata != nil {
 		b, err := json.Marshal(job.Metadata)
 		if err != nil {
 			return fmt.Errorf("marshal metadata: %w", err)
 		}
-		meta = string(b)
+		v := string(b)
+		meta = &v
 	}
 	var cb *string
 	if job.CallbackURL != nil && *job.CallbackURL != "" {
@@ -80,11 +236,66 @@ func (s *SQLiteStore) CreateJob(job *Job) error {
 	if job.Title != nil && *job.Title != "" {
 		title = job.Title
 	}
+	var actor *string
+	if job.Actor != nil && *job.Actor != "" {
+		actor = job.Actor
+	}
+	var branch *string
+	if job.TargetBranch != nil && *job.TargetBranch != "" {
+		branch = job.TargetBranch
+	}
+	var basePath *string
+	if job.TargetBasePath != nil && *job.TargetBasePath != "" {
+		basePath = job.TargetBasePath
+	}
+	var authorName *string
+	if job.AuthorName != nil && *job.AuthorName != "" {
+		authorName = job.AuthorName
+	}
+	var authorEmail *string
+	if job.AuthorEmail != nil && *job.AuthorEmail != "" {
+		authorEmail = job.AuthorEmail
+	}
+	var commentsURL *string
+	if job.CommentsURL != nil && *job.CommentsURL != "" {
+		commentsURL = job.CommentsURL
+	}
+	var parent *string
+	if job.ParentJobID != nil && *job.ParentJobID != "" {
+		parent = job.ParentJobID
+	}
+	var model *string
+	if job.Model != nil && *job.Model != "" {
+		model = job.Model
+	}
+	var instructions *string
+	if job.Instructions != nil && *job.Instructions != "" {
+		instructions = job.Instructions
+	}
+	// Stored comma-separated; an empty subscription (no events) is kept as "".
+	var events *string
+	if job.CallbackEvents != nil {
+		v := strings.Join(job.CallbackEvents, ",")
+		events = &v
+	}
+	var targetNames *string
+	if len(job.Targets) > 0 {
+		b, err := json.Marshal(job.Targets)
+		if err != nil {
+			return fmt.Errorf("marshal targets: %w", err)
+		}
+		v := string(b)
+		targetNames = &v
+	}
 
-	_, err := s.db.Exec(
-		`INSERT INTO jobs (id, image_path, mime_type, target_name, callback_url, title, metadata_json, stage, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		job.ID, job.ImagePath, job.MimeType, job.TargetName, cb, title, meta, string(job.Stage), job.CreatedAt.UTC().Format(time.RFC3339Nano),
+	_, err := ex.Exec(
+		`INSERT INTO jobs (id, image_path, mime_type, target_name, callback_url, title, metadata_json, stage, created_at, actor,
+			target_branch, target_base_path, author_name, author_email, comments_url, debug, idempotency_key, idempotency_expires_at,
+			parent_job_id, model_override, instructions_override, callback_events, target_names)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.ImagePath, job.MimeType, job.TargetName, cb, title, meta, string(job.Stage), job.CreatedAt.UTC().Format(time.RFC3339Nano), actor,
+		branch, basePath, authorName, authorEmail, commentsURL, job.Debug, key, expires,
+		parent, model, instructions, events, targetNames,
 	)
 	if err != nil {
 		return fmt.Errorf("insert job: %w", err)
@@ -113,6 +324,332 @@ func (s *SQLiteStore) UpdateStage(id string, stage Stage, startedAt *time.Time)
 	return nil
 }
 
+// StartJob moves a queued job to stage, started at startedAt, and reports whether it did.
+func (s *SQLiteStore) StartJob(id string, stage Stage, startedAt time.Time) (bool, error) {
+	res, err := s.db.Exec(`UPDATE jobs SET stage = ?, started_at = ? WHERE id = ? AND stage = ?`,
+		string(stage), startedAt.UTC().Format(time.RFC3339Nano), id, string(StageQueued))
+	if err != nil {
+		return false, fmt.Errorf("start job: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("start job: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *SQLiteStore) SaveTranscriptionInfo(id string, info TranscriptionInfo) error {
+	var finish *string
+	if info.FinishReason != "" {
+		finish = &info.FinishReason
+	}
+	var warnings *string
+	if len(info.Warnings) > 0 {
+		b, err := json.Marshal(info.Warnings)
+		if err != nil {
+			return fmt.Errorf("marshal warnings: %w", err)
+		}
+		w := string(b)
+		warnings = &w
+	}
+	var runs *int
+	if info.ConsensusRuns > 0 {
+		runs = &info.ConsensusRuns
+	}
+	var language *string
+	if info.Language != "" {
+		language = &info.Language
+	}
+	var flavor *string
+	if info.Flavor != "" {
+		flavor = &info.Flavor
+	}
+	var providerMeta *string
+	if len(info.ProviderMeta) > 0 {
+		v := string(info.ProviderMeta)
+		providerMeta = &v
+	}
+	_, err := s.db.Exec(`UPDATE jobs SET finish_reason = ?, warnings_json = ?, consensus_runs = ?, agreement = ?, language = ?, markdown_flavor = ?, provider_meta = ?, estimated_cost = ? WHERE id = ?`,
+		finish, warnings, runs, info.Agreement, language, flavor, providerMeta, info.EstimatedCost, id)
+	if err != nil {
+		return fmt.Errorf("save transcription info: %w", err)
+	}
+	return nil
+}
+
+// DeleteFinishedBefore deletes up to limit finished jobs in a single short transaction
+// so that live traffic is not blocked for long; callers loop until fewer than limit
+// paths are returned.
+func (s *SQLiteStore) DeleteFinishedBefore(before time.Time, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	s.maint.RLock()
+	defer s.maint.RUnlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// julianday compares the timestamps as instants; RFC3339Nano strings do not sort
+	// lexically when fractional seconds have different lengths.
+	rows, err := tx.Query(`SELECT id, image_path FROM jobs
+		WHERE stage IN (?, ?) AND completed_at IS NOT NULL AND julianday(completed_at) < julianday(?)
+		ORDER BY completed_at LIMIT ?`,
+		string(StageCompleted), string(StageFailed), before.UTC().Format(time.RFC3339Nano), limit)
+	if err != nil {
+		return nil, fmt.Errorf("select finished jobs: %w", err)
+	}
+	var ids, paths []string
+	for rows.Next() {
+		var id, p string
+		if err := rows.Scan(&id, &p); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("scan finished job: %w", err)
+		}
+		ids = append(ids, id)
+		paths = append(paths, p)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, fmt.Errorf("iterate finished jobs: %w", err)
+	}
+	_ = rows.Close()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, id); err != nil {
+			return nil, fmt.Errorf("delete job %s: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return paths, nil
+}
+
+// CreateJobIdempotent creates job under key, or returns the job already holding the key
+// without creating anything. A key past its expiry is taken over even if the periodic
+// release has not cleared it yet.
+func (s *SQLiteStore) CreateJobIdempotent(job *Job, key string, expiresAt time.Time) (*Job, error) {
+	if job == nil {
+		return nil, errors.New("job is nil")
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Writing first takes the write lock, so concurrent requests with the same key
+	// queue up here instead of both missing the key below.
+	if _, err := tx.Exec(`UPDATE jobs SET idempotency_key = NULL, idempotency_expires_at = NULL
+		WHERE idempotency_key = ? AND julianday(idempotency_expires_at) <= julianday(?)`,
+		key, job.CreatedAt.UTC().Format(time.RFC3339Nano)); err != nil {
+		return nil, fmt.Errorf("release expired key: %w", err)
+	}
+	existing, err := scanJob(tx.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE idempotency_key = ?`, key))
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("lookup idempotency key: %w", err)
+	}
+	expires := expiresAt.UTC().Format(time.RFC3339Nano)
+	if err := insertJob(tx, job, &key, &expires); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return nil, nil
+}
+
+// ReleaseExpiredIdempotencyKeys clears the idempotency keys that expired before now and
+// returns how many were released. The jobs themselves are kept.
+func (s *SQLiteStore) ReleaseExpiredIdempotencyKeys(now time.Time) (int, error) {
+	s.maint.RLock()
+	defer s.maint.RUnlock()
+	res, err := s.db.Exec(`UPDATE jobs SET idempotency_key = NULL, idempotency_expires_at = NULL
+		WHERE idempotency_expires_at IS NOT NULL AND julianday(idempotency_expires_at) <= julianday(?)`,
+		now.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, fmt.Errorf("release expired idempotency keys: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("release expired idempotency keys: %w", err)
+	}
+	return int(n), nil
+}
+
+// ListStuck returns the queued, transcribing and posting jobs that entered their stage
+// before the given time, oldest first.
+func (s *SQLiteStore) ListStuck(before time.Time) ([]Job, error) {
+	rows, err := s.db.Query(`SELECT `+jobColumns+` FROM jobs
+		WHERE stage IN (?, ?, ?) AND julianday(COALESCE(started_at, created_at)) < julianday(?)
+		ORDER BY julianday(COALESCE(started_at, created_at))`,
+		string(StageQueued), string(StageTranscribing), string(StagePosting), before.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, fmt.Errorf("select stuck jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var out []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan stuck job: %w", err)
+		}
+		out = append(out, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate stuck jobs: %w", err)
+	}
+	return out, nil
+}
+
+// EvictOldestFinished deletes the oldest completed or failed jobs while more than keep jobs
+// are stored, at most limit per call, and returns their image paths. Archived jobs are
+// not counted.
+func (s *SQLiteStore) EvictOldestFinished(keep, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	s.maint.RLock()
+	defer s.maint.RUnlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&count); err != nil {
+		return nil, fmt.Errorf("count jobs: %w", err)
+	}
+	excess := min(count-keep, limit)
+	if excess <= 0 {
+		return nil, nil
+	}
+	rows, err := tx.Query(`SELECT id, image_path FROM jobs WHERE stage IN (?, ?)
+		ORDER BY julianday(created_at), id LIMIT ?`,
+		string(StageCompleted), string(StageFailed), excess)
+	if err != nil {
+		return nil, fmt.Errorf("select oldest finished jobs: %w", err)
+	}
+	var ids, paths []string
+	for rows.Next() {
+		var id, p string
+		if err := rows.Scan(&id, &p); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("scan finished job: %w", err)
+		}
+		ids = append(ids, id)
+		paths = append(paths, p)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, fmt.Errorf("iterate finished jobs: %w", err)
+	}
+	_ = rows.Close()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, id); err != nil {
+			return nil, fmt.Errorf("delete job %s: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return paths, nil
+}
+
+// PurgeAll deletes all jobs and cached transcriptions and returns the number of jobs
+// deleted. Archived jobs are left in their archive databases.
+func (s *SQLiteStore) PurgeAll() (int, error) {
+	s.maint.RLock()
+	defer s.maint.RUnlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.Exec(`DELETE FROM jobs`)
+	if err != nil {
+		return 0, fmt.Errorf("delete jobs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count deleted jobs: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM transcription_cache`); err != nil {
+		return 0, fmt.Errorf("delete cached transcriptions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return int(n), nil
+}
+
+// GetCachedTranscription returns the cached transcription for key, or nil if there is none.
+func (s *SQLiteStore) GetCachedTranscription(key string) (*CachedTranscription, error) {
+	var md string
+	var finish, lang sql.NullString
+	err := s.db.QueryRow(`SELECT markdown, finish_reason, language FROM transcription_cache WHERE cache_key = ?`, key).Scan(&md, &finish, &lang)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get cached transcription: %w", err)
+	}
+	return &CachedTranscription{Markdown: md, FinishReason: finish.String, Language: lang.String}, nil
+}
+
+// PutCachedTranscription stores t under key, replacing any previous entry.
+func (s *SQLiteStore) PutCachedTranscription(key string, t CachedTranscription) error {
+	var finish, lang *string
+	if t.FinishReason != "" {
+		finish = &t.FinishReason
+	}
+	if t.Language != "" {
+		lang = &t.Language
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO transcription_cache (cache_key, markdown, finish_reason, language, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key, t.Markdown, finish, lang, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("put cached transcription: %w", err)
+	}
+	return nil
+}
+
+// CostSince sums the estimated cost of the jobs started at or after since. Jobs already
+// archived or deleted by retention are not counted.
+func (s *SQLiteStore) CostSince(since time.Time) (float64, error) {
+	var total float64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(estimated_cost), 0) FROM jobs
+		WHERE started_at IS NOT NULL AND julianday(started_at) >= julianday(?)`,
+		since.UTC().Format(time.RFC3339Nano)).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("sum estimated cost: %w", err)
+	}
+	return total, nil
+}
+
+// SaveTargetResults replaces the per-target results of a job.
+func (s *SQLiteStore) SaveTargetResults(id string, results []TargetResult) error {
+	b, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("marshal target results: %w", err)
+	}
+	if _, err := s.db.Exec(`UPDATE jobs SET target_results = ? WHERE id = ?`, string(b), id); err != nil {
+		return fmt.Errorf("save target results: %w", err)
+	}
+	return nil
+}
+
 func (s *SQLiteStore) SaveResult(id string, location, commit string, completedAt time.Time) error {
 	_, err := s.db.Exec(`UPDATE jobs
 		SET target_location = ?, target_commit = ?, stage = ?, error_message = NULL, completed_at = ?
@@ -137,13 +674,53 @@ func (s *SQLiteStore) SaveError(id string, errMsg string, completedAt time.Time)
 	return nil
 }
 
+// ResetForRetry moves a failed job back to queued, starting now, and clears its error,
+// completion time and per-target results.
+func (s *SQLiteStore) ResetForRetry(id string) error {
+	res, err := s.db.Exec(`UPDATE jobs
+		SET stage = ?, started_at = ?, error_message = NULL, completed_at = NULL, target_results = NULL
+		WHERE id = ? AND stage = ?`,
+		string(StageQueued), time.Now().UTC().Format(time.RFC3339Nano), id, string(StageFailed))
+	if err != nil {
+		return fmt.Errorf("reset for retry: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFailed
+	}
+	return nil
+}
+
+// jobColumns lists all columns of the jobs table, in the order scanJob reads them.
+const jobColumns = `id, image_path, mime_type, target_name, callback_url, title, metadata_json, stage,
+		error_message, target_location, target_commit, created_at, started_at, completed_at,
+		finish_reason, warnings_json, actor, target_branch, target_base_path, consensus_runs, agreement,
+		author_name, author_email, comments_url, language, debug, provider_meta, parent_job_id, model_override,
+		instructions_override, callback_events, markdown_flavor, estimated_cost, target_names, target_results`
+
+// GetJob returns the job with the given id. Jobs moved out of the jobs table by
+// ArchiveFinishedBefore are looked up in the archive files.
 func (s *SQLiteStore) GetJob(id string) (*Job, error) {
-	row := s.db.QueryRow(`SELECT id, image_path, mime_type, target_name, callback_url, title, metadata_json, stage,
-		error_message, target_location, target_commit, created_at, started_at, completed_at
-		FROM jobs WHERE id = ?`, id)
+	job, err := scanJob(s.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) && s.archiveDir != "" {
+		job, err = s.getArchivedJob(id)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("job not found")
+	}
+	return job, err
+}
 
+// rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanJob reads a job selected with jobColumns. It returns sql.ErrNoRows unwrapped.
+func scanJob(row rowScanner) (*Job, error) {
 	var job Job
-	var cb, title, meta, errMsg, loc, commit, created, started, completed sql.NullString
+	var cb, title, meta, errMsg, loc, commit, created, started, completed, finish, warnings, actor, branch, basePath, authorName, authorEmail, commentsURL, language, providerMeta, parent, model, instructions, events, flavor, targetNames, targetResults sql.NullString
+	var runs sql.NullInt64
+	var agreement, cost sql.NullFloat64
 	var stage string
 
 	if err := row.Scan(
@@ -161,9 +738,30 @@ func (s *SQLiteStore) GetJob(id string) (*Job, error) {
 		&created,
 		&started,
 		&completed,
+		&finish,
+		&warnings,
+		&actor,
+		&branch,
+		&basePath,
+		&runs,
+		&agreement,
+		&authorName,
+		&authorEmail,
+		&commentsURL,
+		&language,
+		&job.Debug,
+		&providerMeta,
+		&parent,
+		&model,
+		&instructions,
+		&events,
+		&flavor,
+		&cost,
+		&targetNames,
+		&targetResults,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("job not found")
+			return nil, err
 		}
 		return nil, fmt.Errorf("scan job: %w", err)
 	}
@@ -212,11 +810,108 @@ func (s *SQLiteStore) GetJob(id string) (*Job, error) {
 			job.CompletedAt = &t
 		}
 	}
+	if actor.Valid {
+		v := actor.String
+		job.Actor = &v
+	}
+	if authorName.Valid {
+		v := authorName.String
+		job.AuthorName = &v
+	}
+	if authorEmail.Valid {
+		v := authorEmail.String
+		job.AuthorEmail = &v
+	}
+	if commentsURL.Valid {
+		v := commentsURL.String
+		job.CommentsURL = &v
+	}
+	if language.Valid {
+		v := language.String
+		job.Language = &v
+	}
+	if flavor.Valid {
+		v := flavor.String
+		job.MarkdownFlavor = &v
+	}
+	if cost.Valid {
+		v := cost.Float64
+		job.EstimatedCost = &v
+	}
+	if providerMeta.Valid && providerMeta.String != "" {
+		job.ProviderMeta = json.RawMessage(providerMeta.String)
+	}
+	if parent.Valid {
+		v := parent.String
+		job.ParentJobID = &v
+	}
+	if model.Valid {
+		v := model.String
+		job.Model = &v
+	}
+	if instructions.Valid {
+		v := instructions.String
+		job.Instructions = &v
+	}
+	if events.Valid {
+		job.CallbackEvents = []string{}
+		if events.String != "" {
+			job.CallbackEvents = strings.Split(events.String, ",")
+		}
+	}
+	if targetNames.Valid && targetNames.String != "" {
+		var names []string
+		if err := json.Unmarshal([]byte(targetNames.String), &names); err == nil {
+			job.Targets = names
+		}
+	}
+	if targetResults.Valid && targetResults.String != "" {
+		var results []TargetResult
+		if err := json.Unmarshal([]byte(targetResults.String), &results); err == nil {
+			job.TargetResults = results
+		}
+	}
+	if branch.Valid {
+		v := branch.String
+		job.TargetBranch = &v
+	}
+	if basePath.Valid {
+		v := basePath.String
+		job.TargetBasePath = &v
+	}
+	if finish.Valid {
+		v := finish.String
+		job.FinishReason = &v
+	}
+	if warnings.Valid && warnings.String != "" {
+		var w []string
+		if err := json.Unmarshal([]byte(warnings.String), &w); err == nil {
+			job.Warnings = w
+		}
+	}
+	if runs.Valid {
+		job.ConsensusRuns = int(runs.Int64)
+	}
+	if agreement.Valid {
+		v := agreement.Float64
+		job.Agreement = &v
+	}
 	job.Stage = Stage(stage)
 
 	return &job, nil
 }
 
+// Ping checks that the database can be reached.
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 func (s *SQLiteStore) Close() error {
+	s.archiveMu.Lock()
+	for _, db := range s.archives {
+		_ = db.Close()
+	}
+	s.archives = nil
+	s.archiveMu.Unlock()
 	return s.db.Close()
 }
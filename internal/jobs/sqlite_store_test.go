@@ -1,8 +1,12 @@
 package jobs
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,9 +35,28 @@ func TestSQLiteStore_JobLifecycle(t *testing.T) {
 			v := "Title"
 			return &v
 		}(),
-		Metadata:  map[string]any{"k": "v"},
-		Stage:     StageQueued,
-		CreatedAt: now,
+		Metadata: map[string]any{"k": "v"},
+		Actor: func() *string {
+			v := "mobile-app"
+			return &v
+		}(),
+		TargetBranch: func() *string {
+			v := "drafts"
+			return &v
+		}(),
+		AuthorName: func() *string {
+			v := "Jane Doe"
+			return &v
+		}(),
+		CommentsURL: func() *string {
+			v := "https://api.github.com/repos/o/r/issues/1/comments"
+			return &v
+		}(),
+		CallbackEvents: []string{"completed", "failed"},
+		Targets:        []string{"github", "wiki"},
+		Debug:          true,
+		Stage:          StageQueued,
+		CreatedAt:      now,
 	}
 
 	// Create a fake image file path for completeness (store doesn't validate it)
@@ -51,6 +74,11 @@ func TestSQLiteStore_JobLifecycle(t *testing.T) {
 		t.Fatalf("UpdateStage: %v", err)
 	}
 
+	results := []TargetResult{{TargetName: "github", Location: "git:loc", Commit: "deadbeef"}, {TargetName: "wiki", Error: "boom"}}
+	if err := store.SaveTargetResults(job.ID, results); err != nil {
+		t.Fatalf("SaveTargetResults: %v", err)
+	}
+
 	// Save result to mark completed
 	comp := now.Add(2 * time.Second)
 	if err := store.SaveResult(job.ID, "git:loc", "deadbeef", comp); err != nil {
@@ -64,6 +92,27 @@ func TestSQLiteStore_JobLifecycle(t *testing.T) {
 	if got.ID != job.ID || got.Stage != StageCompleted {
 		t.Fatalf("job mismatch or not completed: %+v", got)
 	}
+	if got.Actor == nil || *got.Actor != "mobile-app" {
+		t.Fatalf("actor mismatch: %+v", got.Actor)
+	}
+	if got.TargetBranch == nil || *got.TargetBranch != "drafts" || got.TargetBasePath != nil {
+		t.Fatalf("target override mismatch: %+v %+v", got.TargetBranch, got.TargetBasePath)
+	}
+	if got.AuthorName == nil || *got.AuthorName != "Jane Doe" || got.AuthorEmail != nil {
+		t.Fatalf("author mismatch: %+v %+v", got.AuthorName, got.AuthorEmail)
+	}
+	if got.CommentsURL == nil || *got.CommentsURL != *job.CommentsURL {
+		t.Fatalf("comments url mismatch: %+v", got.CommentsURL)
+	}
+	if !got.Debug {
+		t.Fatalf("debug flag not persisted")
+	}
+	if strings.Join(got.CallbackEvents, ",") != "completed,failed" {
+		t.Fatalf("callback events mismatch: %v", got.CallbackEvents)
+	}
+	if strings.Join(got.Targets, ",") != "github,wiki" || len(got.TargetResults) != 2 || got.TargetResults[0] != results[0] || got.TargetResults[1] != results[1] {
+		t.Fatalf("targets mismatch: %v %+v", got.Targets, got.TargetResults)
+	}
 	if got.TargetLocation == nil || *got.TargetLocation != "git:loc" {
 		t.Fatalf("location mismatch: %+v", got.TargetLocation)
 	}
@@ -87,3 +136,328 @@ func TestSQLiteStore_JobLifecycle(t *testing.T) {
 		t.Fatalf("error message mismatch: %+v", got2.ErrorMessage)
 	}
 }
+
+func TestSQLiteStore_SaveTranscriptionInfo(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	job := &Job{ID: "job-info", ImagePath: "img.png", MimeType: "image/png", TargetName: "docs", Stage: StageQueued}
+	if err := store.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	info := TranscriptionInfo{FinishReason: "length", Warnings: []string{"truncated"}}
+	if err := store.SaveTranscriptionInfo(job.ID, info); err != nil {
+		t.Fatalf("SaveTranscriptionInfo: %v", err)
+	}
+	got, err := store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.FinishReason == nil || *got.FinishReason != "length" {
+		t.Fatalf("finish reason mismatch: %v", got.FinishReason)
+	}
+	if len(got.Warnings) != 1 || got.Warnings[0] != "truncated" {
+		t.Fatalf("warnings mismatch: %v", got.Warnings)
+	}
+	if got.ConsensusRuns != 0 || got.Agreement != nil || got.Language != nil || got.ProviderMeta != nil {
+		t.Fatalf("consensus, language and provider meta should be unset: %d %v %v %s", got.ConsensusRuns, got.Agreement, got.Language, got.ProviderMeta)
+	}
+
+	agreement := 0.75
+	if err := store.SaveTranscriptionInfo(job.ID, TranscriptionInfo{FinishReason: "stop", ConsensusRuns: 3, Agreement: &agreement, Language: "de", Flavor: "gfm",
+		ProviderMeta: []byte(`{"id":"chatcmpl-1","model":"gpt-5-2025-08-07"}`)}); err != nil {
+		t.Fatalf("SaveTranscriptionInfo with consensus: %v", err)
+	}
+	got, err = store.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.ConsensusRuns != 3 || got.Agreement == nil || *got.Agreement != 0.75 {
+		t.Fatalf("consensus mismatch: %d %v", got.ConsensusRuns, got.Agreement)
+	}
+	if got.Language == nil || *got.Language != "de" {
+		t.Fatalf("language mismatch: %v", got.Language)
+	}
+	if got.MarkdownFlavor == nil || *got.MarkdownFlavor != "gfm" {
+		t.Fatalf("flavor mismatch: %v", got.MarkdownFlavor)
+	}
+	if string(got.ProviderMeta) != `{"id":"chatcmpl-1","model":"gpt-5-2025-08-07"}` {
+		t.Fatalf("provider meta mismatch: %s", got.ProviderMeta)
+	}
+}
+
+func TestSQLiteStore_MigratesExistingSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// Schema as created by earlier versions, without later columns.
+	if _, err := db.Exec(`CREATE TABLE jobs (
+		id TEXT PRIMARY KEY, image_path TEXT NOT NULL, mime_type TEXT NOT NULL, target_name TEXT NOT NULL,
+		callback_url TEXT, title TEXT, metadata_json TEXT, stage TEXT NOT NULL, error_message TEXT,
+		target_location TEXT, target_commit TEXT, created_at TEXT NOT NULL, started_at TEXT, completed_at TEXT)`); err != nil {
+		t.Fatalf("create old schema: %v", err)
+	}
+	_ = db.Close()
+
+	store, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore on old schema: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if err := store.CreateJob(&Job{ID: "j", ImagePath: "p", MimeType: "image/png", TargetName: "t", Stage: StageQueued}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := store.SaveTranscriptionInfo("j", TranscriptionInfo{FinishReason: "stop"}); err != nil {
+		t.Fatalf("SaveTranscriptionInfo after migration: %v", err)
+	}
+}
+
+func TestSQLiteStore_TranscriptionCache(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	got, err := store.GetCachedTranscription("k")
+	if err != nil || got != nil {
+		t.Fatalf("expected cache miss, got %+v, %v", got, err)
+	}
+	if err := store.PutCachedTranscription("k", CachedTranscription{Markdown: "one", FinishReason: "stop"}); err != nil {
+		t.Fatalf("PutCachedTranscription: %v", err)
+	}
+	if err := store.PutCachedTranscription("k", CachedTranscription{Markdown: "two", Language: "de"}); err != nil {
+		t.Fatalf("PutCachedTranscription replace: %v", err)
+	}
+	got, err = store.GetCachedTranscription("k")
+	if err != nil || got == nil || got.Markdown != "two" || got.FinishReason != "" || got.Language != "de" {
+		t.Fatalf("unexpected cached entry: %+v, %v", got, err)
+	}
+}
+
+func TestSQLiteStore_PurgeAll(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	for _, id := range []string{"a", "b"} {
+		if err := store.CreateJob(&Job{ID: id, Stage: StageQueued, ImagePath: "/tmp/" + id}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+	}
+	if err := store.PutCachedTranscription("k", CachedTranscription{Markdown: "md"}); err != nil {
+		t.Fatalf("PutCachedTranscription: %v", err)
+	}
+	n, err := store.PurgeAll()
+	if err != nil || n != 2 {
+		t.Fatalf("PurgeAll = %d, %v; want 2", n, err)
+	}
+	if j, _ := store.GetJob("a"); j != nil {
+		t.Fatalf("job survived purge: %+v", j)
+	}
+	if c, _ := store.GetCachedTranscription("k"); c != nil {
+		t.Fatalf("cache entry survived purge: %+v", c)
+	}
+}
+
+func TestSQLiteStore_CostSince(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	now := time.Now().UTC()
+	for i, j := range []struct {
+		started time.Duration
+		cost    *float64
+	}{
+		{started: -2 * time.Hour, cost: func() *float64 { v := 4.0; return &v }()},
+		{started: -30 * time.Minute, cost: func() *float64 { v := 1.5; return &v }()},
+		{started: -time.Minute, cost: func() *float64 { v := 0.25; return &v }()},
+		{started: -time.Minute}, // not priced
+	} {
+		id := fmt.Sprintf("job-%d", i)
+		if err := store.CreateJob(&Job{ID: id, Stage: StageQueued, ImagePath: "/tmp/" + id, CreatedAt: now}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		started := now.Add(j.started)
+		if err := store.UpdateStage(id, StageTranscribing, &started); err != nil {
+			t.Fatalf("UpdateStage: %v", err)
+		}
+		if err := store.SaveTranscriptionInfo(id, TranscriptionInfo{EstimatedCost: j.cost}); err != nil {
+			t.Fatalf("SaveTranscriptionInfo: %v", err)
+		}
+	}
+	// A queued job has no start and no cost yet.
+	if err := store.CreateJob(&Job{ID: "queued", Stage: StageQueued, ImagePath: "/tmp/q", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+
+	if total, err := store.CostSince(now.Add(-time.Hour)); err != nil || total != 1.75 {
+		t.Fatalf("CostSince(1h) = %v, %v; want 1.75", total, err)
+	}
+	if total, err := store.CostSince(now.Add(-24 * time.Hour)); err != nil || total != 5.75 {
+		t.Fatalf("CostSince(24h) = %v, %v; want 5.75", total, err)
+	}
+	if got, _ := store.GetJob("job-1"); got.EstimatedCost == nil || *got.EstimatedCost != 1.5 {
+		t.Fatalf("estimated cost = %v", got.EstimatedCost)
+	}
+}
+
+func TestSQLiteStore_Vacuum(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	padding := strings.Repeat("x", 4096)
+	for i := 0; i < 200; i++ {
+		job := &Job{ID: fmt.Sprintf("job-%d", i), ImagePath: "img", MimeType: "image/png", TargetName: "t",
+			Metadata: map[string]any{"padding": padding}, Stage: StageQueued, CreatedAt: time.Now().UTC()}
+		if err := store.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+	}
+	if _, err := store.PurgeAll(); err != nil {
+		t.Fatalf("PurgeAll: %v", err)
+	}
+	res, err := store.Vacuum(true)
+	if err != nil {
+		t.Fatalf("Vacuum: %v", err)
+	}
+	if res.SizeBefore < 200*4096 || res.SizeAfter >= res.SizeBefore/2 {
+		t.Fatalf("vacuum did not reclaim space: %+v", res)
+	}
+
+	// Still usable afterwards.
+	if err := store.CreateJob(&Job{ID: "after", ImagePath: "img", MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("CreateJob after vacuum: %v", err)
+	}
+
+	store.vacuuming.Store(true)
+	if _, err := store.Vacuum(false); !errors.Is(err, ErrVacuumRunning) {
+		t.Fatalf("concurrent vacuum: %v", err)
+	}
+}
+
+func TestSQLiteStore_IdempotencyKeySurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	now := time.Now().UTC()
+	first := &Job{ID: "first", Stage: StageQueued, ImagePath: "/tmp/a", MimeType: "image/png", TargetName: "t", CreatedAt: now}
+	if existing, err := store.CreateJobIdempotent(first, "key", now.Add(time.Hour)); err != nil || existing != nil {
+		t.Fatalf("first create = %v, %v", existing, err)
+	}
+	_ = store.Close()
+
+	// A new store instance on the same database, as after a restart.
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	retry := &Job{ID: "retry", Stage: StageQueued, ImagePath: "/tmp/b", MimeType: "image/png", TargetName: "t", CreatedAt: now.Add(time.Minute)}
+	existing, err := store.CreateJobIdempotent(retry, "key", now.Add(time.Hour))
+	if err != nil || existing == nil || existing.ID != "first" {
+		t.Fatalf("retry after restart = %+v, %v; want the first job", existing, err)
+	}
+	if _, err := store.GetJob("retry"); err == nil {
+		t.Fatalf("duplicate job created")
+	}
+	other := &Job{ID: "other", Stage: StageQueued, ImagePath: "/tmp/c", MimeType: "image/png", TargetName: "t", CreatedAt: now}
+	if existing, err := store.CreateJobIdempotent(other, "other-key", now.Add(time.Minute)); err != nil || existing != nil {
+		t.Fatalf("other key = %v, %v", existing, err)
+	}
+
+	// Once expired the key is free again, released or not.
+	late := &Job{ID: "late", Stage: StageQueued, ImagePath: "/tmp/d", MimeType: "image/png", TargetName: "t", CreatedAt: now.Add(2 * time.Hour)}
+	if existing, err := store.CreateJobIdempotent(late, "key", now.Add(3*time.Hour)); err != nil || existing != nil {
+		t.Fatalf("expired key = %v, %v; want a new job", existing, err)
+	}
+	if n, err := store.ReleaseExpiredIdempotencyKeys(now.Add(2 * time.Hour)); err != nil || n != 1 {
+		t.Fatalf("ReleaseExpiredIdempotencyKeys = %d, %v; want other-key released", n, err)
+	}
+	if j, err := store.GetJob("other"); err != nil || j.ID != "other" {
+		t.Fatalf("releasing a key must keep its job: %v, %v", j, err)
+	}
+}
+
+func TestSQLiteStore_StartJobOnlyWhileQueued(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	now := time.Now().UTC()
+	for _, id := range []string{"queued", "reaped"} {
+		if err := store.CreateJob(&Job{ID: id, ImagePath: "/tmp/x.png", MimeType: "image/png", TargetName: "t", Stage: StageQueued, CreatedAt: now}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+	}
+	_ = store.SaveError("reaped", "stuck", now)
+
+	if ok, err := store.StartJob("queued", StageTranscribing, now); err != nil || !ok {
+		t.Fatalf("StartJob(queued) = %v, %v", ok, err)
+	}
+	if got, _ := store.GetJob("queued"); got.Stage != StageTranscribing || got.StartedAt == nil {
+		t.Fatalf("started job: %+v", got)
+	}
+	// A second item of the same job, or one of a job failed meanwhile, does not start.
+	for _, id := range []string{"queued", "reaped"} {
+		if ok, err := store.StartJob(id, StageTranscribing, now); err != nil || ok {
+			t.Fatalf("StartJob(%s) = %v, %v; want false", id, ok, err)
+		}
+	}
+	if got, _ := store.GetJob("reaped"); got.Stage != StageFailed {
+		t.Fatalf("reaped job restarted: stage = %s", got.Stage)
+	}
+}
+
+func TestSQLiteStore_HeldPostSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	if err := store.CreateJob(&Job{ID: "p", Stage: StageTranscribing, ImagePath: "/tmp/p", CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := store.HoldForPost("p", Review{Markdown: "# Later", Model: "m"}); err != nil {
+		t.Fatalf("HoldForPost: %v", err)
+	}
+	_ = store.Close()
+
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if held, err := store.ListByStages(StagePendingPost); err != nil || len(held) != 1 {
+		t.Fatalf("ListByStages = %+v, %v", held, err)
+	}
+	// A job held for a post window is not a review.
+	if review, err := store.TakeReview("p", StagePosting); err != nil || review != nil {
+		t.Fatalf("TakeReview = %+v, %v; want nil", review, err)
+	}
+	held, err := store.TakeHeldPost("p", StagePosting)
+	if err != nil || held == nil || held.Markdown != "# Later" || held.Model != "m" {
+		t.Fatalf("TakeHeldPost = %+v, %v", held, err)
+	}
+	if again, err := store.TakeHeldPost("p", StagePosting); err != nil || again != nil {
+		t.Fatalf("second TakeHeldPost = %+v, %v; want nil", again, err)
+	}
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Vacuum rebuilds the database file to reclaim the space of deleted rows, e.g. after
+// retention or a purge deleted many jobs. It waits for running bulk deletions and
+// archive moves and holds them off until done; single-row writes wait on the busy
+// timeout. With checkpoint, the write-ahead log is truncated as well (a no-op unless
+// the database is in WAL mode).
+func (s *SQLiteStore) Vacuum(checkpoint bool) (VacuumResult, error) {
+	if !s.vacuuming.CompareAndSwap(false, true) {
+		return VacuumResult{}, ErrVacuumRunning
+	}
+	defer s.vacuuming.Store(false)
+	s.maint.Lock()
+	defer s.maint.Unlock()
+
+	var res VacuumResult
+	var err error
+	if res.SizeBefore, err = s.fileSize(); err != nil {
+		return res, err
+	}
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return res, fmt.Errorf("vacuum: %w", err)
+	}
+	if checkpoint {
+		if _, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+			return res, fmt.Errorf("wal checkpoint: %w", err)
+		}
+	}
+	if res.SizeAfter, err = s.fileSize(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// fileSize returns the size of the database file and its write-ahead log, if any.
+func (s *SQLiteStore) fileSize() (int64, error) {
+	var total int64
+	for _, p := range []string{s.path, s.path + "-wal"} {
+		st, err := os.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("stat database: %w", err)
+		}
+		total += st.Size()
+	}
+	return total, nil
+}
@@ -0,0 +1,100 @@
+// Package langdetect identifies the language of transcribed text with a stopword
+// heuristic and normalizes language answers of LLMs to ISO 639-1 codes.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// names maps the ISO 639-1 codes known to this package to their English names.
+var names = map[string]string{
+	"cs": "Czech", "da": "Danish", "de": "German", "el": "Greek", "en": "English",
+	"es": "Spanish", "fi": "Finnish", "fr": "French", "hu": "Hungarian", "it": "Italian",
+	"ja": "Japanese", "ko": "Korean", "nl": "Dutch", "no": "Norwegian", "pl": "Polish",
+	"pt": "Portuguese", "ro": "Romanian", "ru": "Russian", "sv": "Swedish", "tr": "Turkish",
+	"uk": "Ukrainian", "zh": "Chinese",
+}
+
+// stopwords are frequent function words per language. They are short and common enough
+// to show up in any paragraph, and few of them are shared between the languages.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "for", "this", "are", "was", "on", "be"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "sich", "den", "ein", "eine", "auf", "auch", "zu", "für"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "pour", "dans", "que", "qui", "pas", "sur", "du", "avec"},
+	"es": {"el", "los", "las", "y", "es", "del", "una", "para", "con", "que", "por", "se", "como", "más", "pero"},
+	"it": {"il", "di", "che", "è", "per", "una", "gli", "della", "sono", "con", "non", "del", "anche", "come", "alla"},
+	"nl": {"het", "een", "van", "is", "niet", "dat", "op", "te", "voor", "met", "zijn", "ook", "maar", "wordt", "deze"},
+	"pt": {"o", "os", "as", "e", "do", "da", "uma", "para", "com", "não", "que", "em", "dos", "mais", "por"},
+	"sv": {"och", "att", "det", "är", "som", "på", "för", "med", "inte", "av", "till", "den", "har", "jag", "om"},
+	"pl": {"i", "w", "nie", "się", "na", "że", "jest", "do", "to", "z", "jak", "ale", "po", "czy", "tak"},
+}
+
+// minHits is the number of stopword occurrences required before Detect reports a language.
+const minHits = 3
+
+// Detect returns the ISO 639-1 code of the language text is most likely written in,
+// or "" when the text is too short or ambiguous. Only languages with a stopword list
+// (en, de, fr, es, it, nl, pt, sv, pl) can be detected.
+func Detect(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	counts := make(map[string]int, len(words))
+	for _, w := range words {
+		counts[w]++
+	}
+	best, bestHits, secondHits := "", 0, 0
+	for code, list := range stopwords {
+		hits := 0
+		for _, sw := range list {
+			hits += counts[sw]
+		}
+		if hits > bestHits {
+			best, bestHits, secondHits = code, hits, bestHits
+		} else if hits > secondHits {
+			secondHits = hits
+		}
+	}
+	// A tie means the text is ambiguous; map order must not decide it.
+	if bestHits < minHits || bestHits == secondHits {
+		return ""
+	}
+	return best
+}
+
+// Normalize turns an answer like "de", "DE.", "German" or "de-AT" into a lowercase
+// ISO 639-1 code. It returns "" if the answer is not recognizable as a language.
+func Normalize(answer string) string {
+	s := strings.ToLower(strings.TrimSpace(answer))
+	s = strings.TrimFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i := strings.IndexAny(s, "-_ \n"); i > 0 {
+		s = s[:i]
+	}
+	if len(s) == 2 && isASCIILetters(s) {
+		return s
+	}
+	for code, name := range names {
+		if strings.EqualFold(s, name) {
+			return code
+		}
+	}
+	return ""
+}
+
+// Name returns the English name of code, or code itself if it is not known.
+func Name(code string) string {
+	if n, ok := names[code]; ok {
+		return n
+	}
+	return code
+}
+
+func isASCIILetters(s string) bool {
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package langdetect
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	cases := map[string]string{
+		"en": "# Meeting notes\n\nThe budget for this year is fixed and the team agreed on the plan.",
+		"de": "# Besprechung\n\nDas Budget für dieses Jahr ist fest und die Gruppe hat sich auf den Plan geeinigt.",
+		"fr": "# Réunion\n\nLe budget pour cette année est fixé et les équipes sont d'accord avec la proposition.",
+		"es": "# Reunión\n\nEl presupuesto para este año es fijo y los equipos están de acuerdo con el plan.",
+		"":   "- 12\n- 34\n\nTODO",
+	}
+	for want, text := range cases {
+		if got := Detect(text); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"de":       "de",
+		" DE.\n":   "de",
+		"de-AT":    "de",
+		"German":   "de",
+		"\"pt\"":   "pt",
+		"Klingon":  "",
+		"":         "",
+		"deutsch?": "",
+	}
+	for in, want := range cases {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if Name("fr") != "French" || Name("xx") != "xx" {
+		t.Fatalf("unexpected names %q %q", Name("fr"), Name("xx"))
+	}
+}
@@ -15,7 +15,10 @@ import (
 
 	"github.com/jo-hoe/gostwriter/internal/common"
 	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/langdetect"
 	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/markdown"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
 )
 
 //go:embed default_system_prompt.txt
@@ -24,7 +27,11 @@ var defaultSystemPrompt string
 //go:embed default_instructions.txt
 var defaultInstructions string
 
-var _ llm.Client = (*Client)(nil)
+var (
+	_ llm.Client           = (*Client)(nil)
+	_ llm.ResultClient     = (*Client)(nil)
+	_ llm.LanguageDetector = (*Client)(nil)
+)
 
 const (
 	// Headers
@@ -43,12 +50,16 @@ const (
 	// Timeouts and limits
 	defaultHTTPTimeout = 5 * time.Minute
 	errorSnippetLimit  = 400
+	languageMaxTokens  = 16 // a language code, with room for a stray word
 
 	// Data URL constants
 	dataURLPrefix    = "data:"
 	dataURLBase64Sep = ";base64,"
 )
 
+// LanguagePrompt asks for the language of the image text in a form langdetect.Normalize understands.
+const LanguagePrompt = "Identify the main language of the text in this image. Reply with only its ISO 639-1 code, for example \"en\"."
+
 // Role represents the sender role for a chat message.
 type Role string
 
@@ -76,6 +87,7 @@ type Client struct {
 	instr       string
 	temperature *float32
 	maxTokens   *int
+	examples    []ChatMessage // few-shot turns sent between the system prompt and the image
 }
 
 // New creates a new AI Proxy LLM client.
@@ -89,7 +101,26 @@ func New(cfg config.AIProxySettings) *Client {
 		instr:       cfg.Instructions,
 		temperature: optionalFloat32(cfg.Temperature),
 		maxTokens:   optionalInt(cfg.MaxTokens),
+		examples:    exampleMessages(cfg.FewShotExamples),
+	}
+}
+
+// exampleMessages turns the loaded few-shot examples into user/assistant message pairs:
+// the example image followed by its expected transcription.
+func exampleMessages(examples []config.FewShotExample) []ChatMessage {
+	var msgs []ChatMessage
+	for _, ex := range examples {
+		if len(ex.Image) == 0 {
+			continue
+		}
+		msgs = append(msgs,
+			ChatMessage{Role: RoleUser, Content: []MessagePart{
+				{Type: PartImageURL, ImageURL: &ImageURL{URL: BuildDataURL(ex.MimeType, ex.Image)}},
+			}},
+			ChatMessage{Role: RoleAssistant, Content: ex.Markdown},
+		)
 	}
+	return msgs
 }
 
 func newHTTPClient(timeout time.Duration) *http.Client {
@@ -101,32 +132,104 @@ func newHTTPClient(timeout time.Duration) *http.Client {
 
 // TranscribeImage sends a chat completion request instructing the model to transcribe the image into Markdown.
 func (c *Client) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	res, err := c.TranscribeImageResult(ctx, r, mime, llm.Options{})
+	if err != nil {
+		return "", err
+	}
+	return res.Markdown, nil
+}
+
+// TranscribeImageResult works like TranscribeImage but also reports the finish reason,
+// model and token usage of the completion and honors per-call options.
+func (c *Client) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
 	imgData, err := io.ReadAll(r)
 	if err != nil {
-		return "", fmt.Errorf("read image: %w", err)
+		return llm.Result{}, fmt.Errorf("read image: %w", err)
 	}
 	if len(imgData) == 0 {
-		return "", fmt.Errorf("image is empty")
+		return llm.Result{}, fmt.Errorf("image is empty")
 	}
 
-	dataURL := buildDataURL(mime, imgData)
-	reqBody := c.buildRequestBody(dataURL)
+	comp, err := c.complete(ctx, c.buildRequestBody(BuildDataURL(mime, imgData), opts))
+	if err != nil {
+		return llm.Result{}, err
+	}
+	if len(comp.Choices) == 0 || comp.Choices[0].Message.Content == "" {
+		return llm.Result{}, fmt.Errorf("empty completion")
+	}
+	res := llm.Result{
+		Markdown:     comp.Choices[0].Message.Content,
+		FinishReason: comp.Choices[0].FinishReason,
+		Model:        comp.Model,
+	}
+	if res.Model == "" {
+		res.Model = c.model
+		if opts.Model != "" {
+			res.Model = opts.Model
+		}
+	}
+	res.Usage = comp.TokenUsage()
+	res.Meta = &llm.ProviderMeta{
+		ID:                comp.ID,
+		Model:             comp.Model,
+		FinishReason:      res.FinishReason,
+		Created:           comp.Created,
+		SystemFingerprint: comp.SystemFingerprint,
+	}
+	return res, nil
+}
+
+// DetectLanguage asks the model for the ISO 639-1 code of the main language of the text
+// in the image. The request uses a short fixed prompt and a small token budget.
+func (c *Client) DetectLanguage(ctx context.Context, r io.Reader, mime string) (string, llm.Usage, error) {
+	imgData, err := io.ReadAll(r)
+	if err != nil {
+		return "", llm.Usage{}, fmt.Errorf("read image: %w", err)
+	}
+	if len(imgData) == 0 {
+		return "", llm.Usage{}, fmt.Errorf("image is empty")
+	}
+	prompt := LanguagePrompt
+	req := ChatCompletionRequest{
+		Model: c.model,
+		Messages: []ChatMessage{{
+			Role: RoleUser,
+			Content: []MessagePart{
+				{Type: PartText, Text: &prompt},
+				{Type: PartImageURL, ImageURL: &ImageURL{URL: BuildDataURL(mime, imgData)}},
+			},
+		}},
+		MaxTokens: optionalInt(languageMaxTokens),
+	}
+	comp, err := c.complete(ctx, req)
+	if err != nil {
+		return "", llm.Usage{}, err
+	}
+	if len(comp.Choices) == 0 {
+		return "", comp.TokenUsage(), nil
+	}
+	return langdetect.Normalize(comp.Choices[0].Message.Content), comp.TokenUsage(), nil
+}
 
+// complete sends a chat completion request and decodes the response.
+func (c *Client) complete(ctx context.Context, reqBody ChatCompletionRequest) (ChatCompletionResponse, error) {
+	var comp ChatCompletionResponse
 	u, err := url.JoinPath(c.baseURL, endpointChatCompletions)
 	if err != nil {
-		return "", fmt.Errorf("join url: %w", err)
+		return comp, fmt.Errorf("join url: %w", err)
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return comp, fmt.Errorf("marshal request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(bodyBytes))
 	if err != nil {
-		return "", fmt.Errorf("new request: %w", err)
+		return comp, fmt.Errorf("new request: %w", err)
 	}
 	req.Header.Set(headerContentType, common.ContentTypeJSON)
+	tracing.Inject(ctx, req.Header)
 	if strings.TrimSpace(c.apiKey) != "" {
 		req.Header.Set(headerAuthorization, authSchemeBearer+" "+c.apiKey)
 	}
@@ -134,53 +237,51 @@ func (c *Client) TranscribeImage(ctx context.Context, r io.Reader, mime string)
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
-			return "", ctx.Err()
+			return comp, ctx.Err()
 		}
-		return "", fmt.Errorf("http do: %w", err)
+		return comp, llm.Transient(fmt.Errorf("http do: %w", err))
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	respBytes, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return "", fmt.Errorf("aiproxy status %d: %s", resp.StatusCode, truncate(string(respBytes), errorSnippetLimit))
+		err := fmt.Errorf("aiproxy status %d: %s", resp.StatusCode, truncate(string(respBytes), errorSnippetLimit))
+		if llm.IsTransientStatus(resp.StatusCode) {
+			err = llm.Transient(err)
+		}
+		return comp, err
 	}
 
-	var comp chatCompletionResponse
 	if err := json.Unmarshal(respBytes, &comp); err != nil {
-		return "", fmt.Errorf("parse response: %w", err)
-	}
-	if len(comp.Choices) == 0 || comp.Choices[0].Message.Content == "" {
-		return "", fmt.Errorf("empty completion")
+		return comp, fmt.Errorf("parse response: %w", err)
 	}
-	return comp.Choices[0].Message.Content, nil
+	return comp, nil
 }
 
-func (c *Client) buildRequestBody(imageDataURL string) chatCompletionRequest {
-	sys := strings.TrimSpace(c.system)
-	if sys == "" {
-		sys = defaultSystemPrompt
-	}
-	instructions := strings.TrimSpace(c.instr)
-	if instructions == "" {
-		instructions = defaultInstructions
-	}
-
-	msgs := []chatMessage{
-		{
-			Role:    RoleSystem,
-			Content: sys,
-		},
-		{
-			Role: RoleUser,
-			Content: []messagePart{
-				{Type: PartText, Text: &instructions},
-				{Type: PartImageURL, ImageURL: &imageURL{URL: imageDataURL}},
-			},
+func (c *Client) buildRequestBody(imageDataURL string, opts llm.Options) ChatCompletionRequest {
+	sys := SystemPrompt(c.system)
+	instructions := Instructions(c.instr, opts)
+
+	msgs := make([]ChatMessage, 0, len(c.examples)+2)
+	msgs = append(msgs, ChatMessage{
+		Role:    RoleSystem,
+		Content: sys,
+	})
+	msgs = append(msgs, c.examples...)
+	msgs = append(msgs, ChatMessage{
+		Role: RoleUser,
+		Content: []MessagePart{
+			{Type: PartText, Text: &instructions},
+			{Type: PartImageURL, ImageURL: &ImageURL{URL: imageDataURL}},
 		},
-	}
+	})
 
-	req := chatCompletionRequest{
-		Model:    c.model,
+	model := c.model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	req := ChatCompletionRequest{
+		Model:    model,
 		Messages: msgs,
 		Stream:   false,
 	}
@@ -190,11 +291,44 @@ func (c *Client) buildRequestBody(imageDataURL string) chatCompletionRequest {
 	if c.maxTokens != nil {
 		req.MaxTokens = c.maxTokens
 	}
+	if opts.MaxTokens > 0 {
+		req.MaxTokens = optionalInt(opts.MaxTokens)
+	}
 	return req
 }
 
-func buildDataURL(mime string, data []byte) string {
-	mt := strings.TrimSpace(mime)
+// SystemPrompt returns custom, or the built-in transcription system prompt if it is blank.
+func SystemPrompt(custom string) string {
+	if sys := strings.TrimSpace(custom); sys != "" {
+		return sys
+	}
+	return defaultSystemPrompt
+}
+
+// Instructions returns the user instructions for a transcription: those of opts, else
+// custom, else the built-in ones, followed by the language and flavor requested by opts.
+func Instructions(custom string, opts llm.Options) string {
+	instructions := strings.TrimSpace(opts.Instructions)
+	if instructions == "" {
+		instructions = strings.TrimSpace(custom)
+	}
+	if instructions == "" {
+		instructions = defaultInstructions
+	}
+	if opts.Language != "" {
+		// Keep the output in the document language instead of letting the model translate.
+		name := langdetect.Name(opts.Language)
+		instructions += fmt.Sprintf("\n\nThe text in the image is written in %s. Transcribe it in %s; do not translate it.", name, name)
+	}
+	if s := markdown.Flavor(opts.Flavor).Instructions(); s != "" {
+		instructions += "\n\n" + s
+	}
+	return instructions
+}
+
+// BuildDataURL encodes data as a base64 data URL of the given mime type.
+func BuildDataURL(mime string, data []byte) string {
+	mt := llm.NormalizeMime(mime)
 	if mt == "" {
 		mt = contentTypeOctetStream
 	}
@@ -223,11 +357,12 @@ func truncate(s string, n int) string {
 	return s[:n] + "..."
 }
 
-// OpenAI-compatible Chat Completions request/response types
+// OpenAI-compatible Chat Completions request/response types, shared with the openai provider.
 
-type chatCompletionRequest struct {
+// ChatCompletionRequest is the body of a chat completion request.
+type ChatCompletionRequest struct {
 	Model       string        `json:"model"`
-	Messages    []chatMessage `json:"messages"`
+	Messages    []ChatMessage `json:"messages"`
 	Temperature *float32      `json:"temperature,omitempty"`
 	MaxTokens   *int          `json:"max_tokens,omitempty"`
 	Stream      bool          `json:"stream,omitempty"`
@@ -235,43 +370,65 @@ type chatCompletionRequest struct {
 	ResponseFmt any           `json:"response_format,omitempty"`
 }
 
-type chatMessage struct {
+// ChatMessage is a message of a chat completion request.
+type ChatMessage struct {
 	Role    Role   `json:"role"`
-	Content any    `json:"content"` // string or []messagePart
+	Content any    `json:"content"` // string or []MessagePart
 	Name    string `json:"name,omitempty"`
 }
 
-type messagePart struct {
+// MessagePart is a text or image part of a multimodal message.
+type MessagePart struct {
 	Type     PartType  `json:"type"`                // "text" | "image_url"
 	Text     *string   `json:"text,omitempty"`      // when Type == "text"
-	ImageURL *imageURL `json:"image_url,omitempty"` // when Type == "image_url"
+	ImageURL *ImageURL `json:"image_url,omitempty"` // when Type == "image_url"
 }
 
-type imageURL struct {
+// ImageURL references an image, usually as a data URL.
+type ImageURL struct {
 	URL    string  `json:"url"`
 	Detail *string `json:"detail,omitempty"`
 }
 
-type chatCompletionResponse struct {
-	ID      string                 `json:"id"`
-	Object  string                 `json:"object"`
-	Created int64                  `json:"created"`
-	Choices []chatCompletionChoice `json:"choices"`
-	Usage   *chatCompletionUsage   `json:"usage,omitempty"`
+// ChatCompletionResponse is the body of a chat completion response.
+type ChatCompletionResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model,omitempty"`
+	// SystemFingerprint identifies the backend configuration that served the request.
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+	Choices           []ChatCompletionChoice `json:"choices"`
+	Usage             *ChatCompletionUsage   `json:"usage,omitempty"`
+}
+
+// TokenUsage converts the reported token usage; zero if the provider sent none.
+func (r ChatCompletionResponse) TokenUsage() llm.Usage {
+	if r.Usage == nil {
+		return llm.Usage{}
+	}
+	return llm.Usage{
+		PromptTokens:     r.Usage.PromptTokens,
+		CompletionTokens: r.Usage.CompletionTokens,
+		TotalTokens:      r.Usage.TotalTokens,
+	}
 }
 
-type chatCompletionChoice struct {
-	Index        int         `json:"index"`
-	Message      responseMsg `json:"message"`
-	FinishReason string      `json:"finish_reason"`
+// ChatCompletionChoice is one completion of a response.
+type ChatCompletionChoice struct {
+	Index        int             `json:"index"`
+	Message      ResponseMessage `json:"message"`
+	FinishReason string          `json:"finish_reason"`
 }
 
-type responseMsg struct {
+// ResponseMessage is the message of a completion.
+type ResponseMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
 
-type chatCompletionUsage struct {
+// ChatCompletionUsage is the token usage reported with a response.
+type ChatCompletionUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
@@ -3,19 +3,26 @@ package aiproxy
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/markdown"
 )
 
 func TestAIProxy_TranscribeImage_Success(t *testing.T) {
 	var seenAuth string
-	var seenBody chatCompletionRequest
+	var seenBody ChatCompletionRequest
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		seenAuth = r.Header.Get("Authorization")
@@ -28,14 +35,14 @@ func TestAIProxy_TranscribeImage_Success(t *testing.T) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		resp := chatCompletionResponse{
+		resp := ChatCompletionResponse{
 			ID:      "id-123",
 			Object:  "chat.completion",
 			Created: time.Now().Unix(),
-			Choices: []chatCompletionChoice{
+			Choices: []ChatCompletionChoice{
 				{
 					Index: 0,
-					Message: responseMsg{
+					Message: ResponseMessage{
 						Role:    "assistant",
 						Content: "Hello Markdown",
 					},
@@ -79,7 +86,7 @@ func TestAIProxy_TranscribeImage_Success(t *testing.T) {
 	if seenBody.Messages[0].Role != "system" || seenBody.Messages[0].Content.(string) != "System X" {
 		t.Fatalf("system prompt not set correctly: %+v", seenBody.Messages[0])
 	}
-	// user content is []messagePart (marshalled as []any). Check first part is text with our instructions.
+	// user content is []MessagePart (marshalled as []any). Check first part is text with our instructions.
 	userParts, ok := seenBody.Messages[1].Content.([]any)
 	if !ok || len(userParts) == 0 {
 		t.Fatalf("user content not array of parts: %#v", seenBody.Messages[1].Content)
@@ -108,6 +115,73 @@ func TestAIProxy_TranscribeImage_Non200(t *testing.T) {
 	}
 }
 
+func TestAIProxy_TranscribeImage_NormalizesJPGMime(t *testing.T) {
+	var seenBody ChatCompletionRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&seenBody)
+		_ = json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Choices: []ChatCompletionChoice{{Message: ResponseMessage{Role: "assistant", Content: "md"}, FinishReason: "stop"}},
+		})
+	}))
+	defer ts.Close()
+
+	c := New(config.AIProxySettings{BaseURL: ts.URL, Model: "gpt-5"})
+	if _, err := c.TranscribeImage(context.Background(), bytes.NewBufferString("jpegdata"), "image/jpg"); err != nil {
+		t.Fatalf("TranscribeImage: %v", err)
+	}
+	parts, _ := seenBody.Messages[1].Content.([]any)
+	var url string
+	for _, p := range parts {
+		if m, ok := p.(map[string]any); ok && m["type"] == "image_url" {
+			url, _ = m["image_url"].(map[string]any)["url"].(string)
+		}
+	}
+	if !strings.HasPrefix(url, "data:image/jpeg;base64,") {
+		t.Fatalf("expected an image/jpeg data URL, got %.40q", url)
+	}
+}
+
+func TestBuildRequestBody_Overrides(t *testing.T) {
+	c := New(config.AIProxySettings{Model: "gpt-5", Instructions: "configured"})
+	req := c.buildRequestBody("data:image/png;base64,QQ==", llm.Options{Model: "gpt-5-mini", Instructions: "only the headings"})
+	if req.Model != "gpt-5-mini" {
+		t.Fatalf("model = %q, want the override", req.Model)
+	}
+	if parts := req.Messages[1].Content.([]MessagePart); *parts[0].Text != "only the headings" {
+		t.Fatalf("instructions = %q, want the override", *parts[0].Text)
+	}
+	if req := c.buildRequestBody("data:image/png;base64,QQ==", llm.Options{}); req.Model != "gpt-5" {
+		t.Fatalf("model without override = %q", req.Model)
+	}
+}
+
+func TestBuildRequestBody_FewShotExamples(t *testing.T) {
+	c := New(config.AIProxySettings{Model: "gpt-5", FewShotExamples: []config.FewShotExample{
+		{ImagePath: "ex1.png", Markdown: "# Example one", Image: []byte("png1"), MimeType: "image/png"},
+		{ImagePath: "ex2.jpg", Markdown: "- item", Image: []byte("jpg2"), MimeType: "image/jpeg"},
+	}})
+	msgs := c.buildRequestBody("data:image/png;base64,QQ==", llm.Options{}).Messages
+
+	wantRoles := []Role{RoleSystem, RoleUser, RoleAssistant, RoleUser, RoleAssistant, RoleUser}
+	if len(msgs) != len(wantRoles) {
+		t.Fatalf("expected %d messages, got %d", len(wantRoles), len(msgs))
+	}
+	for i, m := range msgs {
+		if m.Role != wantRoles[i] {
+			t.Fatalf("message %d has role %q, want %q", i, m.Role, wantRoles[i])
+		}
+	}
+	if parts := msgs[3].Content.([]MessagePart); parts[0].ImageURL.URL != "data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString([]byte("jpg2")) {
+		t.Fatalf("unexpected example image %q", parts[0].ImageURL.URL)
+	}
+	if msgs[2].Content != "# Example one" || msgs[4].Content != "- item" {
+		t.Fatalf("unexpected example answers %v, %v", msgs[2].Content, msgs[4].Content)
+	}
+	if parts := msgs[5].Content.([]MessagePart); parts[1].ImageURL.URL != "data:image/png;base64,QQ==" {
+		t.Fatalf("the image to transcribe must come last, got %+v", parts)
+	}
+}
+
 func TestAIProxy_TranscribeImage_EmptyImage(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Fatalf("server should not be called for empty image")
@@ -151,3 +225,154 @@ func TestAIProxy_TranscribeImage_ContextCancel(t *testing.T) {
 		t.Fatalf("server was not invoked; test invalid")
 	}
 }
+
+func TestAIProxy_TranscribeImage_ClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body) // lets the server notice the client hanging up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	c := New(config.AIProxySettings{BaseURL: ts.URL, Model: "gpt-5", Timeout: 50 * time.Millisecond})
+	ctx := context.Background()
+	_, err := c.TranscribeImage(ctx, bytes.NewBuffer([]byte("data")), "image/png")
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a client timeout error, got %v", err)
+	}
+	if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+		t.Fatalf("timeout must not look like a cancelled job: %v", err)
+	}
+}
+
+func TestAIProxy_TranscribeImageResult_FinishReasonAndMaxTokens(t *testing.T) {
+	var seenBody ChatCompletionRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&seenBody)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Choices: []ChatCompletionChoice{
+				{Message: ResponseMessage{Role: "assistant", Content: "partial"}, FinishReason: "length"},
+			},
+		})
+	}))
+	defer ts.Close()
+
+	c := New(config.AIProxySettings{BaseURL: ts.URL, Model: "gpt-5", MaxTokens: 100})
+
+	res, err := c.TranscribeImageResult(context.Background(), bytes.NewBufferString("img"), "image/png", llm.Options{MaxTokens: 400})
+	if err != nil {
+		t.Fatalf("TranscribeImageResult error: %v", err)
+	}
+	if res.Markdown != "partial" || res.FinishReason != llm.FinishReasonLength {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if seenBody.MaxTokens == nil || *seenBody.MaxTokens != 400 {
+		t.Fatalf("expected max_tokens override 400, got %v", seenBody.MaxTokens)
+	}
+}
+
+func TestAIProxy_TranscribeImageResult_ModelAndUsage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:                "chatcmpl-123",
+			Created:           1754524800,
+			Model:             "gpt-5-2025-08-07",
+			SystemFingerprint: "fp_abc",
+			Choices:           []ChatCompletionChoice{{Message: ResponseMessage{Role: "assistant", Content: "md"}, FinishReason: "stop"}},
+			Usage:             &ChatCompletionUsage{PromptTokens: 1000, CompletionTokens: 234, TotalTokens: 1234},
+		})
+	}))
+	defer ts.Close()
+
+	c := New(config.AIProxySettings{BaseURL: ts.URL, Model: "gpt-5"})
+	res, err := c.TranscribeImageResult(context.Background(), bytes.NewBufferString("img"), "image/png", llm.Options{})
+	if err != nil {
+		t.Fatalf("TranscribeImageResult error: %v", err)
+	}
+	if res.Model != "gpt-5-2025-08-07" {
+		t.Fatalf("model = %q", res.Model)
+	}
+	if res.Usage != (llm.Usage{PromptTokens: 1000, CompletionTokens: 234, TotalTokens: 1234}) {
+		t.Fatalf("usage = %+v", res.Usage)
+	}
+	want := llm.ProviderMeta{ID: "chatcmpl-123", Model: "gpt-5-2025-08-07", FinishReason: "stop", Created: 1754524800, SystemFingerprint: "fp_abc"}
+	if res.Meta == nil || *res.Meta != want {
+		t.Fatalf("meta = %+v, want %+v", res.Meta, want)
+	}
+}
+
+func TestAIProxy_DetectLanguageAndLanguageOption(t *testing.T) {
+	var prompts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+			MaxTokens *int `json:"max_tokens"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		var parts []MessagePart
+		_ = json.Unmarshal(req.Messages[len(req.Messages)-1].Content, &parts)
+		prompts = append(prompts, *parts[0].Text)
+		answer := "md"
+		if req.MaxTokens != nil && *req.MaxTokens == languageMaxTokens {
+			answer = "DE."
+		}
+		_ = json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Choices: []ChatCompletionChoice{{Message: ResponseMessage{Role: "assistant", Content: answer}}},
+			Usage:   &ChatCompletionUsage{TotalTokens: 5},
+		})
+	}))
+	defer ts.Close()
+
+	c := New(config.AIProxySettings{BaseURL: ts.URL, Model: "gpt-5"})
+	lang, usage, err := c.DetectLanguage(context.Background(), bytes.NewBufferString("img"), "image/png")
+	if err != nil {
+		t.Fatalf("DetectLanguage error: %v", err)
+	}
+	if lang != "de" || usage.TotalTokens != 5 {
+		t.Fatalf("lang = %q, usage = %+v", lang, usage)
+	}
+	if prompts[0] != LanguagePrompt {
+		t.Fatalf("unexpected detection prompt %q", prompts[0])
+	}
+
+	if _, err := c.TranscribeImageResult(context.Background(), bytes.NewBufferString("img"), "image/png", llm.Options{Language: "de"}); err != nil {
+		t.Fatalf("TranscribeImageResult error: %v", err)
+	}
+	if !strings.HasSuffix(prompts[1], "written in German. Transcribe it in German; do not translate it.") {
+		t.Fatalf("language not injected into the instructions: %q", prompts[1])
+	}
+}
+
+func TestAIProxy_FlavorOption(t *testing.T) {
+	var prompt string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		var parts []MessagePart
+		_ = json.Unmarshal(req.Messages[len(req.Messages)-1].Content, &parts)
+		prompt = *parts[0].Text
+		_ = json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Choices: []ChatCompletionChoice{{Message: ResponseMessage{Role: "assistant", Content: "md"}}},
+		})
+	}))
+	defer ts.Close()
+
+	c := New(config.AIProxySettings{BaseURL: ts.URL, Model: "gpt-5", Instructions: "Transcribe."})
+	if _, err := c.TranscribeImageResult(context.Background(), bytes.NewBufferString("img"), "image/png", llm.Options{Flavor: "gfm"}); err != nil {
+		t.Fatalf("TranscribeImageResult error: %v", err)
+	}
+	if want := "Transcribe.\n\n" + markdown.FlavorGFM.Instructions(); prompt != want {
+		t.Fatalf("prompt = %q, want %q", prompt, want)
+	}
+}
@@ -0,0 +1,246 @@
+// Package anthropic implements llm.Client against the Anthropic Messages API.
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/llm/aiproxy"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+)
+
+var (
+	_ llm.Client       = (*Client)(nil)
+	_ llm.ResultClient = (*Client)(nil)
+)
+
+const (
+	headerAPIKey      = "x-api-key"
+	headerVersion     = "anthropic-version"
+	headerContentType = "Content-Type"
+
+	// APIVersion is the Messages API version the client speaks.
+	APIVersion = "2023-06-01"
+	// DefaultBaseURL is the API root, without the version path.
+	DefaultBaseURL = "https://api.anthropic.com"
+	// DefaultMaxTokens is used when no max tokens are configured; the API requires a value.
+	DefaultMaxTokens = 4096
+
+	endpointMessages = "v1/messages"
+
+	// stopReasonMaxTokens is reported when the output was cut off by max_tokens.
+	stopReasonMaxTokens = "max_tokens"
+
+	defaultHTTPTimeout = 5 * time.Minute
+	errorSnippetLimit  = 400
+)
+
+// Client implements llm.Client by calling the Anthropic Messages API.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	model      string
+	maxTokens  int
+}
+
+// New creates a new Anthropic LLM client.
+func New(cfg config.AnthropicSettings) *Client {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+	c := &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:     strings.TrimSpace(cfg.APIKey),
+		model:      cfg.Model,
+		maxTokens:  cfg.MaxTokens,
+	}
+	if c.baseURL == "" {
+		c.baseURL = DefaultBaseURL
+	}
+	if c.maxTokens == 0 {
+		c.maxTokens = DefaultMaxTokens
+	}
+	return c
+}
+
+// TranscribeImage asks the model to transcribe the image into Markdown.
+func (c *Client) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	res, err := c.TranscribeImageResult(ctx, r, mime, llm.Options{})
+	if err != nil {
+		return "", err
+	}
+	return res.Markdown, nil
+}
+
+// TranscribeImageResult works like TranscribeImage but also reports the stop reason,
+// model and token usage of the message and honors per-call options. A message cut off
+// by max_tokens is reported with llm.FinishReasonLength.
+func (c *Client) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return llm.Result{}, fmt.Errorf("read image: %w", err)
+	}
+	if len(data) == 0 {
+		return llm.Result{}, fmt.Errorf("image is empty")
+	}
+	req := messagesRequest{
+		Model:     c.model,
+		MaxTokens: c.maxTokens,
+		System:    aiproxy.SystemPrompt(""),
+		Messages: []message{{
+			Role: "user",
+			Content: []contentBlock{
+				{Type: "image", Source: &imageSource{Type: "base64", MediaType: llm.NormalizeMime(mime), Data: base64.StdEncoding.EncodeToString(data)}},
+				{Type: "text", Text: aiproxy.Instructions("", opts)},
+			},
+		}},
+	}
+	if opts.Model != "" {
+		req.Model = opts.Model
+	}
+	if opts.MaxTokens > 0 {
+		req.MaxTokens = opts.MaxTokens
+	}
+
+	msg, err := c.send(ctx, req)
+	if err != nil {
+		return llm.Result{}, err
+	}
+	if len(msg.Content) == 0 || msg.Content[0].Text == "" {
+		return llm.Result{}, fmt.Errorf("empty completion")
+	}
+	res := llm.Result{
+		Markdown:     msg.Content[0].Text,
+		FinishReason: msg.StopReason,
+		Model:        msg.Model,
+		Usage: llm.Usage{
+			PromptTokens:     msg.Usage.InputTokens,
+			CompletionTokens: msg.Usage.OutputTokens,
+			TotalTokens:      msg.Usage.InputTokens + msg.Usage.OutputTokens,
+		},
+	}
+	if res.FinishReason == stopReasonMaxTokens {
+		res.FinishReason = llm.FinishReasonLength
+	}
+	if res.Model == "" {
+		res.Model = req.Model
+	}
+	res.Meta = &llm.ProviderMeta{ID: msg.ID, Model: msg.Model, FinishReason: res.FinishReason}
+	return res, nil
+}
+
+// send posts a Messages API request and decodes the response.
+func (c *Client) send(ctx context.Context, reqBody messagesRequest) (messagesResponse, error) {
+	var msg messagesResponse
+	u, err := url.JoinPath(c.baseURL, endpointMessages)
+	if err != nil {
+		return msg, fmt.Errorf("join url: %w", err)
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return msg, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return msg, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set(headerContentType, common.ContentTypeJSON)
+	req.Header.Set(headerAPIKey, c.apiKey)
+	req.Header.Set(headerVersion, APIVersion)
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return msg, ctx.Err()
+		}
+		return msg, llm.Transient(fmt.Errorf("http do: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		err := statusError(resp.StatusCode, respBytes)
+		if llm.IsTransientStatus(resp.StatusCode) {
+			err = llm.Transient(err)
+		}
+		return msg, err
+	}
+	if err := json.Unmarshal(respBytes, &msg); err != nil {
+		return msg, fmt.Errorf("parse response: %w", err)
+	}
+	return msg, nil
+}
+
+// statusError describes a non-2xx response, using the error type and message of the
+// Anthropic error body when it has one.
+func statusError(status int, body []byte) error {
+	var e errorResponse
+	if err := json.Unmarshal(body, &e); err == nil && e.Error.Message != "" {
+		return fmt.Errorf("anthropic status %d: %s: %s", status, e.Error.Type, e.Error.Message)
+	}
+	snippet := string(body)
+	if len(snippet) > errorSnippetLimit {
+		snippet = snippet[:errorSnippetLimit] + "..."
+	}
+	return fmt.Errorf("anthropic status %d: %s", status, snippet)
+}
+
+// Messages API request/response types
+
+type messagesRequest struct {
+	Model     string    `json:"model"`
+	MaxTokens int       `json:"max_tokens"`
+	System    string    `json:"system,omitempty"`
+	Messages  []message `json:"messages"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type   string       `json:"type"`             // "text" | "image"
+	Text   string       `json:"text,omitempty"`   // when Type == "text"
+	Source *imageSource `json:"source,omitempty"` // when Type == "image"
+}
+
+type imageSource struct {
+	Type      string `json:"type"` // "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type messagesResponse struct {
+	ID         string         `json:"id"`
+	Model      string         `json:"model"`
+	Content    []contentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+type errorResponse struct {
+	Type  string `json:"type"` // "error"
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
@@ -0,0 +1,66 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+)
+
+func TestAnthropic_TranscribeImageResult(t *testing.T) {
+	var seenPath, seenKey, seenVersion string
+	var seenBody messagesRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenPath = r.URL.Path
+		seenKey = r.Header.Get("x-api-key")
+		seenVersion = r.Header.Get("anthropic-version")
+		if err := json.NewDecoder(r.Body).Decode(&seenBody); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","model":"claude-x","content":[{"type":"text","text":"# Notes"}],"stop_reason":"max_tokens","usage":{"input_tokens":10,"output_tokens":5}}`))
+	}))
+	defer ts.Close()
+	c := New(config.AnthropicSettings{APIKey: "key-1", Model: "claude-x", BaseURL: ts.URL})
+
+	res, err := c.TranscribeImageResult(context.Background(), bytes.NewReader([]byte("A")), "image/png", llm.Options{})
+	if err != nil {
+		t.Fatalf("TranscribeImageResult: %v", err)
+	}
+	if res.Markdown != "# Notes" || res.FinishReason != llm.FinishReasonLength || res.Usage.TotalTokens != 15 || res.Meta.ID != "msg_1" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if seenPath != "/v1/messages" || seenKey != "key-1" || seenVersion != APIVersion {
+		t.Fatalf("path = %q, key = %q, version = %q", seenPath, seenKey, seenVersion)
+	}
+	if seenBody.Model != "claude-x" || seenBody.MaxTokens != DefaultMaxTokens || seenBody.System == "" {
+		t.Fatalf("unexpected request: model %q, max tokens %d, system %q", seenBody.Model, seenBody.MaxTokens, seenBody.System)
+	}
+	if len(seenBody.Messages) != 1 || len(seenBody.Messages[0].Content) != 2 {
+		t.Fatalf("unexpected messages: %+v", seenBody.Messages)
+	}
+	img := seenBody.Messages[0].Content[0]
+	if img.Type != "image" || img.Source == nil || *img.Source != (imageSource{Type: "base64", MediaType: "image/png", Data: "QQ=="}) {
+		t.Fatalf("unexpected image block: %+v", img)
+	}
+}
+
+func TestAnthropic_ErrorResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+	}))
+	defer ts.Close()
+	c := New(config.AnthropicSettings{APIKey: "key-1", Model: "claude-x", BaseURL: ts.URL})
+
+	_, err := c.TranscribeImage(context.Background(), bytes.NewReader([]byte("img")), "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "anthropic status 429: rate_limit_error: slow down") {
+		t.Fatalf("expected anthropic error, got %v", err)
+	}
+}
@@ -2,12 +2,128 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
 )
 
+// FinishReasonLength is reported by providers when the output was cut off by the token limit.
+const FinishReasonLength = "length"
+
+// TransientError marks failures that may succeed when the transcription is retried, e.g.
+// network errors, rate limits and server errors. Providers wrap it with Transient.
+var TransientError = errors.New("transient llm error")
+
+// Transient wraps err so that errors.Is(err, TransientError) holds. The message of err
+// is kept unchanged. Transient(nil) is nil.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err: err}
+}
+
+type transientError struct{ err error }
+
+func (e transientError) Error() string   { return e.err.Error() }
+func (e transientError) Unwrap() []error { return []error{e.err, TransientError} }
+
+// IsTransientStatus reports whether a provider response with the HTTP status code is
+// worth retrying: request timeouts, rate limits and server errors.
+func IsTransientStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
 // Client defines the capability to transcribe an image into Markdown.
 type Client interface {
 	// TranscribeImage reads an image from r (seek not required) with the given mime type
 	// and returns a Markdown string.
 	TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error)
 }
+
+// Result is a transcription together with details reported by the provider.
+type Result struct {
+	Markdown     string
+	FinishReason string        // e.g. "stop" or "length"; empty if the provider does not report it
+	Model        string        // model that produced the output; empty if unknown
+	Usage        Usage         // tokens consumed; zero if the provider does not report it
+	Meta         *ProviderMeta // response metadata as reported by the provider; nil if unknown
+}
+
+// ProviderMeta is the non-content metadata of a completion response. It records which
+// model and version actually served a request, as providers may route to another model.
+type ProviderMeta struct {
+	ID                string `json:"id,omitempty"`
+	Model             string `json:"model,omitempty"`
+	FinishReason      string `json:"finish_reason,omitempty"`
+	Created           int64  `json:"created,omitempty"` // Unix seconds
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+}
+
+// Usage is the token consumption of one or more LLM calls.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// Add returns the sum of u and o.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + o.PromptTokens,
+		CompletionTokens: u.CompletionTokens + o.CompletionTokens,
+		TotalTokens:      u.TotalTokens + o.TotalTokens,
+	}
+}
+
+// Options adjusts a single transcription call.
+type Options struct {
+	MaxTokens int    // overrides the configured max tokens when > 0
+	Language  string // ISO 639-1 code of the document language to transcribe in; empty lets the model decide
+	Flavor    string // Markdown flavor to write (commonmark, gfm, mdx); empty uses plain Markdown
+	// Model and Instructions override the configured model and user instructions when
+	// not empty, e.g. to compare them on the same image.
+	Model        string
+	Instructions string
+}
+
+// ResultClient is implemented by clients that report provider details alongside
+// the transcription and accept per-call options.
+type ResultClient interface {
+	TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts Options) (Result, error)
+}
+
+// LanguageDetector is implemented by clients that can identify the language of the text
+// in an image with a short request ahead of the transcription.
+type LanguageDetector interface {
+	// DetectLanguage returns the ISO 639-1 code of the main language, or "" if the model
+	// gives no recognizable answer, together with the tokens spent.
+	DetectLanguage(ctx context.Context, r io.Reader, mime string) (string, Usage, error)
+}
+
+// NormalizeMime returns the canonical form of an image MIME type: lower case, and the
+// non-standard image/jpg (accepted on upload) as image/jpeg, which some providers require.
+func NormalizeMime(mime string) string {
+	m := strings.ToLower(strings.TrimSpace(mime))
+	if m == common.MimeImageJPG {
+		return common.MimeImageJPEG
+	}
+	return m
+}
+
+// Transcribe uses ResultClient when c implements it and falls back to Client.TranscribeImage otherwise.
+// The MIME type is normalized with NormalizeMime.
+func Transcribe(ctx context.Context, c Client, r io.Reader, mime string, opts Options) (Result, error) {
+	mime = NormalizeMime(mime)
+	if rc, ok := c.(ResultClient); ok {
+		return rc.TranscribeImageResult(ctx, r, mime, opts)
+	}
+	md, err := c.TranscribeImage(ctx, r, mime)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Markdown: md}, nil
+}
@@ -0,0 +1,235 @@
+// Package openai implements llm.Client against the OpenAI Chat Completions API.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/langdetect"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/llm/aiproxy"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+)
+
+var (
+	_ llm.Client           = (*Client)(nil)
+	_ llm.ResultClient     = (*Client)(nil)
+	_ llm.LanguageDetector = (*Client)(nil)
+)
+
+const (
+	headerAuthorization = "Authorization"
+	headerOrganization  = "OpenAI-Organization"
+	headerContentType   = "Content-Type"
+
+	// DefaultBaseURL is the API root, including the version path.
+	DefaultBaseURL = "https://api.openai.com/v1"
+	// DefaultModel is used when no model is configured.
+	DefaultModel = "gpt-4o"
+
+	endpointChatCompletions = "chat/completions" // relative to the base URL
+
+	defaultHTTPTimeout = 5 * time.Minute
+	errorSnippetLimit  = 400
+	languageMaxTokens  = 16
+)
+
+// Client implements llm.Client by calling the OpenAI API.
+type Client struct {
+	httpClient  *http.Client
+	baseURL     string
+	apiKey      string
+	orgID       string
+	model       string
+	temperature *float32
+	maxTokens   *int
+}
+
+// New creates a new OpenAI LLM client.
+func New(cfg config.OpenAISettings) *Client {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+	c := &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:     strings.TrimSpace(cfg.APIKey),
+		orgID:      strings.TrimSpace(cfg.OrgID),
+		model:      cfg.Model,
+	}
+	if c.baseURL == "" {
+		c.baseURL = DefaultBaseURL
+	}
+	if c.model == "" {
+		c.model = DefaultModel
+	}
+	if cfg.Temperature != 0 {
+		c.temperature = &cfg.Temperature
+	}
+	if cfg.MaxTokens != 0 {
+		c.maxTokens = &cfg.MaxTokens
+	}
+	return c
+}
+
+// TranscribeImage asks the model to transcribe the image into Markdown.
+func (c *Client) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	res, err := c.TranscribeImageResult(ctx, r, mime, llm.Options{})
+	if err != nil {
+		return "", err
+	}
+	return res.Markdown, nil
+}
+
+// TranscribeImageResult works like TranscribeImage but also reports the finish reason,
+// model and token usage of the completion and honors per-call options.
+func (c *Client) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	dataURL, err := readDataURL(r, mime)
+	if err != nil {
+		return llm.Result{}, err
+	}
+	instructions := aiproxy.Instructions("", opts)
+	req := aiproxy.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []aiproxy.ChatMessage{
+			{Role: aiproxy.RoleSystem, Content: aiproxy.SystemPrompt("")},
+			{Role: aiproxy.RoleUser, Content: []aiproxy.MessagePart{
+				{Type: aiproxy.PartText, Text: &instructions},
+				{Type: aiproxy.PartImageURL, ImageURL: &aiproxy.ImageURL{URL: dataURL}},
+			}},
+		},
+		Temperature: c.temperature,
+		MaxTokens:   c.maxTokens,
+	}
+	if opts.Model != "" {
+		req.Model = opts.Model
+	}
+	if opts.MaxTokens > 0 {
+		req.MaxTokens = &opts.MaxTokens
+	}
+
+	comp, err := c.complete(ctx, req)
+	if err != nil {
+		return llm.Result{}, err
+	}
+	if len(comp.Choices) == 0 || comp.Choices[0].Message.Content == "" {
+		return llm.Result{}, fmt.Errorf("empty completion")
+	}
+	res := llm.Result{
+		Markdown:     comp.Choices[0].Message.Content,
+		FinishReason: comp.Choices[0].FinishReason,
+		Model:        comp.Model,
+		Usage:        comp.TokenUsage(),
+	}
+	if res.Model == "" {
+		res.Model = req.Model
+	}
+	res.Meta = &llm.ProviderMeta{
+		ID:                comp.ID,
+		Model:             comp.Model,
+		FinishReason:      res.FinishReason,
+		Created:           comp.Created,
+		SystemFingerprint: comp.SystemFingerprint,
+	}
+	return res, nil
+}
+
+// DetectLanguage asks the model for the ISO 639-1 code of the main language of the text
+// in the image.
+func (c *Client) DetectLanguage(ctx context.Context, r io.Reader, mime string) (string, llm.Usage, error) {
+	dataURL, err := readDataURL(r, mime)
+	if err != nil {
+		return "", llm.Usage{}, err
+	}
+	prompt := aiproxy.LanguagePrompt
+	maxTokens := languageMaxTokens
+	comp, err := c.complete(ctx, aiproxy.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []aiproxy.ChatMessage{{
+			Role: aiproxy.RoleUser,
+			Content: []aiproxy.MessagePart{
+				{Type: aiproxy.PartText, Text: &prompt},
+				{Type: aiproxy.PartImageURL, ImageURL: &aiproxy.ImageURL{URL: dataURL}},
+			},
+		}},
+		MaxTokens: &maxTokens,
+	})
+	if err != nil {
+		return "", llm.Usage{}, err
+	}
+	if len(comp.Choices) == 0 {
+		return "", comp.TokenUsage(), nil
+	}
+	return langdetect.Normalize(comp.Choices[0].Message.Content), comp.TokenUsage(), nil
+}
+
+// readDataURL reads the image from r as a data URL.
+func readDataURL(r io.Reader, mime string) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("read image: %w", err)
+	}
+	if len(data) == 0 {
+		return "", fmt.Errorf("image is empty")
+	}
+	return aiproxy.BuildDataURL(mime, data), nil
+}
+
+// complete sends a chat completion request and decodes the response.
+func (c *Client) complete(ctx context.Context, reqBody aiproxy.ChatCompletionRequest) (aiproxy.ChatCompletionResponse, error) {
+	var comp aiproxy.ChatCompletionResponse
+	u, err := url.JoinPath(c.baseURL, endpointChatCompletions)
+	if err != nil {
+		return comp, fmt.Errorf("join url: %w", err)
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return comp, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return comp, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set(headerContentType, common.ContentTypeJSON)
+	req.Header.Set(headerAuthorization, "Bearer "+c.apiKey)
+	if c.orgID != "" {
+		req.Header.Set(headerOrganization, c.orgID)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return comp, ctx.Err()
+		}
+		return comp, llm.Transient(fmt.Errorf("http do: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		snippet := string(respBytes)
+		if len(snippet) > errorSnippetLimit {
+			snippet = snippet[:errorSnippetLimit] + "..."
+		}
+		err := fmt.Errorf("openai status %d: %s", resp.StatusCode, snippet)
+		if llm.IsTransientStatus(resp.StatusCode) {
+			err = llm.Transient(err)
+		}
+		return comp, err
+	}
+	if err := json.Unmarshal(respBytes, &comp); err != nil {
+		return comp, fmt.Errorf("parse response: %w", err)
+	}
+	return comp, nil
+}
@@ -0,0 +1,122 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/llm/aiproxy"
+)
+
+// captured is what the test server saw of a request.
+type captured struct {
+	path, auth, org string
+	body            aiproxy.ChatCompletionRequest
+}
+
+func newServer(t *testing.T, seen *captured) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen.path = r.URL.Path
+		seen.auth = r.Header.Get("Authorization")
+		seen.org = r.Header.Get("OpenAI-Organization")
+		if err := json.NewDecoder(r.Body).Decode(&seen.body); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(aiproxy.ChatCompletionResponse{
+			ID:      "chatcmpl-1",
+			Model:   "gpt-4o-2024-08-06",
+			Choices: []aiproxy.ChatCompletionChoice{{Message: aiproxy.ResponseMessage{Role: "assistant", Content: "# Notes"}, FinishReason: "stop"}},
+			Usage:   &aiproxy.ChatCompletionUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestOpenAI_TranscribeImageResult(t *testing.T) {
+	var seen captured
+	ts := newServer(t, &seen)
+	c := New(config.OpenAISettings{APIKey: "sk-1", OrgID: "org-42", BaseURL: ts.URL + "/v1/"})
+
+	res, err := c.TranscribeImageResult(context.Background(), bytes.NewReader([]byte("A")), "image/png", llm.Options{})
+	if err != nil {
+		t.Fatalf("TranscribeImageResult: %v", err)
+	}
+	if res.Markdown != "# Notes" || res.Model != "gpt-4o-2024-08-06" || res.Usage.TotalTokens != 15 || res.Meta == nil || res.Meta.ID != "chatcmpl-1" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if seen.path != "/v1/chat/completions" {
+		t.Fatalf("path = %q", seen.path)
+	}
+	if seen.auth != "Bearer sk-1" || seen.org != "org-42" {
+		t.Fatalf("auth = %q, org = %q", seen.auth, seen.org)
+	}
+	if seen.body.Model != DefaultModel {
+		t.Fatalf("model = %q, want %q", seen.body.Model, DefaultModel)
+	}
+	if len(seen.body.Messages) != 2 || seen.body.Messages[0].Role != aiproxy.RoleSystem {
+		t.Fatalf("unexpected messages: %+v", seen.body.Messages)
+	}
+	parts, ok := seen.body.Messages[1].Content.([]any)
+	if !ok || len(parts) != 2 {
+		t.Fatalf("user content = %#v", seen.body.Messages[1].Content)
+	}
+	img, _ := parts[1].(map[string]any)["image_url"].(map[string]any)
+	if img["url"] != "data:image/png;base64,QQ==" {
+		t.Fatalf("image url = %v", img["url"])
+	}
+}
+
+func TestOpenAI_NoOrgHeaderWithoutOrgID(t *testing.T) {
+	var seen captured
+	ts := newServer(t, &seen)
+	c := New(config.OpenAISettings{APIKey: "sk-1", Model: "gpt-4.1", BaseURL: ts.URL})
+
+	if _, err := c.TranscribeImage(context.Background(), bytes.NewReader([]byte("img")), "image/jpeg"); err != nil {
+		t.Fatalf("TranscribeImage: %v", err)
+	}
+	if seen.org != "" {
+		t.Fatalf("org header sent without org id: %q", seen.org)
+	}
+	if seen.path != "/chat/completions" || seen.body.Model != "gpt-4.1" {
+		t.Fatalf("path = %q, model = %q", seen.path, seen.body.Model)
+	}
+}
+
+func TestOpenAI_ErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"invalid api key"}}`, http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+	c := New(config.OpenAISettings{APIKey: "bad", BaseURL: ts.URL})
+
+	_, err := c.TranscribeImage(context.Background(), bytes.NewReader([]byte("img")), "image/png")
+	if err == nil || !strings.Contains(err.Error(), "openai status 401") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if errors.Is(err, llm.TransientError) {
+		t.Fatalf("401 must not be marked transient: %v", err)
+	}
+}
+
+func TestOpenAI_TransientErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	c := New(config.OpenAISettings{APIKey: "k", BaseURL: ts.URL})
+
+	_, err := c.TranscribeImage(context.Background(), bytes.NewReader([]byte("img")), "image/png")
+	if !errors.Is(err, llm.TransientError) || !strings.HasPrefix(err.Error(), "openai status 503") {
+		t.Fatalf("expected a transient status error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package weighted spreads LLM calls across several providers by weight and leaves out
+// providers whose recent calls mostly failed until a cooldown has passed.
+package weighted
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+)
+
+var (
+	_ llm.Client           = (*Client)(nil)
+	_ llm.ResultClient     = (*Client)(nil)
+	_ llm.LanguageDetector = (*Client)(nil)
+)
+
+// Provider is a client with its share of the calls.
+type Provider struct {
+	Name   string
+	Weight int // relative share; values below 1 count as 1
+	Client llm.Client
+}
+
+// provider is a Provider with its recent outcomes.
+type provider struct {
+	Provider
+	failed        []bool // ring of the last outcomes, true for a failure
+	next          int    // position of the next outcome in failed
+	recorded      int    // outcomes in failed, at most len(failed)
+	excludedUntil time.Time
+}
+
+// Client implements llm.Client by calling one of its providers per call.
+type Client struct {
+	health config.ProviderHealthConfig
+	log    *slog.Logger
+	now    func() time.Time
+	intn   func(n int) int // random number in [0, n)
+
+	mu        sync.Mutex
+	providers []*provider
+}
+
+// New creates a Client routing between providers as configured by health.
+func New(providers []Provider, health config.ProviderHealthConfig, log *slog.Logger) *Client {
+	c := &Client{health: health, log: log, now: time.Now, intn: rand.IntN}
+	for _, p := range providers {
+		p.Weight = max(p.Weight, 1)
+		c.providers = append(c.providers, &provider{Provider: p, failed: make([]bool, max(health.Window, 1))})
+	}
+	return c
+}
+
+// TranscribeImage transcribes with a provider picked by weight.
+func (c *Client) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	res, err := c.TranscribeImageResult(ctx, r, mime, llm.Options{})
+	return res.Markdown, err
+}
+
+// TranscribeImageResult transcribes with a provider picked by weight, passing opts on to
+// providers that accept them.
+func (c *Client) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	p := c.pick()
+	var res llm.Result
+	var err error
+	if rc, ok := p.Client.(llm.ResultClient); ok {
+		res, err = rc.TranscribeImageResult(ctx, r, mime, opts)
+	} else {
+		res.Markdown, err = p.Client.TranscribeImage(ctx, r, mime)
+	}
+	c.record(p, err)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", p.Name, err)
+	}
+	return res, nil
+}
+
+// DetectLanguage detects the language with a provider picked by weight. Providers that
+// cannot detect languages answer "", which leaves the language to the heuristic.
+func (c *Client) DetectLanguage(ctx context.Context, r io.Reader, mime string) (string, llm.Usage, error) {
+	p := c.pick()
+	d, ok := p.Client.(llm.LanguageDetector)
+	if !ok {
+		return "", llm.Usage{}, nil
+	}
+	lang, usage, err := d.DetectLanguage(ctx, r, mime)
+	c.record(p, err)
+	if err != nil {
+		return "", usage, fmt.Errorf("%s: %w", p.Name, err)
+	}
+	return lang, usage, nil
+}
+
+// pick chooses a provider at random in proportion to its weight among those not left
+// out, or among all of them if every provider is left out. Providers whose cooldown has
+// passed are added back with a clean record.
+func (c *Client) pick() *provider {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var healthy []*provider
+	for _, p := range c.providers {
+		if !p.excludedUntil.IsZero() && !now.Before(p.excludedUntil) {
+			p.excludedUntil = time.Time{}
+			if c.log != nil {
+				c.log.Info("llm provider added back", "provider", p.Name)
+			}
+		}
+		if p.excludedUntil.IsZero() {
+			healthy = append(healthy, p)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = c.providers
+	}
+	total := 0
+	for _, p := range healthy {
+		total += p.Weight
+	}
+	n := c.intn(total)
+	for _, p := range healthy {
+		if n < p.Weight {
+			return p
+		}
+		n -= p.Weight
+	}
+	return healthy[len(healthy)-1]
+}
+
+// record adds the outcome of a call to p and leaves p out for the cooldown once its
+// error rate is too high.
+func (c *Client) record(p *provider, err error) {
+	if errors.Is(err, context.Canceled) {
+		return // a cancelled job says nothing about the provider
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !p.excludedUntil.IsZero() {
+		return // started before p was left out
+	}
+	p.failed[p.next] = err != nil
+	p.next = (p.next + 1) % len(p.failed)
+	p.recorded = min(p.recorded+1, len(p.failed))
+	if p.recorded < c.health.MinCalls {
+		return
+	}
+	failures := 0
+	for i := range p.recorded {
+		if p.failed[i] {
+			failures++
+		}
+	}
+	rate := float64(failures) / float64(p.recorded)
+	if rate <= c.health.MaxErrorRate {
+		return
+	}
+	p.excludedUntil = c.now().Add(c.health.Cooldown)
+	clear(p.failed)
+	p.next, p.recorded = 0, 0
+	if c.log != nil {
+		c.log.Warn("llm provider left out after errors", "provider", p.Name, "error_rate", rate, "until", p.excludedUntil)
+	}
+}
@@ -0,0 +1,123 @@
+package weighted
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+)
+
+// fakeLLM answers with its name, or fails while err is set.
+type fakeLLM struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (f *fakeLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.name, nil
+}
+
+var health = config.ProviderHealthConfig{Window: 10, MinCalls: 4, MaxErrorRate: 0.5, Cooldown: time.Minute}
+
+// sequential returns 0, 1, 2, ... modulo n, so every weight unit is picked in turn.
+func sequential() func(int) int {
+	i := -1
+	return func(n int) int { i++; return i % n }
+}
+
+func transcribe(t *testing.T, c *Client) (string, error) {
+	t.Helper()
+	return c.TranscribeImage(context.Background(), strings.NewReader("img"), "image/png")
+}
+
+func TestClient_WeightedDistribution(t *testing.T) {
+	a, b := &fakeLLM{name: "a"}, &fakeLLM{name: "b"}
+	c := New([]Provider{{Name: "a", Weight: 3, Client: a}, {Name: "b", Weight: 1, Client: b}}, health, nil)
+	c.intn = sequential()
+
+	for range 400 {
+		if _, err := transcribe(t, c); err != nil {
+			t.Fatalf("TranscribeImage: %v", err)
+		}
+	}
+	if a.calls != 300 || b.calls != 100 {
+		t.Fatalf("calls a=%d b=%d, want 300 and 100", a.calls, b.calls)
+	}
+}
+
+func TestClient_UnhealthyProviderLeftOut(t *testing.T) {
+	a, b := &fakeLLM{name: "a"}, &fakeLLM{name: "b", err: errors.New("502 bad gateway")}
+	c := New([]Provider{{Name: "a", Weight: 1, Client: a}, {Name: "b", Weight: 1, Client: b}}, health, nil)
+	c.intn = sequential()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	// Alternating calls: b fails its first four and is left out.
+	for i := range 8 {
+		_, err := transcribe(t, c)
+		if i%2 == 1 && (err == nil || !strings.HasPrefix(err.Error(), "b: ")) {
+			t.Fatalf("call %d: expected error of b, got %v", i, err)
+		}
+	}
+	if b.calls != 4 {
+		t.Fatalf("b calls = %d, want 4", b.calls)
+	}
+	for range 10 {
+		if md, err := transcribe(t, c); err != nil || md != "a" {
+			t.Fatalf("expected a while b is left out, got %q %v", md, err)
+		}
+	}
+	if b.calls != 4 {
+		t.Fatalf("b called while left out: %d", b.calls)
+	}
+
+	// After the cooldown b gets calls again, with a clean record.
+	now = now.Add(time.Minute)
+	b.err = nil
+	for range 4 {
+		if _, err := transcribe(t, c); err != nil {
+			t.Fatalf("after cooldown: %v", err)
+		}
+	}
+	if b.calls != 6 {
+		t.Fatalf("b calls after cooldown = %d, want 6", b.calls)
+	}
+}
+
+func TestClient_AllUnhealthyStillCalls(t *testing.T) {
+	a := &fakeLLM{name: "a", err: errors.New("down")}
+	c := New([]Provider{{Name: "a", Weight: 2, Client: a}}, health, nil)
+	for range 6 {
+		_, _ = transcribe(t, c)
+	}
+	if a.calls != 6 {
+		t.Fatalf("calls = %d, want 6: the only provider must still be tried", a.calls)
+	}
+	// Cancelled calls do not count as failures.
+	a.err = context.Canceled
+	c2 := New([]Provider{{Name: "a", Client: a}}, health, nil)
+	for range 6 {
+		_, _ = transcribe(t, c2)
+	}
+	if !c2.providers[0].excludedUntil.IsZero() {
+		t.Fatalf("provider left out after cancelled calls")
+	}
+}
+
+func TestClient_DetectLanguageWithoutDetector(t *testing.T) {
+	c := New([]Provider{{Name: "a", Client: &fakeLLM{name: "a"}}}, health, nil)
+	lang, usage, err := c.DetectLanguage(context.Background(), strings.NewReader("img"), "image/png")
+	if lang != "" || usage != (llm.Usage{}) || err != nil {
+		t.Fatalf("DetectLanguage = %q %+v %v", lang, usage, err)
+	}
+}
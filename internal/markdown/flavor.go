@@ -0,0 +1,147 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Flavor is the Markdown dialect transcriptions are written in for downstream tools.
+type Flavor string
+
+const (
+	FlavorCommonMark Flavor = "commonmark" // strict CommonMark, no extensions
+	FlavorGFM        Flavor = "gfm"        // GitHub-Flavored Markdown without raw HTML
+	FlavorMDX        Flavor = "mdx"        // Markdown that compiles as MDX
+)
+
+// Flavors lists the supported flavors.
+var Flavors = []Flavor{FlavorCommonMark, FlavorGFM, FlavorMDX}
+
+var (
+	strikeRe   = regexp.MustCompile(`~~([^~]+?)~~`)
+	commentRe  = regexp.MustCompile(`<!--.*?-->`)
+	autolinkRe = regexp.MustCompile(`<((?:https?|mailto):[^<>\s]+)>`)
+	voidTagRe  = regexp.MustCompile(`(?i)<(br|hr|img|input|wbr)\b([^<>]*?)\s*/?>`)
+	tagStartRe = regexp.MustCompile(`^</?[A-Za-z]`)
+)
+
+// Instructions returns the sentence asking the model for flavor f, or "" for no flavor.
+func (f Flavor) Instructions() string {
+	switch f {
+	case FlavorCommonMark:
+		return "Write strict CommonMark: do not use tables, task lists, strikethrough, footnotes or other extensions."
+	case FlavorGFM:
+		return "Write GitHub-Flavored Markdown: use pipe tables, task lists and strikethrough where they fit, and do not use raw HTML."
+	case FlavorMDX:
+		return "Write Markdown that compiles as MDX: do not use HTML comments, write void tags self-closing such as <br />, and escape curly braces and angle brackets that are not Markdown syntax with a backslash."
+	default:
+		return ""
+	}
+}
+
+// Enforce rewrites constructs of md that flavor f does not support, outside fenced code
+// blocks and code spans, and returns how many HTML tables it had to leave unchanged:
+//   - commonmark: strikethrough is reduced to its text.
+//   - gfm: simple HTML tables become pipe tables, as with NormalizeTables, and HTML
+//     comments are removed.
+//   - mdx: HTML comments are removed, autolinks become links, void tags are closed and
+//     braces and angle brackets that do not start a tag are escaped.
+//
+// Multi-line HTML comments are not recognized.
+func (f Flavor) Enforce(md string) (string, int) {
+	skipped := 0
+	switch f {
+	case FlavorCommonMark:
+		md = mapText(md, func(s string) string { return strikeRe.ReplaceAllString(s, "$1") })
+	case FlavorGFM:
+		md, skipped = NormalizeTables(md)
+		md = mapText(md, func(s string) string { return commentRe.ReplaceAllString(s, "") })
+	case FlavorMDX:
+		md = mapText(md, mdxText)
+	}
+	return md, skipped
+}
+
+// mdxText makes a piece of text outside code valid MDX.
+func mdxText(s string) string {
+	s = commentRe.ReplaceAllString(s, "")
+	s = autolinkRe.ReplaceAllString(s, "[$1]($1)")
+	s = voidTagRe.ReplaceAllString(s, "<$1$2 />")
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		escaped := i > 0 && s[i-1] == '\\'
+		switch {
+		case escaped:
+		case c == '{' || c == '}':
+			sb.WriteByte('\\')
+		case c == '<' && !tagStartRe.MatchString(s[i:]):
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// mapText applies fn to the text of md outside fenced code blocks and code spans.
+func mapText(md string, fn func(string) string) string {
+	lines := splitLines(md)
+	code := codeLines(lines)
+	for i, l := range lines {
+		if !code[i] {
+			lines[i] = mapOutsideSpans(l, fn)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mapOutsideSpans applies fn to the parts of line outside code spans. A backtick run
+// without a closing run of the same length is literal text.
+func mapOutsideSpans(line string, fn func(string) string) string {
+	var sb strings.Builder
+	text := 0 // start of the text not yet passed to fn
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		n := backtickRun(line, i)
+		end := closingRun(line, i+n, n)
+		if end < 0 {
+			i += n
+			continue
+		}
+		sb.WriteString(fn(line[text:i]))
+		sb.WriteString(line[i : end+n])
+		i = end + n
+		text = i
+	}
+	sb.WriteString(fn(line[text:]))
+	return sb.String()
+}
+
+// backtickRun returns the length of the backtick run starting at i.
+func backtickRun(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// closingRun returns the index of the next run of exactly n backticks at or after i,
+// or -1 if there is none.
+func closingRun(s string, i, n int) int {
+	for i < len(s) {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		m := backtickRun(s, i)
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
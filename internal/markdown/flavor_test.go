@@ -0,0 +1,58 @@
+package markdown
+
+import "testing"
+
+func TestFlavor_Enforce(t *testing.T) {
+	cases := []struct {
+		name    string
+		flavor  Flavor
+		md      string
+		want    string
+		skipped int
+	}{
+		{
+			name:   "commonmark strikethrough",
+			flavor: FlavorCommonMark,
+			md:     "Buy ~~milk~~ bread, `~~keep~~`\n```\n~~code~~\n```",
+			want:   "Buy milk bread, `~~keep~~`\n```\n~~code~~\n```",
+		},
+		{
+			name:    "gfm tables and comments",
+			flavor:  FlavorGFM,
+			md:      "Note <!-- scan noise -->here\n<table><tr><th>A</th></tr><tr><td>1</td></tr></table>\n<table><tr><td colspan=\"2\">x</td></tr></table>",
+			want:    "Note here\n\n| A |\n| --- |\n| 1 |\n\n<table><tr><td colspan=\"2\">x</td></tr></table>",
+			skipped: 1,
+		},
+		{
+			name:   "mdx escapes",
+			flavor: FlavorMDX,
+			md:     "Set {x} if a < b, see <https://example.com><br><img src=\"a.png\">\\{ok\\}<!-- c -->\n``{``a`` `<b>` ``\n```js\nif (a < b) { x() }\n```",
+			want:   "Set \\{x\\} if a \\< b, see [https://example.com](https://example.com)<br /><img src=\"a.png\" />\\{ok\\}\n``{``a`` `<b>` ``\n```js\nif (a < b) { x() }\n```",
+		},
+		{
+			name:   "no flavor",
+			flavor: "",
+			md:     "~~a~~ {b} <!-- c -->",
+			want:   "~~a~~ {b} <!-- c -->",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, skipped := tc.flavor.Enforce(tc.md)
+			if got != tc.want || skipped != tc.skipped {
+				t.Fatalf("Enforce mismatch (skipped %d):\n got %q\nwant %q", skipped, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFlavor_Instructions(t *testing.T) {
+	for _, f := range Flavors {
+		if f.Instructions() == "" {
+			t.Fatalf("flavor %s has no instructions", f)
+		}
+	}
+	if s := Flavor("").Instructions(); s != "" {
+		t.Fatalf("empty flavor instructions = %q", s)
+	}
+}
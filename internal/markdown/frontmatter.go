@@ -0,0 +1,38 @@
+package markdown
+
+import (
+	"encoding/json"
+	"strings"
+	"text/template"
+)
+
+// frontmatterFuncs are available in frontmatter templates. quote renders any value as a
+// double-quoted JSON scalar, which YAML reads back unchanged, e.g. titles with colons.
+var frontmatterFuncs = template.FuncMap{
+	"quote": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParseFrontmatterTemplate parses a template of YAML frontmatter fields, e.g.
+// server.frontmatter, with the frontmatter functions available.
+func ParseFrontmatterTemplate(text string) (*template.Template, error) {
+	return template.New("frontmatter").Funcs(frontmatterFuncs).Parse(text)
+}
+
+// SplitFrontmatter splits md into a leading YAML frontmatter block, including its
+// delimiter lines and the line break after them, and the rest of the document. front is
+// "" if md does not start with frontmatter.
+func SplitFrontmatter(md string) (front, body string) {
+	lines := splitLines(md)
+	end := frontmatterEnd(lines)
+	if end == 0 {
+		return "", md
+	}
+	front = strings.Join(lines[:end], "\n")
+	if end == len(lines) {
+		return front + "\n", ""
+	}
+	return front + "\n", strings.Join(lines[end:], "\n")
+}
@@ -0,0 +1,22 @@
+package markdown
+
+import "testing"
+
+func TestSplitFrontmatter(t *testing.T) {
+	cases := []struct {
+		name, md, front, body string
+	}{
+		{"none", "# Title\n\nText", "", "# Title\n\nText"},
+		{"block", "---\ntitle: x\n---\n# Title\n", "---\ntitle: x\n---\n", "# Title\n"},
+		{"dots end", "---\na: 1\n...\nText", "---\na: 1\n...\n", "Text"},
+		{"only block", "---\na: 1\n---", "---\na: 1\n---\n", ""},
+		{"unterminated", "---\na: 1\n", "", "---\na: 1\n"},
+		{"thematic break later", "Text\n---\nMore", "", "Text\n---\nMore"},
+	}
+	for _, tc := range cases {
+		front, body := SplitFrontmatter(tc.md)
+		if front != tc.front || body != tc.body {
+			t.Errorf("%s: SplitFrontmatter = %q, %q; want %q, %q", tc.name, front, body, tc.front, tc.body)
+		}
+	}
+}
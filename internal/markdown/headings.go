@@ -0,0 +1,18 @@
+package markdown
+
+import "strings"
+
+// ShiftHeadings moves every ATX heading outside fenced code blocks offset levels deeper
+// (or shallower for a negative offset), clamped to levels 1 to 6, e.g. so a transcription
+// fits below an existing H1 of a larger document. Other lines are left as they are.
+func ShiftHeadings(md string, offset int) string {
+	if offset == 0 {
+		return md
+	}
+	lines := splitLines(md)
+	for _, h := range headings(lines) {
+		level := min(max(h.level+offset, 1), 6)
+		lines[h.line] = strings.Repeat("#", level) + lines[h.line][h.level:]
+	}
+	return strings.Join(lines, "\n")
+}
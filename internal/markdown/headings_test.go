@@ -0,0 +1,17 @@
+package markdown
+
+import "testing"
+
+func TestShiftHeadings(t *testing.T) {
+	md := "# Title\n\nText with a # sign\n\n## Part\n\n```\n# not a heading\n## neither\n```\n\n##### Deep\n###### Deepest ######\n#hashtag\n"
+	want := "## Title\n\nText with a # sign\n\n### Part\n\n```\n# not a heading\n## neither\n```\n\n###### Deep\n###### Deepest ######\n#hashtag\n"
+	if got := ShiftHeadings(md, 1); got != want {
+		t.Fatalf("ShiftHeadings(+1) mismatch:\n got %q\nwant %q", got, want)
+	}
+	if got := ShiftHeadings("### Sub\n# Top", -2); got != "# Sub\n# Top" {
+		t.Fatalf("ShiftHeadings(-2) = %q", got)
+	}
+	if got := ShiftHeadings(md, 0); got != md {
+		t.Fatalf("offset 0 changed the document")
+	}
+}
@@ -0,0 +1,75 @@
+// Package markdown contains post-processing transforms applied to transcriptions
+// before they are posted.
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRe = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	fenceRe   = regexp.MustCompile("^[ \t]{0,3}(```+|~~~+)")
+)
+
+// heading is an ATX heading found outside fenced code blocks.
+type heading struct {
+	line  int // index into the document lines
+	level int
+	text  string
+}
+
+// splitLines splits md into lines, normalizing CRLF line endings.
+func splitLines(md string) []string {
+	return strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+}
+
+// codeLines reports for every line whether it belongs to a fenced code block
+// (including the fence lines themselves).
+func codeLines(lines []string) []bool {
+	in := make([]bool, len(lines))
+	fence := ""
+	for i, l := range lines {
+		if fence != "" {
+			in[i] = true
+			if m := fenceRe.FindStringSubmatch(l); m != nil && strings.HasPrefix(m[1], fence) && strings.TrimSpace(l) == m[1] {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(l); m != nil {
+			in[i] = true
+			fence = m[1]
+		}
+	}
+	return in
+}
+
+// headings returns all ATX headings outside fenced code blocks.
+func headings(lines []string) []heading {
+	code := codeLines(lines)
+	var out []heading
+	for i, l := range lines {
+		if code[i] {
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(l); m != nil {
+			out = append(out, heading{line: i, level: len(m[1]), text: m[2]})
+		}
+	}
+	return out
+}
+
+// frontmatterEnd returns the index of the first line after a leading YAML frontmatter
+// block, or 0 if the document has none.
+func frontmatterEnd(lines []string) int {
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return 0
+	}
+	for i := 1; i < len(lines); i++ {
+		if t := strings.TrimSpace(lines[i]); t == "---" || t == "..." {
+			return i + 1
+		}
+	}
+	return 0
+}
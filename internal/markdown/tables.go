@@ -0,0 +1,193 @@
+package markdown
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// errComplexTable marks an HTML table that has no faithful pipe table equivalent.
+var errComplexTable = errors.New("complex table")
+
+// NormalizeTables converts HTML tables outside fenced code blocks into GitHub-Flavored
+// Markdown pipe tables, since vision models emit either form. Only simple tables are
+// converted: rows of th/td cells with plain text, line breaks and inline emphasis or
+// code. Tables with merged cells, nested tables, other markup or invalid HTML are left
+// as they are and counted in the returned number. A table must start on a line of its
+// own with <table and end at the end of a line with </table>.
+func NormalizeTables(md string) (string, int) {
+	lines := splitLines(md)
+	code := codeLines(lines)
+	var out []string
+	skipped := 0
+	for i := 0; i < len(lines); i++ {
+		if code[i] || !startsTable(lines[i]) {
+			out = append(out, lines[i])
+			continue
+		}
+		end := i
+		for end < len(lines) && !code[end] && !strings.HasSuffix(strings.ToLower(strings.TrimSpace(lines[end])), "</table>") {
+			end++
+		}
+		if end == len(lines) || code[end] {
+			// Not closed before the end or a code block: not a table block.
+			out = append(out, lines[i])
+			continue
+		}
+		rows, err := parseHTMLTable(strings.Join(lines[i:end+1], "\n"))
+		if err != nil {
+			skipped++
+			out = append(out, lines[i:end+1]...)
+			i = end
+			continue
+		}
+		// Pipe tables need blank lines to be told apart from surrounding paragraphs.
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, pipeTable(rows)...)
+		if end+1 < len(lines) && strings.TrimSpace(lines[end+1]) != "" {
+			out = append(out, "")
+		}
+		i = end
+	}
+	return strings.Join(out, "\n"), skipped
+}
+
+// startsTable reports whether line opens an HTML table element.
+func startsTable(line string) bool {
+	l := strings.ToLower(strings.TrimSpace(line))
+	rest, ok := strings.CutPrefix(l, "<table")
+	return ok && (rest == "" || rest[0] == '>' || rest[0] == ' ' || rest[0] == '\t')
+}
+
+// parseHTMLTable reads the cell texts of a simple HTML table row by row.
+func parseHTMLTable(src string) ([][]string, error) {
+	d := xml.NewDecoder(strings.NewReader(src))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var (
+		rows          [][]string
+		row           []string
+		cell          strings.Builder
+		tables        int
+		inRow, inCell bool
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch name := strings.ToLower(t.Name.Local); name {
+			case "table":
+				if tables > 0 {
+					return nil, errComplexTable
+				}
+				tables++
+			case "thead", "tbody", "tfoot":
+			case "tr":
+				if inRow || inCell {
+					return nil, errComplexTable
+				}
+				inRow, row = true, nil
+			case "th", "td":
+				if !inRow || inCell {
+					return nil, errComplexTable
+				}
+				for _, a := range t.Attr {
+					if k := strings.ToLower(a.Name.Local); (k == "colspan" || k == "rowspan") && strings.TrimSpace(a.Value) != "1" {
+						return nil, errComplexTable
+					}
+				}
+				inCell = true
+				cell.Reset()
+			case "br":
+				if !inCell {
+					return nil, errComplexTable
+				}
+				cell.WriteString("<br>")
+			case "b", "strong", "i", "em", "code":
+				if !inCell {
+					return nil, errComplexTable
+				}
+				cell.WriteString(inlineMarker(name))
+			case "span":
+				// Presentational only; its text is kept.
+			default:
+				return nil, errComplexTable
+			}
+		case xml.EndElement:
+			switch name := strings.ToLower(t.Name.Local); name {
+			case "th", "td":
+				if inCell {
+					row = append(row, cellText(cell.String()))
+					inCell = false
+				}
+			case "tr":
+				if inCell || !inRow {
+					return nil, errComplexTable
+				}
+				rows = append(rows, row)
+				inRow = false
+			case "b", "strong", "i", "em", "code":
+				cell.WriteString(inlineMarker(name))
+			}
+		case xml.CharData:
+			if inCell {
+				cell.Write(t)
+			} else if strings.TrimSpace(string(t)) != "" {
+				return nil, errComplexTable
+			}
+		}
+	}
+	if tables != 1 || inRow || len(rows) == 0 {
+		return nil, errComplexTable
+	}
+	return rows, nil
+}
+
+// inlineMarker returns the Markdown delimiter for an inline HTML element.
+func inlineMarker(name string) string {
+	switch name {
+	case "b", "strong":
+		return "**"
+	case "code":
+		return "`"
+	default:
+		return "*"
+	}
+}
+
+// cellText collapses the whitespace of a cell and escapes pipes.
+func cellText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// pipeTable renders rows as a pipe table with the first row as header. Short rows are
+// padded with empty cells.
+func pipeTable(rows [][]string) []string {
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	cols = max(cols, 1)
+	line := func(cells []string) string {
+		padded := make([]string, cols)
+		copy(padded, cells)
+		return "| " + strings.Join(padded, " | ") + " |"
+	}
+	out := []string{line(rows[0]), line(strings.Split(strings.Repeat("---,", cols-1)+"---", ","))}
+	for _, r := range rows[1:] {
+		out = append(out, line(r))
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package markdown
+
+import "testing"
+
+func TestNormalizeTables(t *testing.T) {
+	md := "Prices:\n<table>\n  <thead><tr><th>Item</th><th>Price</th></tr></thead>\n  <tbody>\n" +
+		"    <tr><td><b>Pens</b></td><td>1 &amp; 2 | each</td></tr>\n" +
+		"    <tr><td>Paper<br/>A4</td></tr>\n  </tbody>\n</table>\nDone."
+	want := "Prices:\n\n| Item | Price |\n| --- | --- |\n| **Pens** | 1 & 2 \\| each |\n| Paper<br>A4 |  |\n\nDone."
+	got, skipped := NormalizeTables(md)
+	if got != want || skipped != 0 {
+		t.Fatalf("NormalizeTables mismatch (skipped %d):\n got %q\nwant %q", skipped, got, want)
+	}
+}
+
+func TestNormalizeTables_GFMUnchanged(t *testing.T) {
+	md := "# Title\n\n| a | b |\n| --- | --- |\n| 1 | 2 |\n"
+	if got, skipped := NormalizeTables(md); got != md || skipped != 0 {
+		t.Fatalf("GFM table changed: %q (skipped %d)", got, skipped)
+	}
+}
+
+func TestNormalizeTables_ComplexUntouched(t *testing.T) {
+	for _, md := range []string{
+		"<table><tr><td rowspan=\"2\">a</td><td>b</td></tr><tr><td>c</td></tr></table>",
+		"<table><caption>Q1</caption><tr><td>a</td></tr></table>",
+		"<table><tr><td><table><tr><td>x</td></tr></table></td></tr></table>",
+		"<table><tr><td><ul><li>a</li></ul></td></tr></table>",
+	} {
+		if got, skipped := NormalizeTables(md); got != md || skipped != 1 {
+			t.Fatalf("complex table %q changed to %q (skipped %d)", md, got, skipped)
+		}
+	}
+}
+
+func TestNormalizeTables_CodeBlockUntouched(t *testing.T) {
+	md := "```html\n<table><tr><td>a</td></tr></table>\n```"
+	if got, skipped := NormalizeTables(md); got != md || skipped != 0 {
+		t.Fatalf("table in code block changed: %q (skipped %d)", got, skipped)
+	}
+}
@@ -0,0 +1,16 @@
+package markdown
+
+// FirstHeading returns the plain text of the first H1 outside a YAML frontmatter block
+// and fenced code blocks, or "" if md has none.
+func FirstHeading(md string) string {
+	lines := splitLines(md)
+	start := frontmatterEnd(lines)
+	for _, h := range headings(lines) {
+		if h.line >= start && h.level == 1 {
+			if t := plainText(h.text); t != "" {
+				return t
+			}
+		}
+	}
+	return ""
+}
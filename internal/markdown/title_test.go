@@ -0,0 +1,21 @@
+package markdown
+
+import "testing"
+
+func TestFirstHeading(t *testing.T) {
+	cases := []struct {
+		name, md, want string
+	}{
+		{"leading H1", "# Meeting notes\n\nText", "Meeting notes"},
+		{"H1 after text", "Intro\n\n## Part\n\n# **Real** [title](https://x)\n", "Real title"},
+		{"no heading", "Just text\n\n## Only H2", ""},
+		{"code block", "```\n# not a title\n```\n\n# Title", "Title"},
+		{"frontmatter", "---\n# yaml comment\n---\n# Title", "Title"},
+		{"empty H1", "# \n# `Code` title", "Code title"},
+	}
+	for _, tc := range cases {
+		if got := FirstHeading(tc.md); got != tc.want {
+			t.Errorf("%s: FirstHeading = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// tocMaxLevel is the deepest heading level listed in the table of contents.
+const tocMaxLevel = 2
+
+var (
+	inlineLinkRe = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	inlineHTMLRe = regexp.MustCompile(`<[^>]+>`)
+)
+
+// InsertTOC inserts a linked table of contents of the level 1 and 2 headings at the top
+// of md: after a YAML frontmatter block and after a leading H1 title if present.
+// Anchors follow GitHub's rules so the links work when the file is viewed on GitHub.
+// md is returned unchanged when there is nothing to list.
+func InsertTOC(md string) string {
+	lines := splitLines(md)
+	hs := headings(lines)
+
+	// Slugs are assigned to every heading in document order so duplicate suffixes
+	// match the anchors GitHub generates, even for headings not listed.
+	s := newSlugger()
+	slugs := make([]string, len(hs))
+	for i, h := range hs {
+		slugs[i] = s.slug(h.text)
+	}
+
+	insertAt := frontmatterEnd(lines)
+	// Skip blank lines and a leading title heading.
+	for insertAt < len(lines) && strings.TrimSpace(lines[insertAt]) == "" {
+		insertAt++
+	}
+	titleLine := -1
+	if len(hs) > 0 && hs[0].line == insertAt && hs[0].level == 1 {
+		titleLine = insertAt
+		insertAt++
+	}
+
+	var entries []string
+	minLevel := tocMaxLevel
+	for _, h := range hs {
+		if h.line != titleLine && h.level < minLevel {
+			minLevel = h.level
+		}
+	}
+	for i, h := range hs {
+		if h.line == titleLine || h.level > tocMaxLevel {
+			continue
+		}
+		indent := strings.Repeat("  ", h.level-minLevel)
+		entries = append(entries, fmt.Sprintf("%s- [%s](#%s)", indent, plainText(h.text), slugs[i]))
+	}
+	if len(entries) == 0 {
+		return md
+	}
+
+	block := append([]string{""}, entries...)
+	block = append(block, "")
+	out := make([]string, 0, len(lines)+len(block))
+	out = append(out, lines[:insertAt]...)
+	out = append(out, block...)
+	rest := lines[insertAt:]
+	// Avoid a double blank line between the list and the following content.
+	for len(rest) > 0 && strings.TrimSpace(rest[0]) == "" {
+		rest = rest[1:]
+	}
+	out = append(out, rest...)
+	if insertAt == 0 {
+		out = out[1:]
+	}
+	return strings.Join(out, "\n")
+}
+
+// Slug returns the GitHub anchor for a heading text, without duplicate handling.
+func Slug(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(plainText(text)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsNumber(r), r == '_', r == '-':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// slugger assigns unique anchors the way GitHub does: the first occurrence keeps the
+// plain slug, later ones get -1, -2, ... appended.
+type slugger struct {
+	seen map[string]int
+}
+
+func newSlugger() *slugger {
+	return &slugger{seen: make(map[string]int)}
+}
+
+func (s *slugger) slug(text string) string {
+	base := Slug(text)
+	slug := base
+	for {
+		n, dup := s.seen[slug]
+		if !dup {
+			break
+		}
+		s.seen[slug] = n + 1
+		slug = fmt.Sprintf("%s-%d", base, n+1)
+	}
+	s.seen[slug] = 0
+	return slug
+}
+
+// plainText strips inline Markdown (links, images, emphasis, code, HTML) from a heading.
+func plainText(s string) string {
+	s = inlineLinkRe.ReplaceAllString(s, "$1")
+	s = inlineHTMLRe.ReplaceAllString(s, "")
+	s = strings.NewReplacer("**", "", "__", "", "`", "", "*", "", "~~", "").Replace(s)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,64 @@
+package markdown
+
+import "testing"
+
+func TestSlug(t *testing.T) {
+	cases := map[string]string{
+		"Hello World":              "hello-world",
+		"Step 1: Setup & Install!": "step-1-setup--install",
+		"**Bold** and `code`":      "bold-and-code",
+		"[Link](http://x.y) text":  "link-text",
+		"Größe über alles":         "größe-über-alles",
+		"snake_case-name":          "snake_case-name",
+	}
+	for in, want := range cases {
+		if got := Slug(in); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSlugger_Duplicates(t *testing.T) {
+	s := newSlugger()
+	var got []string
+	for _, h := range []string{"Notes", "Notes", "Notes", "Notes 1"} {
+		got = append(got, s.slug(h))
+	}
+	want := []string{"notes", "notes-1", "notes-2", "notes-1-1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("slugs = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestInsertTOC(t *testing.T) {
+	md := "# Title\n\nIntro\n\n## Part A\n\n### Detail\n\n## Part A\n\n```\n# not a heading\n```\n\n# Appendix\n"
+	// Appendix is H1 while the parts are H2, so the parts are indented below the top level.
+	want := "# Title\n\n  - [Part A](#part-a)\n  - [Part A](#part-a-1)\n- [Appendix](#appendix)\n\nIntro\n\n## Part A\n\n### Detail\n\n## Part A\n\n```\n# not a heading\n```\n\n# Appendix\n"
+	if got := InsertTOC(md); got != want {
+		t.Fatalf("InsertTOC mismatch:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestInsertTOC_FrontmatterAndNoTitle(t *testing.T) {
+	md := "---\ntitle: x\n---\n## One\ntext\n## Two"
+	want := "---\ntitle: x\n---\n\n- [One](#one)\n- [Two](#two)\n\n## One\ntext\n## Two"
+	if got := InsertTOC(md); got != want {
+		t.Fatalf("InsertTOC mismatch:\n got %q\nwant %q", got, want)
+	}
+
+	md = "## One\n\n## Two"
+	want = "- [One](#one)\n- [Two](#two)\n\n## One\n\n## Two"
+	if got := InsertTOC(md); got != want {
+		t.Fatalf("InsertTOC without title mismatch:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestInsertTOC_NothingToList(t *testing.T) {
+	for _, md := range []string{"", "plain text", "# Only a title\n\ntext", "### Deep only"} {
+		if got := InsertTOC(md); got != md {
+			t.Errorf("InsertTOC(%q) = %q, want unchanged", md, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+)
+
+// ErrProviderUnavailable fails LLM calls while the circuit breaker is open.
+var ErrProviderUnavailable = errors.New("provider_unavailable: llm provider is failing, not calling it until the cooldown has passed")
+
+// Circuit breaker states as reported by breaker.state.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// breaker is a circuit breaker for LLM calls. It opens after threshold consecutive
+// failures and rejects calls for cooldown. After that it is half-open: one trial call
+// goes through, closing the circuit on success and opening it again on failure.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	log       *slog.Logger
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int       // consecutive failures while closed
+	openUntil time.Time // zero while closed
+	probing   bool      // the trial call of the half-open state is in flight
+}
+
+// newBreaker returns a breaker for c, or nil (never open) when it is disabled.
+func newBreaker(c config.CircuitBreakerConfig, log *slog.Logger) *breaker {
+	if c.FailureThreshold <= 0 {
+		return nil
+	}
+	return &breaker{threshold: c.FailureThreshold, cooldown: c.Cooldown, log: log, now: time.Now}
+}
+
+// acquire reports whether a call may go to the provider. If so, done must be called
+// with the outcome of the call. A nil breaker allows every call.
+func (b *breaker) acquire() (done func(error), ok bool) {
+	if b == nil {
+		return func(error) {}, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return func(err error) { b.record(err, false) }, true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return nil, false
+	}
+	b.probing = true
+	return func(err error) { b.record(err, true) }, true
+}
+
+func (b *breaker) record(err error, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	} else if !b.openUntil.IsZero() {
+		return // started before the circuit opened; only the trial call decides now
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		// Shutdown or a cancelled job says nothing about the provider.
+	case err == nil:
+		if probe && b.log != nil {
+			b.log.Info("llm circuit breaker closed")
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+	default:
+		b.failures++
+		if probe || b.failures >= b.threshold {
+			b.failures = 0
+			b.openUntil = b.now().Add(b.cooldown)
+			if b.log != nil {
+				b.log.Warn("llm circuit breaker opened", "cooldown", b.cooldown, "err", err)
+			}
+		}
+	}
+}
+
+// state returns breakerClosed, breakerOpen or breakerHalfOpen.
+func (b *breaker) state() string {
+	if b == nil {
+		return breakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return breakerClosed
+	case b.now().Before(b.openUntil):
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
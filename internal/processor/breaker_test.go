@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+func TestBreaker_Transitions(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(config.CircuitBreakerConfig{FailureThreshold: 2, Cooldown: time.Minute}, nil)
+	b.now = func() time.Time { return now }
+	call := func(err error) bool {
+		done, ok := b.acquire()
+		if ok {
+			done(err)
+		}
+		return ok
+	}
+	boom := errors.New("boom")
+
+	// A success resets the count of consecutive failures.
+	call(boom)
+	call(nil)
+	call(boom)
+	if s := b.state(); s != breakerClosed {
+		t.Fatalf("state after non-consecutive failures = %s", s)
+	}
+	call(boom)
+	if s := b.state(); s != breakerOpen {
+		t.Fatalf("state after threshold = %s", s)
+	}
+	if call(nil) {
+		t.Fatalf("open breaker allowed a call")
+	}
+
+	// After the cooldown a single trial call goes through; its failure reopens the circuit.
+	now = now.Add(time.Minute)
+	if s := b.state(); s != breakerHalfOpen {
+		t.Fatalf("state after cooldown = %s", s)
+	}
+	done, ok := b.acquire()
+	if !ok {
+		t.Fatalf("half-open breaker rejected the trial call")
+	}
+	if _, ok := b.acquire(); ok {
+		t.Fatalf("half-open breaker allowed a second call during the trial")
+	}
+	done(boom)
+	if s := b.state(); s != breakerOpen {
+		t.Fatalf("state after failed trial = %s", s)
+	}
+
+	// A successful trial closes it.
+	now = now.Add(time.Minute)
+	if !call(nil) {
+		t.Fatalf("trial call rejected")
+	}
+	if s := b.state(); s != breakerClosed {
+		t.Fatalf("state after successful trial = %s", s)
+	}
+
+	// Cancellations do not count as failures.
+	call(context.Canceled)
+	call(context.Canceled)
+	if s := b.state(); s != breakerClosed {
+		t.Fatalf("state after cancellations = %s", s)
+	}
+}
+
+func TestWorker_Process_CircuitBreaker(t *testing.T) {
+	store := newMemStore()
+	llmClient := &llmMock{err: errors.New("502 bad gateway")}
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{LLM: config.LLMConfig{CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 2, Cooldown: time.Hour}}}
+	worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	for i := range 3 {
+		job := jobs.Job{ID: fmt.Sprintf("job-%d", i), ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+		_ = store.CreateJob(&job)
+		err := worker.Process(context.Background(), jobs.WorkItem{Job: job})
+		if err == nil {
+			t.Fatalf("job %d: expected error", i)
+		}
+		if got := errors.Is(err, ErrProviderUnavailable); got != (i == 2) {
+			t.Fatalf("job %d: provider unavailable = %v (%v)", i, got, err)
+		}
+	}
+	if llmClient.calls != 2 {
+		t.Fatalf("llm calls = %d, want 2: the open circuit must not reach the provider", llmClient.calls)
+	}
+	got, _ := store.GetJob("job-2")
+	if got.Stage != jobs.StageFailed || got.ErrorMessage == nil || *got.ErrorMessage != ErrProviderUnavailable.Error() {
+		t.Fatalf("unexpected job %+v", got)
+	}
+}
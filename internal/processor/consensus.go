@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+)
+
+// pickConsensus selects the result to post from several transcriptions of the same
+// image and returns its index together with the mean pairwise similarity of all runs.
+// "majority" picks the run most similar to all others; "longest" the longest output.
+// Ties go to the earlier run.
+func pickConsensus(results []llm.Result, strategy string) (int, float64) {
+	n := len(results)
+	if n < 2 {
+		return 0, 1
+	}
+	lines := make([]map[string]struct{}, n)
+	for i, r := range results {
+		lines[i] = lineSet(r.Markdown)
+	}
+	scores := make([]float64, n)
+	var total float64
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			s := jaccard(lines[i], lines[j])
+			scores[i] += s
+			scores[j] += s
+			total += s
+		}
+	}
+	agreement := total / float64(n*(n-1)/2)
+
+	best := 0
+	for i := 1; i < n; i++ {
+		if strategy == config.ConsensusLongest {
+			if len(results[i].Markdown) > len(results[best].Markdown) {
+				best = i
+			}
+		} else if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	return best, agreement
+}
+
+// lineSet returns the non-empty lines of md with whitespace normalized, so that
+// differences in indentation or spacing do not count as disagreement.
+func lineSet(md string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, l := range strings.Split(md, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			set[l] = struct{}{}
+		}
+	}
+	return set
+}
+
+// jaccard returns |a ∩ b| / |a ∪ b|; two empty sets are identical.
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+)
+
+func TestPickConsensus(t *testing.T) {
+	results := []llm.Result{
+		{Markdown: "# Notes\n- milk\n- eggs"},
+		{Markdown: "# Notes\n- milk\n- eggs\n- a long hallucinated line"},
+		{Markdown: "# Notes\n-   milk\n- eggs"}, // whitespace differences do not count
+	}
+	best, agreement := pickConsensus(results, config.ConsensusMajority)
+	if best != 0 {
+		t.Fatalf("majority picked run %d, want 0", best)
+	}
+	// Pairs: (0,1)=3/4, (0,2)=1, (1,2)=3/4.
+	if want := (0.75 + 1 + 0.75) / 3; math.Abs(agreement-want) > 1e-9 {
+		t.Fatalf("agreement = %v, want %v", agreement, want)
+	}
+	if best, _ := pickConsensus(results, config.ConsensusLongest); best != 1 {
+		t.Fatalf("longest picked run %d, want 1", best)
+	}
+}
+
+func TestPickConsensus_Disjoint(t *testing.T) {
+	_, agreement := pickConsensus([]llm.Result{{Markdown: "a"}, {Markdown: "b"}}, config.ConsensusMajority)
+	if agreement != 0 {
+		t.Fatalf("agreement = %v, want 0", agreement)
+	}
+	if _, agreement := pickConsensus([]llm.Result{{Markdown: ""}, {Markdown: "\n"}}, config.ConsensusMajority); agreement != 1 {
+		t.Fatalf("empty outputs should agree, got %v", agreement)
+	}
+}
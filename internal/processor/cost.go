@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+)
+
+// estimateCost prices usage with the llm.pricing entry of model, or returns nil if the
+// model has no price.
+func (w *Worker) estimateCost(model string, u llm.Usage) *float64 {
+	p, ok := pricingFor(w.Cfg.LLM.Pricing, model)
+	if !ok {
+		return nil
+	}
+	cost := float64(u.PromptTokens)/1000*p.InputPer1K + float64(u.CompletionTokens)/1000*p.OutputPer1K
+	return &cost
+}
+
+// pricingFor returns the price of model: its own entry, else the longest entry that is a
+// prefix of it, such as "gpt-5" for the dated "gpt-5-2025-08-07", else "*".
+func pricingFor(pricing map[string]config.ModelPricing, model string) (config.ModelPricing, bool) {
+	if p, ok := pricing[model]; ok {
+		return p, true
+	}
+	best := ""
+	for name := range pricing {
+		if name != "*" && len(name) > len(best) && strings.HasPrefix(model, name) {
+			best = name
+		}
+	}
+	if best != "" {
+		return pricing[best], true
+	}
+	p, ok := pricing["*"]
+	return p, ok
+}
+
+// checkPeriodBudget returns an error if the jobs started within the budget period have
+// used up llm.costBudget.perPeriod, so the job is failed before the LLM is called.
+func (w *Worker) checkPeriodBudget(now time.Time) error {
+	b := w.Cfg.LLM.CostBudget
+	if b.PerPeriod <= 0 {
+		return nil
+	}
+	cr, ok := w.Store.(jobs.CostReporter)
+	if !ok {
+		return fmt.Errorf("cost budget: the job store cannot sum job costs")
+	}
+	spent, err := cr.CostSince(now.Add(-b.Period))
+	if err != nil {
+		return fmt.Errorf("cost budget: %w", err)
+	}
+	if spent >= b.PerPeriod {
+		return fmt.Errorf("cost budget: estimated cost %.4f of the last %s reached the budget of %.4f", spent, b.Period, b.PerPeriod)
+	}
+	return nil
+}
+
+// overJobBudget describes why cost exceeds llm.costBudget.perJob, or returns "" if it
+// does not or is not known.
+func (w *Worker) overJobBudget(cost *float64) string {
+	limit := w.Cfg.LLM.CostBudget.PerJob
+	if cost == nil || limit <= 0 || *cost <= limit {
+		return ""
+	}
+	return fmt.Sprintf("estimated cost %.4f exceeds the per-job budget of %.4f", *cost, limit)
+}
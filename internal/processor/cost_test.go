@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// costStore reports a fixed spending for the budget period.
+type costStore struct {
+	*reviewStore
+	spent float64
+	since time.Time
+}
+
+func (s *costStore) CostSince(since time.Time) (float64, error) {
+	s.since = since
+	return s.spent, nil
+}
+
+// pricedLLM reports a dated model name and a known token usage.
+type pricedLLM struct{ calls int }
+
+func (m *pricedLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	return "", nil
+}
+
+func (m *pricedLLM) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	m.calls++
+	return llm.Result{Markdown: "# Notes\n\nall fine", FinishReason: "stop", Model: "gpt-5-2025-08-07",
+		Usage: llm.Usage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500}}, nil
+}
+
+func TestWorker_Process_CostBudget(t *testing.T) {
+	pricing := map[string]config.ModelPricing{
+		"gpt-5":  {InputPer1K: 0.5, OutputPer1K: 2},
+		"gpt-4o": {InputPer1K: 100, OutputPer1K: 100},
+		"*":      {InputPer1K: 100, OutputPer1K: 100},
+	}
+	cases := []struct {
+		name      string
+		budget    config.CostBudgetConfig
+		spent     float64
+		wantStage jobs.Stage
+		wantCalls int
+		wantErr   string
+	}{
+		{name: "no budget", wantStage: jobs.StageCompleted, wantCalls: 1},
+		{name: "within job budget", budget: config.CostBudgetConfig{PerJob: 2}, wantStage: jobs.StageCompleted, wantCalls: 1},
+		{name: "job budget fails", budget: config.CostBudgetConfig{PerJob: 1, Action: config.CostBudgetFail},
+			wantStage: jobs.StageFailed, wantCalls: 1, wantErr: "estimated cost 1.5000 exceeds the per-job budget of 1.0000"},
+		{name: "job budget holds", budget: config.CostBudgetConfig{PerJob: 1, Action: config.CostBudgetHold},
+			wantStage: jobs.StageNeedsReview, wantCalls: 1},
+		{name: "period budget left", budget: config.CostBudgetConfig{PerPeriod: 10, Period: time.Hour}, spent: 8.5,
+			wantStage: jobs.StageCompleted, wantCalls: 1},
+		{name: "period budget used up", budget: config.CostBudgetConfig{PerPeriod: 10, Period: time.Hour}, spent: 10,
+			wantStage: jobs.StageFailed, wantCalls: 0, wantErr: "reached the budget of 10.0000"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &costStore{reviewStore: &reviewStore{memStore: newMemStore(), reviews: map[string]jobs.Review{}}, spent: tc.spent}
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			client := &pricedLLM{}
+			cfg := &config.Config{LLM: config.LLMConfig{Pricing: pricing, CostBudget: tc.budget}}
+			worker := New(discardLogger(), cfg, store, client, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-cost", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+			_ = store.CreateJob(&job)
+			start := time.Now()
+			_ = worker.Process(context.Background(), jobs.WorkItem{Job: job})
+
+			got, _ := store.GetJob(job.ID)
+			if got.Stage != tc.wantStage || client.calls != tc.wantCalls {
+				t.Fatalf("stage=%s calls=%d, want %s %d", got.Stage, client.calls, tc.wantStage, tc.wantCalls)
+			}
+			if tc.wantErr != "" && (got.ErrorMessage == nil || !strings.Contains(*got.ErrorMessage, tc.wantErr)) {
+				t.Fatalf("error = %v, want %q", got.ErrorMessage, tc.wantErr)
+			}
+			if tc.wantCalls > 0 && (got.EstimatedCost == nil || *got.EstimatedCost != 1.5) {
+				t.Fatalf("estimated cost = %v, want 1.5", got.EstimatedCost)
+			}
+			if tc.budget.PerPeriod > 0 && (store.since.Before(start.Add(-tc.budget.Period)) || store.since.After(time.Now().Add(-tc.budget.Period))) {
+				t.Fatalf("period start %v, want %v before the job started", store.since, tc.budget.Period)
+			}
+			if tc.wantStage == jobs.StageNeedsReview {
+				r := store.reviews[job.ID]
+				if len(r.Reasons) != 1 || !strings.Contains(r.Reasons[0], "per-job budget") {
+					t.Fatalf("review reasons = %v", r.Reasons)
+				}
+			}
+		})
+	}
+}
+
+func TestPricingFor(t *testing.T) {
+	pricing := map[string]config.ModelPricing{
+		"gpt-5":      {InputPer1K: 1},
+		"gpt-5-mini": {InputPer1K: 2},
+		"*":          {InputPer1K: 3},
+	}
+	for model, want := range map[string]float64{"gpt-5": 1, "gpt-5-2025-08-07": 1, "gpt-5-mini-2025-08-07": 2, "claude": 3} {
+		if p, ok := pricingFor(pricing, model); !ok || p.InputPer1K != want {
+			t.Fatalf("pricingFor(%q) = %+v %v, want %v", model, p, ok, want)
+		}
+	}
+	if _, ok := pricingFor(map[string]config.ModelPricing{"gpt-5": {}}, "o3"); ok {
+		t.Fatalf("unpriced model should have no price")
+	}
+}
@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/markdown"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// frontmatter renders the YAML frontmatter prepended to posted documents.
+type frontmatter struct {
+	def      *template.Template            // server.frontmatter; nil if not set
+	byTarget map[string]*template.Template // frontmatterTemplate overrides by target name
+}
+
+// newFrontmatter parses the frontmatter templates of cfg, or returns nil when neither
+// the server nor any target configures one.
+func newFrontmatter(cfg *config.Config) (*frontmatter, error) {
+	f := &frontmatter{byTarget: make(map[string]*template.Template)}
+	if s := strings.TrimSpace(cfg.Server.Frontmatter); s != "" {
+		tpl, err := markdown.ParseFrontmatterTemplate(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse server.frontmatter: %w", err)
+		}
+		f.def = tpl
+	}
+	for _, e := range cfg.Targets {
+		s := strings.TrimSpace(e.FrontmatterTemplate)
+		if s == "" {
+			continue
+		}
+		tpl, err := markdown.ParseFrontmatterTemplate(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse frontmatterTemplate of target %s: %w", e.Name, err)
+		}
+		f.byTarget[e.Name] = tpl
+	}
+	if f.def == nil && len(f.byTarget) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// apply returns the Markdown of req with the frontmatter of the named target prepended.
+// Documents that already start with frontmatter, e.g. written by the model, and
+// templates rendering nothing leave the Markdown unchanged.
+func (f *frontmatter) apply(target string, req targets.TargetRequest) (string, error) {
+	if f == nil {
+		return req.Markdown, nil
+	}
+	tpl, ok := f.byTarget[target]
+	if !ok {
+		tpl = f.def
+	}
+	if tpl == nil {
+		return req.Markdown, nil
+	}
+	if front, _ := markdown.SplitFrontmatter(req.Markdown); front != "" {
+		return req.Markdown, nil
+	}
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, map[string]any{
+		"JobID":     req.JobID,
+		"Timestamp": req.Timestamp,
+		"Title":     deref(req.SuggestedTitle),
+		"Metadata":  req.Metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("render frontmatter: %w", err)
+	}
+	yaml := strings.Trim(buf.String(), "\r\n")
+	if strings.TrimSpace(yaml) == "" {
+		return req.Markdown, nil
+	}
+	return "---\n" + yaml + "\n---\n" + req.Markdown, nil
+}
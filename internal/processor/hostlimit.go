@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// hostLimiter bounds the number of concurrent operations per host. Hosts are limited
+// independently, so a saturated host does not delay requests to other hosts. A host is
+// forgotten once nobody holds or waits for one of its slots, so callback URLs of many
+// different hosts do not accumulate.
+type hostLimiter struct {
+	limit int
+	mu    sync.Mutex
+	slots map[string]*hostSlots
+}
+
+// hostSlots are the slots of one host and how many callers hold or wait for one.
+type hostSlots struct {
+	ch    chan struct{}
+	users int
+}
+
+// newHostLimiter returns a limiter allowing limit concurrent operations per host,
+// or nil (no limit) when limit <= 0.
+func newHostLimiter(limit int) *hostLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &hostLimiter{limit: limit, slots: make(map[string]*hostSlots)}
+}
+
+// acquire blocks until a slot for rawURL's host is free or ctx is done. The returned
+// func releases the slot. A nil limiter never blocks.
+func (l *hostLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = strings.ToLower(u.Host)
+	}
+	l.mu.Lock()
+	s, ok := l.slots[host]
+	if !ok {
+		s = &hostSlots{ch: make(chan struct{}, l.limit)}
+		l.slots[host] = s
+	}
+	s.users++
+	l.mu.Unlock()
+
+	select {
+	case s.ch <- struct{}{}:
+		return func() {
+			<-s.ch
+			l.leave(host, s)
+		}, nil
+	case <-ctx.Done():
+		l.leave(host, s)
+		return nil, ctx.Err()
+	}
+}
+
+// leave drops a caller of host's slots and the host once it has none left.
+func (l *hostLimiter) leave(host string, s *hostSlots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s.users--
+	if s.users == 0 {
+		delete(l.slots, host)
+	}
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+func TestHostLimiter_PerHost(t *testing.T) {
+	l := newHostLimiter(1)
+	release, err := l.acquire(context.Background(), "http://a.example/cb")
+	if err != nil {
+		t.Fatalf("acquire a: %v", err)
+	}
+
+	// Same host (case-insensitive) blocks while the slot is held.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "http://A.example/other"); err == nil {
+		t.Fatalf("expected second acquire for the same host to block")
+	}
+
+	// A different host proceeds.
+	releaseB, err := l.acquire(context.Background(), "http://b.example/cb")
+	if err != nil {
+		t.Fatalf("acquire b: %v", err)
+	}
+	releaseB()
+
+	release()
+	releaseA, err := l.acquire(context.Background(), "http://a.example/cb")
+	if err != nil {
+		t.Fatalf("acquire a after release: %v", err)
+	}
+	releaseA()
+	if n := len(l.slots); n != 0 {
+		t.Fatalf("%d hosts kept after all slots were released", n)
+	}
+
+	// A nil limiter never blocks.
+	var none *hostLimiter
+	r, err := none.acquire(context.Background(), "http://a.example")
+	if err != nil {
+		t.Fatalf("nil limiter: %v", err)
+	}
+	r()
+}
+
+func TestWorker_CallbackMaxPerHost(t *testing.T) {
+	const limit = 2
+	var active, peak, served atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		active.Add(-1)
+		served.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	cfg := &config.Config{Server: config.ServerConfig{CallbackMaxPerHost: limit, CallbackRetries: 1}}
+	worker := New(discardLogger(), cfg, newMemStore(), &llmMock{}, targets.NewRegistry())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := worker.sendCallbackWithRetry(context.Background(), slow.URL, callbackPayload{JobID: "j"}); err != nil {
+				t.Errorf("callback: %v", err)
+			}
+		}()
+	}
+
+	// While the slow host is saturated, callbacks to another host are not held back.
+	time.Sleep(10 * time.Millisecond)
+	if err := worker.sendCallbackWithRetry(context.Background(), fast.URL, callbackPayload{JobID: "k"}); err != nil {
+		t.Fatalf("fast callback: %v", err)
+	}
+	if n := served.Load(); n == 8 {
+		t.Fatalf("callback to another host waited for the saturated host")
+	}
+
+	wg.Wait()
+	if p := peak.Load(); p > limit {
+		t.Fatalf("peak concurrency %d exceeds limit %d", p, limit)
+	}
+	if p := peak.Load(); p != limit {
+		t.Fatalf("expected the limit to be reached, peak %d", p)
+	}
+}
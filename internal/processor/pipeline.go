@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+)
+
+// Pipeline implements jobs.Processor by splitting a job into two stages.
+// The queue workers calling Process only run the transcription stage; the finished
+// Markdown is handed over a channel to a separate pool of posting workers, so LLM
+// capacity is not idle while a slow target is being written to.
+type Pipeline struct {
+	worker  *Worker
+	posts   chan postTask
+	workers int
+	wg      sync.WaitGroup
+	mu      sync.RWMutex // read-held while sending so Shutdown cannot close posts mid-send
+	started bool
+	closed  bool
+
+	activeMu sync.Mutex
+	active   map[string]int // job id -> tasks waiting for or being posted
+}
+
+type postTask struct {
+	job         jobs.Job
+	tr          Transcription
+	traceParent string // trace of the job, continued by the post span
+}
+
+// Ensure Pipeline implements jobs.Processor
+var _ jobs.Processor = (*Pipeline)(nil)
+
+// NewPipeline creates a Pipeline using w for both stages with postWorkers posting workers.
+// capacity bounds the number of transcribed jobs waiting to be posted; when full,
+// transcription workers block until a posting worker is free.
+func NewPipeline(w *Worker, postWorkers, capacity int) *Pipeline {
+	if postWorkers <= 0 {
+		postWorkers = common.DefaultWorkerCount
+	}
+	if capacity <= 0 {
+		capacity = common.DefaultQueueCapacity
+	}
+	return &Pipeline{
+		worker:  w,
+		posts:   make(chan postTask, capacity),
+		workers: postWorkers,
+		active:  make(map[string]int),
+	}
+}
+
+// Start launches the posting workers.
+func (p *Pipeline) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started {
+		return errors.New("pipeline already started")
+	}
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.postWorker(ctx, i)
+	}
+	p.started = true
+	return nil
+}
+
+func (p *Pipeline) postWorker(ctx context.Context, idx int) {
+	defer p.wg.Done()
+	for task := range p.posts {
+		if err := p.worker.Post(tracing.WithTraceparent(ctx, task.traceParent), task.job, task.tr); err != nil && p.worker.Log != nil {
+			p.worker.Log.Error("job posting failed", "post_worker", idx, "job_id", task.job.ID, "err", err)
+		}
+		p.track(task.job.ID, -1)
+	}
+}
+
+// Process runs the transcription stage and hands the result to the posting stage.
+// It returns once the job is handed off; posting errors are recorded on the job.
+func (p *Pipeline) Process(ctx context.Context, item jobs.WorkItem) error {
+	ctx = tracing.WithTraceparent(ctx, item.TraceParent)
+	tr, err := p.worker.Transcribe(ctx, item.Job)
+	if errors.Is(err, ErrHeldForReview) || errors.Is(err, ErrNotQueued) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		err := errors.New("pipeline is shut down")
+		p.worker.finishWithError(ctx, item.Job, err)
+		return err
+	}
+	p.track(item.Job.ID, 1)
+	select {
+	case p.posts <- postTask{job: item.Job, tr: tr, traceParent: tracing.Traceparent(ctx)}:
+		return nil
+	case <-ctx.Done():
+		p.track(item.Job.ID, -1)
+		p.worker.finishWithError(ctx, item.Job, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// Holds reports whether the job waits for or is being posted, for jobs.ReaperOptions.Busy.
+func (p *Pipeline) Holds(id string) bool {
+	p.activeMu.Lock()
+	defer p.activeMu.Unlock()
+	return p.active[id] > 0
+}
+
+// track adds delta to the number of post tasks of the job.
+func (p *Pipeline) track(id string, delta int) {
+	p.activeMu.Lock()
+	defer p.activeMu.Unlock()
+	if p.active[id] += delta; p.active[id] <= 0 {
+		delete(p.active, id)
+	}
+}
+
+// Shutdown stops accepting work and waits for queued posts to finish.
+// Call it after the queue feeding Process has been shut down.
+func (p *Pipeline) Shutdown() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+	close(p.posts)
+	p.wg.Wait()
+}
@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// blockingTarget blocks every Post until release is closed.
+type blockingTarget struct {
+	release chan struct{}
+	mu      sync.Mutex
+	posted  []string
+}
+
+func (b *blockingTarget) Name() string { return "github" }
+func (b *blockingTarget) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return targets.TargetResult{}, ctx.Err()
+	}
+	b.mu.Lock()
+	b.posted = append(b.posted, req.JobID)
+	b.mu.Unlock()
+	return targets.TargetResult{TargetName: "github", Location: "loc-" + req.JobID, Commit: "c"}, nil
+}
+
+func TestPipeline_TranscriptionNotBlockedByPosting(t *testing.T) {
+	store := newMemStore()
+	tgt := &blockingTarget{release: make(chan struct{})}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	worker := New(discardLogger(), &config.Config{}, store, &llmMock{out: "md"}, reg)
+
+	p := NewPipeline(worker, 1, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	dir := t.TempDir()
+	ids := []string{"job-a", "job-b", "job-c"}
+	for _, id := range ids {
+		imgPath := filepathJoin(dir, id+".png")
+		if err := os.WriteFile(imgPath, []byte("img"), 0o600); err != nil {
+			t.Fatalf("write img: %v", err)
+		}
+		job := jobs.Job{ID: id, ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Stage: jobs.StageQueued}
+		_ = store.CreateJob(&job)
+
+		// Process must return after transcription even though posting is blocked.
+		done := make(chan error, 1)
+		go func() { done <- p.Process(ctx, jobs.WorkItem{Job: job}) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Process(%s): %v", id, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Process(%s) blocked on posting stage", id)
+		}
+	}
+
+	close(tgt.release)
+	p.Shutdown()
+
+	for _, id := range ids {
+		got, _ := store.GetJob(id)
+		if got == nil || got.Stage != jobs.StageCompleted {
+			t.Fatalf("job %s not completed: %+v", id, got)
+		}
+		if got.TargetLocation == nil || *got.TargetLocation != "loc-"+id {
+			t.Fatalf("job %s location mismatch: %v", id, got.TargetLocation)
+		}
+	}
+}
+
+func TestPipeline_TranscriptionErrorSkipsPosting(t *testing.T) {
+	store := newMemStore()
+	tgt := &blockingTarget{release: make(chan struct{})}
+	close(tgt.release)
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	worker := New(discardLogger(), &config.Config{}, store, &llmMock{out: "md"}, reg)
+
+	p := NewPipeline(worker, 2, 2)
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	job := jobs.Job{ID: "job-missing", ImagePath: filepathJoin(t.TempDir(), "missing.png"), MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := p.Process(context.Background(), jobs.WorkItem{Job: job}); err == nil {
+		t.Fatalf("expected error for missing image")
+	}
+	p.Shutdown()
+
+	got, _ := store.GetJob(job.ID)
+	if got.Stage != jobs.StageFailed {
+		t.Fatalf("expected failed job, got %s", got.Stage)
+	}
+	if len(tgt.posted) != 0 {
+		t.Fatalf("failed transcription must not be posted: %v", tgt.posted)
+	}
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+)
+
+// ErrHeldForReview is returned by Transcribe when the quality gate held the job in the
+// needs_review stage. It is not a failure: the job waits for an operator.
+var ErrHeldForReview = errors.New("held for review by the quality gate")
+
+// qualityGate checks transcriptions before they are posted.
+type qualityGate struct {
+	rejectTruncated bool
+	minLength       int
+	refusals        []*regexp.Regexp
+}
+
+// newQualityGate compiles c, or returns nil when the gate is disabled.
+func newQualityGate(c config.QualityGateConfig) (*qualityGate, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	g := &qualityGate{rejectTruncated: c.RejectTruncated, minLength: c.MinLength}
+	for _, p := range c.RefusalPatterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("refusal pattern %q: %w", p, err)
+		}
+		g.refusals = append(g.refusals, re)
+	}
+	return g, nil
+}
+
+// check returns the reasons md fails the gate; none if it passes or the gate is nil.
+func (g *qualityGate) check(md, finishReason string) []string {
+	if g == nil {
+		return nil
+	}
+	var reasons []string
+	if g.rejectTruncated && finishReason == llm.FinishReasonLength {
+		reasons = append(reasons, "truncated by the token limit")
+	}
+	trimmed := strings.TrimSpace(md)
+	if n := utf8.RuneCountInString(trimmed); g.minLength > 0 && n < g.minLength {
+		reasons = append(reasons, fmt.Sprintf("%d characters, below the minimum of %d", n, g.minLength))
+	}
+	for _, re := range g.refusals {
+		if re.MatchString(trimmed) {
+			reasons = append(reasons, "looks like a refusal: matches "+re.String()[len("(?i)"):])
+			break
+		}
+	}
+	return reasons
+}
+
+// holdForReview stores the transcription of a job that failed the quality gate and moves
+// the job to needs_review. It returns ErrHeldForReview, or the error that failed the job.
+func (w *Worker) holdForReview(ctx context.Context, job jobs.Job, tr Transcription, reasons []string) error {
+	rs, ok := w.Store.(jobs.ReviewStore)
+	if !ok {
+		err := fmt.Errorf("quality gate: %s; the job store cannot hold jobs for review", strings.Join(reasons, "; "))
+		w.finishWithError(ctx, job, err)
+		return err
+	}
+	review := heldTranscription(tr)
+	review.Reasons = reasons
+	if err := rs.HoldForReview(job.ID, review); err != nil {
+		err = fmt.Errorf("hold for review: %w", err)
+		w.finishWithError(ctx, job, err)
+		return err
+	}
+	w.Events.Publish(job.ID, jobs.StageNeedsReview)
+	if w.Log != nil {
+		w.Log.WarnContext(ctx, "job held for review", "job_id", job.ID, "reasons", reasons)
+	}
+	w.notify(ctx, job, callbackPayload{
+		JobID:  job.ID,
+		Status: common.StatusNeedsReview,
+		Stage:  string(jobs.StageNeedsReview),
+	})
+	return ErrHeldForReview
+}
+
+// Approve posts the transcription the quality gate held for job, bypassing the gate and
+// any post windows. A non-empty markdown, e.g. corrected by the reviewer, is posted
+// instead of the held one after the configured redaction. It returns
+// jobs.ErrNotInReview if the job is not held.
+func (w *Worker) Approve(ctx context.Context, job jobs.Job, markdown string) error {
+	rs, ok := w.Store.(jobs.ReviewStore)
+	if !ok {
+		return jobs.ErrNotInReview
+	}
+	review, err := rs.TakeReview(job.ID, jobs.StagePosting)
+	if err != nil {
+		return err
+	}
+	if review == nil {
+		return jobs.ErrNotInReview
+	}
+	if markdown != "" {
+		var info jobs.TranscriptionInfo
+		if markdown, err = w.redact(job.ID, markdown, &info); err != nil {
+			w.finishWithError(ctx, job, err)
+			return err
+		}
+		review.Markdown = markdown
+	}
+	if w.Log != nil {
+		w.Log.InfoContext(ctx, "held job approved", "job_id", job.ID, "edited", markdown != "")
+	}
+	return w.Post(ctx, job, releasedTranscription(review))
+}
+
+// heldTranscription returns tr as stored while the job is held.
+func heldTranscription(tr Transcription) jobs.Review {
+	return jobs.Review{
+		Markdown:   tr.Markdown,
+		Model:      tr.Model,
+		TokenUsage: tr.TokenUsage,
+		DurationMs: tr.Duration.Milliseconds(),
+		Language:   tr.Language,
+		Flavor:     tr.Flavor,
+		Title:      tr.Title,
+	}
+}
+
+// releasedTranscription returns the transcription to post from a held one.
+func releasedTranscription(held *jobs.Review) Transcription {
+	return Transcription{
+		Markdown:   held.Markdown,
+		Model:      held.Model,
+		TokenUsage: held.TokenUsage,
+		Duration:   time.Duration(held.DurationMs) * time.Millisecond,
+		Language:   held.Language,
+		Flavor:     held.Flavor,
+		Title:      held.Title,
+	}
+}
+
+// Reject fails the job the quality gate held without posting it, with the reviewer's
+// optional reason as the job error. Like any failure, it publishes the stage and sends
+// the failed callback. It returns jobs.ErrNotInReview if the job is not held.
+func (w *Worker) Reject(ctx context.Context, job jobs.Job, reason string) error {
+	rs, ok := w.Store.(jobs.ReviewStore)
+	if !ok {
+		return jobs.ErrNotInReview
+	}
+	review, err := rs.TakeReview(job.ID, jobs.StageFailed)
+	if err != nil {
+		return err
+	}
+	if review == nil {
+		return jobs.ErrNotInReview
+	}
+	msg := jobs.RejectedPrefix
+	if reason != "" {
+		msg += ": " + reason
+	}
+	w.fail(ctx, job, errors.New(msg), nil)
+	return nil
+}
@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// reviewStore adds an in-memory jobs.ReviewStore to memStore.
+type reviewStore struct {
+	*memStore
+	reviews map[string]jobs.Review
+}
+
+func (s *reviewStore) HoldForReview(id string, review jobs.Review) error {
+	s.reviews[id] = review
+	return s.UpdateStage(id, jobs.StageNeedsReview, nil)
+}
+
+func (s *reviewStore) TakeReview(id string, stage jobs.Stage) (*jobs.Review, error) {
+	r, ok := s.reviews[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.reviews, id)
+	return &r, s.UpdateStage(id, stage, nil)
+}
+
+func (s *reviewStore) ListByStage(stage jobs.Stage, limit int) ([]jobs.Job, error) {
+	return nil, errors.New("not used")
+}
+
+func TestWorker_Process_QualityGate(t *testing.T) {
+	gate := config.QualityGateConfig{Enabled: true, RejectTruncated: true, MinLength: 10, RefusalPatterns: config.DefaultRefusalPatterns}
+	cases := []struct {
+		name       string
+		out        string
+		wantHeld   bool
+		wantReason string
+	}{
+		{name: "passes", out: "# Notes\n\n- budget approved"},
+		{name: "refusal", out: "I'm sorry, but I can't read the text in this image.", wantHeld: true, wantReason: "looks like a refusal"},
+		{name: "too short", out: "ok", wantHeld: true, wantReason: "2 characters, below the minimum of 10"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &reviewStore{memStore: newMemStore(), reviews: map[string]jobs.Review{}}
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github", Location: "notes.md"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			cfg := &config.Config{QualityGate: gate}
+			worker := New(discardLogger(), cfg, store, &llmMock{out: tc.out}, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			title := "Notes"
+			job := jobs.Job{ID: "job-gate", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Title: &title}
+			_ = store.CreateJob(&job)
+			if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			got, _ := store.GetJob(job.ID)
+			if !tc.wantHeld {
+				if got.Stage != jobs.StageCompleted || len(tgt.reqs) != 1 {
+					t.Fatalf("passing job not posted: stage=%s posts=%d", got.Stage, len(tgt.reqs))
+				}
+				return
+			}
+			if got.Stage != jobs.StageNeedsReview || len(tgt.reqs) != 0 {
+				t.Fatalf("failing job not held: stage=%s posts=%d", got.Stage, len(tgt.reqs))
+			}
+			if len(got.Warnings) != 1 || !strings.Contains(got.Warnings[0], tc.wantReason) {
+				t.Fatalf("warnings = %v, want %q", got.Warnings, tc.wantReason)
+			}
+
+			// Approval posts the held transcription, title included, exactly once.
+			if err := worker.Approve(context.Background(), job, ""); err != nil {
+				t.Fatalf("Approve: %v", err)
+			}
+			if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != "# Notes\n\n"+tc.out {
+				t.Fatalf("approved post = %+v", tgt.reqs)
+			}
+			if got, _ := store.GetJob(job.ID); got.Stage != jobs.StageCompleted {
+				t.Fatalf("stage after approval = %s", got.Stage)
+			}
+			if err := worker.Approve(context.Background(), job, ""); !errors.Is(err, jobs.ErrNotInReview) {
+				t.Fatalf("second approval: %v", err)
+			}
+		})
+	}
+}
+
+func TestWorker_Reject(t *testing.T) {
+	store := &reviewStore{memStore: newMemStore(), reviews: map[string]jobs.Review{}}
+	tgt := &targetMock{name: "github"}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	var callbacks []callbackPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p callbackPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		callbacks = append(callbacks, p)
+	}))
+	defer srv.Close()
+	cfg := &config.Config{Server: config.ServerConfig{CallbackEvents: []string{common.StatusFailed}}}
+	worker := New(discardLogger(), cfg, store, &llmMock{}, reg)
+
+	url := srv.URL
+	job := jobs.Job{ID: "job-reject", TargetName: "github", CallbackURL: &url}
+	_ = store.CreateJob(&job)
+	if err := store.HoldForReview(job.ID, jobs.Review{Markdown: "I can't read this."}); err != nil {
+		t.Fatalf("HoldForReview: %v", err)
+	}
+	if err := worker.Reject(context.Background(), job, "blurry photo"); err != nil {
+		t.Fatalf("Reject: %v", err)
+	}
+	got, _ := store.GetJob(job.ID)
+	if got.Stage != jobs.StageFailed || got.ErrorMessage == nil || *got.ErrorMessage != "rejected in review: blurry photo" || len(tgt.reqs) != 0 {
+		t.Fatalf("rejected job = %+v, posts %d", got, len(tgt.reqs))
+	}
+	// The failed callback carries the rejection, which is not an internal error.
+	if len(callbacks) != 1 || callbacks[0].Status != common.StatusFailed || deref(callbacks[0].Error) != "rejected in review: blurry photo" {
+		t.Fatalf("callbacks = %+v", callbacks)
+	}
+	if err := worker.Reject(context.Background(), job, ""); !errors.Is(err, jobs.ErrNotInReview) {
+		t.Fatalf("second rejection: %v", err)
+	}
+}
+
+func TestWorker_Approve_EditedIsRedacted(t *testing.T) {
+	store := &reviewStore{memStore: newMemStore(), reviews: map[string]jobs.Review{}}
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{Server: config.ServerConfig{Redaction: config.RedactionConfig{Enabled: true, Patterns: []string{"email"}}}}
+	worker := New(discardLogger(), cfg, store, &llmMock{}, reg)
+
+	job := jobs.Job{ID: "job-edit-redact", TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := store.HoldForReview(job.ID, jobs.Review{Markdown: "held"}); err != nil {
+		t.Fatalf("HoldForReview: %v", err)
+	}
+	if err := worker.Approve(context.Background(), job, "Mail jane@example.com"); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != "Mail [REDACTED]" {
+		t.Fatalf("edited post = %+v", tgt.reqs)
+	}
+}
+
+func TestWorker_Approve_Edited(t *testing.T) {
+	store := &reviewStore{memStore: newMemStore(), reviews: map[string]jobs.Review{}}
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github", Location: "notes.md"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	worker := New(discardLogger(), &config.Config{}, store, &llmMock{}, reg)
+
+	job := jobs.Job{ID: "job-edit", TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := store.HoldForReview(job.ID, jobs.Review{Markdown: "I can't read this.", Model: "m"}); err != nil {
+		t.Fatalf("HoldForReview: %v", err)
+	}
+	if err := worker.Approve(context.Background(), job, "# Fixed\n\nby hand"); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != "# Fixed\n\nby hand" || tgt.reqs[0].Model != "m" {
+		t.Fatalf("edited post = %+v", tgt.reqs)
+	}
+}
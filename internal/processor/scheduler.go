@@ -0,0 +1,185 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/schedule"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+)
+
+// schedulerTick is how often the Scheduler checks whether deferred posts are due.
+const schedulerTick = time.Minute
+
+// Scheduler implements jobs.Processor for quiet hours: jobs are transcribed right away,
+// but outside the post windows the result is held in the pending_post stage and posted
+// once a window opens. With a store implementing jobs.HeldPostStore, held results are
+// persisted and Restore picks them up again after a restart; otherwise they live in
+// memory only.
+type Scheduler struct {
+	worker   *Worker
+	schedule *schedule.Schedule
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending []deferredPost // in transcription order
+	closed  bool
+}
+
+// deferredPost is a job waiting for a post window. When held, its transcription is in the
+// store and taken from there when it is posted.
+type deferredPost struct {
+	postTask
+	held bool
+}
+
+// Ensure Scheduler implements jobs.Processor
+var _ jobs.Processor = (*Scheduler)(nil)
+
+// NewScheduler creates a Scheduler posting with w only while s is open.
+func NewScheduler(w *Worker, s *schedule.Schedule) *Scheduler {
+	return &Scheduler{worker: w, schedule: s, now: time.Now}
+}
+
+// Process transcribes the job and posts it if a window is open, or defers the post.
+func (s *Scheduler) Process(ctx context.Context, item jobs.WorkItem) error {
+	ctx = tracing.WithTraceparent(ctx, item.TraceParent)
+	tr, err := s.worker.Transcribe(ctx, item.Job)
+	if errors.Is(err, ErrHeldForReview) || errors.Is(err, ErrNotQueued) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	if s.schedule.Open(now) {
+		return s.worker.Post(ctx, item.Job, tr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		err := errors.New("scheduler is shut down")
+		s.worker.finishWithError(ctx, item.Job, err)
+		return err
+	}
+	hs, held := s.worker.Store.(jobs.HeldPostStore)
+	if held {
+		err = hs.HoldForPost(item.Job.ID, heldTranscription(tr))
+	} else {
+		err = s.worker.Store.UpdateStage(item.Job.ID, jobs.StagePendingPost, nil)
+	}
+	if err != nil {
+		err = fmt.Errorf("update stage to pending_post: %w", err)
+		s.worker.finishWithError(ctx, item.Job, err)
+		return err
+	}
+	s.worker.Events.Publish(item.Job.ID, jobs.StagePendingPost)
+	s.pending = append(s.pending, deferredPost{postTask: postTask{job: item.Job, tr: tr, traceParent: tracing.Traceparent(ctx)}, held: held})
+	if s.worker.Log != nil {
+		s.worker.Log.InfoContext(ctx, "job post deferred", "job_id", item.Job.ID, "until", s.schedule.Next(now))
+	}
+	return nil
+}
+
+// Run posts deferred jobs as soon as a window is open, checking every minute, until ctx
+// is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.PostDue(ctx)
+		}
+	}
+}
+
+// PostDue posts all deferred jobs in transcription order if a window is open and
+// returns how many were posted. Failures are recorded on the jobs.
+func (s *Scheduler) PostDue(ctx context.Context) int {
+	if !s.schedule.Open(s.now()) {
+		return 0
+	}
+	s.mu.Lock()
+	due := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	for i, task := range due {
+		if ctx.Err() != nil {
+			// Keep the rest for the next run, ahead of anything deferred meanwhile.
+			s.mu.Lock()
+			s.pending = append(due[i:], s.pending...)
+			s.mu.Unlock()
+			return i
+		}
+		if err := s.post(ctx, task); err != nil && s.worker.Log != nil {
+			s.worker.Log.Error("deferred job posting failed", "job_id", task.job.ID, "err", err)
+		}
+	}
+	return len(due)
+}
+
+// post posts a deferred job. A held transcription is taken from the store first; if it is
+// gone, e.g. because another instance sharing the store posted it, the job is skipped.
+func (s *Scheduler) post(ctx context.Context, task deferredPost) error {
+	ctx = tracing.WithTraceparent(ctx, task.traceParent)
+	if !task.held {
+		return s.worker.Post(ctx, task.job, task.tr)
+	}
+	held, err := s.worker.Store.(jobs.HeldPostStore).TakeHeldPost(task.job.ID, jobs.StagePosting)
+	if err != nil {
+		err = fmt.Errorf("take held transcription: %w", err)
+		s.worker.finishWithError(ctx, task.job, err)
+		return err
+	}
+	if held == nil {
+		return nil
+	}
+	return s.worker.Post(ctx, task.job, releasedTranscription(held))
+}
+
+// Restore queues the jobs the store holds in pending_post, e.g. deferred before a
+// restart, for the next post window and returns how many there are. It does nothing
+// unless the store implements jobs.HeldPostStore. Call it before Run.
+func (s *Scheduler) Restore() (int, error) {
+	hs, ok := s.worker.Store.(jobs.HeldPostStore)
+	if !ok {
+		return 0, nil
+	}
+	held, err := hs.ListByStages(jobs.StagePendingPost)
+	if err != nil {
+		return 0, fmt.Errorf("list pending_post jobs: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	restored := make([]deferredPost, 0, len(held)+len(s.pending))
+	for _, job := range held {
+		restored = append(restored, deferredPost{postTask: postTask{job: job}, held: true})
+	}
+	s.pending = append(restored, s.pending...)
+	return len(held), nil
+}
+
+// Shutdown stops accepting work and fails the jobs still waiting for a window whose
+// transcriptions are not persisted; held ones stay in pending_post for Restore. Call it
+// after the queue feeding Process has been shut down.
+func (s *Scheduler) Shutdown() {
+	s.mu.Lock()
+	s.closed = true
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	// Failed outside the lock, as failure callbacks may take a while.
+	for _, task := range pending {
+		if !task.held {
+			s.worker.finishWithError(context.Background(), task.job, errors.New("shut down before the next post window"))
+		}
+	}
+}
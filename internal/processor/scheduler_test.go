@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/schedule"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// heldPostStore adds an in-memory jobs.HeldPostStore to memStore.
+type heldPostStore struct {
+	*memStore
+	held map[string]jobs.Review
+}
+
+func (s *heldPostStore) HoldForPost(id string, held jobs.Review) error {
+	s.held[id] = held
+	return s.UpdateStage(id, jobs.StagePendingPost, nil)
+}
+
+func (s *heldPostStore) TakeHeldPost(id string, stage jobs.Stage) (*jobs.Review, error) {
+	r, ok := s.held[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.held, id)
+	return &r, s.UpdateStage(id, stage, nil)
+}
+
+func (s *heldPostStore) ListByStages(stages ...jobs.Stage) ([]jobs.Job, error) {
+	var out []jobs.Job
+	for id := range s.held {
+		j, _ := s.GetJob(id)
+		out = append(out, *j)
+	}
+	return out, nil
+}
+
+func TestScheduler_DefersPostsUntilWindowOpens(t *testing.T) {
+	store := newMemStore()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github", Location: "loc"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	worker := New(discardLogger(), &config.Config{}, store, &llmMock{out: "md"}, reg)
+	sched, err := schedule.New([]schedule.Window{{Start: "08:00", End: "18:00"}}, "UTC")
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	s := NewScheduler(worker, sched)
+	now := time.Date(2025, 3, 4, 22, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	dir := t.TempDir()
+	for _, id := range []string{"job-a", "job-b"} {
+		imgPath := filepathJoin(dir, id+".png")
+		if err := os.WriteFile(imgPath, []byte("img"), 0o600); err != nil {
+			t.Fatalf("write img: %v", err)
+		}
+		job := jobs.Job{ID: id, ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Stage: jobs.StageQueued}
+		_ = store.CreateJob(&job)
+		if err := s.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+		if j, _ := store.GetJob(id); j.Stage != jobs.StagePendingPost {
+			t.Fatalf("%s: stage %q, want pending_post", id, j.Stage)
+		}
+	}
+	if len(tgt.reqs) != 0 || s.PostDue(context.Background()) != 0 {
+		t.Fatalf("posted during quiet hours")
+	}
+
+	now = now.Add(10 * time.Hour) // 08:00 the next day
+	if n := s.PostDue(context.Background()); n != 2 {
+		t.Fatalf("PostDue = %d, want 2", n)
+	}
+	if len(tgt.reqs) != 2 || tgt.reqs[0].JobID != "job-a" || tgt.reqs[1].JobID != "job-b" || tgt.reqs[0].Markdown != "md" {
+		t.Fatalf("unexpected posts %+v", tgt.reqs)
+	}
+	for _, id := range []string{"job-a", "job-b"} {
+		if j, _ := store.GetJob(id); j.Stage != jobs.StageCompleted {
+			t.Fatalf("%s: stage %q, want completed", id, j.Stage)
+		}
+	}
+
+	// Within a window jobs are posted right away.
+	imgPath := filepathJoin(dir, "job-c.png")
+	_ = os.WriteFile(imgPath, []byte("img"), 0o600)
+	job := jobs.Job{ID: "job-c", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := s.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if len(tgt.reqs) != 3 {
+		t.Fatalf("job in window not posted immediately")
+	}
+}
+
+func TestScheduler_ShutdownFailsPendingJobs(t *testing.T) {
+	store := newMemStore()
+	reg := targets.NewRegistry()
+	reg.Add(&targetMock{name: "github"})
+	worker := New(discardLogger(), &config.Config{}, store, &llmMock{out: "md"}, reg)
+	sched, _ := schedule.New([]schedule.Window{{Start: "08:00", End: "09:00", Days: []string{"sat"}}}, "")
+	s := NewScheduler(worker, sched)
+	s.now = func() time.Time { return time.Date(2025, 3, 4, 8, 30, 0, 0, time.UTC) } // a Tuesday
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	_ = os.WriteFile(imgPath, []byte("img"), 0o600)
+	job := jobs.Job{ID: "job-1", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := s.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	s.Shutdown()
+	if j, _ := store.GetJob("job-1"); j.Stage != jobs.StageFailed {
+		t.Fatalf("stage %q, want failed", j.Stage)
+	}
+}
+
+func TestScheduler_RestoresHeldPostsAfterRestart(t *testing.T) {
+	store := &heldPostStore{memStore: newMemStore(), held: map[string]jobs.Review{}}
+	reg := targets.NewRegistry()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github", Location: "loc"}}
+	reg.Add(tgt)
+	worker := New(discardLogger(), &config.Config{}, store, &llmMock{out: "md"}, reg)
+	sched, _ := schedule.New([]schedule.Window{{Start: "08:00", End: "18:00"}}, "UTC")
+	now := time.Date(2025, 3, 4, 22, 0, 0, 0, time.UTC)
+	s := NewScheduler(worker, sched)
+	s.now = func() time.Time { return now }
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	_ = os.WriteFile(imgPath, []byte("img"), 0o600)
+	job := jobs.Job{ID: "job-1", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := s.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	s.Shutdown()
+	if j, _ := store.GetJob("job-1"); j.Stage != jobs.StagePendingPost {
+		t.Fatalf("stage %q after shutdown, want pending_post", j.Stage)
+	}
+
+	// A new scheduler on the same store, as after a restart.
+	restarted := NewScheduler(worker, sched)
+	restarted.now = func() time.Time { return now.Add(10 * time.Hour) }
+	if n, err := restarted.Restore(); err != nil || n != 1 {
+		t.Fatalf("Restore = %d, %v; want 1", n, err)
+	}
+	if n := restarted.PostDue(context.Background()); n != 1 {
+		t.Fatalf("PostDue = %d, want 1", n)
+	}
+	if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != "md" {
+		t.Fatalf("unexpected posts %+v", tgt.reqs)
+	}
+	if j, _ := store.GetJob("job-1"); j.Stage != jobs.StageCompleted {
+		t.Fatalf("stage %q, want completed", j.Stage)
+	}
+}
@@ -3,21 +3,50 @@ package processor
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jo-hoe/gostwriter/internal/common"
 	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/ghwebhook"
+	"github.com/jo-hoe/gostwriter/internal/imageproc"
 	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/langdetect"
 	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/markdown"
+	"github.com/jo-hoe/gostwriter/internal/redact"
+	"github.com/jo-hoe/gostwriter/internal/storage"
 	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+	"github.com/jo-hoe/gostwriter/internal/util"
 )
 
+// warningTruncated is recorded on jobs whose transcription hit the token limit.
+const warningTruncated = "transcription truncated: finish_reason=length"
+
+// warningSuspicious prefixes the warning recorded on jobs whose transcription is shorter
+// than llm.minMarkdownLength.
+const warningSuspicious = "suspicious"
+
+// commentTimeout bounds a single GitHub comment request.
+const commentTimeout = 30 * time.Second
+
+// callbackTimeout bounds a single callback attempt, so a receiver that never answers
+// does not hold its host slot forever.
+const callbackTimeout = 30 * time.Second
+
 // Worker implements jobs.Processor to handle transcription and posting.
 type Worker struct {
 	Log     *slog.Logger
@@ -25,135 +54,944 @@ type Worker struct {
 	Store   jobs.Store
 	LLM     llm.Client
 	Targets *targets.Registry
+	Tracer  *tracing.Tracer // records transcribe and post spans; nil when tracing is off
+	// Images reads job images from the upload backend; nil reads them from local disk.
+	Images storage.ImageStore
+	// Events receives each stage change the worker stores, for live status streams; nil
+	// publishes nothing.
+	Events *jobs.Events
+
+	redactor  *redact.Redactor    // nil when redaction is disabled
+	redactErr error               // set if the redaction config could not be compiled; jobs fail closed
+	callbacks *hostLimiter        // per-host callback concurrency; nil when unlimited
+	callHTTP  *http.Client        // delivers callbacks within callbackTimeout
+	breaker   *breaker            // fails LLM calls fast during provider outages; nil when disabled
+	pipeline  *imageproc.Pipeline // image preprocessing; nil when no transforms are configured
+	pipeErr   error               // set if the pipeline config is invalid; jobs fail closed
+	comments  *ghwebhook.Client   // reports results of webhook jobs on their issue; nil when disabled
+	gate      *qualityGate        // holds poor transcriptions for review; nil when disabled
+	gateErr   error               // set if the quality gate config is invalid; jobs fail closed
+	front     *frontmatter        // prepended to posted documents; nil when not configured
+	frontErr  error               // set if a frontmatter template is invalid; posts fail closed
+
+	debugRedactor *redact.Redactor // masks LLM output in debug logs of sampled jobs
 }
 
 // Ensure Worker implements jobs.Processor
 var _ jobs.Processor = (*Worker)(nil)
 
 func New(log *slog.Logger, cfg *config.Config, store jobs.Store, c llm.Client, regs *targets.Registry) *Worker {
-	return &Worker{
+	w := &Worker{
 		Log:     log,
 		Cfg:     cfg,
 		Store:   store,
 		LLM:     c,
 		Targets: regs,
 	}
+	w.callbacks = newHostLimiter(cfg.Server.CallbackMaxPerHost)
+	w.callHTTP = &http.Client{Timeout: callbackTimeout}
+	w.breaker = newBreaker(cfg.LLM.CircuitBreaker, log)
+	w.pipeline, w.pipeErr = imageproc.NewPipeline(imageTransforms(cfg.LLM))
+	w.gate, w.gateErr = newQualityGate(cfg.QualityGate)
+	w.front, w.frontErr = newFrontmatter(cfg)
+	if wh := cfg.Server.GitHubWebhook; wh.CommentOnCompletion {
+		w.comments = ghwebhook.NewClient(wh, &http.Client{Timeout: commentTimeout})
+	}
+	if rc := cfg.Server.Redaction; rc.Enabled {
+		w.redactor, w.redactErr = redact.New(rc.Patterns, rc.Replacement)
+	}
+	if cfg.LLM.DebugSampleRate > 0 {
+		w.debugRedactor = w.redactor
+		if w.debugRedactor == nil {
+			w.debugRedactor, _ = redact.New(redact.BuiltinNames(), "")
+		}
+	}
+	return w
 }
 
 func (w *Worker) Process(ctx context.Context, item jobs.WorkItem) error {
-	job := item.Job
-	now := time.Now().UTC()
-	if err := w.Store.UpdateStage(job.ID, jobs.StageTranscribing, &now); err != nil {
+	ctx = tracing.WithTraceparent(ctx, item.TraceParent)
+	tr, err := w.Transcribe(ctx, item.Job)
+	if errors.Is(err, ErrHeldForReview) || errors.Is(err, ErrNotQueued) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return w.Post(ctx, item.Job, tr)
+}
+
+// start moves the job to transcribing. With a jobs.Starter store, a job that is no longer
+// queued is not started and ErrNotQueued is returned.
+func (w *Worker) start(id string, now time.Time) error {
+	starter, ok := w.Store.(jobs.Starter)
+	if !ok {
+		if err := w.Store.UpdateStage(id, jobs.StageTranscribing, &now); err != nil {
+			return fmt.Errorf("update stage to transcribing: %w", err)
+		}
+		return nil
+	}
+	started, err := starter.StartJob(id, jobs.StageTranscribing, now)
+	if err != nil {
 		return fmt.Errorf("update stage to transcribing: %w", err)
 	}
+	if !started {
+		if w.Log != nil {
+			w.Log.Warn("job skipped: no longer queued", "job_id", id)
+		}
+		return ErrNotQueued
+	}
+	return nil
+}
+
+// Transcription is the output of the transcription stage handed to the posting stage.
+type Transcription struct {
+	Markdown   string
+	Model      string        // model that produced the Markdown
+	TokenUsage int           // total tokens spent, including retries and consensus runs
+	Duration   time.Duration // time spent in the transcription stage
+	Language   string        // detected document language; empty if unknown or detection is off
+	Flavor     string        // Markdown flavor the transcription was written in; empty if none
+	Title      string        // title derived from the Markdown for jobs without one; empty if none
+}
+
+// ErrNotQueued is returned by Transcribe when the job left the queued stage before a
+// worker got to it, e.g. because it was reaped or queued again; the item is dropped.
+var ErrNotQueued = errors.New("job is no longer queued")
+
+// Transcribe runs the transcription stage of a job and returns the Markdown to post
+// together with processing metrics. On failure the job is marked failed. If the quality
+// gate holds the job for review, it returns ErrHeldForReview, and ErrNotQueued if the job
+// was not queued anymore.
+func (w *Worker) Transcribe(ctx context.Context, job jobs.Job) (_ Transcription, err error) {
+	ctx, span := w.Tracer.Start(ctx, "transcribe", tracing.KindInternal)
+	span.SetAttr("job.id", job.ID)
+	defer func() { span.End(err) }()
+
+	now := time.Now().UTC()
+	if err := w.start(job.ID, now); err != nil {
+		return Transcription{}, err
+	}
+	w.Events.Publish(job.ID, jobs.StageTranscribing)
 	if w.Log != nil {
-		w.Log.Info("job transcribing", "job_id", job.ID)
+		w.Log.InfoContext(ctx, "job transcribing", "job_id", job.ID)
+	}
+	if err := w.checkPeriodBudget(now); err != nil {
+		w.finishWithError(ctx, job, err)
+		return Transcription{}, err
 	}
 
-	f, err := os.Open(job.ImagePath)
+	info := jobs.TranscriptionInfo{Flavor: w.Cfg.PostProcess.MarkdownFlavor}
+	result, err := w.transcribeCached(ctx, job, &info)
 	if err != nil {
-		w.finishWithError(job.ID, fmt.Errorf("open image: %w", err))
-		return err
+		w.finishWithError(ctx, job, err)
+		return Transcription{}, err
+	}
+	info.FinishReason = result.FinishReason
+	model := w.modelName(job, result.Model)
+	info.EstimatedCost = w.estimateCost(model, result.Usage)
+	if w.Cfg.LLM.StoreProviderMeta && result.Meta != nil {
+		if b, err := json.Marshal(result.Meta); err == nil {
+			info.ProviderMeta = b
+		}
+	}
+	if result.FinishReason == llm.FinishReasonLength {
+		info.Warnings = append(info.Warnings, warningTruncated)
+	}
+	md := result.Markdown
+	if w.Cfg.LLM.DetectLanguage && info.Language == "" {
+		// Heuristic mode, cache hits and clients without a detection call.
+		info.Language = langdetect.Detect(md)
+	}
+	if w.Log != nil {
+		w.Log.InfoContext(ctx, "transcription completed", "job_id", job.ID, "finish_reason", result.FinishReason, "language", info.Language)
+	}
+
+	// Optionally prepend title as a heading, after any frontmatter the model wrote.
+	if job.Title != nil && *job.Title != "" && w.Cfg.Server.PrependTitle() {
+		level := min(max(w.Cfg.Server.TitleHeadingLevel, 1), 6)
+		front, body := markdown.SplitFrontmatter(md)
+		md = fmt.Sprintf("%s%s %s\n\n%s", front, strings.Repeat("#", level), *job.Title, body)
 	}
-	defer func() { _ = f.Close() }()
 
-	md, err := w.LLM.TranscribeImage(ctx, f, job.MimeType)
+	md, err = w.redact(job.ID, md, &info)
 	if err != nil {
-		w.finishWithError(job.ID, fmt.Errorf("llm transcribe: %w", err))
-		return err
+		w.finishWithError(ctx, job, err)
+		return Transcription{}, err
 	}
-	if w.Log != nil {
-		w.Log.Info("transcription completed", "job_id", job.ID)
+	// Derived before the transforms, which may shift the H1 to a deeper level.
+	var title string
+	if w.Cfg.PostProcess.DeriveTitleFromContent && (job.Title == nil || *job.Title == "") {
+		title = markdown.FirstHeading(md)
+	}
+	md = w.postProcess(md, &info)
+
+	if w.gateErr != nil {
+		err := fmt.Errorf("quality gate: %w", w.gateErr)
+		w.finishWithError(ctx, job, err)
+		return Transcription{}, err
+	}
+	// The raw output is checked: the title and transforms would hide a refusal.
+	reasons := w.gate.check(result.Markdown, result.FinishReason)
+	for _, r := range reasons {
+		info.Warnings = append(info.Warnings, "quality gate: "+r)
+	}
+	overBudget := w.overJobBudget(info.EstimatedCost)
+	if overBudget != "" {
+		info.Warnings = append(info.Warnings, "cost budget: "+overBudget)
+	}
+
+	if err := w.Store.SaveTranscriptionInfo(job.ID, info); err != nil {
+		w.finishWithError(ctx, job, fmt.Errorf("save transcription info: %w", err))
+		return Transcription{}, err
+	}
+	if overBudget != "" {
+		if w.Cfg.LLM.CostBudget.Action != config.CostBudgetHold {
+			err := errors.New("cost budget: " + overBudget)
+			w.finishWithError(ctx, job, err)
+			return Transcription{}, err
+		}
+		reasons = append(reasons, overBudget)
+	}
+	tr := Transcription{
+		Markdown:   md,
+		Model:      model,
+		TokenUsage: result.Usage.TotalTokens,
+		Duration:   time.Since(now),
+		Language:   info.Language,
+		Flavor:     info.Flavor,
+		Title:      title,
+	}
+	if len(reasons) > 0 {
+		return Transcription{}, w.holdForReview(ctx, job, tr, reasons)
+	}
+	return tr, nil
+}
+
+// modelName returns the model reported by the provider, or the one the job asked for.
+func (w *Worker) modelName(job jobs.Job, reported string) string {
+	if reported != "" {
+		return reported
+	}
+	if job.Model != nil {
+		return *job.Model
+	}
+	if strings.EqualFold(w.Cfg.LLM.Provider, "aiproxy") {
+		return w.Cfg.LLM.AIProxy.Model
+	}
+	return w.Cfg.LLM.Provider
+}
+
+// postProcess applies the configured Markdown transforms.
+func (w *Worker) postProcess(md string, info *jobs.TranscriptionInfo) string {
+	if info.Flavor != "" {
+		var skipped int
+		md, skipped = markdown.Flavor(info.Flavor).Enforce(md)
+		if skipped > 0 {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("%s: left %d complex HTML tables unchanged", info.Flavor, skipped))
+		}
 	}
+	if w.Cfg.PostProcess.NormalizeTables {
+		var skipped int
+		md, skipped = markdown.NormalizeTables(md)
+		if skipped > 0 {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("tables: left %d complex HTML tables unchanged", skipped))
+		}
+	}
+	if w.Cfg.PostProcess.GenerateTOC {
+		md = markdown.InsertTOC(md)
+	}
+	// After the TOC, which lists the headings by their original levels.
+	md = markdown.ShiftHeadings(md, w.Cfg.PostProcess.HeadingOffset)
+	return md
+}
 
-	// Optionally prepend title as Markdown H1.
-	if job.Title != nil && *job.Title != "" {
-		md = fmt.Sprintf("# %s\n\n%s", *job.Title, md)
+// redact masks sensitive content in md according to the redaction config, or fails
+// if the config asks to reject such documents. Matched content is never logged.
+func (w *Worker) redact(jobID, md string, info *jobs.TranscriptionInfo) (string, error) {
+	if w.redactErr != nil {
+		return "", fmt.Errorf("redaction: %w", w.redactErr)
+	}
+	if w.redactor == nil {
+		return md, nil
+	}
+	if w.Cfg.Server.Redaction.FailOnMatch {
+		if w.redactor.Matches(md) {
+			return "", errors.New("redaction: sensitive content detected")
+		}
+		return md, nil
+	}
+	out, n := w.redactor.Redact(md)
+	if n > 0 {
+		info.Warnings = append(info.Warnings, fmt.Sprintf("redacted %d sensitive matches", n))
+		if w.Log != nil {
+			w.Log.Info("sensitive content redacted", "job_id", jobID, "matches", n)
+		}
 	}
+	return out, nil
+}
+
+// Post runs the posting stage of a job: it sends the transcription to the job's target,
+// records the result and delivers the callback. On failure the job is marked failed.
+func (w *Worker) Post(ctx context.Context, job jobs.Job, tr Transcription) (err error) {
+	ctx, span := w.Tracer.Start(ctx, "target.post", tracing.KindInternal)
+	span.SetAttr("job.id", job.ID)
+	span.SetAttr("target.name", job.TargetName)
+	defer func() { span.End(err) }()
 
 	// Posting stage
 	startPost := time.Now().UTC()
 	if err := w.Store.UpdateStage(job.ID, jobs.StagePosting, &startPost); err != nil {
-		w.finishWithError(job.ID, fmt.Errorf("update stage to posting: %w", err))
+		w.finishWithError(ctx, job, fmt.Errorf("update stage to posting: %w", err))
 		return err
 	}
+	w.Events.Publish(job.ID, jobs.StagePosting)
 	if w.Log != nil {
-		w.Log.Info("job posting", "job_id", job.ID, "target", job.TargetName)
+		w.Log.InfoContext(ctx, "job posting", "job_id", job.ID, "target", job.TargetName)
 	}
 
-	t, ok := w.Targets.Get(job.TargetName)
-	if !ok {
-		w.finishWithError(job.ID, fmt.Errorf("target %q not registered", job.TargetName))
-		return fmt.Errorf("unknown target %q", job.TargetName)
+	title := job.Title
+	if (title == nil || *title == "") && tr.Title != "" {
+		title = &tr.Title
 	}
-
 	req := targets.TargetRequest{
 		JobID:          job.ID,
-		Markdown:       md,
-		SuggestedTitle: job.Title,
+		Markdown:       tr.Markdown,
+		SuggestedTitle: title,
+		Actor:          deref(job.Actor),
+		AuthorName:     deref(job.AuthorName),
+		AuthorEmail:    deref(job.AuthorEmail),
 		Metadata:       job.Metadata,
 		Timestamp:      time.Now().UTC(),
+		BasePath:       deref(job.TargetBasePath),
+		Branch:         deref(job.TargetBranch),
+		Model:          tr.Model,
+		TokenUsage:     tr.TokenUsage,
+		DurationMs:     tr.Duration.Milliseconds(),
+		Language:       tr.Language,
+		Flavor:         tr.Flavor,
 	}
 
-	res, err := t.Post(ctx, req)
+	res, results, err := w.postTargets(ctx, job, req)
 	if err != nil {
-		w.finishWithError(job.ID, fmt.Errorf("target post: %w", err))
 		return err
 	}
-	if w.Log != nil {
-		w.Log.Info("post completed", "job_id", job.ID, "target", res.TargetName, "location", res.Location, "commit", res.Commit)
-	}
 
 	// Success
 	done := time.Now().UTC()
 	if err := w.Store.SaveResult(job.ID, res.Location, res.Commit, done); err != nil {
 		return fmt.Errorf("save result: %w", err)
 	}
+	w.Events.Publish(job.ID, jobs.StageCompleted)
 	if w.Log != nil {
 		w.Log.Info("job completed", "job_id", job.ID)
 	}
 
-	// Callback if provided
-	if job.CallbackURL != nil && *job.CallbackURL != "" {
-		cbErr := w.sendCallbackWithRetry(ctx, *job.CallbackURL, callbackPayload{
-			JobID:  job.ID,
-			Status: common.StatusCompleted,
-			Stage:  string(jobs.StageCompleted),
-			Error:  nil,
-			Result: &callbackResult{
-				Target:   res.TargetName,
-				Location: res.Location,
-				Commit:   res.Commit,
-			},
-		})
-		if cbErr != nil {
-			w.Log.Warn("callback failed after retries", "job_id", job.ID, "err", cbErr)
+	w.notify(ctx, job, callbackPayload{
+		JobID:  job.ID,
+		Status: common.StatusCompleted,
+		Stage:  string(jobs.StageCompleted),
+		Result: &callbackResult{
+			Target:        res.TargetName,
+			Location:      res.Location,
+			Commit:        res.Commit,
+			BranchCommits: res.BranchCommits,
+		},
+		Results: callbackResults(results),
+	})
+
+	// Report back on the GitHub issue a webhook job came from.
+	if job.CommentsURL != nil && *job.CommentsURL != "" && w.comments != nil {
+		if err := w.comments.Comment(ctx, *job.CommentsURL, w.completionComment(job, res)); err != nil && w.Log != nil {
+			w.Log.Warn("github comment failed", "job_id", job.ID, "err", err)
 		}
 	}
 
 	return nil
 }
 
-func (w *Worker) finishWithError(jobID string, err error) {
+// postTargets posts req to every target of job and returns the result of the first one
+// that succeeded. For a job with several targets it also returns and stores the outcome
+// per target; targets that succeeded in an earlier attempt are skipped, so a retry does
+// not post the same document twice. The job is marked failed only if all targets failed.
+func (w *Worker) postTargets(ctx context.Context, job jobs.Job, req targets.TargetRequest) (targets.TargetResult, []jobs.TargetResult, error) {
+	names := job.PostTargets()
+	if len(names) == 1 {
+		res, err := w.postTo(ctx, job, names[0], req)
+		if err != nil {
+			w.finishWithError(ctx, job, err)
+			return targets.TargetResult{}, nil, err
+		}
+		return res, nil, nil
+	}
+
+	done := make(map[string]jobs.TargetResult)
+	for _, r := range job.TargetResults {
+		if r.Error == "" {
+			done[r.TargetName] = r
+		}
+	}
+	var primary *targets.TargetResult
+	results := make([]jobs.TargetResult, 0, len(names))
+	var failed []string
+	for _, name := range names {
+		if r, ok := done[name]; ok {
+			results = append(results, r)
+			if primary == nil {
+				primary = &targets.TargetResult{TargetName: name, Location: r.Location, Commit: r.Commit}
+			}
+			continue
+		}
+		r := jobs.TargetResult{TargetName: name}
+		res, err := w.postTo(ctx, job, name, req)
+		if err != nil {
+			r.Error = err.Error()
+			failed = append(failed, name+": "+r.Error)
+		} else {
+			r.Location, r.Commit = res.Location, res.Commit
+			if primary == nil {
+				res.TargetName = name
+				primary = &res
+			}
+		}
+		results = append(results, r)
+	}
+	if rs, ok := w.Store.(jobs.TargetResultStore); ok {
+		if err := rs.SaveTargetResults(job.ID, results); err != nil && w.Log != nil {
+			w.Log.Warn("saving target results failed", "job_id", job.ID, "err", err)
+		}
+	}
+	if primary == nil {
+		err := fmt.Errorf("all targets failed: %s", strings.Join(failed, "; "))
+		w.fail(ctx, job, err, results)
+		return targets.TargetResult{}, results, err
+	}
+	if len(failed) > 0 && w.Log != nil {
+		w.Log.WarnContext(ctx, "job posted with failed targets", "job_id", job.ID, "failed", strings.Join(failed, "; "))
+	}
+	return *primary, results, nil
+}
+
+// postTo posts req to the named target, with the frontmatter configured for it.
+func (w *Worker) postTo(ctx context.Context, job jobs.Job, name string, req targets.TargetRequest) (targets.TargetResult, error) {
+	t, ok := w.Targets.Get(name)
+	if !ok {
+		return targets.TargetResult{}, fmt.Errorf("target %q not registered", name)
+	}
+	if w.frontErr != nil {
+		return targets.TargetResult{}, fmt.Errorf("frontmatter: %w", w.frontErr)
+	}
+	md, err := w.front.apply(name, req)
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+	req.Markdown = md
+	res, err := t.Post(ctx, req)
+	if err != nil {
+		return targets.TargetResult{}, fmt.Errorf("target post: %w", err)
+	}
+	if w.Log != nil {
+		w.Log.InfoContext(ctx, "post completed", "job_id", job.ID, "target", res.TargetName, "location", res.Location, "commit", res.Commit, "branch_commits", res.BranchCommits)
+	}
+	return res, nil
+}
+
+// completionComment is the issue comment posted for a finished webhook job.
+func (w *Worker) completionComment(job jobs.Job, res targets.TargetResult) string {
+	name := job.TargetName
+	if res.TargetName != "" {
+		name = res.TargetName
+	}
+	if u := w.Targets.ViewURL(name, res.Location); u != "" {
+		return fmt.Sprintf("Transcribed to [%s](%s).", res.Location, u)
+	}
+	return fmt.Sprintf("Transcribed to `%s`.", res.Location)
+}
+
+// transcribeCached returns the cached result for the job image when caching is enabled
+// and the store supports it; otherwise it transcribes and caches complete results.
+// Cache failures are logged and never fail the job.
+func (w *Worker) transcribeCached(ctx context.Context, job jobs.Job, info *jobs.TranscriptionInfo) (llm.Result, error) {
+	cache, key := w.transcriptionCache(job)
+	if cache != nil {
+		cached, err := cache.GetCachedTranscription(key)
+		if err != nil && w.Log != nil {
+			w.Log.Warn("transcription cache lookup failed", "job_id", job.ID, "err", err)
+		}
+		if cached != nil {
+			if w.Log != nil {
+				w.Log.Info("transcription cache hit", "job_id", job.ID)
+			}
+			if w.Cfg.LLM.DetectLanguage {
+				info.Language = cached.Language
+			}
+			return llm.Result{Markdown: cached.Markdown, FinishReason: cached.FinishReason}, nil
+		}
+	}
+
+	opts, detectUsage := w.detectLanguage(ctx, job, info)
+	opts.Model, opts.Instructions = deref(job.Model), deref(job.Instructions)
+	opts.Flavor = info.Flavor
+	result, err := w.transcribeConsensus(ctx, job, opts, info)
+	if err != nil {
+		return llm.Result{}, err
+	}
+	result, short, err := w.checkLength(ctx, job, opts, info, result)
+	if err != nil {
+		return llm.Result{}, err
+	}
+	result.Usage = result.Usage.Add(detectUsage)
+	// Truncated or suspiciously short output is not worth reusing; a later attempt may get
+	// the full document.
+	if cache != nil && result.FinishReason != llm.FinishReasonLength && !short {
+		err := cache.PutCachedTranscription(key, jobs.CachedTranscription{Markdown: result.Markdown, FinishReason: result.FinishReason, Language: info.Language})
+		if err != nil && w.Log != nil {
+			w.Log.Warn("transcription cache store failed", "job_id", job.ID, "err", err)
+		}
+	}
+	return result, nil
+}
+
+// checkLength applies llm.minMarkdownAction to a result shorter than llm.minMarkdownLength:
+// it retries once, fails, or records a suspicious warning in info. short reports whether
+// the returned result is still below the minimum.
+func (w *Worker) checkLength(ctx context.Context, job jobs.Job, opts llm.Options, info *jobs.TranscriptionInfo, result llm.Result) (_ llm.Result, short bool, err error) {
+	minLen := w.Cfg.LLM.MinMarkdownLength
+	n := utf8.RuneCountInString(strings.TrimSpace(result.Markdown))
+	if minLen <= 0 || n >= minLen {
+		return result, false, nil
+	}
+	switch w.Cfg.LLM.MinMarkdownAction {
+	case config.MinMarkdownFail:
+		return llm.Result{}, true, fmt.Errorf("transcription has %d characters, below the minimum of %d", n, minLen)
+	case config.MinMarkdownRetry:
+		if w.Log != nil {
+			w.Log.Warn("transcription suspiciously short, retrying", "job_id", job.ID, "chars", n, "min", minLen)
+		}
+		retried, err := w.transcribeConsensus(ctx, job, opts, info)
+		if err != nil {
+			return llm.Result{}, true, err
+		}
+		retried.Usage = result.Usage.Add(retried.Usage)
+		result = retried
+		if n = utf8.RuneCountInString(strings.TrimSpace(result.Markdown)); n >= minLen {
+			return result, false, nil
+		}
+	}
+	info.Warnings = append(info.Warnings, fmt.Sprintf("%s: transcription has %d characters, below the minimum of %d", warningSuspicious, n, minLen))
+	return result, true, nil
+}
+
+// transcribeConsensus transcribes the image ConsensusRuns times and returns the result
+// picked by the configured strategy, recording the run count and agreement in info.
+// It fails if the runs agree less than ConsensusMinAgreement. With fewer than two runs
+// configured it is a single transcription.
+func (w *Worker) transcribeConsensus(ctx context.Context, job jobs.Job, opts llm.Options, info *jobs.TranscriptionInfo) (llm.Result, error) {
+	runs := w.Cfg.LLM.ConsensusRuns
+	if runs < 2 {
+		return w.transcribeWithRetry(ctx, job, opts)
+	}
+	results := make([]llm.Result, 0, runs)
+	var usage llm.Usage
+	for i := 0; i < runs; i++ {
+		res, err := w.transcribeWithRetry(ctx, job, opts)
+		if err != nil {
+			return llm.Result{}, fmt.Errorf("consensus run %d: %w", i+1, err)
+		}
+		results = append(results, res)
+		usage = usage.Add(res.Usage)
+	}
+	best, agreement := pickConsensus(results, w.Cfg.LLM.ConsensusStrategy)
+	results[best].Usage = usage
+	info.ConsensusRuns = runs
+	info.Agreement = &agreement
+	if w.Log != nil {
+		w.Log.Info("transcription consensus", "job_id", job.ID, "runs", runs, "agreement", agreement, "picked", best+1)
+	}
+	if minAgreement := w.Cfg.LLM.ConsensusMinAgreement; minAgreement > 0 && agreement < minAgreement {
+		return llm.Result{}, fmt.Errorf("consensus: agreement %.2f below minimum %.2f", agreement, minAgreement)
+	}
+	return results[best], nil
+}
+
+// transcriptionCache returns the cache and the key for the job image, or nil when caching
+// is disabled, unsupported by the store or the image cannot be hashed. Reruns are never
+// cached: they exist to get a fresh transcription of an image seen before.
+func (w *Worker) transcriptionCache(job jobs.Job) (jobs.TranscriptionCache, string) {
+	if !w.Cfg.LLM.CacheTranscriptions || job.ParentJobID != nil {
+		return nil, ""
+	}
+	cache, ok := w.Store.(jobs.TranscriptionCache)
+	if !ok {
+		return nil, ""
+	}
+	sum, err := w.imageSHA256(job.ImagePath)
+	if err != nil {
+		if w.Log != nil {
+			w.Log.Warn("transcription cache disabled for job", "job_id", job.ID, "err", err)
+		}
+		return nil, ""
+	}
+	// Results differ between providers, models, prompts and preprocessing, so they are
+	// part of the key.
+	key := fmt.Sprintf("%s:%s:%s", w.Cfg.LLM.Provider, providerDigest(w.Cfg.LLM), sum)
+	if job.Model != nil {
+		key += ":model=" + *job.Model
+	}
+	if job.Instructions != nil {
+		key += ":instructions=" + shortDigest([]byte(*job.Instructions))
+	}
+	// A detected language is passed to the model, which then answers in it.
+	if c := w.Cfg.LLM; c.DetectLanguage && c.LanguageDetection == config.LanguageDetectionLLM {
+		key += ":lang=llm"
+	}
+	if w.pipeline != nil {
+		key += ":" + w.pipeline.String()
+	}
+	if c := w.Cfg.LLM; c.MaxImagePixels > 0 || c.MaxImageBytes > 0 {
+		key += fmt.Sprintf(":limit=%dpx,%db", c.MaxImagePixels, c.MaxImageBytes)
+	}
+	// The flavor changes the prompt, so results of other flavors do not apply.
+	if f := w.Cfg.PostProcess.MarkdownFlavor; f != "" {
+		key += ":flavor=" + f
+	}
+	return cache, key
+}
+
+// cachedProvider holds the settings of a provider that shape its output: the model,
+// prompts, few-shot examples and sampling. Credentials and timeouts are left out, so
+// rotating a key keeps the cache.
+type cachedProvider struct {
+	Type      string                    `json:"type"`
+	AIProxy   *config.AIProxySettings   `json:"aiproxy,omitempty"`
+	OpenAI    *config.OpenAISettings    `json:"openai,omitempty"`
+	Anthropic *config.AnthropicSettings `json:"anthropic,omitempty"`
+}
+
+// providerDigest returns a short digest of the output shaping settings of the configured
+// provider, or of every provider of "weighted", for the transcription cache key.
+func providerDigest(c config.LLMConfig) string {
+	var providers []cachedProvider
+	if strings.EqualFold(c.Provider, "weighted") {
+		for _, p := range c.Providers {
+			providers = append(providers, newCachedProvider(p.Type, p.AIProxy, p.OpenAI, p.Anthropic))
+		}
+	} else {
+		providers = append(providers, newCachedProvider(c.Provider, c.AIProxy, c.OpenAI, c.Anthropic))
+	}
+	b, _ := json.Marshal(providers)
+	return shortDigest(b)
+}
+
+func newCachedProvider(typ string, a config.AIProxySettings, o config.OpenAISettings, an config.AnthropicSettings) cachedProvider {
+	p := cachedProvider{Type: strings.ToLower(typ)}
+	switch p.Type {
+	case "aiproxy":
+		a.APIKey, a.Timeout = "", 0
+		p.AIProxy = &a // few-shot examples are included with their image content
+	case "openai":
+		o.APIKey, o.OrgID, o.Timeout = "", "", 0
+		p.OpenAI = &o
+	case "anthropic":
+		an.APIKey, an.Timeout = "", 0
+		p.Anthropic = &an
+	}
+	return p
+}
+
+// shortDigest returns the first 16 hex digits of the SHA-256 of b.
+func shortDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// transcribeWithRetry transcribes the job image and retries once with a higher token
+// budget if the output was cut off.
+func (w *Worker) transcribeWithRetry(ctx context.Context, job jobs.Job, opts llm.Options) (llm.Result, error) {
+	result, err := w.transcribe(ctx, job, opts)
+	if err != nil {
+		return llm.Result{}, err
+	}
+	if result.FinishReason == llm.FinishReasonLength && w.Cfg.LLM.TruncationRetryMaxTokens > 0 {
+		if w.Log != nil {
+			w.Log.Warn("transcription truncated, retrying", "job_id", job.ID, "max_tokens", w.Cfg.LLM.TruncationRetryMaxTokens)
+		}
+		retryOpts := opts
+		retryOpts.MaxTokens = w.Cfg.LLM.TruncationRetryMaxTokens
+		retried, err := w.transcribe(ctx, job, retryOpts)
+		if err != nil {
+			return llm.Result{}, err
+		}
+		retried.Usage = result.Usage.Add(retried.Usage)
+		return retried, nil
+	}
+	return result, nil
+}
+
+// transcribe runs the job image through the LLM and retries up to server.llmRetries
+// times while the call fails with an llm.TransientError, waiting attempt times
+// server.llmRetryBackoff in between. Retries stop when ctx is done.
+func (w *Worker) transcribe(ctx context.Context, job jobs.Job, opts llm.Options) (llm.Result, error) {
+	retries := max(w.Cfg.Server.LLMRetries, 0)
+	backoff := w.Cfg.Server.LLMRetryBackoff
+	for attempt := 1; ; attempt++ {
+		res, err := w.transcribeOnce(ctx, job, opts)
+		if err == nil || attempt > retries || !errors.Is(err, llm.TransientError) || ctx.Err() != nil {
+			if attempt > 1 && w.Log != nil {
+				if err != nil {
+					w.Log.Warn("transcription failed after retries", "job_id", job.ID, "attempts", attempt, "err", err)
+				} else {
+					w.Log.Info("transcription succeeded after retry", "job_id", job.ID, "attempts", attempt)
+				}
+			}
+			return res, err
+		}
+		if w.Log != nil {
+			w.Log.Warn("transcription failed, retrying", "job_id", job.ID, "attempt", attempt, "err", err)
+		}
+		t := time.NewTimer(time.Duration(attempt) * backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return llm.Result{}, err
+		case <-t.C:
+		}
+	}
+}
+
+// transcribeOnce opens the job image and runs it through the LLM. The file is reopened
+// on every call since the LLM client consumes the reader. While the circuit breaker is
+// open it fails with ErrProviderUnavailable without calling the LLM.
+func (w *Worker) transcribeOnce(ctx context.Context, job jobs.Job, opts llm.Options) (llm.Result, error) {
+	img, mime, closeImg, err := w.openImage(job)
+	if err != nil {
+		return llm.Result{}, err
+	}
+	defer closeImg()
+
+	done, ok := w.breaker.acquire()
+	if !ok {
+		return llm.Result{}, ErrProviderUnavailable
+	}
+	start := time.Now()
+	res, err := llm.Transcribe(ctx, w.LLM, img, mime, opts)
+	done(err)
+	if job.Debug {
+		w.logLLMDebug(job, mime, opts, res, err, time.Since(start))
+	}
+	if err != nil {
+		return llm.Result{}, fmt.Errorf("llm transcribe: %w", err)
+	}
+	return res, nil
+}
+
+// debugOutputLimit bounds the transcription output included in a debug log entry.
+const debugOutputLimit = 4096
+
+// logLLMDebug logs the details of one LLM call of a job sampled by llm.debugSampleRate.
+// The output passes through the redactor (all built-in patterns when redaction is off)
+// because debug logs usually travel further than the documents themselves.
+func (w *Worker) logLLMDebug(job jobs.Job, mime string, opts llm.Options, res llm.Result, callErr error, d time.Duration) {
+	if w.Log == nil {
+		return
+	}
+	out := res.Markdown
+	if w.debugRedactor != nil {
+		out, _ = w.debugRedactor.Redact(out)
+	}
+	if len(out) > debugOutputLimit {
+		out = strings.ToValidUTF8(out[:debugOutputLimit], "") + "…"
+	}
+	attrs := []any{
+		"job_id", job.ID, "mime", mime, "max_tokens", opts.MaxTokens, "language", opts.Language,
+		"model", res.Model, "finish_reason", res.FinishReason, "prompt_tokens", res.Usage.PromptTokens,
+		"completion_tokens", res.Usage.CompletionTokens, "duration", d, "output", out,
+	}
+	if callErr != nil {
+		attrs = append(attrs, "err", callErr)
+	}
+	w.Log.Info("llm debug", attrs...)
+}
+
+// imageTransforms returns the configured image pipeline followed by the longest edge
+// limit, if any.
+func imageTransforms(c config.LLMConfig) []imageproc.Transform {
+	steps := slices.Clone(c.ImagePipeline)
+	if c.MaxLongestEdge > 0 {
+		steps = append(steps, imageproc.Transform{Name: imageproc.Downscale, MaxLongestEdge: c.MaxLongestEdge})
+	}
+	return steps
+}
+
+// openImage opens the job image as it is sent to the LLM, i.e. after the image pipeline
+// and the size limits, and returns it with its mime type and a func to close the
+// underlying file.
+func (w *Worker) openImage(job jobs.Job) (io.Reader, string, func(), error) {
+	if w.pipeErr != nil {
+		return nil, "", nil, fmt.Errorf("image pipeline: %w", w.pipeErr)
+	}
+	f, err := w.images().Open(job.ImagePath)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("open image: %w", err)
+	}
+	var img io.Reader = f
+	mime := job.MimeType
+	closeFile := func() { _ = f.Close() }
+	if w.pipeline != nil {
+		b, err := w.pipeline.Process(f)
+		closeFile()
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("image pipeline: %w", err)
+		}
+		img, mime, closeFile = bytes.NewReader(b), common.MimeImagePNG, func() {}
+	}
+	if c := w.Cfg.LLM; c.MaxImagePixels > 0 || c.MaxImageBytes > 0 {
+		limited, limitedMime, err := imageproc.Limit(img, mime, c.MaxImagePixels, c.MaxImageBytes)
+		closeFile()
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("limit image size: %w", err)
+		}
+		img, mime, closeFile = limited, limitedMime, func() {}
+	}
+	return img, mime, closeFile, nil
+}
+
+// images returns the store job images are read from.
+func (w *Worker) images() storage.ImageStore {
+	if w.Images == nil {
+		return storage.LocalImages{}
+	}
+	return w.Images
+}
+
+// imageSHA256 returns the hex SHA-256 of the stored image at path.
+func (w *Worker) imageSHA256(path string) (string, error) {
+	f, err := w.images().Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	return util.ReaderSHA256(f)
+}
+
+// detectLanguage identifies the document language with a short LLM call when configured
+// and supported by the client, records it in info and returns the options to transcribe
+// in it. Failures are logged and leave the language to the heuristic fallback.
+func (w *Worker) detectLanguage(ctx context.Context, job jobs.Job, info *jobs.TranscriptionInfo) (llm.Options, llm.Usage) {
+	if !w.Cfg.LLM.DetectLanguage || w.Cfg.LLM.LanguageDetection != config.LanguageDetectionLLM {
+		return llm.Options{}, llm.Usage{}
+	}
+	d, ok := w.LLM.(llm.LanguageDetector)
+	if !ok {
+		return llm.Options{}, llm.Usage{}
+	}
+	img, mime, closeImg, err := w.openImage(job)
+	if err != nil {
+		return llm.Options{}, llm.Usage{}
+	}
+	defer closeImg()
+	lang, usage, err := d.DetectLanguage(ctx, img, mime)
+	if err != nil {
+		if w.Log != nil {
+			w.Log.Warn("language detection failed", "job_id", job.ID, "err", err)
+		}
+		return llm.Options{}, usage
+	}
+	info.Language = lang
+	return llm.Options{Language: lang}, usage
+}
+
+func (w *Worker) finishWithError(ctx context.Context, job jobs.Job, err error) {
+	w.fail(ctx, job, err, nil)
+}
+
+// fail marks job failed like finishWithError, listing results, the outcome per target,
+// in the callback.
+func (w *Worker) fail(ctx context.Context, job jobs.Job, err error, results []jobs.TargetResult) {
 	done := time.Now().UTC()
-	_ = w.Store.SaveError(jobID, err.Error(), done)
+	_ = w.Store.SaveError(job.ID, err.Error(), done)
+	w.Events.Publish(job.ID, jobs.StageFailed)
 	if w.Log != nil {
-		w.Log.Error("job failed", "job_id", jobID, "error", err)
+		w.Log.Error("job failed", "job_id", job.ID, "error", err)
+	}
+	// As in the status response, only a rejection is sent; other errors may expose internals.
+	msg := jobs.PublicError(err.Error())
+	w.notify(ctx, job, callbackPayload{
+		JobID:   job.ID,
+		Status:  common.StatusFailed,
+		Stage:   string(jobs.StageFailed),
+		Error:   &msg,
+		Results: callbackResults(results),
+	})
+}
+
+func deref(p *string) string {
+	if p == nil {
+		return ""
 	}
+	return *p
 }
 
 type callbackPayload struct {
 	JobID  string          `json:"job_id"`
-	Status string          `json:"status"` // completed|failed
+	Status string          `json:"status"` // completed|failed|needs_review, the event
 	Stage  string          `json:"stage"`
 	Error  *string         `json:"error,omitempty"`
 	Result *callbackResult `json:"result,omitempty"`
+	// Results lists the outcome per target of a job posting to several targets.
+	Results []callbackTargetResult `json:"results,omitempty"`
 }
 
-type callbackResult struct {
+// callbackTargetResult is the outcome of posting to one target. As with the job error,
+// the reason a target failed is not sent.
+type callbackTargetResult struct {
 	Target   string `json:"target"`
-	Location string `json:"location"`
-	Commit   string `json:"commit"`
+	Status   string `json:"status"` // completed or failed
+	Location string `json:"location,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+}
+
+// callbackResults converts per-target results for the callback payload.
+func callbackResults(results []jobs.TargetResult) []callbackTargetResult {
+	if len(results) == 0 {
+		return nil
+	}
+	out := make([]callbackTargetResult, len(results))
+	for i, r := range results {
+		out[i] = callbackTargetResult{Target: r.TargetName, Status: common.StatusCompleted, Location: r.Location, Commit: r.Commit}
+		if r.Error != "" {
+			out[i].Status = common.StatusFailed
+		}
+	}
+	return out
+}
+
+type callbackResult struct {
+	Target        string            `json:"target"`
+	Location      string            `json:"location"`
+	Commit        string            `json:"commit"`
+	BranchCommits map[string]string `json:"branch_commits,omitempty"` // commits on additional branches
+}
+
+// notify sends payload to the callback URL of job if the job subscribed to its event,
+// through callback_events or server.callbackEvents.
+func (w *Worker) notify(ctx context.Context, job jobs.Job, payload callbackPayload) {
+	if job.CallbackURL == nil || *job.CallbackURL == "" {
+		return
+	}
+	events := job.CallbackEvents
+	if events == nil {
+		events = w.Cfg.Server.CallbackEvents
+		if events == nil {
+			events = []string{common.StatusCompleted}
+		}
+	}
+	if !slices.Contains(events, payload.Status) {
+		return
+	}
+	if err := w.sendCallbackWithRetry(ctx, *job.CallbackURL, payload); err != nil && w.Log != nil {
+		w.Log.Warn("callback failed after retries", "job_id", job.ID, "event", payload.Status, "err", err)
+	}
 }
 
 func (w *Worker) sendCallbackWithRetry(ctx context.Context, url string, payload callbackPayload) error {
@@ -168,7 +1006,7 @@ func (w *Worker) sendCallbackWithRetry(ctx context.Context, url string, payload
 
 	var lastErr error
 	for attempt := 1; attempt <= max; attempt++ {
-		if err := w.postJSON(ctx, url, payload); err != nil {
+		if err := w.postCallback(ctx, url, payload); err != nil {
 			lastErr = err
 			// If context was cancelled, stop retries.
 			if errors.Is(ctx.Err(), context.Canceled) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
@@ -183,19 +1021,48 @@ func (w *Worker) sendCallbackWithRetry(ctx context.Context, url string, payload
 	return lastErr
 }
 
+// postCallback delivers a single callback attempt, waiting for a free slot for the
+// callback host first. The slot is not held while backing off between attempts.
+func (w *Worker) postCallback(ctx context.Context, url string, payload any) error {
+	release, err := w.callbacks.acquire(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return w.postJSON(ctx, url, payload)
+}
+
+// callbackSignature returns the hex HMAC-SHA256 of timestamp + "." + body under secret,
+// which receivers recompute to verify a callback.
+func callbackSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func (w *Worker) postJSON(ctx context.Context, url string, payload any) error {
 	b, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	method := w.Cfg.Server.CallbackMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", common.ContentTypeJSON)
-	// Optional: include a simple signature or key if required in future
+	tracing.Inject(ctx, req.Header)
+	if secret := w.Cfg.Server.CallbackSecret; secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(common.HeaderCallbackTime, ts)
+		req.Header.Set(common.HeaderCallbackSig, "sha256="+callbackSignature(secret, ts, b))
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := w.callHTTP.Do(req)
 	if err != nil {
 		return err
 	}
@@ -1,22 +1,37 @@
 package processor
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/jo-hoe/gostwriter/internal/common"
 	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/imageproc"
 	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/llm"
+	"github.com/jo-hoe/gostwriter/internal/markdown"
 	"github.com/jo-hoe/gostwriter/internal/targets"
+	"gopkg.in/yaml.v3"
 )
 
 type memStore struct {
@@ -49,6 +64,31 @@ func (s *memStore) UpdateStage(id string, stage jobs.Stage, startedAt *time.Time
 	return nil
 }
 
+func (s *memStore) SaveTranscriptionInfo(id string, info jobs.TranscriptionInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		if info.FinishReason != "" {
+			fr := info.FinishReason
+			j.FinishReason = &fr
+		}
+		j.Warnings = info.Warnings
+		j.ConsensusRuns = info.ConsensusRuns
+		j.Agreement = info.Agreement
+		if info.Language != "" {
+			lang := info.Language
+			j.Language = &lang
+		}
+		if info.Flavor != "" {
+			flavor := info.Flavor
+			j.MarkdownFlavor = &flavor
+		}
+		j.EstimatedCost = info.EstimatedCost
+		j.ProviderMeta = info.ProviderMeta
+	}
+	return nil
+}
+
 func (s *memStore) SaveResult(id string, location, commit string, completedAt time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -77,6 +117,15 @@ func (s *memStore) SaveError(id string, errMsg string, completedAt time.Time) er
 	return nil
 }
 
+func (s *memStore) SaveTargetResults(id string, results []jobs.TargetResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		j.TargetResults = append([]jobs.TargetResult(nil), results...)
+	}
+	return nil
+}
+
 func (s *memStore) GetJob(id string) (*jobs.Job, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -90,11 +139,13 @@ func (s *memStore) GetJob(id string) (*jobs.Job, error) {
 func (s *memStore) Close() error { return nil }
 
 type llmMock struct {
-	out string
-	err error
+	out   string
+	err   error
+	calls int
 }
 
 func (m *llmMock) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	m.calls++
 	if m.err != nil {
 		return "", m.err
 	}
@@ -106,10 +157,12 @@ type targetMock struct {
 	name string
 	res  targets.TargetResult
 	err  error
+	reqs []targets.TargetRequest
 }
 
 func (t *targetMock) Name() string { return t.name }
 func (t *targetMock) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
+	t.reqs = append(t.reqs, req)
 	if t.err != nil {
 		return targets.TargetResult{}, t.err
 	}
@@ -124,12 +177,14 @@ func TestWorker_Process_SuccessWithCallback(t *testing.T) {
 	// Callback collector
 	var cbMu sync.Mutex
 	var cbBodies []map[string]any
+	var cbMethods []string
 	cbSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() { _ = r.Body.Close() }()
 		var body map[string]any
 		_ = json.NewDecoder(r.Body).Decode(&body)
 		cbMu.Lock()
 		cbBodies = append(cbBodies, body)
+		cbMethods = append(cbMethods, r.Method)
 		cbMu.Unlock()
 		w.WriteHeader(http.StatusOK)
 	}))
@@ -211,6 +266,91 @@ func TestWorker_Process_SuccessWithCallback(t *testing.T) {
 	if cbBodies[0]["status"] != common.StatusCompleted {
 		t.Fatalf("callback status mismatch: %v", cbBodies[0]["status"])
 	}
+	if cbMethods[0] != http.MethodPost {
+		t.Fatalf("callback method = %s, want POST by default", cbMethods[0])
+	}
+}
+
+func TestWorker_PostJSON_Signature(t *testing.T) {
+	type received struct {
+		body       []byte
+		sig, stamp string
+	}
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- received{body: b, sig: r.Header.Get(common.HeaderCallbackSig), stamp: r.Header.Get(common.HeaderCallbackTime)}
+	}))
+	defer srv.Close()
+
+	const secret = "s3cret"
+	cfg := &config.Config{Server: config.ServerConfig{CallbackSecret: secret}}
+	worker := New(discardLogger(), cfg, newMemStore(), &llmMock{}, targets.NewRegistry())
+	if err := worker.postJSON(context.Background(), srv.URL, map[string]any{"status": "completed"}); err != nil {
+		t.Fatalf("postJSON: %v", err)
+	}
+	r := <-got
+	if r.stamp == "" {
+		t.Fatalf("missing %s header", common.HeaderCallbackTime)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.stamp + "." + string(r.body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(r.sig), []byte(want)) {
+		t.Fatalf("signature = %q, want %q", r.sig, want)
+	}
+
+	cfg.Server.CallbackSecret = ""
+	if err := worker.postJSON(context.Background(), srv.URL, map[string]any{"status": "completed"}); err != nil {
+		t.Fatalf("postJSON: %v", err)
+	}
+	if r := <-got; r.sig != "" || r.stamp != "" {
+		t.Fatalf("unsigned callback carried signature headers: %q %q", r.sig, r.stamp)
+	}
+}
+
+func TestWorker_Process_CallbackEvents(t *testing.T) {
+	var cbMu sync.Mutex
+	var statuses []string
+	cbSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		cbMu.Lock()
+		statuses = append(statuses, fmt.Sprint(body["job_id"], ":", body["status"]))
+		cbMu.Unlock()
+	}))
+	defer cbSrv.Close()
+
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{Server: config.ServerConfig{CallbackRetries: 1, CallbackEvents: []string{common.StatusCompleted}}}
+	store := newMemStore()
+	run := func(id string, events []string, llmErr error) {
+		t.Helper()
+		imgPath := filepathJoin(t.TempDir(), "img.png")
+		if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+			t.Fatalf("write img: %v", err)
+		}
+		cbURL := cbSrv.URL
+		job := jobs.Job{ID: id, ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", CallbackURL: &cbURL, CallbackEvents: events}
+		_ = store.CreateJob(&job)
+		worker := New(discardLogger(), cfg, store, &llmMock{out: "markdown", err: llmErr}, reg)
+		_ = worker.Process(context.Background(), jobs.WorkItem{Job: job})
+	}
+
+	// Subscribed to failures only: a completed job sends nothing, a failed one does.
+	run("failed-only-ok", []string{common.StatusFailed}, nil)
+	run("failed-only-err", []string{common.StatusFailed}, errors.New("boom"))
+	// Without a subscription the configured events apply: completions only.
+	run("default-ok", nil, nil)
+	run("default-err", nil, errors.New("boom"))
+
+	cbMu.Lock()
+	defer cbMu.Unlock()
+	want := []string{"failed-only-err:failed", "default-ok:completed"}
+	if strings.Join(statuses, " ") != strings.Join(want, " ") {
+		t.Fatalf("callbacks = %v, want %v", statuses, want)
+	}
 }
 
 func TestWorker_Process_LLMError_SetsFailed(t *testing.T) {
@@ -261,7 +401,1199 @@ func TestWorker_Process_LLMError_SetsFailed(t *testing.T) {
 	}
 }
 
+// flakyLLMMock fails the first failures calls with a transient error and records the
+// image read by every call.
+type flakyLLMMock struct {
+	failures int
+	reads    []string
+}
+
+func (m *flakyLLMMock) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	b, _ := io.ReadAll(r)
+	m.reads = append(m.reads, string(b))
+	if len(m.reads) <= m.failures {
+		return "", llm.Transient(errors.New("status 503"))
+	}
+	return "text", nil
+}
+
+func TestWorker_Process_LLMRetries(t *testing.T) {
+	store := newMemStore()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{Server: config.ServerConfig{LLMRetries: 2, LLMRetryBackoff: time.Millisecond}}
+	flaky := &flakyLLMMock{failures: 1}
+	worker := New(discardLogger(), cfg, store, flaky, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	job := jobs.Job{ID: "job-retry", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	// The image is reopened for the retry, so both attempts read all of it.
+	if !reflect.DeepEqual(flaky.reads, []string{"fakeimg", "fakeimg"}) {
+		t.Fatalf("unexpected attempts %q", flaky.reads)
+	}
+	if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != "text" {
+		t.Fatalf("unexpected posts %+v", tgt.reqs)
+	}
+
+	// Errors not marked transient fail at once.
+	failing := &llmMock{err: errors.New("boom")}
+	worker = New(discardLogger(), cfg, store, failing, reg)
+	job.ID = "job-no-retry"
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err == nil || failing.calls != 1 {
+		t.Fatalf("expected a single failed attempt, got %d calls, err %v", failing.calls, err)
+	}
+}
+
 // filepathJoin to avoid importing path/filepath in multiple places in this test.
 func filepathJoin(dir, name string) string {
 	return dir + string(os.PathSeparator) + name
 }
+
+// resultLLMMock reports finish_reason "length" unless a max tokens override is given.
+type resultLLMMock struct {
+	mu   sync.Mutex
+	opts []llm.Options
+}
+
+func (m *resultLLMMock) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	res, err := m.TranscribeImageResult(ctx, r, mime, llm.Options{})
+	return res.Markdown, err
+}
+
+func (m *resultLLMMock) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	m.mu.Lock()
+	m.opts = append(m.opts, opts)
+	m.mu.Unlock()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return llm.Result{}, err
+	}
+	if opts.MaxTokens > 0 {
+		return llm.Result{Markdown: "full", FinishReason: "stop"}, nil
+	}
+	return llm.Result{Markdown: "part", FinishReason: llm.FinishReasonLength}, nil
+}
+
+func TestWorker_Process_TruncationRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		retryTokens  int
+		wantCalls    int
+		wantFinish   string
+		wantWarnings int
+	}{
+		{name: "retry with higher max tokens", retryTokens: 4096, wantCalls: 2, wantFinish: "stop", wantWarnings: 0},
+		{name: "no retry configured", retryTokens: 0, wantCalls: 1, wantFinish: llm.FinishReasonLength, wantWarnings: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			llmClient := &resultLLMMock{}
+			reg := targets.NewRegistry()
+			reg.Add(&targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}})
+			cfg := &config.Config{LLM: config.LLMConfig{TruncationRetryMaxTokens: tc.retryTokens}}
+			worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-trunc", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Stage: jobs.StageQueued}
+			_ = store.CreateJob(&job)
+
+			if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+				t.Fatalf("Process error: %v", err)
+			}
+			if len(llmClient.opts) != tc.wantCalls {
+				t.Fatalf("expected %d llm calls, got %d", tc.wantCalls, len(llmClient.opts))
+			}
+			if tc.wantCalls == 2 && llmClient.opts[1].MaxTokens != tc.retryTokens {
+				t.Fatalf("retry max tokens = %d", llmClient.opts[1].MaxTokens)
+			}
+			got, _ := store.GetJob(job.ID)
+			if got.FinishReason == nil || *got.FinishReason != tc.wantFinish {
+				t.Fatalf("finish reason mismatch: %v", got.FinishReason)
+			}
+			if len(got.Warnings) != tc.wantWarnings {
+				t.Fatalf("warnings mismatch: %v", got.Warnings)
+			}
+		})
+	}
+}
+
+func TestWorker_Process_Redaction(t *testing.T) {
+	const doc = "Patient SSN 123-45-6789, card 4111-1111-1111-1111."
+	for _, tc := range []struct {
+		name        string
+		failOnMatch bool
+		wantStage   jobs.Stage
+	}{
+		{name: "redact", wantStage: jobs.StageCompleted},
+		{name: "fail on match", failOnMatch: true, wantStage: jobs.StageFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			cfg := &config.Config{Server: config.ServerConfig{
+				Redaction: config.RedactionConfig{Enabled: true, FailOnMatch: tc.failOnMatch},
+			}}
+			worker := New(discardLogger(), cfg, store, &llmMock{out: doc}, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-redact", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+			_ = store.CreateJob(&job)
+			_ = worker.Process(context.Background(), jobs.WorkItem{Job: job})
+
+			got, _ := store.GetJob(job.ID)
+			if got.Stage != tc.wantStage {
+				t.Fatalf("stage = %s, want %s", got.Stage, tc.wantStage)
+			}
+			if tc.failOnMatch {
+				if len(tgt.reqs) != 0 {
+					t.Fatalf("document with sensitive content must not be posted")
+				}
+				return
+			}
+			if len(tgt.reqs) != 1 {
+				t.Fatalf("expected one post, got %d", len(tgt.reqs))
+			}
+			md := tgt.reqs[0].Markdown
+			if strings.Contains(md, "123-45-6789") || strings.Contains(md, "4111-1111-1111-1111") {
+				t.Fatalf("PII leaked into posted markdown: %q", md)
+			}
+			if strings.Count(md, "[REDACTED]") != 2 {
+				t.Fatalf("expected two redactions: %q", md)
+			}
+		})
+	}
+}
+
+// cachingStore adds an in-memory jobs.TranscriptionCache to memStore.
+type cachingStore struct {
+	*memStore
+	cache map[string]jobs.CachedTranscription
+}
+
+func (s *cachingStore) GetCachedTranscription(key string) (*jobs.CachedTranscription, error) {
+	if c, ok := s.cache[key]; ok {
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (s *cachingStore) PutCachedTranscription(key string, t jobs.CachedTranscription) error {
+	s.cache[key] = t
+	return nil
+}
+
+func TestWorker_Process_TranscriptionCache(t *testing.T) {
+	store := &cachingStore{memStore: newMemStore(), cache: map[string]jobs.CachedTranscription{}}
+	llmClient := &llmMock{out: "cached text"}
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{LLM: config.LLMConfig{Provider: "mock", CacheTranscriptions: true}}
+	worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+	dir := t.TempDir()
+	run := func(id, content string) {
+		t.Helper()
+		imgPath := filepathJoin(dir, id+".png")
+		if err := os.WriteFile(imgPath, []byte(content), 0o600); err != nil {
+			t.Fatalf("write img: %v", err)
+		}
+		job := jobs.Job{ID: id, ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+		_ = store.CreateJob(&job)
+		if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+			t.Fatalf("Process %s: %v", id, err)
+		}
+	}
+
+	run("job-1", "same image")
+	run("job-2", "same image")
+	if llmClient.calls != 1 {
+		t.Fatalf("expected the second job to reuse the cached result, got %d llm calls", llmClient.calls)
+	}
+	if len(tgt.reqs) != 2 || tgt.reqs[1].Markdown != "cached text" {
+		t.Fatalf("cached markdown not posted: %+v", tgt.reqs)
+	}
+	run("job-3", "other image")
+	if llmClient.calls != 2 {
+		t.Fatalf("expected a different image to miss the cache, got %d llm calls", llmClient.calls)
+	}
+
+	// Another model or few-shot examples give other results, whatever the provider.
+	for i, change := range []func(){
+		func() { cfg.LLM.Provider, cfg.LLM.OpenAI.Model = "openai", "gpt-4o" },
+		func() { cfg.LLM.OpenAI.Model = "gpt-5" },
+		func() { cfg.LLM.OpenAI.APIKey = "rotated" }, // credentials do not matter
+		func() {
+			cfg.LLM.Provider = "aiproxy"
+			cfg.LLM.AIProxy.FewShotExamples = []config.FewShotExample{{Markdown: "# Example", Image: []byte("png")}}
+		},
+		func() { cfg.LLM.AIProxy.FewShotExamples[0].Image = []byte("other png") },
+	} {
+		change()
+		run(fmt.Sprintf("job-change-%d", i), "same image")
+	}
+	if llmClient.calls != 6 {
+		t.Fatalf("expected model and few-shot changes to miss the cache, got %d llm calls", llmClient.calls)
+	}
+
+	// Disabled caching always calls the LLM.
+	cfg.LLM.CacheTranscriptions = false
+	run("job-4", "same image")
+	if llmClient.calls != 7 {
+		t.Fatalf("expected cache to be bypassed when disabled, got %d llm calls", llmClient.calls)
+	}
+}
+
+// memImages is an in-memory storage.ImageStore, standing in for a remote upload backend.
+type memImages map[string][]byte
+
+func (m memImages) Open(path string) (io.ReadCloser, error) {
+	b, ok := m[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m memImages) Delete(path string) error {
+	delete(m, path)
+	return nil
+}
+
+func TestWorker_Process_ImageStore(t *testing.T) {
+	store := &cachingStore{memStore: newMemStore(), cache: map[string]jobs.CachedTranscription{}}
+	llmClient := &llmMock{out: "remote text"}
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{LLM: config.LLMConfig{Provider: "mock", CacheTranscriptions: true}}
+	worker := New(discardLogger(), cfg, store, llmClient, reg)
+	images := memImages{"s3://b/1.png": []byte("img"), "s3://b/2.png": []byte("img")}
+	worker.Images = images
+
+	for _, id := range []string{"1", "2"} {
+		job := jobs.Job{ID: "job-" + id, ImagePath: "s3://b/" + id + ".png", MimeType: common.MimeImagePNG, TargetName: "github"}
+		_ = store.CreateJob(&job)
+		if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+			t.Fatalf("Process %s: %v", id, err)
+		}
+	}
+	// Both images are read from the store and hashed for the cache.
+	if llmClient.calls != 1 || len(tgt.reqs) != 2 || tgt.reqs[1].Markdown != "remote text" {
+		t.Fatalf("unexpected processing: %d llm calls, posts %+v", llmClient.calls, tgt.reqs)
+	}
+
+	// A missing image fails the job.
+	job := jobs.Job{ID: "job-3", ImagePath: "s3://b/3.png", MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	_ = worker.Process(context.Background(), jobs.WorkItem{Job: job})
+	if got, _ := store.GetJob(job.ID); got.Stage != jobs.StageFailed {
+		t.Fatalf("job without image: stage = %s, want failed", got.Stage)
+	}
+}
+
+func TestWorker_Process_GenerateTOC(t *testing.T) {
+	store := newMemStore()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{PostProcess: config.PostProcessConfig{GenerateTOC: true}}
+	worker := New(discardLogger(), cfg, store, &llmMock{out: "## First\n\ntext\n\n## Second"}, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	title := "Notes"
+	job := jobs.Job{ID: "job-toc", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Title: &title}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	want := "# Notes\n\n- [First](#first)\n- [Second](#second)\n\n## First\n\ntext\n\n## Second"
+	if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != want {
+		t.Fatalf("unexpected posted markdown: %q", tgt.reqs[0].Markdown)
+	}
+}
+
+func TestWorker_Process_HeadingOffset(t *testing.T) {
+	store := newMemStore()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{PostProcess: config.PostProcessConfig{HeadingOffset: 1}}
+	worker := New(discardLogger(), cfg, store, &llmMock{out: "## Part\n\n```\n# code\n```"}, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	title := "Notes"
+	job := jobs.Job{ID: "job-offset", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Title: &title}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	want := "## Notes\n\n### Part\n\n```\n# code\n```"
+	if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != want {
+		t.Fatalf("unexpected posted markdown: %q", tgt.reqs[0].Markdown)
+	}
+}
+
+func TestWorker_Process_TitleHeading(t *testing.T) {
+	disabled := false
+	for _, tc := range []struct {
+		name   string
+		server config.ServerConfig
+		want   string
+	}{
+		{name: "level 2", server: config.ServerConfig{TitleHeadingLevel: 2}, want: "## Notes\n\ntext"},
+		{name: "level 3", server: config.ServerConfig{TitleHeadingLevel: 3}, want: "### Notes\n\ntext"},
+		{name: "disabled", server: config.ServerConfig{TitleEnabled: &disabled, TitleHeadingLevel: 2}, want: "text"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			worker := New(discardLogger(), &config.Config{Server: tc.server}, store, &llmMock{out: "text"}, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			title := "Notes"
+			job := jobs.Job{ID: "job-title", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Title: &title}
+			_ = store.CreateJob(&job)
+			if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != tc.want {
+				t.Fatalf("unexpected posted markdown: %q", tgt.reqs[0].Markdown)
+			}
+			// The title still reaches the target for file names and commit messages.
+			if st := tgt.reqs[0].SuggestedTitle; st == nil || *st != "Notes" {
+				t.Fatalf("suggested title %v, want Notes", st)
+			}
+		})
+	}
+}
+
+func TestWorker_Process_DeriveTitleFromContent(t *testing.T) {
+	given := "Given"
+	cases := []struct {
+		name      string
+		title     *string
+		out       string
+		wantTitle string // "" for no suggested title
+		wantMD    string
+	}{
+		{"leading heading", nil, "# Weekly Sync\n\nnotes", "Weekly Sync", "## Weekly Sync\n\nnotes"},
+		{"no heading", nil, "just notes", "", "just notes"},
+		{"given title", &given, "# Weekly Sync\n\nnotes", "Given", "## Given\n\n## Weekly Sync\n\nnotes"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			// The offset shows the title is taken before the headings move.
+			cfg := &config.Config{PostProcess: config.PostProcessConfig{DeriveTitleFromContent: true, HeadingOffset: 1}}
+			worker := New(discardLogger(), cfg, store, &llmMock{out: tc.out}, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-derive", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Title: tc.title}
+			_ = store.CreateJob(&job)
+			if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			req := tgt.reqs[0]
+			got := ""
+			if req.SuggestedTitle != nil {
+				got = *req.SuggestedTitle
+			}
+			if got != tc.wantTitle {
+				t.Fatalf("suggested title %q, want %q", got, tc.wantTitle)
+			}
+			if req.Markdown != tc.wantMD {
+				t.Fatalf("posted markdown %q, want %q", req.Markdown, tc.wantMD)
+			}
+		})
+	}
+}
+
+func TestWorker_Process_Frontmatter(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour) // YAML reads the unquoted date as a timestamp
+	cases := []struct {
+		name      string
+		out       string
+		wantFront map[string]map[string]any // by target
+	}{
+		{name: "rendered", out: "Text", wantFront: map[string]map[string]any{
+			"blog": {"title": "Notes: Part 1", "job": "job-fm", "tags": []any{"a", "b"}},
+			"site": {"date": today},
+		}},
+		{name: "model frontmatter kept", out: "---\ndraft: true\n---\nText", wantFront: map[string]map[string]any{
+			"blog": {"draft": true},
+			"site": {"draft": true},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			blog := &targetMock{name: "blog", res: targets.TargetResult{TargetName: "blog"}}
+			site := &targetMock{name: "site", res: targets.TargetResult{TargetName: "site"}}
+			reg := targets.NewRegistry()
+			reg.Add(blog)
+			reg.Add(site)
+			cfg := &config.Config{
+				Server: config.ServerConfig{Frontmatter: "title: {{ quote .Title }}\njob: {{ .JobID }}\ntags: {{ quote .Metadata.tags }}\n"},
+				Targets: []config.TargetEntry{
+					{Name: "blog", Type: config.TargetTypeGitHub},
+					{Name: "site", Type: config.TargetTypeGitHub, FrontmatterTemplate: "date: {{ .Timestamp.Format \"2006-01-02\" }}"},
+				},
+			}
+			worker := New(discardLogger(), cfg, store, &llmMock{out: tc.out}, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			title := "Notes: Part 1"
+			job := jobs.Job{ID: "job-fm", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "blog", Targets: []string{"blog", "site"},
+				Title: &title, Metadata: map[string]any{"tags": []any{"a", "b"}}}
+			_ = store.CreateJob(&job)
+			if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+
+			for _, tgt := range []*targetMock{blog, site} {
+				// The title H1 follows the frontmatter.
+				md := tgt.reqs[0].Markdown
+				front, body := markdown.SplitFrontmatter(md)
+				if !strings.HasPrefix(front, "---\n") || !strings.HasSuffix(front, "\n---\n") || body != "# Notes: Part 1\n\nText" {
+					t.Fatalf("%s: posted markdown %q", tgt.name, md)
+				}
+				var got map[string]any
+				if err := yaml.Unmarshal([]byte(strings.TrimSuffix(strings.TrimPrefix(front, "---\n"), "---\n")), &got); err != nil {
+					t.Fatalf("%s: frontmatter is not valid YAML: %v\n%s", tgt.name, err, front)
+				}
+				if !reflect.DeepEqual(got, tc.wantFront[tgt.name]) {
+					t.Fatalf("%s: frontmatter %v, want %v", tgt.name, got, tc.wantFront[tgt.name])
+				}
+			}
+		})
+	}
+}
+
+func TestWorker_Process_MultipleTargets(t *testing.T) {
+	var cbMu sync.Mutex
+	var callbacks []string
+	cbSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Status  string `json:"status"`
+			Results []struct {
+				Target, Status string
+			} `json:"results"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		cbMu.Lock()
+		callbacks = append(callbacks, fmt.Sprintf("%s %v", body.Status, body.Results))
+		cbMu.Unlock()
+	}))
+	defer cbSrv.Close()
+
+	store := newMemStore()
+	primary := &targetMock{name: "github", err: errors.New("unreachable")}
+	mirror := &targetMock{name: "mirror", err: errors.New("unreachable")}
+	reg := targets.NewRegistry()
+	reg.Add(primary)
+	reg.Add(mirror)
+	cfg := &config.Config{Server: config.ServerConfig{CallbackRetries: 1, CallbackEvents: []string{common.StatusCompleted, common.StatusFailed}}}
+	worker := New(discardLogger(), cfg, store, &llmMock{out: "md"}, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	cbURL := cbSrv.URL
+	job := jobs.Job{ID: "job-multi", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Targets: []string{"github", "mirror"}, CallbackURL: &cbURL}
+	_ = store.CreateJob(&job)
+
+	// All targets failing fail the job, naming each.
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err == nil {
+		t.Fatalf("expected the job to fail when all targets fail")
+	}
+	got, _ := store.GetJob(job.ID)
+	if got.Stage != jobs.StageFailed || got.ErrorMessage == nil ||
+		*got.ErrorMessage != "all targets failed: github: target post: unreachable; mirror: target post: unreachable" {
+		t.Fatalf("job stage=%s error=%v, want failed by both targets", got.Stage, deref(got.ErrorMessage))
+	}
+
+	// One target succeeding completes the job; the failure is kept per target.
+	primary.err, primary.res = nil, targets.TargetResult{TargetName: "github", Location: "git:a", Commit: "c1"}
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: *got}); err != nil {
+		t.Fatalf("partial failure: %v", err)
+	}
+	got, _ = store.GetJob(job.ID)
+	if got.Stage != jobs.StageCompleted || deref(got.TargetLocation) != "git:a" || deref(got.TargetCommit) != "c1" {
+		t.Fatalf("job stage=%s location=%q, want completed with the github result", got.Stage, deref(got.TargetLocation))
+	}
+	want := []jobs.TargetResult{{TargetName: "github", Location: "git:a", Commit: "c1"}, {TargetName: "mirror", Error: "target post: unreachable"}}
+	if !reflect.DeepEqual(got.TargetResults, want) {
+		t.Fatalf("target results %+v, want %+v", got.TargetResults, want)
+	}
+
+	// A retry posts to the failed target only.
+	mirror.err, mirror.res = nil, targets.TargetResult{TargetName: "mirror", Location: "git:b", Commit: "c2"}
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: *got}); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if len(primary.reqs) != 2 || len(mirror.reqs) != 3 {
+		t.Fatalf("posts: github %d, mirror %d; want 2 and 3", len(primary.reqs), len(mirror.reqs))
+	}
+	got, _ = store.GetJob(job.ID)
+	if len(got.TargetResults) != 2 || got.TargetResults[1].Location != "git:b" || got.TargetResults[1].Error != "" {
+		t.Fatalf("target results after retry %+v", got.TargetResults)
+	}
+
+	cbMu.Lock()
+	defer cbMu.Unlock()
+	wantCallbacks := []string{
+		"failed [{github failed} {mirror failed}]",
+		"completed [{github completed} {mirror failed}]",
+		"completed [{github completed} {mirror completed}]",
+	}
+	if !reflect.DeepEqual(callbacks, wantCallbacks) {
+		t.Fatalf("callbacks %q, want %q", callbacks, wantCallbacks)
+	}
+}
+
+func TestWorker_Process_NormalizeTables(t *testing.T) {
+	store := newMemStore()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{PostProcess: config.PostProcessConfig{NormalizeTables: true}}
+	out := "<table><tr><th>Item</th><th>Qty</th></tr><tr><td>Pens</td><td>3</td></tr></table>\n\n" +
+		"<table><tr><td colspan=\"2\">Total</td></tr></table>"
+	worker := New(discardLogger(), cfg, store, &llmMock{out: out}, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	job := jobs.Job{ID: "job-tables", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	want := "| Item | Qty |\n| --- | --- |\n| Pens | 3 |\n\n<table><tr><td colspan=\"2\">Total</td></tr></table>"
+	if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != want {
+		t.Fatalf("unexpected posted markdown: %q", tgt.reqs[0].Markdown)
+	}
+	got, _ := store.GetJob(job.ID)
+	if len(got.Warnings) != 1 || got.Warnings[0] != "tables: left 1 complex HTML tables unchanged" {
+		t.Fatalf("warnings = %v", got.Warnings)
+	}
+}
+
+type imageCaptureLLM struct {
+	mime string
+	img  []byte
+}
+
+func (m *imageCaptureLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	m.mime = mime
+	b, err := io.ReadAll(r)
+	m.img = b
+	return "markdown", err
+}
+
+func TestWorker_Process_ImagePipeline(t *testing.T) {
+	store := newMemStore()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	cfg := &config.Config{LLM: config.LLMConfig{ImagePipeline: []imageproc.Transform{
+		{Name: imageproc.Grayscale},
+		{Name: imageproc.Resize, MaxWidth: 8},
+	}}}
+	llmClient := &imageCaptureLLM{}
+	worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+	src := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	imgPath := filepathJoin(t.TempDir(), "img.jpg")
+	if err := os.WriteFile(imgPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	job := jobs.Job{ID: "job-pipe", ImagePath: imgPath, MimeType: common.MimeImageJPEG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if llmClient.mime != common.MimeImagePNG {
+		t.Fatalf("processed image should be sent as png, got %q", llmClient.mime)
+	}
+	img, err := png.Decode(bytes.NewReader(llmClient.img))
+	if err != nil {
+		t.Fatalf("decode sent image: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 4 {
+		t.Fatalf("sent image size %v, want 8x4", b)
+	}
+}
+
+func TestWorker_Process_MaxLongestEdge(t *testing.T) {
+	store := newMemStore()
+	reg := targets.NewRegistry()
+	reg.Add(&targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}})
+	cfg := &config.Config{LLM: config.LLMConfig{MaxLongestEdge: 8}}
+	llmClient := &imageCaptureLLM{}
+	worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 32))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	job := jobs.Job{ID: "job-edge", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(llmClient.img))
+	if err != nil {
+		t.Fatalf("decode sent image: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 8 {
+		t.Fatalf("sent image size %v, want 4x8", b)
+	}
+}
+
+func TestWorker_Process_MaxImagePixels(t *testing.T) {
+	store := newMemStore()
+	reg := targets.NewRegistry()
+	reg.Add(&targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}})
+	cfg := &config.Config{LLM: config.LLMConfig{MaxImagePixels: 200}}
+	llmClient := &imageCaptureLLM{}
+	worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	job := jobs.Job{ID: "job-pixels", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(llmClient.img))
+	if err != nil {
+		t.Fatalf("decode sent image: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 10 {
+		t.Fatalf("sent image size %v, want 20x10", b)
+	}
+}
+
+func TestWorker_Process_DebugLogsSampledJobs(t *testing.T) {
+	var logs bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&logs, nil))
+	store := newMemStore()
+	reg := targets.NewRegistry()
+	reg.Add(&targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}})
+	cfg := &config.Config{LLM: config.LLMConfig{DebugSampleRate: 0.5}}
+	worker := New(log, cfg, store, &llmMock{out: "Contact jane@example.com"}, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	for _, job := range []jobs.Job{
+		{ID: "job-plain", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"},
+		{ID: "job-debug", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", Debug: true},
+	} {
+		_ = store.CreateJob(&job)
+		if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+	}
+
+	out := logs.String()
+	if n := strings.Count(out, "llm debug"); n != 1 {
+		t.Fatalf("expected one debug entry, got %d:\n%s", n, out)
+	}
+	if !strings.Contains(out, "job_id=job-debug") || strings.Contains(out, "jane@example.com") {
+		t.Fatalf("debug entry should belong to the sampled job and be redacted:\n%s", out)
+	}
+}
+
+func TestWorker_Process_InvalidImagePipelineFailsJob(t *testing.T) {
+	store := newMemStore()
+	reg := targets.NewRegistry()
+	reg.Add(&targetMock{name: "github"})
+	cfg := &config.Config{LLM: config.LLMConfig{ImagePipeline: []imageproc.Transform{{Name: "blur"}}}}
+	llmClient := &llmMock{out: "markdown"}
+	worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	job := jobs.Job{ID: "job-badpipe", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err == nil {
+		t.Fatalf("expected invalid pipeline to fail the job")
+	}
+	if llmClient.calls != 0 {
+		t.Fatalf("llm should not be called, got %d calls", llmClient.calls)
+	}
+	if got, _ := store.GetJob(job.ID); got == nil || got.Stage != jobs.StageFailed {
+		t.Fatalf("job not failed: %+v", got)
+	}
+}
+
+// seqLLM returns its outputs in order, one per call.
+type seqLLM struct {
+	outs  []string
+	calls int
+}
+
+func (m *seqLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	_, _ = io.Copy(io.Discard, r)
+	out := m.outs[m.calls%len(m.outs)]
+	m.calls++
+	return out, nil
+}
+
+func TestWorker_Process_Consensus(t *testing.T) {
+	outs := []string{"line a\nline b", "line a\nline b\nextra", "line a\nline b"}
+	cases := []struct {
+		name         string
+		strategy     string
+		minAgreement float64
+		wantPosted   string
+		wantErr      bool
+	}{
+		{name: "majority", strategy: config.ConsensusMajority, wantPosted: "line a\nline b"},
+		{name: "longest", strategy: config.ConsensusLongest, wantPosted: "line a\nline b\nextra"},
+		{name: "below minimum agreement", strategy: config.ConsensusMajority, minAgreement: 0.9, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			cfg := &config.Config{LLM: config.LLMConfig{
+				ConsensusRuns:         3,
+				ConsensusStrategy:     tc.strategy,
+				ConsensusMinAgreement: tc.minAgreement,
+			}}
+			llmClient := &seqLLM{outs: outs}
+			worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-consensus", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+			_ = store.CreateJob(&job)
+			err := worker.Process(context.Background(), jobs.WorkItem{Job: job})
+			if llmClient.calls != 3 {
+				t.Fatalf("llm calls = %d, want 3", llmClient.calls)
+			}
+			if tc.wantErr {
+				if err == nil || len(tgt.reqs) != 0 {
+					t.Fatalf("expected failure without posting, err=%v posts=%d", err, len(tgt.reqs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != tc.wantPosted {
+				t.Fatalf("posted %q, want %q", tgt.reqs[0].Markdown, tc.wantPosted)
+			}
+			got, _ := store.GetJob(job.ID)
+			// Pairs: (0,1)=2/3, (0,2)=1, (1,2)=2/3.
+			if got.ConsensusRuns != 3 || got.Agreement == nil || *got.Agreement < 0.77 || *got.Agreement > 0.78 {
+				t.Fatalf("consensus not recorded: runs=%d agreement=%v", got.ConsensusRuns, got.Agreement)
+			}
+		})
+	}
+}
+
+func TestWorker_Process_MinMarkdownLength(t *testing.T) {
+	full := "# Meeting notes\n\n- budget approved\n- next review in May"
+	cases := []struct {
+		name         string
+		action       string
+		outs         []string
+		wantCalls    int
+		wantPosted   string
+		wantWarnings int
+		wantErr      bool
+	}{
+		{name: "normal output", action: config.MinMarkdownWarn, outs: []string{full}, wantCalls: 1, wantPosted: full},
+		{name: "warn", action: config.MinMarkdownWarn, outs: []string{"I can't read this."}, wantCalls: 1, wantPosted: "I can't read this.", wantWarnings: 1},
+		{name: "default action warns", outs: []string{"ok"}, wantCalls: 1, wantPosted: "ok", wantWarnings: 1},
+		{name: "retry succeeds", action: config.MinMarkdownRetry, outs: []string{"ok", full}, wantCalls: 2, wantPosted: full},
+		{name: "retry still short", action: config.MinMarkdownRetry, outs: []string{"ok", "still ok"}, wantCalls: 2, wantPosted: "still ok", wantWarnings: 1},
+		{name: "fail", action: config.MinMarkdownFail, outs: []string{"ok"}, wantCalls: 1, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			cfg := &config.Config{LLM: config.LLMConfig{MinMarkdownLength: 30, MinMarkdownAction: tc.action}}
+			llmClient := &seqLLM{outs: tc.outs}
+			worker := New(discardLogger(), cfg, store, llmClient, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-short", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+			_ = store.CreateJob(&job)
+			err := worker.Process(context.Background(), jobs.WorkItem{Job: job})
+			if llmClient.calls != tc.wantCalls {
+				t.Fatalf("llm calls = %d, want %d", llmClient.calls, tc.wantCalls)
+			}
+			got, _ := store.GetJob(job.ID)
+			if tc.wantErr {
+				if err == nil || len(tgt.reqs) != 0 || got.Stage != jobs.StageFailed {
+					t.Fatalf("expected failure without posting, err=%v posts=%d stage=%s", err, len(tgt.reqs), got.Stage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if len(tgt.reqs) != 1 || tgt.reqs[0].Markdown != tc.wantPosted {
+				t.Fatalf("posted %+v, want %q", tgt.reqs, tc.wantPosted)
+			}
+			if len(got.Warnings) != tc.wantWarnings {
+				t.Fatalf("warnings = %v, want %d", got.Warnings, tc.wantWarnings)
+			}
+			if tc.wantWarnings > 0 && !strings.HasPrefix(got.Warnings[0], "suspicious: ") {
+				t.Fatalf("warning not flagged suspicious: %q", got.Warnings[0])
+			}
+		})
+	}
+}
+
+// usageLLM reports model and token usage like a real provider would.
+type usageLLM struct{}
+
+func (usageLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	return "", errors.New("not used")
+}
+
+func (usageLLM) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	return llm.Result{Markdown: "md", FinishReason: "stop", Model: "gpt-5-mini", Usage: llm.Usage{TotalTokens: 100}}, nil
+}
+
+func TestWorker_Process_ProcessingMetrics(t *testing.T) {
+	cases := []struct {
+		name       string
+		client     llm.Client
+		runs       int
+		wantModel  string
+		wantTokens int
+	}{
+		{name: "reported by provider", client: usageLLM{}, wantModel: "gpt-5-mini", wantTokens: 100},
+		{name: "summed over consensus runs", client: usageLLM{}, runs: 3, wantModel: "gpt-5-mini", wantTokens: 300},
+		{name: "configured model as fallback", client: &llmMock{out: "md"}, wantModel: "gpt-5", wantTokens: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			cfg := &config.Config{LLM: config.LLMConfig{
+				Provider:      "aiproxy",
+				AIProxy:       config.AIProxySettings{Model: "gpt-5"},
+				ConsensusRuns: tc.runs,
+			}}
+			worker := New(discardLogger(), cfg, store, tc.client, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-metrics", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+			_ = store.CreateJob(&job)
+			if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			req := tgt.reqs[0]
+			if req.Model != tc.wantModel || req.TokenUsage != tc.wantTokens {
+				t.Fatalf("model=%q tokens=%d, want %q %d", req.Model, req.TokenUsage, tc.wantModel, tc.wantTokens)
+			}
+			if req.DurationMs < 0 {
+				t.Fatalf("negative duration: %d", req.DurationMs)
+			}
+		})
+	}
+}
+
+func TestWorker_Process_CommentsOnGitHubIssue(t *testing.T) {
+	comments := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		comments <- r.URL.Path + " " + body["body"]
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	store := newMemStore()
+	reg := targets.NewRegistry()
+	reg.Add(&targetMock{name: "github", res: targets.TargetResult{TargetName: "github", Location: "notes/a.md"}})
+	cfg := &config.Config{Server: config.ServerConfig{GitHubWebhook: config.GitHubWebhookConfig{
+		Secret: "s", CommentOnCompletion: true, Token: "t", APIURL: ts.URL,
+	}}}
+	worker := New(discardLogger(), cfg, store, &llmMock{out: "md"}, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	commentsURL := ts.URL + "/repos/o/r/issues/7/comments"
+	job := jobs.Job{ID: "job-gh", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github", CommentsURL: &commentsURL}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	select {
+	case got := <-comments:
+		if got != "/repos/o/r/issues/7/comments Transcribed to `notes/a.md`." {
+			t.Fatalf("unexpected comment %q", got)
+		}
+	default:
+		t.Fatalf("no comment posted")
+	}
+}
+
+// langLLM detects a fixed language and records the options of each transcription.
+type langLLM struct {
+	mu   sync.Mutex
+	opts []llm.Options
+}
+
+func (m *langLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	return "", errors.New("not used")
+}
+
+func (m *langLLM) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opts = append(m.opts, opts)
+	return llm.Result{Markdown: "Le budget pour cette année est fixé et les équipes sont d'accord.", Usage: llm.Usage{TotalTokens: 100}}, nil
+}
+
+func (m *langLLM) DetectLanguage(ctx context.Context, r io.Reader, mime string) (string, llm.Usage, error) {
+	return "de", llm.Usage{TotalTokens: 5}, nil
+}
+
+func TestWorker_Process_DetectLanguage(t *testing.T) {
+	cases := []struct {
+		method     string
+		wantLang   string
+		wantOpt    string
+		wantTokens int
+	}{
+		// The LLM answer wins over the text and is passed on to the transcription.
+		{method: config.LanguageDetectionLLM, wantLang: "de", wantOpt: "de", wantTokens: 105},
+		{method: config.LanguageDetectionHeuristic, wantLang: "fr", wantOpt: "", wantTokens: 100},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method, func(t *testing.T) {
+			store := newMemStore()
+			tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+			reg := targets.NewRegistry()
+			reg.Add(tgt)
+			client := &langLLM{}
+			cfg := &config.Config{LLM: config.LLMConfig{DetectLanguage: true, LanguageDetection: tc.method}}
+			worker := New(discardLogger(), cfg, store, client, reg)
+
+			imgPath := filepathJoin(t.TempDir(), "img.png")
+			if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+			job := jobs.Job{ID: "job-lang", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+			_ = store.CreateJob(&job)
+			if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if len(client.opts) != 1 || client.opts[0].Language != tc.wantOpt {
+				t.Fatalf("transcription options %+v, want language %q", client.opts, tc.wantOpt)
+			}
+			got, _ := store.GetJob(job.ID)
+			if got.Language == nil || *got.Language != tc.wantLang {
+				t.Fatalf("stored language %v, want %q", got.Language, tc.wantLang)
+			}
+			if req := tgt.reqs[0]; req.Language != tc.wantLang || req.TokenUsage != tc.wantTokens {
+				t.Fatalf("target request language=%q tokens=%d, want %q %d", req.Language, req.TokenUsage, tc.wantLang, tc.wantTokens)
+			}
+		})
+	}
+}
+
+// flavorLLM answers with Markdown MDX cannot compile and records the options of each call.
+type flavorLLM struct {
+	opts []llm.Options
+}
+
+func (m *flavorLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	return "", errors.New("not used")
+}
+
+func (m *flavorLLM) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	m.opts = append(m.opts, opts)
+	return llm.Result{Markdown: "Total {sum}<br>\n`{code}`", FinishReason: "stop"}, nil
+}
+
+func TestWorker_Process_CachedLanguage(t *testing.T) {
+	store := &cachingStore{memStore: newMemStore(), cache: map[string]jobs.CachedTranscription{}}
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	client := &langLLM{}
+	cfg := &config.Config{LLM: config.LLMConfig{CacheTranscriptions: true, DetectLanguage: true, LanguageDetection: config.LanguageDetectionLLM}}
+	worker := New(discardLogger(), cfg, store, client, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	for _, id := range []string{"job-1", "job-2"} {
+		job := jobs.Job{ID: id, ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+		_ = store.CreateJob(&job)
+		if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+			t.Fatalf("Process %s: %v", id, err)
+		}
+	}
+	// The cache hit keeps the language the LLM detected, not the heuristic guess (fr).
+	if len(client.opts) != 1 {
+		t.Fatalf("expected one transcription, got %d", len(client.opts))
+	}
+	if got, _ := store.GetJob("job-2"); got.Language == nil || *got.Language != "de" {
+		t.Fatalf("cached job language %v, want de", got.Language)
+	}
+}
+
+func TestWorker_Process_MarkdownFlavor(t *testing.T) {
+	store := newMemStore()
+	tgt := &targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}}
+	reg := targets.NewRegistry()
+	reg.Add(tgt)
+	client := &flavorLLM{}
+	cfg := &config.Config{PostProcess: config.PostProcessConfig{MarkdownFlavor: "mdx"}}
+	worker := New(discardLogger(), cfg, store, client, reg)
+
+	imgPath := filepathJoin(t.TempDir(), "img.png")
+	if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+		t.Fatalf("write img: %v", err)
+	}
+	job := jobs.Job{ID: "job-flavor", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+	_ = store.CreateJob(&job)
+	if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if len(client.opts) != 1 || client.opts[0].Flavor != "mdx" {
+		t.Fatalf("transcription options %+v, want flavor mdx", client.opts)
+	}
+	req := tgt.reqs[0]
+	if want := "Total \\{sum\\}<br />\n`{code}`"; req.Markdown != want || req.Flavor != "mdx" {
+		t.Fatalf("target request markdown=%q flavor=%q, want %q mdx", req.Markdown, req.Flavor, want)
+	}
+	got, _ := store.GetJob(job.ID)
+	if got.MarkdownFlavor == nil || *got.MarkdownFlavor != "mdx" {
+		t.Fatalf("stored flavor %v, want mdx", got.MarkdownFlavor)
+	}
+}
+
+// metaLLM reports provider response metadata.
+type metaLLM struct{}
+
+func (metaLLM) TranscribeImage(ctx context.Context, r io.Reader, mime string) (string, error) {
+	return "", errors.New("not used")
+}
+
+func (metaLLM) TranscribeImageResult(ctx context.Context, r io.Reader, mime string, opts llm.Options) (llm.Result, error) {
+	return llm.Result{
+		Markdown: "md", FinishReason: "stop", Model: "gpt-5-mini",
+		Meta: &llm.ProviderMeta{ID: "chatcmpl-1", Model: "gpt-5-mini-2025-08-07", FinishReason: "stop", Created: 1754524800},
+	}, nil
+}
+
+func TestWorker_Process_StoresProviderMeta(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		store := newMemStore()
+		reg := targets.NewRegistry()
+		reg.Add(&targetMock{name: "github", res: targets.TargetResult{TargetName: "github"}})
+		cfg := &config.Config{LLM: config.LLMConfig{StoreProviderMeta: enabled}}
+		worker := New(discardLogger(), cfg, store, metaLLM{}, reg)
+
+		imgPath := filepathJoin(t.TempDir(), "img.png")
+		if err := os.WriteFile(imgPath, []byte("fakeimg"), 0o600); err != nil {
+			t.Fatalf("write img: %v", err)
+		}
+		job := jobs.Job{ID: "job-meta", ImagePath: imgPath, MimeType: common.MimeImagePNG, TargetName: "github"}
+		_ = store.CreateJob(&job)
+		if err := worker.Process(context.Background(), jobs.WorkItem{Job: job}); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+		got, _ := store.GetJob(job.ID)
+		if !enabled {
+			if got.ProviderMeta != nil {
+				t.Fatalf("provider meta stored although disabled: %s", got.ProviderMeta)
+			}
+			continue
+		}
+		var meta llm.ProviderMeta
+		if err := json.Unmarshal(got.ProviderMeta, &meta); err != nil {
+			t.Fatalf("decode provider meta %q: %v", got.ProviderMeta, err)
+		}
+		if meta.ID != "chatcmpl-1" || meta.Model != "gpt-5-mini-2025-08-07" || meta.Created != 1754524800 {
+			t.Fatalf("unexpected provider meta %+v", meta)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultReplacement is used when no replacement string is configured.
+const DefaultReplacement = "[REDACTED]"
+
+// builtinPatterns maps well-known names to regular expressions for common PII.
+var builtinPatterns = map[string]string{
+	// US social security number, e.g. 123-45-6789
+	"ssn": `\b\d{3}-\d{2}-\d{4}\b`,
+	// Payment card numbers of 13-19 digits, optionally grouped by spaces or dashes
+	"credit_card": `\b\d(?:[ -]?\d){12,18}\b`,
+	// E-mail addresses
+	"email": `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`,
+	// International bank account numbers, e.g. DE89 3704 0044 0532 0130 00
+	"iban": `\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`,
+}
+
+// DefaultPatterns are applied when no patterns are configured.
+var DefaultPatterns = []string{"ssn", "credit_card"}
+
+// BuiltinNames returns the names of all built-in patterns in sorted order.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtinPatterns))
+	for name := range builtinPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Redactor replaces sensitive content matched by a set of patterns.
+type Redactor struct {
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// New compiles patterns into a Redactor. Each entry is either the name of a built-in
+// pattern (ssn, credit_card, email, iban) or a regular expression. An empty list selects DefaultPatterns,
+// an empty replacement selects DefaultReplacement.
+func New(patterns []string, replacement string) (*Redactor, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultPatterns
+	}
+	if replacement == "" {
+		replacement = DefaultReplacement
+	}
+	r := &Redactor{replacement: replacement}
+	for _, p := range patterns {
+		expr := strings.TrimSpace(p)
+		if expr == "" {
+			return nil, fmt.Errorf("empty redaction pattern")
+		}
+		if builtin, ok := builtinPatterns[strings.ToLower(expr)]; ok {
+			expr = builtin
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compile redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redact replaces all matches in s and returns the result with the number of replacements.
+func (r *Redactor) Redact(s string) (string, int) {
+	count := 0
+	for _, re := range r.patterns {
+		s = re.ReplaceAllStringFunc(s, func(string) string {
+			count++
+			return r.replacement
+		})
+	}
+	return s, count
+}
+
+// Matches reports whether any pattern matches s.
+func (r *Redactor) Matches(s string) bool {
+	for _, re := range r.patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
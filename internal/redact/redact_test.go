@@ -0,0 +1,68 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact_BuiltinPatterns(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		in      string
+		leak    string
+	}{
+		{"ssn", "ssn", "SSN: 123-45-6789 on file", "123-45-6789"},
+		{"credit card grouped", "credit_card", "Card 4111 1111 1111 1111 exp 12/29", "4111 1111 1111 1111"},
+		{"credit card plain", "credit_card", "Card 5500000000000004.", "5500000000000004"},
+		{"email", "email", "Contact jane.doe@example.com today", "jane.doe@example.com"},
+		{"iban", "iban", "IBAN DE89 3704 0044 0532 0130 00", "DE89 3704 0044 0532 0130 00"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := New([]string{c.pattern}, "")
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if !r.Matches(c.in) {
+				t.Fatalf("expected match in %q", c.in)
+			}
+			out, n := r.Redact(c.in)
+			if n == 0 || strings.Contains(out, c.leak) || !strings.Contains(out, DefaultReplacement) {
+				t.Fatalf("not redacted: %q (n=%d)", out, n)
+			}
+		})
+	}
+}
+
+func TestRedact_DefaultsCustomPatternAndReplacement(t *testing.T) {
+	r, err := New(nil, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	out, n := r.Redact("ssn 123-45-6789, mail a@b.io, date 2024-01-02")
+	if n != 1 || !strings.Contains(out, "a@b.io") || !strings.Contains(out, "2024-01-02") {
+		t.Fatalf("defaults should only redact ssn and card numbers: %q (n=%d)", out, n)
+	}
+
+	r, err = New([]string{`secret-\w+`}, "***")
+	if err != nil {
+		t.Fatalf("New custom: %v", err)
+	}
+	out, n = r.Redact("token secret-abc and secret-def")
+	if n != 2 || out != "token *** and ***" {
+		t.Fatalf("custom redaction mismatch: %q (n=%d)", out, n)
+	}
+	if r.Matches("nothing here") {
+		t.Fatalf("unexpected match")
+	}
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := New([]string{"("}, ""); err == nil {
+		t.Fatalf("expected compile error")
+	}
+	if _, err := New([]string{" "}, ""); err == nil {
+		t.Fatalf("expected error for empty pattern")
+	}
+}
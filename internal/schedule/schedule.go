@@ -0,0 +1,111 @@
+// Package schedule decides whether a point in time falls into one of a set of weekly
+// recurring time windows, e.g. the hours in which transcriptions may be posted.
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zones also work in images without a zoneinfo database
+)
+
+// Window is a daily time range, optionally limited to some days of the week.
+type Window struct {
+	Start string   `yaml:"start"` // "HH:MM", inclusive
+	End   string   `yaml:"end"`   // "HH:MM", exclusive; at or before start the window ends the next day
+	Days  []string `yaml:"days"`  // days the window starts on (mon..sun); empty = every day
+}
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Schedule is a validated set of windows in a time zone.
+type Schedule struct {
+	loc     *time.Location
+	windows []window
+}
+
+type window struct {
+	start, end int // minutes since midnight
+	days       [7]bool
+}
+
+// New validates the windows and returns a Schedule evaluating them in the IANA time zone
+// tz ("" = UTC). It returns nil for an empty list.
+func New(windows []Window, tz string) (*Schedule, error) {
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(strings.TrimSpace(tz))
+	if err != nil {
+		return nil, fmt.Errorf("time zone: %w", err)
+	}
+	s := &Schedule{loc: loc}
+	for i, w := range windows {
+		var p window
+		if p.start, err = parseClock(w.Start); err != nil {
+			return nil, fmt.Errorf("window %d: start: %w", i, err)
+		}
+		if p.end, err = parseClock(w.End); err != nil {
+			return nil, fmt.Errorf("window %d: end: %w", i, err)
+		}
+		if len(w.Days) == 0 {
+			p.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		for _, d := range w.Days {
+			wd, ok := dayNames[strings.ToLower(strings.TrimSpace(d))]
+			if !ok {
+				return nil, fmt.Errorf("window %d: unknown day %q", i, d)
+			}
+			p.days[wd] = true
+		}
+		s.windows = append(s.windows, p)
+	}
+	return s, nil
+}
+
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Open reports whether t falls into one of the windows.
+func (s *Schedule) Open(t time.Time) bool {
+	t = t.In(s.loc)
+	m := t.Hour()*60 + t.Minute()
+	day, prev := t.Weekday(), (t.Weekday()+6)%7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[day] && m >= w.start && m < w.end {
+				return true
+			}
+			continue
+		}
+		// The window runs past midnight into the next day.
+		if (w.days[day] && m >= w.start) || (w.days[prev] && m < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the start of the next minute at or after t in which the schedule is open,
+// or the zero time if it is never open within a week.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.Open(t) {
+		return t
+	}
+	t = t.Truncate(time.Minute)
+	for i := 0; i < 8*24*60; i++ {
+		t = t.Add(time.Minute)
+		if s.Open(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
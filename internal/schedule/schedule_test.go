@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNew_Validation(t *testing.T) {
+	if s, err := New(nil, "Mars/Olympus"); s != nil || err != nil {
+		t.Fatalf("empty schedule should be nil, got %v %v", s, err)
+	}
+	for _, bad := range []struct {
+		w  Window
+		tz string
+	}{
+		{Window{Start: "8", End: "18:00"}, ""},
+		{Window{Start: "08:00", End: "24:30"}, ""},
+		{Window{Start: "08:00", End: "18:00", Days: []string{"someday"}}, ""},
+		{Window{Start: "08:00", End: "18:00"}, "Mars/Olympus"},
+	} {
+		if _, err := New([]Window{bad.w}, bad.tz); err == nil {
+			t.Errorf("expected error for %+v in %q", bad.w, bad.tz)
+		}
+	}
+}
+
+func TestSchedule_Open(t *testing.T) {
+	s, err := New([]Window{
+		{Start: "09:00", End: "17:00", Days: []string{"mon", "Tue", "wed", "thu", "fri"}},
+		{Start: "22:00", End: "02:00", Days: []string{"sat"}},
+	}, "Europe/Berlin")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	at := func(day, hour, minute int) time.Time { // March 2025: the 3rd is a Monday
+		return time.Date(2025, 3, day, hour, minute, 0, 0, berlin)
+	}
+	for _, tc := range []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(3, 9, 0), true},
+		{at(3, 16, 59), true},
+		{at(3, 17, 0), false}, // end is exclusive
+		{at(3, 8, 30).In(time.UTC), false},
+		{time.Date(2025, 3, 3, 8, 30, 0, 0, time.UTC), true}, // 09:30 in Berlin
+		{at(8, 12, 0), false},                                // Saturday daytime
+		{at(8, 23, 0), true},                                 // Saturday night
+		{at(9, 1, 59), true},                                 // past midnight into Sunday
+		{at(9, 2, 0), false},
+		{at(9, 23, 0), false}, // the night window starts on Saturdays only
+	} {
+		if got := s.Open(tc.t); got != tc.want {
+			t.Errorf("Open(%v) = %v, want %v", tc.t, got, tc.want)
+		}
+	}
+	if got, want := s.Next(at(3, 17, 30)), at(4, 9, 0); !got.Equal(want) {
+		t.Fatalf("Next = %v, want %v", got, want)
+	}
+}
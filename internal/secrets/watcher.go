@@ -0,0 +1,88 @@
+// Package secrets reloads file-based secrets, such as mounted token files, when they
+// change on disk so rotated credentials are picked up without a restart.
+package secrets
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+)
+
+// Watcher polls secret files and reports changed values. It only stats the files on
+// each tick and reads them when the file was replaced or modified, which also covers
+// Kubernetes secret volumes that swap a symlink to a new file.
+type Watcher struct {
+	log      *slog.Logger
+	interval time.Duration
+
+	mu    sync.Mutex
+	files []*watchedFile
+}
+
+type watchedFile struct {
+	path     string
+	info     os.FileInfo // last seen; nil if the file could not be stat'ed
+	value    string
+	onChange func(string)
+}
+
+// NewWatcher creates a Watcher that checks its files every interval.
+func NewWatcher(logger *slog.Logger, interval time.Duration) *Watcher {
+	return &Watcher{log: logger, interval: interval}
+}
+
+// Watch registers path, whose current content is value. onChange is called with the
+// new trimmed content whenever it differs from the last value. Empty or unreadable
+// files are logged and leave the last value in use.
+func (w *Watcher) Watch(path, value string, onChange func(string)) {
+	info, _ := os.Stat(path)
+	w.mu.Lock()
+	w.files = append(w.files, &watchedFile{path: path, info: info, value: value, onChange: onChange})
+	w.mu.Unlock()
+}
+
+// Run checks the files every interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.CheckOnce()
+		}
+	}
+}
+
+// CheckOnce checks all files once and calls onChange for those whose value changed.
+func (w *Watcher) CheckOnce() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, f := range w.files {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			w.log.Warn("stat secret file", "path", f.path, "err", err)
+			continue
+		}
+		if f.info != nil && os.SameFile(f.info, info) && f.info.ModTime().Equal(info.ModTime()) && f.info.Size() == info.Size() {
+			continue
+		}
+		v, err := config.ReadSecretFile(f.path)
+		if err != nil {
+			w.log.Warn("reload secret file", "path", f.path, "err", err)
+			continue
+		}
+		f.info = info
+		if v == f.value {
+			continue
+		}
+		f.value = v
+		f.onChange(v)
+		w.log.Info("secret reloaded", "path", f.path)
+	}
+}
@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+	githubTarget "github.com/jo-hoe/gostwriter/internal/targets/github"
+)
+
+// replaceFile atomically swaps path for a new file, as secret volumes do on rotation.
+func replaceFile(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := path + ".new"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+}
+
+func TestWatcher_RotatedTokenIsUsedByTarget(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"commit":{"sha":"abc"}}`)
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	replaceFile(t, tokenFile, "old-token\n")
+	token, err := appcfg.ReadSecretFile(tokenFile)
+	if err != nil {
+		t.Fatalf("ReadSecretFile: %v", err)
+	}
+	tg, err := githubTarget.New("github", appcfg.GitHubTargetConfig{
+		RepositoryOwner: "org", RepositoryName: "repo", Branch: "main", APIBaseURL: ts.URL,
+		Auth: appcfg.GitHubAuthConfig{Token: token},
+	})
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	tg.WithHTTPClient(ts.Client())
+
+	w := NewWatcher(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Hour)
+	reloads := 0
+	w.Watch(tokenFile, token, func(v string) {
+		reloads++
+		tg.SetToken(v)
+	})
+	post := func() string {
+		t.Helper()
+		if _, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now()}); err != nil {
+			t.Fatalf("Post: %v", err)
+		}
+		return auth
+	}
+
+	w.CheckOnce()
+	if got := post(); got != "Bearer old-token" || reloads != 0 {
+		t.Fatalf("unchanged file: auth %q, reloads %d", got, reloads)
+	}
+
+	replaceFile(t, tokenFile, "new-token\n")
+	w.CheckOnce()
+	if got := post(); got != "Bearer new-token" || reloads != 1 {
+		t.Fatalf("rotated file: auth %q, reloads %d", got, reloads)
+	}
+
+	// An empty file (e.g., caught mid-write) keeps the last token.
+	replaceFile(t, tokenFile, "")
+	w.CheckOnce()
+	if got := post(); got != "Bearer new-token" || reloads != 1 {
+		t.Fatalf("empty file: auth %q, reloads %d", got, reloads)
+	}
+}
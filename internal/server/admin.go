@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/storage"
+)
+
+type purgeResponse struct {
+	Jobs           int `json:"jobs"`
+	Uploads        int `json:"uploads"`
+	PartialUploads int `json:"partial_uploads"`
+}
+
+// handleAdminPurge deletes all jobs, stored uploads and unfinished resumable uploads. It
+// is refused unless server.allowAdminPurge is set and an API key is configured. Jobs
+// still in flight are not stopped; their results fail to save once their rows are gone.
+func (svc *Service) handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	if !svc.Cfg.Server.AllowAdminPurge {
+		http.Error(w, "admin purge is disabled", http.StatusForbidden)
+		return
+	}
+	if !svc.apiKeyRequired() {
+		http.Error(w, "admin purge requires an API key", http.StatusForbidden)
+		return
+	}
+	purger, ok := svc.Store.(jobs.Purger)
+	if !ok {
+		http.Error(w, "store does not support purging", http.StatusNotImplemented)
+		return
+	}
+	var res purgeResponse
+	var err error
+	if res.Jobs, err = purger.PurgeAll(); err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("purge jobs", "err", err)
+		}
+		http.Error(w, "failed to purge jobs", http.StatusInternalServerError)
+		return
+	}
+	if res.Uploads, err = svc.Uploader.RemoveAll(); err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("purge uploads", "err", err)
+		}
+		http.Error(w, "failed to purge uploads", http.StatusInternalServerError)
+		return
+	}
+	if res.PartialUploads, err = storage.RemoveFiles(svc.partialDir()); err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("purge partial uploads", "err", err)
+		}
+		http.Error(w, "failed to purge partial uploads", http.StatusInternalServerError)
+		return
+	}
+	if svc.Log != nil {
+		svc.Log.Warn("purged all data", "actor", deref(actorFromContext(r.Context())),
+			"jobs", res.Jobs, "uploads", res.Uploads, "partial_uploads", res.PartialUploads)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+type vacuumResponse struct {
+	SizeBefore int64 `json:"size_before"` // bytes of the database file (and WAL) before
+	SizeAfter  int64 `json:"size_after"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// handleAdminVacuum rebuilds the job database to reclaim the space of deleted jobs while
+// the server keeps serving. ?checkpoint=true also truncates the write-ahead log. A
+// second request while a vacuum runs answers 409.
+func (svc *Service) handleAdminVacuum(w http.ResponseWriter, r *http.Request) {
+	vacuumer, ok := svc.Store.(jobs.Vacuumer)
+	if !ok {
+		http.Error(w, "store does not support vacuum", http.StatusNotImplemented)
+		return
+	}
+	checkpoint := false
+	if v := r.URL.Query().Get("checkpoint"); v != "" {
+		var err error
+		if checkpoint, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "checkpoint must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	start := time.Now()
+	res, err := vacuumer.Vacuum(checkpoint)
+	if errors.Is(err, jobs.ErrVacuumRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("vacuum", "err", err)
+		}
+		http.Error(w, "failed to vacuum", http.StatusInternalServerError)
+		return
+	}
+	out := vacuumResponse{SizeBefore: res.SizeBefore, SizeAfter: res.SizeAfter, DurationMs: time.Since(start).Milliseconds()}
+	if svc.Log != nil {
+		svc.Log.Info("vacuumed job database", "actor", deref(actorFromContext(r.Context())),
+			"size_before", out.SizeBefore, "size_after", out.SizeAfter, "duration_ms", out.DurationMs)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+)
+
+// eventsPollInterval is how often an event stream re-reads its job from the store, for
+// stage changes that are not published, e.g. by the reaper or another instance.
+const eventsPollInterval = 2 * time.Second
+
+// handleTranscriptionEvents streams the status of a job as Server-Sent Events: one
+// "stage" event with the status response now and on each stage change, until the job
+// is completed or failed, the client disconnects or the server shuts down.
+func (svc *Service) handleTranscriptionEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	// Subscribing first, no change between the first read and the subscription is missed.
+	var changes <-chan jobs.Stage
+	if svc.Events != nil {
+		ch, unsubscribe := svc.Events.Subscribe(id)
+		defer unsubscribe()
+		changes = ch
+	}
+	job, err := svc.Store.GetJob(id)
+	if err != nil || job == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// The stream outlives server.writeTimeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(eventsPollInterval)
+	defer ticker.Stop()
+	stopping := serverStopping(r.Context())
+	var last jobs.Stage
+	for {
+		if job.Stage != last {
+			if err := svc.writeStageEvent(w, job); err != nil {
+				return
+			}
+			flusher.Flush()
+			last = job.Stage
+		}
+		if job.Stage == jobs.StageCompleted || job.Stage == jobs.StageFailed {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-stopping:
+			return
+		case <-changes:
+		case <-ticker.C:
+		}
+		if job, err = svc.Store.GetJob(id); err != nil || job == nil {
+			return
+		}
+	}
+}
+
+// writeStageEvent writes the status response of job as a "stage" event.
+func (svc *Service) writeStageEvent(w http.ResponseWriter, job *jobs.Job) error {
+	b, err := json.Marshal(svc.jobStatus(job))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: stage\ndata: %s\n\n", b)
+	return err
+}
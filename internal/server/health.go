@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+)
+
+// readyPingTimeout bounds the database check of a readiness probe.
+const readyPingTimeout = 2 * time.Second
+
+// handleReadyz answers 200 once the job database can be reached, the queue is started
+// and at least one target is registered, and 503 with the failing components otherwise.
+// Reasons are logged rather than returned, as the probe needs no API key.
+func (svc *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	failing := []string{}
+	if p, ok := svc.Store.(jobs.Pinger); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readyPingTimeout)
+		err := p.Ping(ctx)
+		cancel()
+		if err != nil {
+			failing = append(failing, "database")
+			if svc.Log != nil {
+				svc.Log.Warn("readiness: database unreachable", "err", err)
+			}
+		}
+	}
+	if svc.Queue == nil || !svc.Queue.Ready() {
+		failing = append(failing, "queue")
+	}
+	if svc.Targets == nil || len(svc.Targets.Names()) == 0 {
+		failing = append(failing, "targets")
+	}
+	if len(failing) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "unavailable", "failing": failing})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// imageURLField is the form field naming an image to download instead of a file upload.
+const imageURLField = "image_url"
+
+// maxImageURLRedirects bounds the redirects followed for an image_url.
+const maxImageURLRedirects = 5
+
+// fetchImageURL downloads the image at raw through the uploader, with the same size and
+// type checks as a file upload. raw must be an http(s) URL on one of
+// server.imageUrlHosts, and so must every redirect. Return values match
+// storage.Uploader.SaveImageStream.
+func (svc *Service) fetchImageURL(ctx context.Context, raw string) (string, func() error, string, error) {
+	hosts := svc.Cfg.Server.ImageURLHosts
+	if len(hosts) == 0 {
+		return "", nil, "", errors.New("not enabled on this server")
+	}
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if err := checkImageURL(u, hosts); err != nil {
+		return "", nil, "", err
+	}
+
+	client := &http.Client{
+		Timeout: svc.Cfg.Server.ImageURLTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxImageURLRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkImageURL(req.URL, hosts)
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("download: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", nil, "", fmt.Errorf("download: status %d", resp.StatusCode)
+	}
+	maxBytes := safeInt64(svc.Cfg.Server.MaxUploadSize)
+	if resp.ContentLength > maxBytes {
+		return "", nil, "", fmt.Errorf("image exceeds %d bytes", maxBytes)
+	}
+	p, cleanup, mimeType, err := svc.Uploader.SaveImageStream(resp.Body, path.Base(resp.Request.URL.Path), resp.Header.Get("Content-Type"), maxBytes)
+	if err != nil {
+		return "", nil, "", err
+	}
+	// The uploader stops at maxBytes; anything left means the image was too large.
+	if n, _ := resp.Body.Read(make([]byte, 1)); n > 0 {
+		_ = cleanup()
+		return "", nil, "", fmt.Errorf("image exceeds %d bytes", maxBytes)
+	}
+	return p, cleanup, mimeType, nil
+}
+
+// checkImageURL reports why u may not be downloaded: it must be http or https and its
+// host must match one of hosts, exactly or, for "*.example.com", as a subdomain.
+func checkImageURL(u *url.URL, hosts []string) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return errors.New("missing host")
+	}
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if host == h || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s is not allowed", host)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/storage"
+	"github.com/jo-hoe/gostwriter/internal/util"
+)
+
+// IngestWatcher polls server.ingestDir and creates a job for each image file that
+// appears in it, for non-HTTP workflows such as a scanner writing to a shared folder.
+type IngestWatcher struct {
+	svc      *Service
+	dir      string
+	interval time.Duration
+	seen     map[string]ingestFile // by file name, as of the previous poll
+}
+
+// ingestFile is what a poll saw of a file. A file is ingested once a poll sees it
+// unchanged, so files still being written are left alone.
+type ingestFile struct {
+	size     int64
+	modTime  time.Time
+	rejected bool // not retried until the file changes
+}
+
+// NewIngestWatcher creates a watcher for svc.Cfg.Server.IngestDir.
+func (svc *Service) NewIngestWatcher() *IngestWatcher {
+	return &IngestWatcher{
+		svc:      svc,
+		dir:      svc.Cfg.Server.IngestDir,
+		interval: svc.Cfg.Server.IngestInterval,
+		seen:     make(map[string]ingestFile),
+	}
+}
+
+// Run polls the directory every interval until ctx is done.
+func (iw *IngestWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(iw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			iw.CheckOnce()
+		}
+	}
+}
+
+// CheckOnce ingests the image files that are unchanged since the previous call and
+// returns how many jobs were queued. Files are moved to the done/ subdirectory once
+// their job is queued; files that could not be queued are retried on the next call.
+func (iw *IngestWatcher) CheckOnce() int {
+	log := iw.svc.Log
+	entries, err := os.ReadDir(iw.dir)
+	if err != nil {
+		log.Warn("read ingest dir", "dir", iw.dir, "err", err)
+		return 0
+	}
+	current := make(map[string]ingestFile, len(entries))
+	queued := 0
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || strings.HasPrefix(name, ".") || storage.CheckImageType(name, "") != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since ReadDir
+		}
+		f := ingestFile{size: info.Size(), modTime: info.ModTime()}
+		prev, ok := iw.seen[name]
+		if !ok || prev.size != f.size || !prev.modTime.Equal(f.modTime) || f.size == 0 {
+			current[name] = f // new or still being written
+			continue
+		}
+		if prev.rejected {
+			current[name] = prev
+			continue
+		}
+		jobID, retry, err := iw.ingest(name)
+		if err != nil {
+			log.Warn("ingest file", "file", name, "err", err)
+			f.rejected = !retry
+			current[name] = f
+			continue
+		}
+		queued++
+		log.Info("job enqueued from ingest dir", "job_id", jobID, "file", name)
+	}
+	iw.seen = current
+	return queued
+}
+
+// ingest creates and queues the job for the file name and moves the file to done/. retry
+// reports whether a failure may go away without the file changing, e.g. a full queue.
+func (iw *IngestWatcher) ingest(name string) (jobID string, retry bool, err error) {
+	svc := iw.svc
+	if svc.Queue.Depth() >= svc.Queue.Capacity() || svc.queueSaturated() {
+		return "", true, errors.New("queue full")
+	}
+	src, err := os.Open(filepath.Join(iw.dir, name)) // #nosec G304 - name listed from the configured ingest dir
+	if err != nil {
+		return "", true, err
+	}
+	imgPath, cleanup, mimeType, err := svc.Uploader.SaveImageStream(src, name, "", safeInt64(svc.Cfg.Server.MaxUploadSize))
+	_ = src.Close()
+	if err != nil {
+		return "", false, err
+	}
+
+	job := jobs.Job{
+		ID:         util.NewID(),
+		ImagePath:  imgPath,
+		MimeType:   mimeType,
+		TargetName: svc.defaultTargetName(),
+		Targets:    svc.jobTargets(),
+		Metadata:   map[string]any{"ingest_file": name},
+		Debug:      svc.sampleDebug(),
+		Stage:      jobs.StageQueued,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := svc.Store.CreateJob(&job); err != nil {
+		_ = cleanup()
+		return "", true, fmt.Errorf("persist job: %w", err)
+	}
+	if err := svc.Queue.Enqueue(jobs.WorkItem{Job: job, Cleanup: svc.processedCleanup(cleanup)}); err != nil {
+		_ = cleanup()
+		_ = svc.Store.SaveError(job.ID, "queue full", time.Now().UTC())
+		return "", true, fmt.Errorf("enqueue: %w", err)
+	}
+
+	// The job works on its own copy, so the file can be moved right away. The job id
+	// prefix keeps names unique and links each file to its job.
+	done := filepath.Join(iw.dir, common.DoneDirName)
+	moveErr := os.MkdirAll(done, 0o750)
+	if moveErr == nil {
+		moveErr = os.Rename(filepath.Join(iw.dir, name), filepath.Join(done, job.ID+"-"+name))
+	}
+	if moveErr != nil {
+		// Leaving the file would ingest it again on the next poll.
+		_ = os.Remove(filepath.Join(iw.dir, name))
+		svc.Log.Warn("move ingested file to done dir; removed it instead", "file", name, "err", moveErr)
+	}
+	return job.ID, false, nil
+}
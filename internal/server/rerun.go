@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+	"github.com/jo-hoe/gostwriter/internal/util"
+)
+
+// maxRerunBody bounds the JSON body of a rerun request.
+const maxRerunBody = 64 << 10
+
+// rerunRequest holds the optional overrides of a rerun.
+type rerunRequest struct {
+	Model        string `json:"model"`
+	Instructions string `json:"instructions"`
+	Target       string `json:"target"`
+}
+
+// handleRerunTranscription transcribes the image of an existing job again as a new async
+// job, optionally with another model, instructions or target, e.g. to compare prompts on
+// the same source. The new job links to the original through parent_job_id. Registered
+// only with server.keepUploads, since the image is otherwise deleted after processing.
+func (svc *Service) handleRerunTranscription(w http.ResponseWriter, r *http.Request) {
+	parent, err := svc.Store.GetJob(r.PathValue("id"))
+	if err != nil || parent == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var req rerunRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRerunBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	targetName := parent.TargetName
+	if t := strings.TrimSpace(req.Target); t != "" {
+		known := false
+		if svc.Targets != nil {
+			_, known = svc.Targets.Get(t)
+		}
+		if !known {
+			http.Error(w, "unknown target: "+t, http.StatusBadRequest)
+			return
+		}
+		targetName = t
+	}
+	if svc.queueSaturated() {
+		w.Header().Set(common.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(svc.Cfg.Server.QueueRetryAfter)))
+		http.Error(w, "too many queued jobs, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	// The rerun gets its own copy of the image, so retention can delete either job first.
+	src, err := svc.images().Open(parent.ImagePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "original image is no longer available", http.StatusGone)
+		return
+	}
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("open original image", "job_id", parent.ID, "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	imgPath, cleanup, mimeType, err := svc.Uploader.SaveImageStream(src, parent.ImagePath, parent.MimeType, safeInt64(svc.Cfg.Server.MaxUploadSize))
+	_ = src.Close()
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("copy original image", "job_id", parent.ID, "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	job := jobs.Job{
+		ID:           util.NewID(),
+		ImagePath:    imgPath,
+		MimeType:     mimeType,
+		TargetName:   targetName,
+		Title:        parent.Title,
+		Metadata:     parent.Metadata,
+		Actor:        actorFromContext(r.Context()),
+		AuthorName:   parent.AuthorName,
+		AuthorEmail:  parent.AuthorEmail,
+		ParentJobID:  &parent.ID,
+		Model:        parseOptionalString(strings.TrimSpace(req.Model)),
+		Instructions: parseOptionalString(strings.TrimSpace(req.Instructions)),
+		Debug:        svc.sampleDebug(),
+		Stage:        jobs.StageQueued,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if strings.TrimSpace(req.Target) == "" {
+		job.Targets = parent.Targets // an explicit target posts there only
+	}
+	if targetName == parent.TargetName {
+		job.TargetBranch, job.TargetBasePath = parent.TargetBranch, parent.TargetBasePath
+	}
+	if err := svc.Store.CreateJob(&job); err != nil {
+		_ = cleanup()
+		if svc.Log != nil {
+			svc.Log.Error("persist job", "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := svc.Queue.Enqueue(jobs.WorkItem{Job: job, Cleanup: svc.processedCleanup(cleanup), TraceParent: tracing.Traceparent(r.Context())}); err != nil {
+		_ = cleanup()
+		_ = svc.Store.SaveError(job.ID, "queue full", time.Now().UTC())
+		http.Error(w, "queue full, try later", http.StatusServiceUnavailable)
+		return
+	}
+	if svc.Log != nil {
+		svc.Log.Info("rerun enqueued", "job_id", job.ID, "parent_job_id", parent.ID, "target", targetName)
+	}
+	out := jobToOut(&job)
+	out["status_url"] = path.Join(common.PathTranscriptions, job.ID)
+	writeJSON(w, http.StatusAccepted, out)
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+)
+
+// Reviewer approves or rejects transcriptions held by the quality gate; implemented by
+// processor.Worker.
+type Reviewer interface {
+	// Approve posts the held transcription of job, or markdown instead if it is not
+	// empty. It returns jobs.ErrNotInReview if the job is not held.
+	Approve(ctx context.Context, job jobs.Job, markdown string) error
+	// Reject fails the held job with the optional reason without posting it. It returns
+	// jobs.ErrNotInReview if the job is not held.
+	Reject(ctx context.Context, job jobs.Job, reason string) error
+}
+
+// Limits of the list endpoint.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// maxReviewBody bounds the JSON body of approve and reject requests, which may carry an
+// edited transcription.
+const maxReviewBody = 4 << 20
+
+// approveRequest optionally replaces the held transcription.
+type approveRequest struct {
+	Markdown string `json:"markdown"`
+}
+
+// rejectRequest optionally records why a held job was rejected.
+type rejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+// decodeReviewBody decodes the optional JSON body of r into v; an empty body is allowed.
+func decodeReviewBody(r *http.Request, v any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxReviewBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// handleListTranscriptions lists the jobs in the stage given by the stage query field,
+// oldest first, e.g. those held for review in needs_review.
+func (svc *Service) handleListTranscriptions(w http.ResponseWriter, r *http.Request) {
+	rs, ok := svc.Store.(jobs.ReviewStore)
+	if !ok {
+		http.Error(w, "listing jobs is not supported by the job store", http.StatusNotImplemented)
+		return
+	}
+	stage := r.URL.Query().Get("stage")
+	if stage == "" {
+		http.Error(w, "stage is required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxListLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxListLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	list, err := rs.ListByStage(jobs.Stage(stage), limit)
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("list jobs", "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]any, 0, len(list))
+	for i := range list {
+		out = append(out, svc.jobStatus(&list[i]))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": out})
+}
+
+// handleApproveTranscription posts the transcription the quality gate held for a job, or
+// the edited markdown of the body, and answers with the job status.
+func (svc *Service) handleApproveTranscription(w http.ResponseWriter, r *http.Request) {
+	job, err := svc.Store.GetJob(r.PathValue("id"))
+	if err != nil || job == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var req approveRequest
+	if err := decodeReviewBody(r, &req); err != nil {
+		http.Error(w, "invalid json body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = svc.Reviews.Approve(r.Context(), *job, strings.TrimSpace(req.Markdown))
+	if errors.Is(err, jobs.ErrNotInReview) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	status := http.StatusOK
+	if err != nil {
+		// The job is failed with the post error, as any other failed post.
+		status = http.StatusBadGateway
+	}
+	if job, err = svc.Store.GetJob(job.ID); err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, svc.jobStatus(job))
+}
+
+// handleRejectTranscription fails a job held by the quality gate without posting it and
+// answers with the job status. The optional reason is kept in the job error, which the
+// status shows. As for any failed job, the failed callback is sent and the image is
+// deleted unless server.keepUploads keeps it.
+func (svc *Service) handleRejectTranscription(w http.ResponseWriter, r *http.Request) {
+	job, err := svc.Store.GetJob(r.PathValue("id"))
+	if err != nil || job == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var req rejectRequest
+	if err := decodeReviewBody(r, &req); err != nil {
+		http.Error(w, "invalid json body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = svc.Reviews.Reject(r.Context(), *job, strings.TrimSpace(req.Reason))
+	if errors.Is(err, jobs.ErrNotInReview) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("reject held job", "job_id", job.ID, "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	images, imgPath := svc.images(), job.ImagePath
+	if cleanup := svc.processedCleanup(func() error { return images.Delete(imgPath) }); cleanup != nil {
+		if err := cleanup(); err != nil && !errors.Is(err, fs.ErrNotExist) && svc.Log != nil {
+			svc.Log.Warn("delete image of rejected job", "job_id", job.ID, "error", err)
+		}
+	}
+	if job, err = svc.Store.GetJob(job.ID); err != nil || job == nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, svc.jobStatus(job))
+}
+
+// handleRetryTranscription queues a failed job, or one held by the quality gate, to be
+// transcribed again. The image must still be on disk, which for async jobs needs
+// server.keepUploads.
+func (svc *Service) handleRetryTranscription(w http.ResponseWriter, r *http.Request) {
+	job, err := svc.Store.GetJob(r.PathValue("id"))
+	if err != nil || job == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	// requeue moves the job to queued and reports false if it left its stage meanwhile.
+	var requeue func() (bool, error)
+	notRetryable := jobs.ErrNotFailed
+	switch {
+	case job.Stage == jobs.StageFailed:
+		if rs, ok := svc.Store.(jobs.RetryStore); ok {
+			requeue = func() (bool, error) {
+				err := rs.ResetForRetry(job.ID)
+				if errors.Is(err, jobs.ErrNotFailed) {
+					return false, nil
+				}
+				return err == nil, err
+			}
+		}
+	case svc.Cfg.QualityGate.Enabled:
+		notRetryable = jobs.ErrNotInReview
+		if rs, ok := svc.Store.(jobs.ReviewStore); ok && job.Stage == jobs.StageNeedsReview {
+			requeue = func() (bool, error) {
+				review, err := rs.TakeReview(job.ID, jobs.StageQueued)
+				return review != nil, err
+			}
+		}
+	}
+	if requeue == nil {
+		http.Error(w, notRetryable.Error(), http.StatusConflict)
+		return
+	}
+	img, err := svc.images().Open(job.ImagePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "image is no longer available", http.StatusGone)
+		return
+	}
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("open image to retry", "job_id", job.ID, "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	_ = img.Close()
+	ok, err := requeue()
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("requeue job", "job_id", job.ID, "stage", job.Stage, "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, notRetryable.Error(), http.StatusConflict)
+		return
+	}
+	stage := job.Stage
+	job.Stage, job.ErrorMessage, job.CompletedAt, job.TargetResults = jobs.StageQueued, nil, nil, nil
+	images, imgPath := svc.images(), job.ImagePath
+	cleanup := func() error {
+		return images.Delete(imgPath)
+	}
+	if err := svc.Queue.Enqueue(jobs.WorkItem{Job: *job, Cleanup: svc.processedCleanup(cleanup), TraceParent: tracing.Traceparent(r.Context())}); err != nil {
+		_ = svc.Store.SaveError(job.ID, "queue full", time.Now().UTC())
+		http.Error(w, "queue full, try later", http.StatusServiceUnavailable)
+		return
+	}
+	if svc.Log != nil {
+		svc.Log.Info("job queued again", "job_id", job.ID, "was", stage)
+	}
+	writeJSON(w, http.StatusAccepted, createResponse{
+		JobID:     job.ID,
+		StatusURL: path.Join(common.PathTranscriptions, job.ID),
+	})
+}
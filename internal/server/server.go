@@ -1,23 +1,34 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"math"
+	"math/rand/v2"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jo-hoe/gostwriter/internal/common"
 	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/ghwebhook"
+	"github.com/jo-hoe/gostwriter/internal/identity"
 	"github.com/jo-hoe/gostwriter/internal/jobs"
 	"github.com/jo-hoe/gostwriter/internal/storage"
 	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
 	"github.com/jo-hoe/gostwriter/internal/util"
 )
 
@@ -26,9 +37,16 @@ type Service struct {
 	Cfg       *config.Config
 	Store     jobs.Store
 	Queue     *jobs.Queue
-	Uploader  *storage.Uploader
+	Uploader  storage.Uploader
+	Images    storage.ImageStore // reads and deletes stored images; nil means local disk
 	Targets   *targets.Registry
 	Processor jobs.Processor
+	Identity  *identity.Extractor // nil when no request identity is configured
+	Tracer    *tracing.Tracer     // nil when tracing is disabled
+	Reviews   Reviewer            // approves and rejects jobs held by the quality gate; nil disables both
+	Events    *jobs.Events        // stage changes for event streams; nil leaves them to polling
+	// GitHubWebhook downloads attachments of webhook deliveries; nil when the webhook is disabled.
+	GitHubWebhook *ghwebhook.Client
 }
 
 // NewHTTPServer builds the http.Server with routes and middleware.
@@ -37,29 +55,79 @@ func NewHTTPServer(svc *Service) *http.Server {
 	mux.HandleFunc(http.MethodGet+" "+common.PathHealthz, func(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
+	mux.HandleFunc(http.MethodGet+" "+common.PathReadyz, svc.handleReadyz)
 
 	mux.HandleFunc(http.MethodPost+" "+common.PathTranscriptions, svc.withCommon(svc.handleCreateTranscription))
+	mux.HandleFunc(http.MethodGet+" "+common.PathTranscriptions, svc.withCommon(svc.handleListTranscriptions))
 	// Pattern match /v1/transcriptions/{id}
 	mux.HandleFunc(http.MethodGet+" "+common.PathTranscriptions+"/", svc.withCommon(svc.handleGetTranscriptionByPrefix))
+	mux.HandleFunc(http.MethodGet+" "+common.PathTranscriptions+"/{id}/events", svc.withCommon(svc.handleTranscriptionEvents))
+	if svc.Cfg.Server.KeepUploads {
+		mux.HandleFunc(http.MethodPost+" "+common.PathTranscriptions+"/{id}/rerun", svc.withCommon(svc.handleRerunTranscription))
+	}
+	mux.HandleFunc(http.MethodPost+" "+common.PathTranscriptions+"/{id}/retry", svc.withCommon(svc.handleRetryTranscription))
+	if svc.Cfg.QualityGate.Enabled {
+		if svc.Reviews != nil {
+			mux.HandleFunc(http.MethodPost+" "+common.PathTranscriptions+"/{id}/approve", svc.withCommon(svc.handleApproveTranscription))
+			mux.HandleFunc(http.MethodPost+" "+common.PathTranscriptions+"/{id}/reject", svc.withCommon(svc.handleRejectTranscription))
+		}
+	}
+	if svc.Cfg.Server.ResumableUploads {
+		mux.HandleFunc(http.MethodOptions+" "+common.PathUploads, svc.withCommon(svc.handleUploadOptions))
+		mux.HandleFunc(http.MethodPost+" "+common.PathUploads, svc.withCommon(svc.handleCreateUpload))
+		mux.HandleFunc(http.MethodHead+" "+common.PathUploads+"/{id}", svc.withCommon(svc.handleUploadHead))
+		mux.HandleFunc(http.MethodPatch+" "+common.PathUploads+"/{id}", svc.withCommon(svc.handleUploadPatch))
+	}
+	mux.HandleFunc(http.MethodPost+" "+common.PathAdminPurge, svc.withCommon(svc.handleAdminPurge))
+	mux.HandleFunc(http.MethodPost+" "+common.PathAdminVacuum, svc.withCommon(svc.handleAdminVacuum))
+	if svc.Cfg.Server.ShareSecret != "" {
+		mux.HandleFunc(http.MethodPost+" "+common.PathTranscriptions+"/{id}/share", svc.withCommon(svc.handleCreateShare))
+		// Not behind withCommon: the signed token stands in for the API key.
+		mux.HandleFunc(http.MethodGet+" "+common.PathShared+"/{token}", svc.handleGetShared)
+	}
+	if svc.Cfg.Server.GitHubWebhook.Secret != "" {
+		// Not behind withCommon: GitHub cannot send the API key, deliveries are signed instead.
+		mux.HandleFunc(http.MethodPost+" "+common.PathGitHubWebhook, svc.handleGitHubWebhook)
+	}
 
 	s := &http.Server{
 		Addr:         svc.Cfg.Server.Addr,
-		Handler:      loggingMiddleware(recoveryMiddleware(mux), svc.Log),
+		Handler:      tracingMiddleware(loggingMiddleware(recoveryMiddleware(mux), svc.Log), svc.Tracer),
 		ReadTimeout:  svc.Cfg.Server.ReadTimeout,
 		WriteTimeout: svc.Cfg.Server.WriteTimeout,
 		IdleTimeout:  svc.Cfg.Server.IdleTimeout,
 	}
+	// Shutdown does not cancel requests; long-lived ones like event streams watch this
+	// channel so they do not hold up the shutdown until the grace period runs out.
+	stopping := make(chan struct{})
+	s.RegisterOnShutdown(sync.OnceFunc(func() { close(stopping) }))
+	s.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), stoppingKey{}, (<-chan struct{})(stopping))
+	}
 	return s
 }
 
+type stoppingKey struct{}
+
+// serverStopping returns a channel closed when the server serving ctx shuts down, or nil
+// (never ready) outside an http.Server from NewHTTPServer.
+func serverStopping(ctx context.Context) <-chan struct{} {
+	ch, _ := ctx.Value(stoppingKey{}).(<-chan struct{})
+	return ch
+}
+
 func (svc *Service) withCommon(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Enforce API key if configured
-		if key := strings.TrimSpace(svc.Cfg.Server.APIKey); key != "" {
-			if r.Header.Get(common.HeaderAPIKey) != key {
+		if svc.apiKeyRequired() {
+			actor, ok := svc.matchAPIKey(r.Header.Get(common.HeaderAPIKey))
+			if !ok {
 				http.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
+			if actor != "" {
+				r = r.WithContext(context.WithValue(r.Context(), actorKey{}, actor))
+			}
 		}
 		// Enforce max body size
 		max := safeInt64(svc.Cfg.Server.MaxUploadSize)
@@ -70,6 +138,35 @@ func (svc *Service) withCommon(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// actorKey is the request context key holding the name of the matched API key.
+type actorKey struct{}
+
+func (svc *Service) apiKeyRequired() bool {
+	return strings.TrimSpace(svc.Cfg.Server.APIKey) != "" || len(svc.Cfg.Server.APIKeys) > 0
+}
+
+// matchAPIKey checks got against the static and named API keys. It returns the key's
+// name (empty for the unnamed static key) and whether any key matched.
+func (svc *Service) matchAPIKey(got string) (string, bool) {
+	if key := strings.TrimSpace(svc.Cfg.Server.APIKey); key != "" && subtle.ConstantTimeCompare([]byte(got), []byte(key)) == 1 {
+		return "", true
+	}
+	for _, k := range svc.Cfg.Server.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(got), []byte(k.Key)) == 1 {
+			return k.Name, true
+		}
+	}
+	return "", false
+}
+
+// actorFromContext returns the API key name stored by withCommon, or nil.
+func actorFromContext(ctx context.Context) *string {
+	if v, ok := ctx.Value(actorKey{}).(string); ok && v != "" {
+		return &v
+	}
+	return nil
+}
+
 type createResponse struct {
 	JobID     string `json:"job_id"`
 	StatusURL string `json:"status_url"`
@@ -80,92 +177,172 @@ func (svc *Service) handleCreateTranscription(w http.ResponseWriter, r *http.Req
 		http.Error(w, "method", http.StatusMethodNotAllowed)
 		return
 	}
-	// Parse multipart
-	if err := r.ParseMultipartForm(safeInt64(svc.Cfg.Server.MaxUploadSize)); err != nil {
-		http.Error(w, "invalid form: "+err.Error(), http.StatusBadRequest)
+	// Target is fixed by configuration; request cannot override
+	targetName := svc.defaultTargetName()
+	if targetName == "" {
+		http.Error(w, "no target configured", http.StatusServiceUnavailable)
 		return
 	}
 
-	// File
-	fileHeader := r.MultipartForm.File["file"]
-	if len(fileHeader) == 0 {
-		http.Error(w, "file is required", http.StatusBadRequest)
+	// Determine sync vs async from the Prefer header or, for clients that cannot set it, an
+	// async query field; the form field is checked once the body is read.
+	async, err := asyncRequested(r.Header.Get(common.HeaderPrefer), r.URL.Query().Get(asyncField))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	uploaded := fileHeader[0]
 
-	// Target is fixed by configuration; request cannot override
-	// Derive target by enabled backend. Currently supports only GitHub.
-	targetName := ""
-	if svc.Cfg.Target.GitHub.Enabled {
-		targetName = "github"
-	}
-	if targetName == "" {
-		http.Error(w, "no target configured", http.StatusServiceUnavailable)
+	// Ask clients to slow down before the queue is full, and before storing the upload.
+	if async && svc.queueSaturated() {
+		w.Header().Set(common.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(svc.Cfg.Server.QueueRetryAfter)))
+		http.Error(w, "too many queued jobs, retry later", http.StatusTooManyRequests)
 		return
 	}
 
-	// Optional fields
-	callbackURLPtr, err := parseOptionalURL(r.FormValue("callback_url"))
+	syncTimeout, err := svc.syncTimeout(r)
 	if err != nil {
-		http.Error(w, "invalid callback_url", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	titlePtr := parseOptionalString(r.FormValue("title"))
-	metadata, err := parseOptionalJSONMap(r.FormValue("metadata"))
+	idemKey, idemStore, status, err := svc.idempotencyKey(r)
 	if err != nil {
-		http.Error(w, "invalid metadata json", http.StatusBadRequest)
+		http.Error(w, err.Error(), status)
 		return
 	}
 
-	// Store upload
-	imgPath, cleanup, mimeType, err := svc.Uploader.SaveMultipartImage(uploaded, safeInt64(svc.Cfg.Server.MaxUploadSize))
+	// Requesting user, if an identity proxy header or JWT is configured. A present but
+	// invalid token is rejected before the upload is stored.
+	ident, err := svc.Identity.FromRequest(r)
 	if err != nil {
-		http.Error(w, "upload failed: "+err.Error(), http.StatusBadRequest)
+		if svc.Log != nil {
+			svc.Log.Warn("rejected identity token", "err", err)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+
+	// Stream the multipart body: the file goes straight to disk, other parts are read as form fields.
+	form, err := svc.readImageSource(r)
 	// Ensure we cleanup temp file if we fail later in this handler
+	cleanup := form.cleanup
 	defer func() {
 		// The worker will also call cleanup after processing, but if we failed before enqueue, cleanup here
 		if cleanup != nil {
 			_ = cleanup()
 		}
 	}()
+	if err != nil {
+		if clientGone(r, err) {
+			// Nobody is left to answer; a partially stored file is removed by the deferred cleanup.
+			if svc.Log != nil {
+				svc.Log.Debug("upload aborted by client", "err", err)
+			}
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if form.imagePath == "" {
+		http.Error(w, "file or image_url is required", http.StatusBadRequest)
+		return
+	}
+	imgPath, mimeType := form.imagePath, form.mimeType
+	if !async && r.URL.Query().Get(asyncField) == "" && form.values.Get(asyncField) != "" {
+		if async, err = asyncRequested(r.Header.Get(common.HeaderPrefer), form.values.Get(asyncField)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if async && svc.queueSaturated() {
+			w.Header().Set(common.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(svc.Cfg.Server.QueueRetryAfter)))
+			http.Error(w, "too many queued jobs, retry later", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// Optional fields
+	callbackURLPtr, err := svc.parseCallbackURL(form.values.Get("callback_url"))
+	if err != nil {
+		http.Error(w, "invalid callback_url: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	callbackEvents, err := parseCallbackEvents(form.values.Get("callback_events"))
+	if err != nil {
+		http.Error(w, "invalid callback_events: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	titlePtr := parseOptionalString(form.values.Get("title"))
+	metadata, err := parseOptionalJSONMap(form.values.Get("metadata"))
+	if err != nil {
+		http.Error(w, "invalid metadata json", http.StatusBadRequest)
+		return
+	}
+
+	branchPtr, basePathPtr, err := svc.parseTargetOverrides(form.values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Build job
 	jobID := util.NewID()
 	job := jobs.Job{
-		ID:          jobID,
-		ImagePath:   imgPath,
-		MimeType:    mimeType,
-		TargetName:  targetName,
-		CallbackURL: callbackURLPtr,
-		Title:       titlePtr,
-		Metadata:    metadata,
-		Stage:       jobs.StageQueued,
-		CreatedAt:   time.Now().UTC(),
-	}
-
-	if err := svc.Store.CreateJob(&job); err != nil {
+		ID:             jobID,
+		ImagePath:      imgPath,
+		MimeType:       mimeType,
+		TargetName:     targetName,
+		Targets:        svc.jobTargets(),
+		CallbackURL:    callbackURLPtr,
+		Title:          titlePtr,
+		CallbackEvents: callbackEvents,
+		Metadata:       metadata,
+		Actor:          actorFromContext(r.Context()),
+		Debug:          svc.sampleDebug(),
+		Stage:          jobs.StageQueued,
+		CreatedAt:      time.Now().UTC(),
+
+		TargetBranch:   branchPtr,
+		TargetBasePath: basePathPtr,
+	}
+	if ident != nil {
+		job.AuthorName = parseOptionalString(ident.Name)
+		job.AuthorEmail = parseOptionalString(ident.Email)
+	}
+
+	var existing *jobs.Job
+	if idemKey != "" {
+		existing, err = idemStore.CreateJobIdempotent(&job, idemKey, job.CreatedAt.Add(svc.Cfg.Server.IdempotencyKeyTTL))
+	} else {
+		err = svc.Store.CreateJob(&job)
+	}
+	if err != nil {
 		if svc.Log != nil {
 			svc.Log.Error("persist job", "error", err)
 		}
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if existing != nil {
+		// A retry of a request that already created a job; the new upload is dropped by the deferred cleanup.
+		if svc.Log != nil {
+			svc.Log.Info("idempotent request replayed", "job_id", existing.ID)
+		}
+		w.Header().Set(common.HeaderIdempotentReplay, "true")
+		writeJSON(w, http.StatusAccepted, createResponse{
+			JobID:     existing.ID,
+			StatusURL: path.Join(common.PathTranscriptions, existing.ID),
+		})
+		return
+	}
 	if svc.Log != nil {
 		svc.Log.Info("job created", "job_id", jobID, "target", targetName)
 	}
 
-	// Determine sync vs async based on Prefer header
-	prefer := strings.ToLower(strings.TrimSpace(r.Header.Get(common.HeaderPrefer)))
-	async := strings.Contains(prefer, common.PreferRespondAsync)
-
 	if async {
 		// Enqueue for async processing; transfer cleanup responsibility to worker on success
 		err = svc.Queue.Enqueue(jobs.WorkItem{
-			Job:     job,
-			Cleanup: cleanup,
+			Job:         job,
+			Cleanup:     svc.processedCleanup(cleanup),
+			TraceParent: tracing.Traceparent(r.Context()),
 		})
 		if err != nil {
 			// Failed to enqueue; cleanup will run due to defer
@@ -186,12 +363,47 @@ func (svc *Service) handleCreateTranscription(w http.ResponseWriter, r *http.Req
 	}
 
 	// Synchronous processing path: process the job inline and return result.
-	if err := svc.Processor.Process(r.Context(), jobs.WorkItem{Job: job}); err != nil {
-		if svc.Log != nil {
-			svc.Log.Error("processing failed", "error", err)
+	if syncTimeout > 0 {
+		// The job continues in the background past the deadline and owns the upload from here.
+		finished, err := svc.processWithDeadline(r.Context(), jobs.WorkItem{Job: job, Cleanup: svc.processedCleanup(cleanup)}, syncTimeout)
+		cleanup = nil
+		if !finished {
+			if svc.Log != nil {
+				svc.Log.Info("sync deadline exceeded, job continues", "job_id", jobID, "timeout", syncTimeout)
+			}
+			writeJSON(w, http.StatusGatewayTimeout, createResponse{
+				JobID:     jobID,
+				StatusURL: path.Join(common.PathTranscriptions, jobID),
+			})
+			return
+		}
+		if err != nil {
+			if svc.Log != nil {
+				svc.Log.Error("processing failed", "error", err)
+			}
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		cleanup = svc.processedCleanup(cleanup)
+		if err := svc.Processor.Process(r.Context(), jobs.WorkItem{Job: job}); err != nil {
+			if svc.Log != nil {
+				svc.Log.Error("processing failed", "error", err)
+			}
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Held by the quality gate: accepted, but nothing was posted.
+	if svc.Cfg.QualityGate.Enabled {
+		if held, err := svc.Store.GetJob(jobID); err == nil && held.Stage == jobs.StageNeedsReview {
+			writeJSON(w, http.StatusAccepted, createResponse{
+				JobID:     jobID,
+				StatusURL: path.Join(common.PathTranscriptions, jobID),
+			})
+			return
 		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
 	}
 
 	// Synchronous success: return 200 with no details
@@ -201,6 +413,327 @@ func (svc *Service) handleCreateTranscription(w http.ResponseWriter, r *http.Req
 	w.WriteHeader(http.StatusOK)
 }
 
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKey returns the Idempotency-Key of r scoped to the requesting API key, so
+// clients cannot collide with each other's keys, together with the store to create the
+// job with. The key is empty without the header. On error, status is the HTTP status to
+// answer with.
+func (svc *Service) idempotencyKey(r *http.Request) (string, jobs.IdempotencyStore, int, error) {
+	key := strings.TrimSpace(r.Header.Get(common.HeaderIdempotencyKey))
+	if key == "" {
+		return "", nil, 0, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return "", nil, http.StatusBadRequest, fmt.Errorf("%s longer than %d characters", common.HeaderIdempotencyKey, maxIdempotencyKeyLength)
+	}
+	store, ok := svc.Store.(jobs.IdempotencyStore)
+	if !ok {
+		return "", nil, http.StatusNotImplemented, fmt.Errorf("%s not supported by the job store", common.HeaderIdempotencyKey)
+	}
+	actor := deref(actorFromContext(r.Context()))
+	return fmt.Sprintf("%d:%s:%s", len(actor), actor, key), store, 0, nil
+}
+
+// asyncField is the query or form field requesting async processing without a Prefer header.
+const asyncField = "async"
+
+// asyncRequested decides between sync and async processing. "Prefer: respond-async" takes
+// precedence: it makes the request async even when the async field says false. Otherwise
+// the async field (a boolean; empty means false) decides. An invalid field value is an
+// error even when the header decides, so typos do not go unnoticed.
+func asyncRequested(prefer, field string) (bool, error) {
+	var fieldAsync bool
+	if v := strings.TrimSpace(field); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s field", asyncField)
+		}
+		fieldAsync = b
+	}
+	if strings.Contains(strings.ToLower(prefer), common.PreferRespondAsync) {
+		return true, nil
+	}
+	return fieldAsync, nil
+}
+
+// syncTimeout returns the deadline for a sync request: the Request-Timeout header (a Go
+// duration like "30s" or a number of seconds) or the configured default; 0 means none.
+func (svc *Service) syncTimeout(r *http.Request) (time.Duration, error) {
+	v := strings.TrimSpace(r.Header.Get(common.HeaderRequestTimeout))
+	if v == "" {
+		return svc.Cfg.Server.SyncTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, perr := strconv.ParseFloat(v, 64)
+		if perr != nil {
+			return 0, fmt.Errorf("invalid %s header", common.HeaderRequestTimeout)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s header", common.HeaderRequestTimeout)
+	}
+	return d, nil
+}
+
+// processWithDeadline runs the job detached from the request so it is not aborted when
+// the deadline passes or the client goes away, and waits up to timeout for it. It reports
+// whether the job finished in time and, if so, its error. The item's cleanup runs when
+// processing ends.
+func (svc *Service) processWithDeadline(ctx context.Context, item jobs.WorkItem, timeout time.Duration) (bool, error) {
+	done := make(chan error, 1)
+	go func() {
+		err := svc.Processor.Process(context.WithoutCancel(ctx), item)
+		if item.Cleanup != nil {
+			if cerr := item.Cleanup(); cerr != nil && svc.Log != nil {
+				svc.Log.Warn("cleanup failed", "job_id", item.Job.ID, "err", cerr)
+			}
+		}
+		done <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return true, err
+	case <-timer.C:
+		return false, nil
+	}
+}
+
+// sampleDebug decides at job creation whether the job's LLM calls are logged in detail.
+func (svc *Service) sampleDebug() bool {
+	return sampled(svc.Cfg.LLM.DebugSampleRate, rand.Float64)
+}
+
+// sampled reports true with probability rate, drawing uniform values in [0, 1) from r.
+func sampled(rate float64, r func() float64) bool {
+	return rate > 0 && r() < rate
+}
+
+// queueSaturated reports whether the queue has reached the configured high watermark.
+func (svc *Service) queueSaturated() bool {
+	wm := svc.Cfg.Server.QueueHighWatermark
+	if wm <= 0 || svc.Queue == nil {
+		return false
+	}
+	return float64(svc.Queue.Depth()) >= wm*float64(svc.Queue.Capacity())
+}
+
+// processedCleanup returns the cleanup to run once the job of an upload is processed:
+// none when server.keepUploads keeps the image for reruns. Retention then deletes it
+// together with the job.
+func (svc *Service) processedCleanup(cleanup func() error) func() error {
+	if svc.Cfg.Server.KeepUploads {
+		return nil
+	}
+	return cleanup
+}
+
+// images returns the store job images are read from and deleted in.
+func (svc *Service) images() storage.ImageStore {
+	if svc.Images == nil {
+		return storage.LocalImages{}
+	}
+	return svc.Images
+}
+
+// retryAfterSeconds converts d to whole seconds for Retry-After, rounding up to at least 1.
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// defaultTargetName returns the first configured target, the one jobs report as theirs.
+func (svc *Service) defaultTargetName() string {
+	if entries := svc.Cfg.TargetEntries(); len(entries) > 0 {
+		return entries[0].Name
+	}
+	return ""
+}
+
+// jobTargets returns the names of all configured targets, which new jobs post to, or
+// nil if there is only one.
+func (svc *Service) jobTargets() []string {
+	entries := svc.Cfg.TargetEntries()
+	if len(entries) < 2 {
+		return nil
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	return names
+}
+
+// parseTargetOverrides reads the optional "branch" and "base_path" fields. They are
+// rejected unless overrides are enabled and all targets support them (github only).
+func (svc *Service) parseTargetOverrides(values url.Values) (*string, *string, error) {
+	branchPtr := parseOptionalString(values.Get("branch"))
+	basePathPtr := parseOptionalString(values.Get("base_path"))
+	if branchPtr == nil && basePathPtr == nil {
+		return nil, nil, nil
+	}
+	if !svc.Cfg.Server.AllowTargetOverrides {
+		return nil, nil, fmt.Errorf("target overrides are not allowed")
+	}
+	for _, e := range svc.Cfg.TargetEntries() {
+		if e.Type != config.TargetTypeGitHub {
+			return nil, nil, fmt.Errorf("target %s does not support branch or base_path overrides", e.Name)
+		}
+	}
+	if branchPtr != nil {
+		if err := util.ValidateBranchName(*branchPtr); err != nil {
+			return nil, nil, fmt.Errorf("invalid branch: %w", err)
+		}
+	}
+	if basePathPtr != nil {
+		p, err := util.CleanRelativePath(*basePathPtr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid base_path: %w", err)
+		}
+		basePathPtr = parseOptionalString(p)
+	}
+	return branchPtr, basePathPtr, nil
+}
+
+// maxFormFieldBytes bounds the size of a single non-file form field.
+const maxFormFieldBytes = 1 << 20
+
+// uploadForm is the result of streaming a multipart upload request.
+type uploadForm struct {
+	imagePath string
+	mimeType  string
+	cleanup   func() error
+	values    url.Values
+}
+
+// readUploadForm reads the multipart body part by part. The first "file" part is streamed
+// directly to disk through the uploader so the image is never buffered in memory; all other
+// parts are collected as form values. Parts may appear in any order.
+// On error, the returned form still carries the cleanup func for an already stored file.
+func (svc *Service) readUploadForm(r *http.Request) (uploadForm, error) {
+	form := uploadForm{values: url.Values{}}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return form, fmt.Errorf("invalid form: %w", err)
+	}
+	maxBytes := safeInt64(svc.Cfg.Server.MaxUploadSize)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return form, fmt.Errorf("invalid form: %w", err)
+		}
+		name := part.FormName()
+		switch {
+		case name == "":
+			// Not a form-data part; skip.
+		case name == "file" && part.FileName() != "":
+			if form.imagePath != "" {
+				// Only a single file is supported; ignore additional ones.
+				break
+			}
+			p, cleanup, mimeType, err := svc.Uploader.SaveImageStream(part, part.FileName(), part.Header.Get("Content-Type"), maxBytes)
+			if err != nil {
+				_ = part.Close()
+				return form, fmt.Errorf("upload failed: %w", err)
+			}
+			form.imagePath, form.mimeType, form.cleanup = p, mimeType, cleanup
+		default:
+			b, err := io.ReadAll(io.LimitReader(part, maxFormFieldBytes+1))
+			if err != nil {
+				_ = part.Close()
+				return form, fmt.Errorf("invalid form: %w", err)
+			}
+			if len(b) > maxFormFieldBytes {
+				_ = part.Close()
+				return form, fmt.Errorf("invalid form: field %q too large", name)
+			}
+			form.values.Add(name, string(b))
+		}
+		_ = part.Close()
+	}
+}
+
+// readImageSource reads the upload form, or a JSON body with a base64 encoded image, and,
+// when the form carries no file but an image_url field, downloads that image through the
+// uploader instead.
+func (svc *Service) readImageSource(r *http.Request) (uploadForm, error) {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == common.ContentTypeJSON {
+		return svc.readJSONUpload(r)
+	}
+	form, err := svc.readUploadForm(r)
+	if err != nil || form.imagePath != "" {
+		return form, err
+	}
+	if raw := strings.TrimSpace(form.values.Get(imageURLField)); raw != "" {
+		form.imagePath, form.cleanup, form.mimeType, err = svc.fetchImageURL(r.Context(), raw)
+		if err != nil {
+			return form, fmt.Errorf("invalid image_url: %w", err)
+		}
+	}
+	return form, nil
+}
+
+// jsonUpload is the JSON alternative to the multipart upload form.
+type jsonUpload struct {
+	ImageBase64    string         `json:"image_base64"`
+	MimeType       string         `json:"mime_type"`
+	Title          string         `json:"title"`
+	CallbackURL    string         `json:"callback_url"`
+	CallbackEvents string         `json:"callback_events"`
+	Metadata       map[string]any `json:"metadata"`
+	Branch         string         `json:"branch"`
+	BasePath       string         `json:"base_path"`
+}
+
+// readJSONUpload reads a JSON body, stores its base64 encoded image through the uploader
+// and returns the other fields as form values, so the request continues like an upload.
+func (svc *Service) readJSONUpload(r *http.Request) (uploadForm, error) {
+	form := uploadForm{values: url.Values{}}
+	var body jsonUpload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		// Not wrapped: a truncated document ends in io.ErrUnexpectedEOF, which is not a
+		// client hanging up here.
+		return form, fmt.Errorf("invalid json body: %v", err)
+	}
+	if body.ImageBase64 == "" {
+		return form, errors.New("image_base64 is required")
+	}
+	for name, v := range map[string]string{
+		"title": body.Title, "callback_url": body.CallbackURL, "callback_events": body.CallbackEvents,
+		"branch": body.Branch, "base_path": body.BasePath,
+	} {
+		if v != "" {
+			form.values.Set(name, v)
+		}
+	}
+	if body.Metadata != nil {
+		b, err := json.Marshal(body.Metadata)
+		if err != nil {
+			return form, fmt.Errorf("invalid metadata: %w", err)
+		}
+		form.values.Set("metadata", string(b))
+	}
+	p, cleanup, mimeType, err := storage.SaveBase64Image(svc.Uploader, body.ImageBase64, body.MimeType, safeInt64(svc.Cfg.Server.MaxUploadSize))
+	if err != nil {
+		return form, fmt.Errorf("upload failed: %w", err)
+	}
+	form.imagePath, form.mimeType, form.cleanup = p, mimeType, cleanup
+	return form, nil
+}
+
+// clientGone reports whether err from reading the request body means the client went
+// away mid-upload (disconnect or canceled request) rather than sent a malformed body.
+func clientGone(r *http.Request, err error) bool {
+	return r.Context().Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 var idPattern = regexp.MustCompile(fmt.Sprintf("^%s/([a-f0-9-]+)$", common.PathTranscriptions))
 
 func (svc *Service) handleGetTranscriptionByPrefix(w http.ResponseWriter, r *http.Request) {
@@ -219,8 +752,19 @@ func (svc *Service) handleGetTranscriptionByPrefix(w http.ResponseWriter, r *htt
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	writeJSON(w, http.StatusOK, svc.jobStatus(job))
+}
 
-	writeJSON(w, http.StatusOK, jobToOut(job))
+// jobStatus returns the status response of job, with the view URL of its result if the
+// target has one.
+func (svc *Service) jobStatus(job *jobs.Job) map[string]any {
+	out := jobToOut(job)
+	if job.TargetLocation != nil && svc.Targets != nil {
+		if u := svc.Targets.ViewURL(resultTarget(job), *job.TargetLocation); u != "" {
+			out["view_url"] = u
+		}
+	}
+	return out
 }
 
 func deref(p *string) string {
@@ -230,6 +774,17 @@ func deref(p *string) string {
 	return *p
 }
 
+// resultTarget returns the target whose result is stored as the job's location and
+// commit: the first that succeeded of a job with several targets.
+func resultTarget(job *jobs.Job) string {
+	for _, r := range job.TargetResults {
+		if r.Error == "" {
+			return r.TargetName
+		}
+	}
+	return job.TargetName
+}
+
 func jobToOut(job *jobs.Job) map[string]any {
 	type result struct {
 		Target   string `json:"target"`
@@ -238,7 +793,7 @@ func jobToOut(job *jobs.Job) map[string]any {
 	}
 	var errVal any = nil
 	if job.ErrorMessage != nil && *job.ErrorMessage != "" {
-		errVal = "internal error"
+		errVal = jobs.PublicError(*job.ErrorMessage)
 	}
 	out := map[string]any{
 		"job_id":       job.ID,
@@ -248,13 +803,56 @@ func jobToOut(job *jobs.Job) map[string]any {
 		"completed_at": job.CompletedAt,
 		"error":        errVal,
 	}
+	if job.FinishReason != nil {
+		out["finish_reason"] = *job.FinishReason
+	}
+	if len(job.Warnings) > 0 {
+		out["warnings"] = job.Warnings
+	}
+	if job.ConsensusRuns > 0 {
+		out["consensus"] = map[string]any{"runs": job.ConsensusRuns, "agreement": job.Agreement}
+	}
+	if job.Language != nil {
+		out["language"] = *job.Language
+	}
+	if job.MarkdownFlavor != nil {
+		out["markdown_flavor"] = *job.MarkdownFlavor
+	}
+	if job.EstimatedCost != nil {
+		out["estimated_cost"] = *job.EstimatedCost
+	}
+	if job.Debug {
+		out["debug"] = true
+	}
+	if job.ParentJobID != nil {
+		out["parent_job_id"] = *job.ParentJobID
+	}
+	if len(job.ProviderMeta) > 0 {
+		out["provider_meta"] = job.ProviderMeta
+	}
 	if job.TargetLocation != nil || job.TargetCommit != nil {
 		out["target_result"] = result{
-			Target:   job.TargetName,
+			Target:   resultTarget(job),
 			Location: deref(job.TargetLocation),
 			Commit:   deref(job.TargetCommit),
 		}
 	}
+	if len(job.TargetResults) > 0 {
+		type targetResult struct {
+			Target   string `json:"target"`
+			Status   string `json:"status"` // completed or failed
+			Location string `json:"location,omitempty"`
+			Commit   string `json:"commit,omitempty"`
+		}
+		results := make([]targetResult, len(job.TargetResults))
+		for i, r := range job.TargetResults {
+			results[i] = targetResult{Target: r.TargetName, Status: common.StatusCompleted, Location: r.Location, Commit: r.Commit}
+			if r.Error != "" {
+				results[i].Status = common.StatusFailed
+			}
+		}
+		out["target_results"] = results
+	}
 	return out
 }
 
@@ -273,17 +871,42 @@ func safeInt64(u config.ByteSize) int64 {
 	return int64(u) // #nosec G115 - safe cast after explicit upper-bound check
 }
 
-func parseOptionalURL(s string) (*string, error) {
+// parseCallbackURL validates the optional callback_url field: an absolute http or https
+// URL, and https only when server.callbackRequireHttps is set.
+func (svc *Service) parseCallbackURL(s string) (*string, error) {
 	v := strings.TrimSpace(s)
 	if v == "" {
 		return nil, nil
 	}
-	if _, err := url.ParseRequestURI(v); err != nil {
+	u, err := url.ParseRequestURI(v)
+	if err != nil {
 		return nil, err
 	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if svc.Cfg.Server.CallbackRequireHTTPS {
+			return nil, errors.New("https is required")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("missing host")
+	}
 	return &v, nil
 }
 
+// parseCallbackEvents parses the optional callback_events field, e.g. "completed,failed".
+// It returns nil when the field is empty, leaving the events to server.callbackEvents.
+func parseCallbackEvents(s string) ([]string, error) {
+	events, err := config.ParseCallbackEvents(s)
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return events, nil
+}
+
 func parseOptionalString(s string) *string {
 	v := strings.TrimSpace(s)
 	if v == "" {
@@ -313,7 +936,7 @@ func loggingMiddleware(next http.Handler, log *slog.Logger) http.Handler {
 		start := time.Now()
 		ww := &writeWrap{ResponseWriter: w, code: http.StatusOK}
 		next.ServeHTTP(ww, r)
-		log.Info("http",
+		log.InfoContext(r.Context(), "http",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", ww.code,
@@ -322,6 +945,29 @@ func loggingMiddleware(next http.Handler, log *slog.Logger) http.Handler {
 	})
 }
 
+// tracingMiddleware records a server span per request, continuing the trace of an
+// incoming traceparent header. Handlers and the logging middleware see the span in the
+// request context.
+func tracingMiddleware(next http.Handler, tracer *tracing.Tracer) http.Handler {
+	if tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.WithTraceparent(r.Context(), r.Header.Get(tracing.HeaderTraceparent))
+		ctx, span := tracer.Start(ctx, "HTTP "+r.Method, tracing.KindServer)
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		ww := &writeWrap{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(ww, r.WithContext(ctx))
+		span.SetAttr("http.status_code", ww.code)
+		var err error
+		if ww.code >= http.StatusInternalServerError {
+			err = errors.New(http.StatusText(ww.code))
+		}
+		span.End(err)
+	})
+}
+
 type writeWrap struct {
 	http.ResponseWriter
 	code int
@@ -332,6 +978,18 @@ func (w *writeWrap) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Flush passes flushes of streaming responses on to the wrapped writer.
+func (w *writeWrap) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer.
+func (w *writeWrap) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
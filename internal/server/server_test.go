@@ -1,14 +1,28 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"math/rand/v2"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -16,9 +30,12 @@ import (
 
 	"github.com/jo-hoe/gostwriter/internal/common"
 	"github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/ghwebhook"
+	"github.com/jo-hoe/gostwriter/internal/identity"
 	"github.com/jo-hoe/gostwriter/internal/jobs"
 	"github.com/jo-hoe/gostwriter/internal/storage"
 	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
 )
 
 type memStore struct {
@@ -52,6 +69,26 @@ func (s *memStore) UpdateStage(id string, stage jobs.Stage, startedAt *time.Time
 	return nil
 }
 
+func (s *memStore) SaveTranscriptionInfo(id string, info jobs.TranscriptionInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.data[id]; ok {
+		if info.FinishReason != "" {
+			fr := info.FinishReason
+			j.FinishReason = &fr
+		}
+		j.Warnings = info.Warnings
+		j.ConsensusRuns = info.ConsensusRuns
+		j.Agreement = info.Agreement
+		if info.Language != "" {
+			lang := info.Language
+			j.Language = &lang
+		}
+		j.ProviderMeta = info.ProviderMeta
+	}
+	return nil
+}
+
 func (s *memStore) SaveResult(id string, location, commit string, completedAt time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -94,6 +131,14 @@ func (s *memStore) GetJob(id string) (*jobs.Job, error) {
 
 func (s *memStore) Close() error { return nil }
 
+func (s *memStore) PurgeAll() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.data)
+	clear(s.data)
+	return n, nil
+}
+
 type fakeProcessor struct {
 	store *memStore
 }
@@ -129,6 +174,55 @@ func TestHealthz(t *testing.T) {
 	}
 }
 
+// pingStore is a memStore whose database check fails with err.
+type pingStore struct {
+	*memStore
+	err error
+}
+
+func (s *pingStore) Ping(ctx context.Context) error { return s.err }
+
+func TestReadyz(t *testing.T) {
+	store := &pingStore{memStore: newMemStore(), err: errors.New("disk gone")}
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 2, 1)
+	svc := &Service{
+		Cfg:     &config.Config{Server: config.ServerConfig{Addr: ":0"}},
+		Store:   store,
+		Queue:   queue,
+		Targets: targets.NewRegistry(),
+	}
+	srv := NewHTTPServer(svc)
+	probe := func() (int, string) {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, common.PathReadyz, nil))
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	if code, body := probe(); code != http.StatusServiceUnavailable || body != `{"failing":["database","queue","targets"],"status":"unavailable"}` {
+		t.Fatalf("not ready: got %d %s", code, body)
+	}
+	store.err = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := queue.Start(ctx, &fakeProcessor{store: store.memStore}); err != nil {
+		t.Fatalf("start queue: %v", err)
+	}
+	svc.Targets.Add(viewerTarget{})
+	if code, body := probe(); code != http.StatusOK || body != `{"status":"ok"}` {
+		t.Fatalf("ready: got %d %s", code, body)
+	}
+	queue.Shutdown(time.Second)
+	if code, body := probe(); code != http.StatusServiceUnavailable || !strings.Contains(body, `["queue"]`) {
+		t.Fatalf("after shutdown: got %d %s", code, body)
+	}
+	// Liveness does not depend on any of them.
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, common.PathHealthz, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("healthz status %d", rec.Code)
+	}
+}
+
 func makeMultipart(t *testing.T, fieldName, filename, contentType string, content []byte) (string, *bytes.Buffer) {
 	t.Helper()
 	var b bytes.Buffer
@@ -153,7 +247,7 @@ func makeMultipart(t *testing.T, fieldName, filename, contentType string, conten
 func TestCreateTranscription_Synchronous200(t *testing.T) {
 	tmp := t.TempDir()
 	store := newMemStore()
-	uploader := storage.NewUploader(tmp)
+	uploader := storage.NewLocalUploader(tmp)
 	svc := &Service{
 		Log: nil,
 		Cfg: &config.Config{
@@ -197,7 +291,7 @@ func TestCreateTranscription_Synchronous200(t *testing.T) {
 func TestCreateTranscription_Asynchronous202(t *testing.T) {
 	tmp := t.TempDir()
 	store := newMemStore()
-	uploader := storage.NewUploader(tmp)
+	uploader := storage.NewLocalUploader(tmp)
 
 	// Real queue with no-op processor
 	logger := slogDiscard{}
@@ -256,9 +350,1933 @@ func TestCreateTranscription_Asynchronous202(t *testing.T) {
 	}
 }
 
-// slogDiscard wraps a no-op slog handler for tests.
-type slogDiscard struct{}
+func TestCreateTranscription_IdempotencyKeyAcrossRestart(t *testing.T) {
+	tmp := t.TempDir()
+	dbPath := filepath.Join(tmp, "jobs.db")
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 4, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	items := &itemProcessor{items: make(chan jobs.WorkItem, 4)}
+	if err := queue.Start(ctx, items); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
 
-func (s slogDiscard) Logger() *slog.Logger {
-	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	// newServer opens the database like a fresh process would.
+	newServer := func() (*http.Server, *jobs.SQLiteStore) {
+		store, err := jobs.NewSQLiteStore(dbPath)
+		if err != nil {
+			t.Fatalf("NewSQLiteStore: %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close() })
+		cfg := &config.Config{Server: config.ServerConfig{
+			MaxUploadSize:     config.ByteSize(1 << 20),
+			StorageDir:        tmp,
+			IdempotencyKeyTTL: time.Hour,
+		}, Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}}}
+		svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Queue: queue, Uploader: storage.NewLocalUploader(tmp), Targets: targets.NewRegistry()}
+		return NewHTTPServer(svc), store
+	}
+	post := func(server *http.Server, key string) *httptest.ResponseRecorder {
+		ctype, body := makeMultipart(t, "file", "img.png", "image/png", []byte("img"))
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, body)
+		req.Header.Set("Content-Type", ctype)
+		req.Header.Set(common.HeaderPrefer, common.PreferRespondAsync)
+		if key != "" {
+			req.Header.Set(common.HeaderIdempotencyKey, key)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	jobID := func(rec *httptest.ResponseRecorder) string {
+		var resp createResponse
+		if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.JobID == "" {
+			t.Fatalf("expected 202 with job_id, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return resp.JobID
+	}
+
+	server, _ := newServer()
+	rec := post(server, "order-42")
+	first := jobID(rec)
+	if rec.Header().Get(common.HeaderIdempotentReplay) != "" {
+		t.Fatalf("first request marked as replay")
+	}
+	firstImage := filepath.Base((<-items.items).Job.ImagePath)
+
+	server, store := newServer()
+	rec = post(server, "order-42")
+	if got := jobID(rec); got != first || rec.Header().Get(common.HeaderIdempotentReplay) != "true" {
+		t.Fatalf("retry after restart: job %s (replay %q), want %s", got, rec.Header().Get(common.HeaderIdempotentReplay), first)
+	}
+	select {
+	case item := <-items.items:
+		t.Fatalf("replayed request queued job %s", item.Job.ID)
+	default:
+	}
+	// Only the first job's image may be left; the queue removes it once processed.
+	entries, _ := os.ReadDir(filepath.Join(tmp, common.UploadsDirName))
+	for _, e := range entries {
+		if e.Name() != firstImage {
+			t.Fatalf("replayed upload not removed: %s", e.Name())
+		}
+	}
+
+	if got := jobID(post(server, "")); got == first {
+		t.Fatalf("request without key deduplicated")
+	}
+	if j, err := store.GetJob(first); err != nil || j.ID != first {
+		t.Fatalf("original job: %v, %v", j, err)
+	}
+	if rec := post(server, strings.Repeat("k", 256)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("overlong key: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestAsyncRequested(t *testing.T) {
+	cases := []struct {
+		prefer, field string
+		want          bool
+	}{
+		{"", "", false},
+		{"respond-async", "", true},
+		{"", "true", true},
+		{"", "1", true},
+		{"", "false", false},
+		{"respond-async, wait=10", "false", true}, // the header takes precedence
+		{"return=minimal", "true", true},
+	}
+	for _, c := range cases {
+		got, err := asyncRequested(c.prefer, c.field)
+		if err != nil || got != c.want {
+			t.Errorf("asyncRequested(%q, %q) = %v, %v; want %v", c.prefer, c.field, got, err, c.want)
+		}
+	}
+	if _, err := asyncRequested("respond-async", "yes please"); err == nil {
+		t.Errorf("expected an invalid field to be rejected")
+	}
+}
+
+func TestCreateTranscription_AsyncField(t *testing.T) {
+	tmp := t.TempDir()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 4, 1)
+	proc := &itemProcessor{items: make(chan jobs.WorkItem, 4)}
+	if err := queue.Start(context.Background(), proc); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+	store := newMemStore()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:     store,
+		Queue:     queue,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: store},
+	}
+	server := NewHTTPServer(svc)
+
+	post := func(query, formAsync, prefer string) int {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, _ := mw.CreateFormFile("file", "img.png")
+		_, _ = fw.Write([]byte("img"))
+		if formAsync != "" {
+			_ = mw.WriteField("async", formAsync)
+		}
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions+query, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if prefer != "" {
+			req.Header.Set(common.HeaderPrefer, prefer)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, c := range []struct {
+		name, query, form, prefer string
+		want                      int
+	}{
+		{"query field", "?async=true", "", "", http.StatusAccepted},
+		{"form field", "", "true", "", http.StatusAccepted},
+		{"prefer wins over field", "?async=false", "", common.PreferRespondAsync, http.StatusAccepted},
+		{"field false", "", "false", "", http.StatusOK},
+		{"invalid field", "?async=maybe", "", "", http.StatusBadRequest},
+	} {
+		if got := post(c.query, c.form, c.prefer); got != c.want {
+			t.Errorf("%s: status %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRerunTranscription(t *testing.T) {
+	tmp := t.TempDir()
+	store, err := jobs.NewSQLiteStore(filepath.Join(tmp, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 4, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	items := &itemProcessor{items: make(chan jobs.WorkItem, 4)}
+	if err := queue.Start(ctx, items); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+
+	cfg := &config.Config{Server: config.ServerConfig{
+		MaxUploadSize: config.ByteSize(1 << 20),
+		StorageDir:    tmp,
+		KeepUploads:   true,
+	}, Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}}}
+	svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Queue: queue, Uploader: storage.NewLocalUploader(tmp), Targets: targets.NewRegistry()}
+	server := NewHTTPServer(svc)
+
+	ctype, body := makeMultipart(t, "file", "img.png", "image/png", []byte("img"))
+	req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, body)
+	req.Header.Set("Content-Type", ctype)
+	req.Header.Set(common.HeaderPrefer, common.PreferRespondAsync)
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	var created createResponse
+	if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &created) != nil {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body.String())
+	}
+	original := <-items.items
+	if original.Cleanup != nil {
+		t.Fatalf("upload handed to the worker for deletion despite keepUploads")
+	}
+
+	rerun := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions+"/"+id+"/rerun", strings.NewReader(body))
+		req.Header.Set("Content-Type", common.ContentTypeJSON)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = rerun(created.JobID, `{"model":"gpt-5-mini","instructions":"only the headings"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("rerun: %d %s", rec.Code, rec.Body.String())
+	}
+	var out map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if out["parent_job_id"] != created.JobID || out["stage"] != string(jobs.StageQueued) {
+		t.Fatalf("unexpected rerun response %v", out)
+	}
+	item := <-items.items
+	got := item.Job
+	if got.ID == created.JobID || *got.ParentJobID != created.JobID || *got.Model != "gpt-5-mini" || *got.Instructions != "only the headings" {
+		t.Fatalf("unexpected rerun job %+v", got)
+	}
+	if got.ImagePath == original.Job.ImagePath {
+		t.Fatalf("rerun shares the image file of the original")
+	}
+	if b, err := os.ReadFile(got.ImagePath); err != nil || string(b) != "img" {
+		t.Fatalf("rerun image = %q, %v", b, err)
+	}
+
+	// The link is stored and shown in the status of the new job.
+	req = httptest.NewRequest(http.MethodGet, common.PathTranscriptions+"/"+got.ID, nil)
+	rec = httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	out = nil
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if out["parent_job_id"] != created.JobID {
+		t.Fatalf("status without parent_job_id: %s", rec.Body.String())
+	}
+
+	if rec := rerun(created.JobID, `{"target":"confluence"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown target: %d", rec.Code)
+	}
+	if rec := rerun("0000", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown job: %d", rec.Code)
+	}
+	if err := os.Remove(original.Job.ImagePath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if rec := rerun(created.JobID, ""); rec.Code != http.StatusGone {
+		t.Fatalf("rerun without image: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestShareLink(t *testing.T) {
+	secret := strings.Repeat("s", 32)
+	store := newMemStore()
+	loc := "notes/a.md"
+	_ = store.CreateJob(&jobs.Job{ID: "abc-1", Stage: jobs.StageCompleted, TargetName: "github", TargetLocation: &loc})
+	cfg := &config.Config{Server: config.ServerConfig{APIKey: "k", ShareSecret: secret, ShareExpiry: time.Hour}}
+	svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Targets: targets.NewRegistry()}
+	server := NewHTTPServer(svc)
+	do := func(method, target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			req.Header.Set(common.HeaderAPIKey, key)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, common.PathTranscriptions+"/abc-1/share", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("share without API key: %d", rec.Code)
+	}
+	rec := do(http.MethodPost, common.PathTranscriptions+"/abc-1/share?expires_in=10m", "k")
+	var share shareResponse
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &share) != nil {
+		t.Fatalf("create share: %d %s", rec.Code, rec.Body.String())
+	}
+	if d := time.Until(share.ExpiresAt); d > 10*time.Minute || d < 9*time.Minute {
+		t.Fatalf("expires_at %s not capped by expires_in", share.ExpiresAt)
+	}
+
+	// Valid: the status is served without the API key.
+	rec = do(http.MethodGet, share.ShareURL, "")
+	var out map[string]any
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &out) != nil || out["job_id"] != "abc-1" {
+		t.Fatalf("shared status: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Tampered: another job id, a changed expiry or a foreign secret break the signature.
+	token := strings.TrimPrefix(share.ShareURL, common.PathShared+"/")
+	_, exp, _ := strings.Cut(token, ".")
+	for _, bad := range []string{
+		"abc-2." + exp,
+		"abc-1.9999999999." + token[strings.LastIndexByte(token, '.')+1:],
+		shareToken(strings.Repeat("x", 32), "abc-1", time.Now().Add(time.Hour)),
+		"garbage",
+	} {
+		if rec := do(http.MethodGet, common.PathShared+"/"+bad, ""); rec.Code != http.StatusForbidden {
+			t.Fatalf("tampered token %q: %d", bad, rec.Code)
+		}
+	}
+
+	// Expired.
+	expired := shareToken(secret, "abc-1", time.Now().Add(-time.Second))
+	if rec := do(http.MethodGet, common.PathShared+"/"+expired, ""); rec.Code != http.StatusGone {
+		t.Fatalf("expired token: %d", rec.Code)
+	}
+}
+
+// approverMock approves held jobs by moving them to completed and records the markdown
+// each approval would post.
+type approverMock struct {
+	store  jobs.ReviewStore
+	posted map[string]string
+}
+
+func (a *approverMock) Approve(_ context.Context, job jobs.Job, markdown string) error {
+	review, err := a.store.TakeReview(job.ID, jobs.StageCompleted)
+	if err != nil {
+		return err
+	}
+	if review == nil {
+		return jobs.ErrNotInReview
+	}
+	if markdown == "" {
+		markdown = review.Markdown
+	}
+	a.posted[job.ID] = markdown
+	return nil
+}
+
+func (a *approverMock) Reject(_ context.Context, job jobs.Job, reason string) error {
+	review, err := a.store.TakeReview(job.ID, jobs.StageFailed)
+	if err != nil {
+		return err
+	}
+	if review == nil {
+		return jobs.ErrNotInReview
+	}
+	return a.store.(jobs.Store).SaveError(job.ID, jobs.RejectedPrefix+": "+reason, time.Now().UTC())
+}
+
+func TestReviewEndpoints(t *testing.T) {
+	tmp := t.TempDir()
+	store, err := jobs.NewSQLiteStore(filepath.Join(tmp, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 4, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	items := &itemProcessor{items: make(chan jobs.WorkItem, 4)}
+	if err := queue.Start(ctx, items); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+
+	now := time.Now().UTC()
+	for i, id := range []string{"held-1", "held-2", "held-3", "held-4", "done-1"} {
+		img := filepath.Join(tmp, id+".png")
+		if err := os.WriteFile(img, []byte("img"), 0o600); err != nil {
+			t.Fatalf("write img: %v", err)
+		}
+		job := &jobs.Job{ID: id, Stage: jobs.StageTranscribing, TargetName: "github", ImagePath: img, MimeType: common.MimeImagePNG, CreatedAt: now.Add(time.Duration(i) * time.Second)}
+		if err := store.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		if id != "done-1" {
+			if err := store.HoldForReview(id, jobs.Review{Markdown: "I can't", Reasons: []string{"looks like a refusal"}}); err != nil {
+				t.Fatalf("HoldForReview: %v", err)
+			}
+		}
+	}
+
+	cfg := &config.Config{QualityGate: config.QualityGateConfig{Enabled: true}}
+	approver := &approverMock{store: store, posted: map[string]string{}}
+	svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Queue: queue, Uploader: storage.NewLocalUploader(tmp), Targets: targets.NewRegistry(), Reviews: approver}
+	server := NewHTTPServer(svc)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+	doJSON := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", common.ContentTypeJSON)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, common.PathTranscriptions+"?stage=needs_review")
+	var list struct {
+		Jobs []map[string]any `json:"jobs"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &list) != nil {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body.String())
+	}
+	if len(list.Jobs) != 4 || list.Jobs[0]["job_id"] != "held-1" || list.Jobs[3]["job_id"] != "held-4" {
+		t.Fatalf("unexpected held jobs %v", list.Jobs)
+	}
+	if rec := do(http.MethodGet, common.PathTranscriptions); rec.Code != http.StatusBadRequest {
+		t.Fatalf("list without stage: %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, common.PathTranscriptions+"/held-1/approve"); rec.Code != http.StatusOK {
+		t.Fatalf("approve: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, common.PathTranscriptions+"/held-1/approve"); rec.Code != http.StatusConflict {
+		t.Fatalf("second approve: %d", rec.Code)
+	}
+	if approver.posted["held-1"] != "I can't" {
+		t.Fatalf("approve posted %q, want the held markdown", approver.posted["held-1"])
+	}
+
+	// Approve with an edited transcription.
+	if rec := doJSON(common.PathTranscriptions+"/held-3/approve", `{"markdown":"# Fixed"}`); rec.Code != http.StatusOK {
+		t.Fatalf("approve with edit: %d %s", rec.Code, rec.Body.String())
+	}
+	if approver.posted["held-3"] != "# Fixed" {
+		t.Fatalf("approve posted %q, want the edited markdown", approver.posted["held-3"])
+	}
+	if rec := doJSON(common.PathTranscriptions+"/held-4/approve", `{"md":"x"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("approve with unknown field: %d", rec.Code)
+	}
+
+	// Reject fails the job without posting.
+	rec = doJSON(common.PathTranscriptions+"/held-4/reject", `{"reason":"blurry photo"}`)
+	var status map[string]any
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &status) != nil {
+		t.Fatalf("reject: %d %s", rec.Code, rec.Body.String())
+	}
+	if status["stage"] != string(jobs.StageFailed) || status["error"] != "rejected in review: blurry photo" {
+		t.Fatalf("unexpected rejected status %v", status)
+	}
+	if got, _ := store.GetJob("held-4"); got.ErrorMessage == nil || *got.ErrorMessage != "rejected in review: blurry photo" {
+		t.Fatalf("rejection reason not stored: %+v", got)
+	}
+	if _, posted := approver.posted["held-4"]; posted {
+		t.Fatalf("rejected job was posted")
+	}
+	if rec := do(http.MethodPost, common.PathTranscriptions+"/held-4/reject"); rec.Code != http.StatusConflict {
+		t.Fatalf("second reject: %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, common.PathTranscriptions+"/held-2/retry"); rec.Code != http.StatusAccepted {
+		t.Fatalf("retry: %d %s", rec.Code, rec.Body.String())
+	}
+	if item := <-items.items; item.Job.ID != "held-2" || item.Job.Stage != jobs.StageQueued {
+		t.Fatalf("unexpected retried item %+v", item.Job)
+	}
+	if rec := do(http.MethodPost, common.PathTranscriptions+"/done-1/retry"); rec.Code != http.StatusConflict {
+		t.Fatalf("retry of a job not in review: %d", rec.Code)
+	}
+}
+
+func TestRetryFailedTranscription(t *testing.T) {
+	tmp := t.TempDir()
+	store, err := jobs.NewSQLiteStore(filepath.Join(tmp, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 4, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	items := &itemProcessor{items: make(chan jobs.WorkItem, 4)}
+	if err := queue.Start(ctx, items); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+
+	now := time.Now().UTC()
+	for _, id := range []string{"failed-1", "failed-gone", "done-1"} {
+		img := filepath.Join(tmp, id+".png")
+		if id != "failed-gone" {
+			if err := os.WriteFile(img, []byte("img"), 0o600); err != nil {
+				t.Fatalf("write img: %v", err)
+			}
+		}
+		if err := store.CreateJob(&jobs.Job{ID: id, Stage: jobs.StageQueued, TargetName: "github", ImagePath: img, MimeType: common.MimeImagePNG, CreatedAt: now}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+	}
+	_ = store.SaveError("failed-1", "github: 502 bad gateway", now)
+	_ = store.SaveError("failed-gone", "github: 502 bad gateway", now)
+	_ = store.SaveResult("done-1", "loc", "abc", now)
+
+	server := NewHTTPServer(&Service{Cfg: &config.Config{}, Store: store, Queue: queue, Log: slogDiscard{}.Logger()})
+	retry := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, common.PathTranscriptions+"/"+id+"/retry", nil))
+		return rec
+	}
+
+	if rec := retry("failed-1"); rec.Code != http.StatusAccepted {
+		t.Fatalf("retry: %d %s", rec.Code, rec.Body.String())
+	}
+	if item := <-items.items; item.Job.ID != "failed-1" || item.Job.Stage != jobs.StageQueued || item.Job.ErrorMessage != nil {
+		t.Fatalf("unexpected retried item %+v", item.Job)
+	}
+	got, _ := store.GetJob("failed-1")
+	if got.Stage != jobs.StageQueued || got.ErrorMessage != nil || got.CompletedAt != nil {
+		t.Fatalf("job not reset: %+v", got)
+	}
+	if rec := retry("failed-1"); rec.Code != http.StatusConflict {
+		t.Fatalf("retry of a queued job: %d", rec.Code)
+	}
+	if rec := retry("failed-gone"); rec.Code != http.StatusGone {
+		t.Fatalf("retry without image: %d", rec.Code)
+	}
+	if got, _ := store.GetJob("failed-gone"); got.Stage != jobs.StageFailed {
+		t.Fatalf("job without image: stage %s, want failed", got.Stage)
+	}
+	if rec := retry("done-1"); rec.Code != http.StatusConflict {
+		t.Fatalf("retry of a completed job: %d", rec.Code)
+	}
+	if rec := retry("0000-ffff"); rec.Code != http.StatusNotFound {
+		t.Fatalf("retry of an unknown job: %d", rec.Code)
+	}
+}
+
+// itemProcessor hands every processed item to the test, and its image if images is set
+// (the file is removed once processing returns).
+type itemProcessor struct {
+	items  chan jobs.WorkItem
+	images chan []byte
+}
+
+func (p *itemProcessor) Process(ctx context.Context, item jobs.WorkItem) error {
+	if p.images != nil {
+		b, _ := os.ReadFile(item.Job.ImagePath)
+		p.images <- b
+	}
+	p.items <- item
+	return nil
+}
+
+func TestCreateTranscription_TracingContinuesIncomingTrace(t *testing.T) {
+	tmp := t.TempDir()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 2, 1)
+	proc := &itemProcessor{items: make(chan jobs.WorkItem, 1)}
+	if err := queue.Start(context.Background(), proc); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+
+	var spans bytes.Buffer
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:    newMemStore(),
+		Queue:    queue,
+		Uploader: storage.NewLocalUploader(tmp),
+		Targets:  targets.NewRegistry(),
+		Tracer:   tracing.New(&spans),
+	}
+	server := NewHTTPServer(svc)
+
+	ctype, body := makeMultipart(t, "file", "img.png", "image/png", []byte("img"))
+	req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, body)
+	req.Header.Set("Content-Type", ctype)
+	req.Header.Set(common.HeaderPrefer, common.PreferRespondAsync)
+	req.Header.Set(tracing.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+
+	var span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Kind         string `json:"kind"`
+	}
+	if err := json.Unmarshal(spans.Bytes(), &span); err != nil {
+		t.Fatalf("decode span %q: %v", spans.String(), err)
+	}
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" || span.Kind != string(tracing.KindServer) {
+		t.Fatalf("unexpected request span %+v", span)
+	}
+	// The queued job continues the trace under the request span.
+	item := <-proc.items
+	if want := "00-" + span.TraceID + "-" + span.SpanID + "-01"; item.TraceParent != want {
+		t.Fatalf("item traceparent %q, want %q", item.TraceParent, want)
+	}
+}
+
+// blockingProcessor signals when it picked up a job and then blocks until released.
+type blockingProcessor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProcessor) Process(ctx context.Context, item jobs.WorkItem) error {
+	select {
+	case p.started <- struct{}{}:
+	default:
+	}
+	<-p.release
+	return nil
+}
+
+func TestCreateTranscription_QueueHighWatermark429(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 4, 1)
+	proc := &blockingProcessor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	if err := queue.Start(context.Background(), proc); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+	defer close(proc.release)
+
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{
+				MaxUploadSize:      config.ByteSize(10 * 1024 * 1024),
+				StorageDir:         tmp,
+				QueueHighWatermark: 0.5,
+				QueueRetryAfter:    1500 * time.Millisecond,
+			},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:     store,
+		Queue:     queue,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: store},
+	}
+	server := NewHTTPServer(svc)
+	send := func(async bool) *httptest.ResponseRecorder {
+		ctype, body := makeMultipart(t, "file", "img.jpg", "image/jpeg", []byte("img"))
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, body)
+		req.Header.Set("Content-Type", ctype)
+		if async {
+			req.Header.Set(common.HeaderPrefer, common.PreferRespondAsync)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The first job occupies the only worker; the next two wait in the queue.
+	if rec := send(true); rec.Code != http.StatusAccepted {
+		t.Fatalf("first request: %d", rec.Code)
+	}
+	<-proc.started
+	for i := 0; i < 2; i++ {
+		if rec := send(true); rec.Code != http.StatusAccepted {
+			t.Fatalf("request %d below watermark: %d", i+2, rec.Code)
+		}
+	}
+
+	// Depth 2 of capacity 4 reaches the 0.5 watermark.
+	rec := send(true)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 at the watermark, got %d", rec.Code)
+	}
+	if got := rec.Header().Get(common.HeaderRetryAfter); got != "2" {
+		t.Fatalf("Retry-After = %q, want 2", got)
+	}
+	// Sync requests do not use the queue and are not throttled.
+	if rec := send(false); rec.Code != http.StatusOK {
+		t.Fatalf("sync request: %d", rec.Code)
+	}
+}
+
+// slowProcessor completes the job only after release is closed.
+type slowProcessor struct {
+	store   *memStore
+	release chan struct{}
+	done    chan struct{}
+}
+
+func (p *slowProcessor) Process(ctx context.Context, item jobs.WorkItem) error {
+	<-p.release
+	defer close(p.done)
+	return p.store.SaveResult(item.Job.ID, "git:loc", "deadbeef", time.Now().UTC())
+}
+
+func TestCreateTranscription_SyncDeadline504ContinuesInBackground(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	proc := &slowProcessor{store: store, release: make(chan struct{}), done: make(chan struct{})}
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:     store,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: proc,
+	}
+	server := NewHTTPServer(svc)
+	send := func(timeout string) *httptest.ResponseRecorder {
+		ctype, body := makeMultipart(t, "file", "img.jpg", "image/jpeg", []byte("img"))
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, body)
+		req.Header.Set("Content-Type", ctype)
+		req.Header.Set(common.HeaderRequestTimeout, timeout)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("soon"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid header, got %d", rec.Code)
+	}
+
+	rec := send("0.05")
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d", rec.Code)
+	}
+	var resp createResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if resp.StatusURL != common.PathTranscriptions+"/"+resp.JobID {
+		t.Fatalf("unexpected status url %q for job %q", resp.StatusURL, resp.JobID)
+	}
+
+	// The upload is kept for the job still running and removed once it finishes.
+	uploads, _ := filepath.Glob(filepath.Join(tmp, "*", "*"))
+	if len(uploads) != 1 {
+		t.Fatalf("expected the upload to be kept while the job runs, found %v", uploads)
+	}
+	close(proc.release)
+	<-proc.done
+	got, _ := store.GetJob(resp.JobID)
+	if got == nil || got.Stage != jobs.StageCompleted {
+		t.Fatalf("job did not complete in the background: %+v", got)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if uploads, _ := filepath.Glob(filepath.Join(tmp, "*", "*")); len(uploads) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("upload not cleaned up after the job finished")
+		}
+	}
+}
+
+// slogDiscard wraps a no-op slog handler for tests.
+type slogDiscard struct{}
+
+func (s slogDiscard) Logger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func TestCreateTranscription_StreamsFileAndReadsFieldsInAnyOrder(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{
+				MaxUploadSize: config.ByteSize(10 * 1024 * 1024),
+				StorageDir:    tmp,
+			},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:     store,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: store},
+	}
+	server := NewHTTPServer(svc)
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	_ = mw.WriteField("title", "Before File")
+	fw, err := mw.CreateFormFile("file", "img.png")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	_, _ = fw.Write([]byte("img"))
+	_ = mw.WriteField("metadata", `{"source":"after"}`)
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.data) != 1 {
+		t.Fatalf("expected one job, got %d", len(store.data))
+	}
+	for _, j := range store.data {
+		if j.Title == nil || *j.Title != "Before File" {
+			t.Fatalf("title not parsed: %v", j.Title)
+		}
+		if j.Metadata["source"] != "after" {
+			t.Fatalf("metadata not parsed: %v", j.Metadata)
+		}
+		if j.MimeType != common.MimeImagePNG {
+			t.Fatalf("mime = %q", j.MimeType)
+		}
+	}
+}
+
+func TestCreateTranscription_MissingFile400(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(1024), StorageDir: tmp},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:    store,
+		Uploader: storage.NewLocalUploader(tmp),
+		Targets:  targets.NewRegistry(),
+	}
+	server := NewHTTPServer(svc)
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	_ = mw.WriteField("title", "no file")
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestCreateTranscription_CallbackURLScheme(t *testing.T) {
+	tmp := t.TempDir()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp, CallbackRequireHTTPS: true},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:     newMemStore(),
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: newMemStore()},
+	}
+	server := NewHTTPServer(svc)
+
+	post := func(callback string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, _ := mw.CreateFormFile("file", "img.png")
+		_, _ = fw.Write([]byte("img"))
+		_ = mw.WriteField("callback_url", callback)
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, cb := range []string{"http://hooks.example.com/done", "ftp://hooks.example.com/done", "https:///done"} {
+		if rec := post(cb); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid callback_url") {
+			t.Fatalf("%s: expected 400, got %d %q", cb, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := post("https://hooks.example.com/done"); rec.Code != http.StatusOK {
+		t.Fatalf("https callback: expected 200, got %d %q", rec.Code, rec.Body.String())
+	}
+	svc.Cfg.Server.CallbackRequireHTTPS = false
+	if rec := post("http://hooks.example.com/done"); rec.Code != http.StatusOK {
+		t.Fatalf("http callback allowed: expected 200, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateTranscription_CallbackEvents(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:     store,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: newMemStore()},
+	}
+	server := NewHTTPServer(svc)
+
+	post := func(events string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, _ := mw.CreateFormFile("file", "img.png")
+		_, _ = fw.Write([]byte("img"))
+		_ = mw.WriteField("callback_url", "https://hooks.example.com/done")
+		_ = mw.WriteField("callback_events", events)
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("completed,started"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid callback_events") {
+		t.Fatalf("unknown event: expected 400, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("Failed, needs_review, failed"); rec.Code != http.StatusOK {
+		t.Fatalf("valid events: expected 200, got %d %q", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.data) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(store.data))
+	}
+	for _, job := range store.data {
+		if strings.Join(job.CallbackEvents, ",") != "failed,needs_review" {
+			t.Fatalf("callback events = %v", job.CallbackEvents)
+		}
+	}
+}
+
+func TestCreateTranscription_MultipleTargets(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server:  config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp, AllowTargetOverrides: true},
+			Target:  config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+			Targets: []config.TargetEntry{{Name: "pages", Type: config.TargetTypeNotion}},
+		},
+		Store:     store,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: newMemStore()},
+	}
+	server := NewHTTPServer(svc)
+
+	post := func(branch string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, _ := mw.CreateFormFile("file", "img.png")
+		_, _ = fw.Write([]byte("img"))
+		if branch != "" {
+			_ = mw.WriteField("branch", branch)
+		}
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("drafts"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "target pages does not support") {
+		t.Fatalf("override with a notion target: expected 400, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post(""); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %q", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, job := range store.data {
+		if job.TargetName != "github" || strings.Join(job.Targets, ",") != "github,pages" {
+			t.Fatalf("job target %q targets %v, want github of github,pages", job.TargetName, job.Targets)
+		}
+	}
+
+	out := jobToOut(&jobs.Job{ID: "j", Stage: jobs.StageFailed, TargetResults: []jobs.TargetResult{
+		{TargetName: "github", Location: "git:a", Commit: "c1"},
+		{TargetName: "pages", Error: "boom"},
+	}})
+	b, _ := json.Marshal(out["target_results"])
+	if want := `[{"target":"github","status":"completed","location":"git:a","commit":"c1"},{"target":"pages","status":"failed"}]`; string(b) != want {
+		t.Fatalf("target_results = %s, want %s", b, want)
+	}
+}
+
+func TestCreateTranscription_TruncatedBodyLeavesNoFiles(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	var logs bytes.Buffer
+	svc := &Service{
+		Log: slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:    store,
+		Uploader: storage.NewLocalUploader(tmp),
+		Targets:  targets.NewRegistry(),
+	}
+	server := NewHTTPServer(svc)
+
+	// Cut the body off in the middle of the image, as a client disconnecting mid-upload would.
+	ct, body := makeMultipart(t, "file", "img.png", "image/png", bytes.Repeat([]byte{0x89}, 64<<10))
+	req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, bytes.NewReader(body.Bytes()[:32<<10]))
+	req.Header.Set("Content-Type", ct)
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+
+	if rec.Body.Len() != 0 {
+		t.Fatalf("expected no response for an aborted upload, got %d %q", rec.Code, rec.Body.String())
+	}
+	if len(store.data) != 0 {
+		t.Fatalf("expected no job, got %d", len(store.data))
+	}
+	entries, err := os.ReadDir(filepath.Join(tmp, common.UploadsDirName))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("read uploads dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("partial upload left behind: %v", entries)
+	}
+	if out := logs.String(); !strings.Contains(out, "upload aborted by client") || strings.Contains(out, "level=ERROR") {
+		t.Fatalf("unexpected logs: %s", out)
+	}
+}
+
+func TestCreateTranscription_NamedAPIKeySetsActor(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{
+				MaxUploadSize: config.ByteSize(10 * 1024 * 1024),
+				StorageDir:    tmp,
+				APIKey:        "static",
+				APIKeys:       []config.APIKeyConfig{{Name: "mobile-app", Key: "k-mobile"}},
+			},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:     store,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: store},
+	}
+	server := NewHTTPServer(svc)
+
+	send := func(key string) int {
+		ctype, body := makeMultipart(t, "file", "img.png", "image/png", []byte("img"))
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, body)
+		req.Header.Set("Content-Type", ctype)
+		req.Header.Set(common.HeaderAPIKey, key)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown key, got %d", code)
+	}
+	if code := send("k-mobile"); code != http.StatusOK {
+		t.Fatalf("expected 200 for named key, got %d", code)
+	}
+	if code := send("static"); code != http.StatusOK {
+		t.Fatalf("expected 200 for static key, got %d", code)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var named, unnamed int
+	for _, j := range store.data {
+		if j.Actor != nil && *j.Actor == "mobile-app" {
+			named++
+		} else if j.Actor == nil {
+			unnamed++
+		}
+	}
+	if named != 1 || unnamed != 1 {
+		t.Fatalf("actor mismatch: named=%d unnamed=%d", named, unnamed)
+	}
+}
+
+func TestCreateTranscription_TargetOverrides(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	cfg := &config.Config{
+		Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp},
+		Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+	}
+	svc := &Service{
+		Cfg:       cfg,
+		Store:     store,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: store},
+	}
+	server := NewHTTPServer(svc)
+
+	send := func(fields map[string]string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		for k, v := range fields {
+			_ = mw.WriteField(k, v)
+		}
+		fw, _ := mw.CreateFormFile("file", "img.png")
+		_, _ = fw.Write([]byte("img"))
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(map[string]string{"branch": "drafts"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when overrides are disabled, got %d", rec.Code)
+	}
+
+	cfg.Server.AllowTargetOverrides = true
+	if rec := send(map[string]string{"branch": "bad..name"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid branch, got %d", rec.Code)
+	}
+	if rec := send(map[string]string{"base_path": "../outside"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for traversal in base_path, got %d", rec.Code)
+	}
+	if rec := send(map[string]string{"branch": "drafts", "base_path": `notes\2024`}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.data) != 1 {
+		t.Fatalf("expected one job, got %d", len(store.data))
+	}
+	for _, j := range store.data {
+		if j.TargetBranch == nil || *j.TargetBranch != "drafts" {
+			t.Fatalf("branch not stored: %v", j.TargetBranch)
+		}
+		if j.TargetBasePath == nil || *j.TargetBasePath != "notes/2024/" {
+			t.Fatalf("base path not normalized: %v", j.TargetBasePath)
+		}
+	}
+}
+
+// viewerTarget is a targets.Viewer that maps any location to a fixed URL prefix.
+type viewerTarget struct{}
+
+func (viewerTarget) Name() string { return "github" }
+func (viewerTarget) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
+	return targets.TargetResult{}, nil
+}
+func (viewerTarget) ViewURL(location string) (string, bool) {
+	return "https://view.example/" + location, true
+}
+
+func TestCreateTranscription_RequestIdentity(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	cfg := &config.Config{
+		Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp},
+		Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+	}
+	idCfg := config.IdentityConfig{
+		Header:      "X-Forwarded-User",
+		EmailHeader: "X-Forwarded-Email",
+		JWT:         config.JWTConfig{Enabled: true, Header: "Authorization", Secret: "s3cret", NameClaim: "name", EmailClaim: "email"},
+	}
+	svc := &Service{
+		Cfg:       cfg,
+		Store:     store,
+		Uploader:  storage.NewLocalUploader(tmp),
+		Targets:   targets.NewRegistry(),
+		Processor: &fakeProcessor{store: store},
+		Identity:  identity.New(idCfg, http.DefaultClient),
+	}
+	server := NewHTTPServer(svc)
+
+	send := func(headers map[string]string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, _ := mw.CreateFormFile("file", "img.png")
+		_, _ = fw.Write([]byte("img"))
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(map[string]string{"Authorization": "Bearer forged.token.value", "X-Forwarded-User": "jane"}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an invalid token, got %d", rec.Code)
+	}
+	if rec := send(map[string]string{"X-Forwarded-User": "jane", "X-Forwarded-Email": "jane@example.com"}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.data) != 1 {
+		t.Fatalf("expected one job, got %d", len(store.data))
+	}
+	for _, j := range store.data {
+		if deref(j.AuthorName) != "jane" || deref(j.AuthorEmail) != "jane@example.com" {
+			t.Fatalf("identity not stored: %v %v", j.AuthorName, j.AuthorEmail)
+		}
+	}
+}
+
+func TestGetTranscription_IncludesViewURL(t *testing.T) {
+	store := newMemStore()
+	loc, lang := "github:org/repo@main:a.md", "de"
+	_ = store.CreateJob(&jobs.Job{ID: "0000-aaaa", TargetName: "github", Stage: jobs.StageCompleted, TargetLocation: &loc, Language: &lang,
+		ProviderMeta: []byte(`{"model":"gpt-5-2025-08-07"}`)})
+	_ = store.CreateJob(&jobs.Job{ID: "0000-bbbb", TargetName: "github", Stage: jobs.StageQueued})
+	reg := targets.NewRegistry()
+	reg.Add(viewerTarget{})
+	svc := &Service{Cfg: &config.Config{}, Store: store, Targets: reg}
+	server := NewHTTPServer(svc)
+
+	get := func(id string) map[string]any {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, common.PathTranscriptions+"/"+id, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d", id, rec.Code)
+		}
+		var out map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out
+	}
+	done := get("0000-aaaa")
+	if got := done["view_url"]; got != "https://view.example/"+loc {
+		t.Fatalf("view_url = %v", got)
+	}
+	if got := done["language"]; got != "de" {
+		t.Fatalf("language = %v", got)
+	}
+	if meta, ok := done["provider_meta"].(map[string]any); !ok || meta["model"] != "gpt-5-2025-08-07" {
+		t.Fatalf("provider_meta = %v", done["provider_meta"])
+	}
+	if _, ok := get("0000-bbbb")["view_url"]; ok {
+		t.Fatalf("view_url must be absent before the job is posted")
+	}
+}
+
+func TestTranscriptionEvents(t *testing.T) {
+	store := newMemStore()
+	_ = store.CreateJob(&jobs.Job{ID: "0000-aaaa", TargetName: "github", Stage: jobs.StageQueued})
+	events := jobs.NewEvents()
+	svc := &Service{Cfg: &config.Config{}, Store: store, Events: events}
+	ts := httptest.NewServer(NewHTTPServer(svc).Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + common.PathTranscriptions + "/0000-aaaa/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	body := bufio.NewReader(resp.Body)
+	next := func() map[string]any {
+		t.Helper()
+		var data string
+		for {
+			line, err := body.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event: %v", err)
+			}
+			line = strings.TrimRight(line, "\n")
+			if line == "" {
+				break
+			}
+			if v, ok := strings.CutPrefix(line, "data: "); ok {
+				data = v
+			} else if line != "event: stage" {
+				t.Fatalf("unexpected line %q", line)
+			}
+		}
+		var out map[string]any
+		if err := json.Unmarshal([]byte(data), &out); err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		return out
+	}
+
+	if got := next()["stage"]; got != "queued" {
+		t.Fatalf("first event stage = %v", got)
+	}
+	now := time.Now().UTC()
+	_ = store.UpdateStage("0000-aaaa", jobs.StageTranscribing, &now)
+	events.Publish("0000-aaaa", jobs.StageTranscribing)
+	if got := next()["stage"]; got != "transcribing" {
+		t.Fatalf("second event stage = %v", got)
+	}
+	_ = store.SaveResult("0000-aaaa", "github:a.md", "abc", now)
+	events.Publish("0000-aaaa", jobs.StageCompleted)
+	done := next()
+	if done["stage"] != "completed" || done["target_result"] == nil {
+		t.Fatalf("last event = %v", done)
+	}
+	// The stream ends with the terminal stage.
+	if rest, err := io.ReadAll(body); err != nil || len(rest) != 0 {
+		t.Fatalf("after completion: %q, %v", rest, err)
+	}
+
+	resp, err = http.Get(ts.URL + common.PathTranscriptions + "/0000-ffff/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown job: status %d", resp.StatusCode)
+	}
+}
+
+func TestTranscriptionEvents_EndOnShutdown(t *testing.T) {
+	store := newMemStore()
+	_ = store.CreateJob(&jobs.Job{ID: "0000-aaaa", TargetName: "github", Stage: jobs.StageNeedsReview})
+	svc := &Service{Cfg: &config.Config{}, Store: store, Events: jobs.NewEvents()}
+	srv := NewHTTPServer(svc)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + common.PathTranscriptions + "/0000-aaaa/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body := bufio.NewReader(resp.Body)
+	if line, err := body.ReadString('\n'); err != nil || line != "event: stage\n" {
+		t.Fatalf("first event: %q, %v", line, err)
+	}
+
+	// A job held for review never finishes on its own; the stream must not hold up Shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown with open stream: %v after %s", err, time.Since(start))
+	}
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatalf("stream not closed: %v", err)
+	}
+}
+
+// redirectTransport sends every request to a test server regardless of its URL.
+type redirectTransport struct{ target *httptest.Server }
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	req.URL.Host = strings.TrimPrefix(rt.target.URL, "http://")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	fetched := make(chan string, 1)
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched <- r.URL.Path
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png"))
+	}))
+	defer images.Close()
+
+	tmp := t.TempDir()
+	store := newMemStore()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 2, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := queue.Start(ctx, &fakeProcessor{store: store}); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+
+	whCfg := config.GitHubWebhookConfig{Secret: "hook-secret", CommentOnCompletion: true, Token: "t", APIURL: "https://api.github.com"}
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(10 * 1024 * 1024), StorageDir: tmp, GitHubWebhook: whCfg},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:         store,
+		Queue:         queue,
+		Uploader:      storage.NewLocalUploader(tmp),
+		Targets:       targets.NewRegistry(),
+		GitHubWebhook: ghwebhook.NewClient(whCfg, &http.Client{Transport: redirectTransport{images}}),
+	}
+	server := NewHTTPServer(svc)
+
+	payload := []byte(`{"action":"opened","issue":{"number":7,"title":"Meeting notes","body":"see ![scan](https://github.com/user-attachments/assets/abc)",` +
+		`"comments_url":"https://api.github.com/repos/o/r/issues/7/comments"},"repository":{"full_name":"o/r"},"sender":{"login":"jane","type":"User"}}`)
+	send := func(event, secret string) *httptest.ResponseRecorder {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		req := httptest.NewRequest(http.MethodPost, common.PathGitHubWebhook, bytes.NewReader(payload))
+		req.Header.Set(common.HeaderGitHubEvent, event)
+		req.Header.Set(common.HeaderGitHubSig256, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("issues", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an invalid signature, got %d", rec.Code)
+	}
+	if rec := send("push", "hook-secret"); rec.Code != http.StatusOK {
+		t.Fatalf("expected other events to be acknowledged with 200, got %d", rec.Code)
+	}
+
+	rec := send("issues", "hook-secret")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if p := <-fetched; p != "/user-attachments/assets/abc" {
+		t.Fatalf("unexpected image fetch %q", p)
+	}
+	var resp createResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	job, err := store.GetJob(resp.JobID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if job.MimeType != "image/png" || job.Title == nil || *job.Title != "Meeting notes" || job.Metadata["github_issue"] != 7 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if job.CommentsURL == nil || *job.CommentsURL != "https://api.github.com/repos/o/r/issues/7/comments" {
+		t.Fatalf("comments url not recorded: %+v", job.CommentsURL)
+	}
+}
+
+func TestSampled_HonorsRate(t *testing.T) {
+	const draws = 20000
+	r := rand.New(rand.NewPCG(1, 2))
+	for _, rate := range []float64{0, 0.01, 0.25, 1} {
+		n := 0
+		for i := 0; i < draws; i++ {
+			if sampled(rate, r.Float64) {
+				n++
+			}
+		}
+		want := rate * draws
+		if math.Abs(float64(n)-want) > 0.1*want {
+			t.Errorf("rate %v: sampled %d of %d, want about %.0f", rate, n, draws, want)
+		}
+	}
+}
+
+func TestResumableUpload_CreatePatchComplete(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 2, 1)
+	proc := &itemProcessor{items: make(chan jobs.WorkItem, 1), images: make(chan []byte, 1)}
+	if err := queue.Start(context.Background(), proc); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(1024), StorageDir: tmp, ResumableUploads: true},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:    store,
+		Queue:    queue,
+		Uploader: storage.NewLocalUploader(tmp),
+		Targets:  targets.NewRegistry(),
+	}
+	server := NewHTTPServer(svc)
+	do := func(method, target string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	b64 := base64.StdEncoding.EncodeToString
+
+	if rec := do(http.MethodPost, common.PathUploads, nil, map[string]string{"Upload-Length": "2048"}); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: expected 413, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, common.PathUploads, nil, map[string]string{"Upload-Length": "4", "Tus-Resumable": "0.2.2"}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("unsupported version: expected 412, got %d", rec.Code)
+	}
+
+	img := bytes.Repeat([]byte("png!"), 100)
+	rec := do(http.MethodPost, common.PathUploads, nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(len(img)),
+		"Upload-Metadata": "filename " + b64([]byte("scan.png")) + ",title " + b64([]byte("Scan")) + ",is_confidential",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d %q", rec.Code, rec.Body.String())
+	}
+	loc := rec.Header().Get("Location")
+	if !strings.HasPrefix(loc, common.PathUploads+"/") {
+		t.Fatalf("unexpected Location %q", loc)
+	}
+	chunk := func(offset, end int) *httptest.ResponseRecorder {
+		return do(http.MethodPatch, loc, img[offset:end], map[string]string{
+			"Content-Type": "application/offset+octet-stream", "Upload-Offset": strconv.Itoa(offset),
+		})
+	}
+
+	if rec := chunk(0, 150); rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "150" {
+		t.Fatalf("first chunk: %d, offset %q", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+	if rec := do(http.MethodHead, loc, nil, nil); rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "150" || rec.Header().Get("Upload-Length") != "400" {
+		t.Fatalf("head: %d, headers %v", rec.Code, rec.Header())
+	}
+	if rec := chunk(100, 200); rec.Code != http.StatusConflict {
+		t.Fatalf("stale offset: expected 409, got %d", rec.Code)
+	}
+	rec = chunk(150, len(img))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "400" {
+		t.Fatalf("last chunk: %d, offset %q: %s", rec.Code, rec.Header().Get("Upload-Offset"), rec.Body.String())
+	}
+	jobID := rec.Header().Get(HeaderJobID)
+
+	item := <-proc.items
+	if item.Job.ID != jobID || item.Job.Title == nil || *item.Job.Title != "Scan" || item.Job.MimeType != common.MimeImagePNG {
+		t.Fatalf("unexpected job %+v (header job id %q)", item.Job, jobID)
+	}
+	if got := <-proc.images; !bytes.Equal(got, img) {
+		t.Fatalf("assembled image differs: %d bytes", len(got))
+	}
+	if j, _ := store.GetJob(jobID); j == nil {
+		t.Fatalf("job %s not stored", jobID)
+	}
+	if rec := do(http.MethodHead, loc, nil, nil); rec.Header().Get(HeaderJobID) != jobID || rec.Header().Get("Upload-Offset") != "400" {
+		t.Fatalf("head after completion: %v", rec.Header())
+	}
+	if _, err := os.Stat(filepath.Join(tmp, common.PartialDirName, path.Base(loc)+".bin")); !os.IsNotExist(err) {
+		t.Fatalf("partial data not removed: %v", err)
+	}
+}
+
+func TestResumableUpload_Expiry(t *testing.T) {
+	tmp := t.TempDir()
+	svc := &Service{
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(1024), StorageDir: tmp, ResumableUploads: true, ResumableUploadExpiry: time.Hour},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:    newMemStore(),
+		Uploader: storage.NewLocalUploader(tmp),
+		Targets:  targets.NewRegistry(),
+	}
+	server := NewHTTPServer(svc)
+	do := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if ext := do(http.MethodOptions, common.PathUploads, nil).Header().Get("Tus-Extension"); !strings.Contains(ext, "expiration") {
+		t.Fatalf("expiration extension not announced: %q", ext)
+	}
+	rec := do(http.MethodPost, common.PathUploads, map[string]string{
+		"Upload-Length":   "4",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("scan.png")),
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d %q", rec.Code, rec.Body.String())
+	}
+	expires, err := http.ParseTime(rec.Header().Get("Upload-Expires"))
+	if err != nil || time.Until(expires) < 58*time.Minute || time.Until(expires) > time.Hour {
+		t.Fatalf("unexpected Upload-Expires %q (%v)", rec.Header().Get("Upload-Expires"), err)
+	}
+	loc := rec.Header().Get("Location")
+	if rec := do(http.MethodHead, loc, nil); rec.Code != http.StatusOK || rec.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("head: %d, headers %v", rec.Code, rec.Header())
+	}
+
+	if n, err := ExpireUploads(tmp, time.Hour, time.Now()); err != nil || n != 0 {
+		t.Fatalf("expire before deadline: n=%d err=%v", n, err)
+	}
+	if n, err := ExpireUploads(tmp, time.Hour, expires.Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("expire after deadline: n=%d err=%v", n, err)
+	}
+	if rec := do(http.MethodHead, loc, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("head after expiry: expected 404, got %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, common.PartialDirName, path.Base(loc)+".json")); !os.IsNotExist(err) {
+		t.Fatalf("upload state not removed: %v", err)
+	}
+	if _, ok := uploadLocks.Load(path.Base(loc)); ok {
+		t.Fatalf("upload lock not removed")
+	}
+}
+
+func TestAdminPurge(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	_ = store.CreateJob(&jobs.Job{ID: "job-1", Stage: jobs.StageCompleted})
+	uploader := storage.NewLocalUploader(tmp)
+	if _, _, _, err := uploader.SaveImageStream(strings.NewReader("png"), "a.png", "image/png", 0); err != nil {
+		t.Fatalf("save upload: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmp, common.PartialDirName), 0o750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, common.PartialDirName, "x.bin"), []byte("p"), 0o600); err != nil {
+		t.Fatalf("write partial: %v", err)
+	}
+	cfg := &config.Config{Server: config.ServerConfig{StorageDir: tmp, APIKey: "k"}}
+	svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Uploader: uploader, Targets: targets.NewRegistry()}
+	server := NewHTTPServer(svc)
+	purge := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, common.PathAdminPurge, nil)
+		req.Header.Set(common.HeaderAPIKey, key)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := purge("k"); rec.Code != http.StatusForbidden {
+		t.Fatalf("disabled purge: expected 403, got %d", rec.Code)
+	}
+	cfg.Server.AllowAdminPurge = true
+	cfg.Server.APIKey = ""
+	if rec := purge(""); rec.Code != http.StatusForbidden {
+		t.Fatalf("purge without configured API key: expected 403, got %d", rec.Code)
+	}
+	cfg.Server.APIKey = "k"
+	if rec := purge("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong key: expected 401, got %d", rec.Code)
+	}
+	if j, _ := store.GetJob("job-1"); j == nil {
+		t.Fatalf("job removed by a refused purge")
+	}
+
+	rec := purge("k")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("purge: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res purgeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if res != (purgeResponse{Jobs: 1, Uploads: 1, PartialUploads: 1}) {
+		t.Fatalf("unexpected counts %+v", res)
+	}
+	if j, _ := store.GetJob("job-1"); j != nil {
+		t.Fatalf("job survived purge")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(tmp, common.UploadsDirName)); len(entries) != 0 {
+		t.Fatalf("uploads survived purge: %v", entries)
+	}
+}
+
+func TestAdminVacuum(t *testing.T) {
+	tmp := t.TempDir()
+	store, err := jobs.NewSQLiteStore(filepath.Join(tmp, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	padding := strings.Repeat("x", 4096)
+	for i := 0; i < 100; i++ {
+		job := &jobs.Job{ID: fmt.Sprintf("old-%d", i), ImagePath: "img", MimeType: common.MimeImagePNG, TargetName: "github",
+			Metadata: map[string]any{"padding": padding}, Stage: jobs.StageCompleted, CreatedAt: time.Now().UTC()}
+		if err := store.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		_ = store.SaveResult(job.ID, "loc", "c", time.Now().UTC())
+	}
+	if _, err := store.DeleteFinishedBefore(time.Now().Add(time.Hour), 1000); err != nil {
+		t.Fatalf("DeleteFinishedBefore: %v", err)
+	}
+	if err := store.CreateJob(&jobs.Job{ID: "abc-1", ImagePath: "img", MimeType: common.MimeImagePNG, TargetName: "github", Stage: jobs.StageQueued, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+
+	cfg := &config.Config{Server: config.ServerConfig{StorageDir: tmp}}
+	svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Targets: targets.NewRegistry()}
+	server := NewHTTPServer(svc)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	// Status requests keep being served while the vacuum runs.
+	stop := make(chan struct{})
+	served := make(chan int)
+	go func() {
+		n := 0
+		defer func() { served <- n }()
+		for {
+			if rec := do(http.MethodGet, common.PathTranscriptions+"/abc-1"); rec.Code != http.StatusOK {
+				t.Errorf("status during vacuum: %d", rec.Code)
+				return
+			}
+			n++
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	rec := do(http.MethodPost, common.PathAdminVacuum+"?checkpoint=true")
+	close(stop)
+	if n := <-served; n == 0 {
+		t.Fatalf("no status request served")
+	}
+	var res vacuumResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &res) != nil {
+		t.Fatalf("vacuum: %d %s", rec.Code, rec.Body.String())
+	}
+	if res.SizeAfter >= res.SizeBefore {
+		t.Fatalf("vacuum did not shrink the database: %+v", res)
+	}
+	if rec := do(http.MethodPost, common.PathAdminVacuum+"?checkpoint=maybe"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid checkpoint: %d", rec.Code)
+	}
+
+	svc.Store = newMemStore()
+	if rec := do(http.MethodPost, common.PathAdminVacuum); rec.Code != http.StatusNotImplemented {
+		t.Fatalf("unsupported store: %d", rec.Code)
+	}
+}
+
+func TestIngestWatcher_QueuesStableFilesAndMovesThem(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "inbox")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	store := newMemStore()
+	queue := jobs.NewQueue(slogDiscard{}.Logger(), 4, 1)
+	proc := &itemProcessor{items: make(chan jobs.WorkItem, 2), images: make(chan []byte, 2)}
+	if err := queue.Start(context.Background(), proc); err != nil {
+		t.Fatalf("queue start: %v", err)
+	}
+	defer queue.Shutdown(time.Second)
+	svc := &Service{
+		Log: slogDiscard{}.Logger(),
+		Cfg: &config.Config{
+			Server: config.ServerConfig{MaxUploadSize: config.ByteSize(1024), StorageDir: tmp, IngestDir: dir},
+			Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+		},
+		Store:    store,
+		Queue:    queue,
+		Uploader: storage.NewLocalUploader(tmp),
+		Targets:  targets.NewRegistry(),
+	}
+	iw := svc.NewIngestWatcher()
+	write := func(name, data string, flag int) {
+		t.Helper()
+		f, err := os.OpenFile(filepath.Join(dir, name), flag|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		_, _ = f.WriteString(data)
+		_ = f.Close()
+	}
+
+	write("page.png", "png-", os.O_TRUNC)
+	write("notes.txt", "not an image", os.O_TRUNC)
+	if n := iw.CheckOnce(); n != 0 {
+		t.Fatalf("new file ingested before it was seen unchanged: %d", n)
+	}
+	write("page.png", "data", os.O_APPEND) // still being written
+	if n := iw.CheckOnce(); n != 0 {
+		t.Fatalf("growing file ingested: %d", n)
+	}
+	if n := iw.CheckOnce(); n != 1 {
+		t.Fatalf("expected the stable file to be queued, got %d", n)
+	}
+
+	item := <-proc.items
+	if img := <-proc.images; string(img) != "png-data" {
+		t.Fatalf("job image %q, want the complete file", img)
+	}
+	if item.Job.TargetName != "github" || item.Job.Metadata["ingest_file"] != "page.png" {
+		t.Fatalf("unexpected job %+v", item.Job)
+	}
+	if j, _ := store.GetJob(item.Job.ID); j == nil {
+		t.Fatalf("job not persisted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, common.DoneDirName, item.Job.ID+"-page.png")); err != nil {
+		t.Fatalf("file not moved to done: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Fatalf("non-image file should be left alone: %v", err)
+	}
+	if n := iw.CheckOnce(); n != 0 {
+		t.Fatalf("moved file ingested again: %d", n)
+	}
+}
+
+func TestCreateTranscription_ImageURL(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nimage")
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/note.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(png)
+		case "/big.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(append(png, make([]byte, 2048)...))
+		case "/moved":
+			http.Redirect(w, r, "http://localhost.invalid/note.png", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		}
+	}))
+	defer origin.Close()
+
+	tmp := t.TempDir()
+	store := newMemStore()
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			MaxUploadSize:   config.ByteSize(1024),
+			StorageDir:      tmp,
+			ImageURLHosts:   []string{"127.0.0.1"},
+			ImageURLTimeout: 5 * time.Second,
+		},
+		Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+	}
+	svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Uploader: storage.NewLocalUploader(tmp), Targets: targets.NewRegistry(), Processor: &fakeProcessor{store: store}}
+	server := NewHTTPServer(svc)
+	post := func(imageURL string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		_ = mw.WriteField("image_url", imageURL)
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post(origin.URL + "/note.png"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	if len(store.data) != 1 {
+		t.Fatalf("expected one job, got %d", len(store.data))
+	}
+	for _, job := range store.data {
+		if job.MimeType != common.MimeImagePNG || !strings.HasSuffix(job.ImagePath, ".png") {
+			t.Fatalf("unexpected job image %s (%s)", job.ImagePath, job.MimeType)
+		}
+	}
+	store.mu.Unlock()
+
+	for _, bad := range []string{
+		"ftp://127.0.0.1/note.png", // scheme
+		strings.Replace(origin.URL, "127.0.0.1", "localhost", 1) + "/note.png", // host not listed
+		origin.URL + "/moved", // redirect to a host not listed
+		origin.URL + "/page",  // not an image
+	} {
+		if rec := post(bad); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "image_url") {
+			t.Fatalf("%s: expected 400 about image_url, got %d: %s", bad, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := post(origin.URL + "/big.png"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "exceeds") {
+		t.Fatalf("expected 400 for an oversized image, got %d: %s", rec.Code, rec.Body.String())
+	}
+	cfg.Server.ImageURLHosts = nil
+	if rec := post(origin.URL + "/note.png"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not enabled") {
+		t.Fatalf("expected 400 with image_url disabled, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateTranscription_JSONBody(t *testing.T) {
+	tmp := t.TempDir()
+	store := newMemStore()
+	cfg := &config.Config{
+		Server: config.ServerConfig{MaxUploadSize: config.ByteSize(1024), StorageDir: tmp},
+		Target: config.TargetsConfig{GitHub: config.GitHubTargetConfig{Enabled: true}},
+	}
+	svc := &Service{Log: slogDiscard{}.Logger(), Cfg: cfg, Store: store, Uploader: storage.NewLocalUploader(tmp), Targets: targets.NewRegistry(), Processor: &fakeProcessor{store: store}}
+	server := NewHTTPServer(svc)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, common.PathTranscriptions, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"image_base64":"aW1n","mime_type":"image/jpeg","title":"Notes","metadata":{"project":"x"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	for _, job := range store.data {
+		if job.MimeType != common.MimeImageJPEG || deref(job.Title) != "Notes" || job.Metadata["project"] != "x" {
+			t.Fatalf("unexpected job: %+v", job)
+		}
+	}
+	store.mu.Unlock()
+
+	for _, bad := range []string{
+		`{"image_base64":"%%%","mime_type":"image/png"}`,
+		`{"image_base64":"aW1n","mime_type":"image/gif"}`,
+		`{"mime_type":"image/png"}`,
+		`{"image_base64":`,
+	} {
+		if rec := post(bad); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", bad, rec.Code, rec.Body.String())
+		}
+	}
 }
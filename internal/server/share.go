@@ -0,0 +1,105 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+)
+
+var (
+	errShareInvalid = errors.New("invalid share link")
+	errShareExpired = errors.New("share link expired")
+)
+
+// shareResponse is returned when a share link is created.
+type shareResponse struct {
+	ShareURL  string    `json:"share_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// shareToken returns the token of a share link for job id that is valid until expires:
+// "<id>.<expiry in Unix seconds>.<HMAC-SHA256 of both>".
+func shareToken(secret, id string, expires time.Time) string {
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + shareSignature(secret, payload)
+}
+
+func shareSignature(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseShareToken verifies token and returns the id of the job it was issued for. It
+// fails with errShareInvalid for a token not signed with secret and errShareExpired
+// once the token has expired.
+func parseShareToken(secret, token string, now time.Time) (string, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(shareSignature(secret, token[:i]))) {
+		return "", errShareInvalid
+	}
+	id, exp, ok := strings.Cut(token[:i], ".")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if !ok || err != nil || id == "" {
+		return "", errShareInvalid
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return "", errShareExpired
+	}
+	return id, nil
+}
+
+// handleCreateShare returns a link that shows the status of a job without the API key
+// until it expires after server.shareExpiry, or the shorter expires_in query duration.
+func (svc *Service) handleCreateShare(w http.ResponseWriter, r *http.Request) {
+	job, err := svc.Store.GetJob(r.PathValue("id"))
+	if err != nil || job == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	expiry := svc.Cfg.Server.ShareExpiry
+	if v := r.URL.Query().Get("expires_in"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid expires_in: must be a positive duration such as 1h", http.StatusBadRequest)
+			return
+		}
+		expiry = min(expiry, d)
+	}
+	expires := time.Now().Add(expiry).Truncate(time.Second).UTC()
+	if svc.Log != nil {
+		svc.Log.Info("share link created", "job_id", job.ID, "expires_at", expires)
+	}
+	writeJSON(w, http.StatusCreated, shareResponse{
+		ShareURL:  path.Join(common.PathShared, shareToken(svc.Cfg.Server.ShareSecret, job.ID, expires)),
+		ExpiresAt: expires,
+	})
+}
+
+// handleGetShared answers with the status of the job a valid share token was issued for.
+func (svc *Service) handleGetShared(w http.ResponseWriter, r *http.Request) {
+	id, err := parseShareToken(svc.Cfg.Server.ShareSecret, r.PathValue("token"), time.Now())
+	switch {
+	case errors.Is(err, errShareExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	job, err := svc.Store.GetJob(id)
+	if err != nil || job == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, svc.jobStatus(job))
+}
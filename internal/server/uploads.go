@@ -0,0 +1,532 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/storage"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+	"github.com/jo-hoe/gostwriter/internal/util"
+)
+
+// tus 1.0 protocol headers and values.
+const (
+	tusVersion              = "1.0.0"
+	headerTusResumable      = "Tus-Resumable"
+	headerTusVersion        = "Tus-Version"
+	headerTusExtension      = "Tus-Extension"
+	headerTusMaxSize        = "Tus-Max-Size"
+	headerUploadLength      = "Upload-Length"
+	headerUploadOffset      = "Upload-Offset"
+	headerUploadMetadata    = "Upload-Metadata"
+	headerUploadExpires     = "Upload-Expires"
+	contentTypeOffsetOctets = "application/offset+octet-stream"
+)
+
+// HeaderJobID carries the id of the job created from a completed upload.
+const HeaderJobID = "X-Job-Id"
+
+var uploadIDPattern = regexp.MustCompile(`^[a-f0-9-]{36}$`)
+
+// resumableUpload is the state of an upload, stored next to its data as <id>.json. The
+// received offset is the size of the data file <id>.bin.
+type resumableUpload struct {
+	Length      int64             `json:"length"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Actor       string            `json:"actor,omitempty"`
+	AuthorName  string            `json:"author_name,omitempty"`
+	AuthorEmail string            `json:"author_email,omitempty"`
+	JobID       string            `json:"job_id,omitempty"` // set once the upload is complete
+	// Expires is when the upload can no longer be continued and is deleted; zero for
+	// uploads created without an expiry.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// expired reports whether the upload expired before now.
+func (up resumableUpload) expired(now time.Time) bool {
+	return !up.Expires.IsZero() && up.Expires.Before(now)
+}
+
+// uploadLocks serializes requests to the same upload. Entries are removed when an upload
+// completes, is not found or expires.
+var uploadLocks sync.Map // upload id -> *sync.Mutex
+
+// tryLockUpload locks the upload with id unless another request holds it.
+func tryLockUpload(id string) (*sync.Mutex, bool) {
+	lock, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	return mu, mu.TryLock()
+}
+
+func (svc *Service) partialDir() string {
+	return partialDir(svc.Cfg.Server.StorageDir)
+}
+
+func partialDir(storageDir string) string {
+	return filepath.Join(storageDir, common.PartialDirName)
+}
+
+func (svc *Service) uploadPaths(id string) (data, info string) {
+	return uploadPaths(svc.partialDir(), id)
+}
+
+func uploadPaths(dir, id string) (data, info string) {
+	base := filepath.Join(dir, id)
+	return base + ".bin", base + ".json"
+}
+
+// tusHeaders checks the Tus-Resumable header of a request and sets it on the response.
+func tusHeaders(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set(headerTusResumable, tusVersion)
+	if r.Header.Get(headerTusResumable) != tusVersion {
+		w.Header().Set(headerTusVersion, tusVersion)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// handleUploadOptions advertises the supported tus version, extensions and size limit.
+func (svc *Service) handleUploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(headerTusResumable, tusVersion)
+	w.Header().Set(headerTusVersion, tusVersion)
+	w.Header().Set(headerTusExtension, "creation,expiration")
+	if max := safeInt64(svc.Cfg.Server.MaxUploadSize); max > 0 {
+		w.Header().Set(headerTusMaxSize, strconv.FormatInt(max, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateUpload starts an upload of Upload-Length bytes. The job fields (filename,
+// filetype, title, callback_url, callback_events, metadata and the target overrides) are passed in
+// Upload-Metadata and validated here, before any data is sent.
+func (svc *Service) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusHeaders(w, r) {
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get(headerUploadLength), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if max := safeInt64(svc.Cfg.Server.MaxUploadSize); max > 0 && length > max {
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	meta, err := parseUploadMetadata(r.Header.Get(headerUploadMetadata))
+	if err != nil {
+		http.Error(w, "invalid Upload-Metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := storage.CheckImageType(meta["filename"], meta["filetype"]); err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	targetName := svc.defaultTargetName()
+	if targetName == "" {
+		http.Error(w, "no target configured", http.StatusServiceUnavailable)
+		return
+	}
+	if _, err := svc.uploadJob(targetName, meta); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ident, err := svc.Identity.FromRequest(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	up := resumableUpload{Length: length, Metadata: meta, Actor: deref(actorFromContext(r.Context()))}
+	if ident != nil {
+		up.AuthorName, up.AuthorEmail = ident.Name, ident.Email
+	}
+	if expiry := svc.Cfg.Server.ResumableUploadExpiry; expiry > 0 {
+		up.Expires = time.Now().UTC().Add(expiry)
+	}
+	id := util.NewID()
+	if err := svc.createUpload(id, up); err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("create upload", "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", path.Join(common.PathUploads, id))
+	setUploadExpires(w, up)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// setUploadExpires announces when an upload expires, if it does.
+func setUploadExpires(w http.ResponseWriter, up resumableUpload) {
+	if !up.Expires.IsZero() {
+		w.Header().Set(headerUploadExpires, up.Expires.UTC().Format(http.TimeFormat))
+	}
+}
+
+func (svc *Service) createUpload(id string, up resumableUpload) error {
+	if err := os.MkdirAll(svc.partialDir(), 0o750); err != nil {
+		return err
+	}
+	data, _ := svc.uploadPaths(id)
+	f, err := os.OpenFile(data, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) // #nosec G304 - id is generated
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return svc.saveUpload(id, up)
+}
+
+// handleUploadHead reports how much of an upload was received, so a client can resume.
+func (svc *Service) handleUploadHead(w http.ResponseWriter, r *http.Request) {
+	if !tusHeaders(w, r) {
+		return
+	}
+	id := r.PathValue("id")
+	up, offset, err := svc.loadUpload(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(headerUploadLength, strconv.FormatInt(up.Length, 10))
+	w.Header().Set(headerUploadOffset, strconv.FormatInt(offset, 10))
+	setUploadExpires(w, up)
+	if up.JobID != "" {
+		w.Header().Set(HeaderJobID, up.JobID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUploadPatch appends the body at Upload-Offset. Data received before a client
+// disconnects is kept, so the client can resume from the offset reported by HEAD. Once
+// all bytes are received, the job is created and its id returned in X-Job-Id.
+func (svc *Service) handleUploadPatch(w http.ResponseWriter, r *http.Request) {
+	if !tusHeaders(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != contentTypeOffsetOctets {
+		http.Error(w, "content type must be "+contentTypeOffsetOctets, http.StatusUnsupportedMediaType)
+		return
+	}
+	id := r.PathValue("id")
+	if !uploadIDPattern.MatchString(id) {
+		http.NotFound(w, r)
+		return
+	}
+	mu, ok := tryLockUpload(id)
+	if !ok {
+		http.Error(w, "upload is in use", http.StatusLocked)
+		return
+	}
+	defer mu.Unlock()
+
+	up, offset, err := svc.loadUpload(id)
+	if err != nil {
+		uploadLocks.Delete(id)
+		http.NotFound(w, r)
+		return
+	}
+	if got, err := strconv.ParseInt(r.Header.Get(headerUploadOffset), 10, 64); err != nil || got != offset {
+		w.Header().Set(headerUploadOffset, strconv.FormatInt(offset, 10))
+		http.Error(w, "Upload-Offset does not match", http.StatusConflict)
+		return
+	}
+	remaining := up.Length - offset
+	if r.ContentLength > remaining {
+		http.Error(w, "body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if remaining > 0 {
+		n, err := svc.appendUpload(id, r.Body, remaining)
+		offset += n
+		if err != nil {
+			if errors.Is(err, errUploadTooLong) {
+				http.Error(w, "body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if clientGone(r, err) {
+				if svc.Log != nil {
+					svc.Log.Debug("upload chunk aborted by client", "upload_id", id, "offset", offset, "err", err)
+				}
+				return
+			}
+			if svc.Log != nil {
+				svc.Log.Error("append upload", "upload_id", id, "error", err)
+			}
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set(headerUploadOffset, strconv.FormatInt(offset, 10))
+	setUploadExpires(w, up)
+
+	if offset == up.Length && up.JobID == "" {
+		status, err := svc.completeUpload(r, id, &up)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	if up.JobID != "" {
+		w.Header().Set(HeaderJobID, up.JobID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errUploadTooLong = errors.New("body exceeds Upload-Length")
+
+// appendUpload writes up to max bytes of src to the upload's data file and returns how
+// many were written. A body longer than max is rolled back.
+func (svc *Service) appendUpload(id string, src io.Reader, max int64) (int64, error) {
+	data, _ := svc.uploadPaths(id)
+	f, err := os.OpenFile(data, os.O_WRONLY|os.O_APPEND, 0o600) // #nosec G304 - id matched uploadIDPattern
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	start, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, io.LimitReader(src, max))
+	if err != nil {
+		return n, err
+	}
+	if n == max {
+		if extra, _ := src.Read(make([]byte, 1)); extra > 0 {
+			_ = f.Truncate(start)
+			return 0, errUploadTooLong
+		}
+	}
+	return n, f.Sync()
+}
+
+// completeUpload moves the finished upload to the uploads directory and enqueues its job.
+// It returns the HTTP status to answer with on failure.
+func (svc *Service) completeUpload(r *http.Request, id string, up *resumableUpload) (int, error) {
+	data, _ := svc.uploadPaths(id)
+	targetName := svc.defaultTargetName()
+	job, err := svc.uploadJob(targetName, up.Metadata)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	src, err := os.Open(data) // #nosec G304 - id matched uploadIDPattern
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("internal error")
+	}
+	imgPath, cleanup, mimeType, err := svc.Uploader.SaveImageStream(src, up.Metadata["filename"], up.Metadata["filetype"], up.Length)
+	_ = src.Close()
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("upload failed: %w", err)
+	}
+
+	job.ImagePath, job.MimeType = imgPath, mimeType
+	job.Actor = parseOptionalString(up.Actor)
+	job.AuthorName = parseOptionalString(up.AuthorName)
+	job.AuthorEmail = parseOptionalString(up.AuthorEmail)
+	if err := svc.Store.CreateJob(&job); err != nil {
+		_ = cleanup()
+		if svc.Log != nil {
+			svc.Log.Error("persist job", "error", err)
+		}
+		return http.StatusInternalServerError, errors.New("internal error")
+	}
+	if err := svc.Queue.Enqueue(jobs.WorkItem{Job: job, Cleanup: svc.processedCleanup(cleanup), TraceParent: tracing.Traceparent(r.Context())}); err != nil {
+		_ = cleanup()
+		_ = svc.Store.SaveError(job.ID, "queue full", time.Now().UTC())
+		return http.StatusServiceUnavailable, errors.New("queue full, try later")
+	}
+
+	// The data is in the uploads directory now; keep the state so HEAD still reports the job.
+	up.JobID = job.ID
+	if err := svc.saveUpload(id, *up); err != nil && svc.Log != nil {
+		svc.Log.Warn("save upload state", "upload_id", id, "err", err)
+	}
+	_ = os.Remove(data)
+	uploadLocks.Delete(id)
+	if svc.Log != nil {
+		svc.Log.Info("job enqueued from resumable upload", "job_id", job.ID, "upload_id", id)
+	}
+	return 0, nil
+}
+
+// uploadJob builds the job for an upload from its metadata, validating the fields.
+func (svc *Service) uploadJob(targetName string, meta map[string]string) (jobs.Job, error) {
+	values := url.Values{}
+	for k, v := range meta {
+		values.Set(k, v)
+	}
+	callbackURL, err := svc.parseCallbackURL(values.Get("callback_url"))
+	if err != nil {
+		return jobs.Job{}, fmt.Errorf("invalid callback_url: %w", err)
+	}
+	callbackEvents, err := parseCallbackEvents(values.Get("callback_events"))
+	if err != nil {
+		return jobs.Job{}, fmt.Errorf("invalid callback_events: %w", err)
+	}
+	metadata, err := parseOptionalJSONMap(values.Get("metadata"))
+	if err != nil {
+		return jobs.Job{}, errors.New("invalid metadata json")
+	}
+	branch, basePath, err := svc.parseTargetOverrides(values)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	return jobs.Job{
+		ID:             util.NewID(),
+		TargetName:     targetName,
+		Targets:        svc.jobTargets(),
+		CallbackURL:    callbackURL,
+		CallbackEvents: callbackEvents,
+		Title:          parseOptionalString(values.Get("title")),
+		Metadata:       metadata,
+		Debug:          svc.sampleDebug(),
+		Stage:          jobs.StageQueued,
+		CreatedAt:      time.Now().UTC(),
+		TargetBranch:   branch,
+		TargetBasePath: basePath,
+	}, nil
+}
+
+// loadUpload returns the state of an upload and the number of bytes received. Expired
+// uploads are reported as not existing, even before the janitor deletes them.
+func (svc *Service) loadUpload(id string) (resumableUpload, int64, error) {
+	var up resumableUpload
+	if !uploadIDPattern.MatchString(id) {
+		return up, 0, os.ErrNotExist
+	}
+	data, info := svc.uploadPaths(id)
+	up, err := readUploadState(info)
+	if err != nil {
+		return up, 0, err
+	}
+	if up.expired(time.Now()) {
+		return up, 0, os.ErrNotExist
+	}
+	if up.JobID != "" {
+		return up, up.Length, nil
+	}
+	st, err := os.Stat(data)
+	if err != nil {
+		return up, 0, err
+	}
+	return up, st.Size(), nil
+}
+
+func readUploadState(info string) (resumableUpload, error) {
+	var up resumableUpload
+	b, err := os.ReadFile(info) // #nosec G304 - callers pass the state file of a valid upload id
+	if err != nil {
+		return up, err
+	}
+	err = json.Unmarshal(b, &up)
+	return up, err
+}
+
+// ExpireUploads deletes the resumable uploads below storageDir that expired before now,
+// complete or not, and returns how many were deleted. Uploads without an expiry expire
+// expiry after their state was last written. Uploads a request is working on are left
+// for the next run.
+func ExpireUploads(storageDir string, expiry time.Duration, now time.Time) (int, error) {
+	dir := partialDir(storageDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	var errs []error
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !uploadIDPattern.MatchString(id) {
+			continue
+		}
+		mu, ok := tryLockUpload(id)
+		if !ok {
+			continue
+		}
+		gone, err := expireUpload(dir, id, expiry, now)
+		if gone {
+			uploadLocks.Delete(id)
+			deleted++
+		}
+		mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upload %s: %w", id, err))
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// expireUpload deletes the files of the upload if it expired and reports whether it did.
+func expireUpload(dir, id string, expiry time.Duration, now time.Time) (bool, error) {
+	data, info := uploadPaths(dir, id)
+	up, err := readUploadState(info)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err == nil && up.Expires.IsZero() {
+		st, err := os.Stat(info)
+		if err != nil || expiry <= 0 || st.ModTime().Add(expiry).After(now) {
+			return false, err
+		}
+	} else if err == nil && !up.expired(now) {
+		return false, nil
+	}
+	// Unreadable state is deleted as well; the upload could not be continued anyway.
+	if err := os.Remove(data); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if err := os.Remove(info); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	return true, nil
+}
+
+func (svc *Service) saveUpload(id string, up resumableUpload) error {
+	b, err := json.Marshal(up)
+	if err != nil {
+		return err
+	}
+	_, info := svc.uploadPaths(id)
+	return os.WriteFile(info, b, 0o600)
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated pairs of a key
+// and an optional base64 value.
+func parseUploadMetadata(h string) (map[string]string, error) {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(h, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, enc, _ := strings.Cut(pair, " ")
+		v, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+		if err != nil {
+			return nil, fmt.Errorf("value of %q is not base64", key)
+		}
+		meta[key] = string(v)
+	}
+	return meta, nil
+}
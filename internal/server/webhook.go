@@ -0,0 +1,114 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/common"
+	"github.com/jo-hoe/gostwriter/internal/ghwebhook"
+	"github.com/jo-hoe/gostwriter/internal/jobs"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+	"github.com/jo-hoe/gostwriter/internal/util"
+)
+
+// maxWebhookPayload is the largest payload GitHub delivers (25 MB).
+const maxWebhookPayload = 25 << 20
+
+// handleGitHubWebhook creates a job from a newly opened issue or a new issue comment with
+// an image attachment. Deliveries authenticate with their signature instead of the API key
+// and are always processed asynchronously, as GitHub expects a response within seconds.
+func (svc *Service) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if !ghwebhook.VerifySignature(svc.Cfg.Server.GitHubWebhook.Secret, body, r.Header.Get(common.HeaderGitHubSig256)) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	sub, err := ghwebhook.Parse(r.Header.Get(common.HeaderGitHubEvent), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sub == nil {
+		// Pings, other events and bodies without an attachment are acknowledged and dropped.
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	targetName := svc.defaultTargetName()
+	if targetName == "" || svc.GitHubWebhook == nil {
+		http.Error(w, "no target configured", http.StatusServiceUnavailable)
+		return
+	}
+	if svc.queueSaturated() {
+		w.Header().Set(common.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(svc.Cfg.Server.QueueRetryAfter)))
+		http.Error(w, "too many queued jobs, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	src, contentType, err := svc.GitHubWebhook.FetchImage(r.Context(), sub.ImageURL)
+	if err != nil {
+		if svc.Log != nil {
+			svc.Log.Warn("github webhook image download failed", "url", sub.ImageURL, "err", err)
+		}
+		http.Error(w, "image download failed", http.StatusBadGateway)
+		return
+	}
+	imgPath, cleanup, mimeType, err := svc.Uploader.SaveImageStream(src, path.Base(sub.ImageURL), contentType, safeInt64(svc.Cfg.Server.MaxUploadSize))
+	_ = src.Close()
+	if err != nil {
+		http.Error(w, "upload failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		if cleanup != nil {
+			_ = cleanup()
+		}
+	}()
+
+	jobID := util.NewID()
+	job := jobs.Job{
+		ID:         jobID,
+		ImagePath:  imgPath,
+		MimeType:   mimeType,
+		TargetName: targetName,
+		Targets:    svc.jobTargets(),
+		Title:      parseOptionalString(sub.Title),
+		Metadata: map[string]any{
+			"github_repository": sub.Repository,
+			"github_issue":      sub.Issue,
+			"github_sender":     sub.Sender,
+		},
+		Debug:     svc.sampleDebug(),
+		Stage:     jobs.StageQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+	if svc.Cfg.Server.GitHubWebhook.CommentOnCompletion {
+		job.CommentsURL = parseOptionalString(sub.CommentsURL)
+	}
+	if err := svc.Store.CreateJob(&job); err != nil {
+		if svc.Log != nil {
+			svc.Log.Error("persist job", "error", err)
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := svc.Queue.Enqueue(jobs.WorkItem{Job: job, Cleanup: svc.processedCleanup(cleanup), TraceParent: tracing.Traceparent(r.Context())}); err != nil {
+		http.Error(w, "queue full, try later", http.StatusServiceUnavailable)
+		return
+	}
+	cleanup = nil
+	if svc.Log != nil {
+		svc.Log.Info("job enqueued from github webhook", "job_id", jobID, "repository", sub.Repository, "issue", sub.Issue)
+	}
+	writeJSON(w, http.StatusAccepted, createResponse{
+		JobID:     jobID,
+		StatusURL: path.Join(common.PathTranscriptions, jobID),
+	})
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/config"
+)
+
+// S3Scheme prefixes the image paths of uploads stored in S3: s3://bucket/key.
+const S3Scheme = "s3://"
+
+// S3Uploader stores uploads as objects in an S3-compatible bucket, so any instance
+// sharing the bucket can read them back with Open.
+type S3Uploader struct {
+	cfg    config.S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Uploader creates an uploader for the bucket of c. A nil client uses
+// http.DefaultClient.
+func NewS3Uploader(c config.S3Config, client *http.Client) *S3Uploader {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Uploader{cfg: c, client: client, now: time.Now}
+}
+
+// SaveMultipartImage validates and stores an uploaded image (png/jpg) in the bucket.
+// Return values match LocalUploader.SaveMultipartImage, with an s3:// path.
+func (u *S3Uploader) SaveMultipartImage(fileHeader *multipart.FileHeader, maxBytes int64) (string, func() error, string, error) {
+	if fileHeader == nil {
+		return "", nil, "", fmt.Errorf("no file provided")
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		return "", nil, "", fmt.Errorf("open uploaded file: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+	return u.SaveImageStream(src, fileHeader.Filename, fileHeader.Header.Get("Content-Type"), maxBytes)
+}
+
+// SaveImageStream validates and stores an image read from src in the bucket. The image
+// is spooled to a temporary file first, since S3 needs its length and hash up front.
+// Return values match LocalUploader.SaveImageStream, with an s3:// path.
+func (u *S3Uploader) SaveImageStream(src io.Reader, filename, contentType string, maxBytes int64) (string, func() error, string, error) {
+	if src == nil {
+		return "", nil, "", fmt.Errorf("no file provided")
+	}
+	mimeType := resolveMime(contentType, filename)
+	if !isAllowedImageMime(mimeType) {
+		return "", nil, "", fmt.Errorf("unsupported content type: %s", mimeType)
+	}
+
+	spool, err := os.CreateTemp("", "gostwriter-upload-*")
+	if err != nil {
+		return "", nil, "", fmt.Errorf("create spool file: %w", err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(spool, h), io.LimitReader(src, maxBytes))
+	if err != nil {
+		return "", nil, "", fmt.Errorf("copy upload: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return "", nil, "", fmt.Errorf("rewind spool file: %w", err)
+	}
+
+	key := u.cfg.Prefix + randomHex(16) + pickExtension(mimeType, filename)
+	resp, err := u.do(http.MethodPut, key, nil, spool, n, hex.EncodeToString(h.Sum(nil)), mimeType)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("put object: %w", err)
+	}
+	_ = resp.Body.Close()
+
+	path := S3Scheme + u.cfg.Bucket + "/" + key
+	cleanup := func() error {
+		return u.Delete(path)
+	}
+	return path, cleanup, mimeType, nil
+}
+
+// Open returns the content of the object at path, an s3:// path returned by
+// SaveImageStream. A missing object yields an error wrapping fs.ErrNotExist.
+func (u *S3Uploader) Open(path string) (io.ReadCloser, error) {
+	key, err := u.key(path)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.do(http.MethodGet, key, nil, nil, 0, emptyPayloadHash, "")
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object at path. A missing object is not an error.
+func (u *S3Uploader) Delete(path string) error {
+	key, err := u.key(path)
+	if err != nil {
+		return err
+	}
+	resp, err := u.do(http.MethodDelete, key, nil, nil, 0, emptyPayloadHash, "")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// listBucketResult is the part of a ListObjectsV2 response used by RemoveAll.
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// RemoveAll deletes all objects under the configured prefix and returns how many were
+// removed.
+func (u *S3Uploader) RemoveAll() (int, error) {
+	n := 0
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {u.cfg.Prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := u.do(http.MethodGet, "", q, nil, 0, emptyPayloadHash, "")
+		if err != nil {
+			return n, fmt.Errorf("list objects: %w", err)
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return n, fmt.Errorf("decode object list: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if err := u.Delete(S3Scheme + u.cfg.Bucket + "/" + obj.Key); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return n, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// key returns the object key of an s3:// path in the configured bucket.
+func (u *S3Uploader) key(path string) (string, error) {
+	key, ok := strings.CutPrefix(path, S3Scheme+u.cfg.Bucket+"/")
+	if !ok || key == "" {
+		return "", fmt.Errorf("not an object of bucket %s: %s", u.cfg.Bucket, path)
+	}
+	return key, nil
+}
+
+// objectURL returns the URL of key, or of the bucket if key is empty.
+func (u *S3Uploader) objectURL(key string, q url.Values) (*url.URL, error) {
+	base, err := url.Parse(strings.TrimRight(u.cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	obj := *base
+	if u.cfg.PathStyle {
+		obj.Path = base.Path + "/" + u.cfg.Bucket
+		if key != "" {
+			obj.Path += "/" + key
+		}
+	} else {
+		obj.Host = u.cfg.Bucket + "." + base.Host
+		obj.Path = base.Path + "/" + key
+	}
+	obj.RawPath = awsEscape(obj.Path, false)
+	obj.RawQuery = canonicalQuery(q)
+	return &obj, nil
+}
+
+// do sends a signed request for key and returns the response of a 2xx status. Other
+// statuses are returned as errors, 404 wrapping fs.ErrNotExist.
+func (u *S3Uploader) do(method, key string, q url.Values, body io.Reader, length int64, payloadHash, contentType string) (*http.Response, error) {
+	target, err := u.objectURL(key, q)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signV4(req, u.cfg.AccessKeyID, u.cfg.SecretAccessKey, u.cfg.Region, payloadHash, u.now())
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s %s: %w", method, key, fs.ErrNotExist)
+	}
+	return nil, fmt.Errorf("%s %s: status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(msg)))
+}
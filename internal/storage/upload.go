@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime"
 	"mime/multipart"
 	"os"
@@ -15,51 +19,148 @@ import (
 	"github.com/jo-hoe/gostwriter/internal/common"
 )
 
-// Uploader handles storing temporary uploads on disk.
-type Uploader struct {
+// Uploader stores uploaded images until their jobs are processed. The returned path
+// is kept as the job image path; the cleanup func deletes the stored image.
+type Uploader interface {
+	SaveMultipartImage(fileHeader *multipart.FileHeader, maxBytes int64) (string, func() error, string, error)
+	SaveImageStream(src io.Reader, filename, contentType string, maxBytes int64) (string, func() error, string, error)
+	// RemoveAll deletes all stored uploads and returns how many were removed.
+	RemoveAll() (int, error)
+}
+
+// ImageStore reads and deletes stored job images, wherever the configured Uploader put
+// them, so the worker and cleanup do not depend on the backend.
+type ImageStore interface {
+	// Open returns the content of the image at path. A missing image yields an error
+	// wrapping fs.ErrNotExist.
+	Open(path string) (io.ReadCloser, error)
+	// Delete removes the image at path. A missing image is not an error.
+	Delete(path string) error
+}
+
+// LocalImages is the ImageStore of images on local disk.
+type LocalImages struct{}
+
+// Open opens the image file at path.
+func (LocalImages) Open(path string) (io.ReadCloser, error) {
+	return os.Open(filepath.Clean(path)) // #nosec G304 - path was created by the uploader
+}
+
+// Delete removes the image file at path.
+func (LocalImages) Delete(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// LocalUploader handles storing temporary uploads on disk.
+type LocalUploader struct {
+	LocalImages
 	baseDir string
 }
 
+var (
+	_ Uploader   = (*LocalUploader)(nil)
+	_ Uploader   = (*S3Uploader)(nil)
+	_ ImageStore = LocalImages{}
+	_ ImageStore = (*LocalUploader)(nil)
+	_ ImageStore = (*S3Uploader)(nil)
+)
+
 var allowedImageMimes = map[string]string{
 	common.MimeImagePNG:  ".png",
 	common.MimeImageJPEG: ".jpg",
 	common.MimeImageJPG:  ".jpg",
 }
 
-// NewUploader creates an uploader that stores to baseDir/uploads.
-func NewUploader(baseDir string) *Uploader {
-	return &Uploader{baseDir: filepath.Join(baseDir, common.UploadsDirName)}
+// NewLocalUploader creates an uploader that stores to baseDir/uploads.
+func NewLocalUploader(baseDir string) *LocalUploader {
+	return &LocalUploader{baseDir: filepath.Join(baseDir, common.UploadsDirName)}
 }
 
 // SaveMultipartImage validates and stores an uploaded image (png/jpg) to disk.
 // It returns the absolute file path and a cleanup function to delete the file.
 // The caller should always invoke the cleanup function when the file is no longer needed.
-func (u *Uploader) SaveMultipartImage(fileHeader *multipart.FileHeader, maxBytes int64) (string, func() error, string, error) {
+func (u *LocalUploader) SaveMultipartImage(fileHeader *multipart.FileHeader, maxBytes int64) (string, func() error, string, error) {
 	if fileHeader == nil {
 		return "", nil, "", fmt.Errorf("no file provided")
 	}
-	mimeType := fileHeader.Header.Get("Content-Type")
-	// Some clients set application/octet-stream for uploads; treat it as unknown and fall back to extension.
-	if mimeType == "" || strings.EqualFold(strings.TrimSpace(mimeType), "application/octet-stream") {
-		// Fallback: try to detect by extension
-		ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
-		mimeType = mime.TypeByExtension(ext)
-	}
+	mimeType := resolveMime(fileHeader.Header.Get("Content-Type"), fileHeader.Filename)
 	if !isAllowedImageMime(mimeType) {
 		return "", nil, "", fmt.Errorf("unsupported content type: %s", mimeType)
 	}
 
-	if err := os.MkdirAll(u.baseDir, 0o750); err != nil {
-		return "", nil, "", fmt.Errorf("ensure uploads dir: %w", err)
-	}
-
 	src, err := fileHeader.Open()
 	if err != nil {
 		return "", nil, "", fmt.Errorf("open uploaded file: %w", err)
 	}
 	defer func() { _ = src.Close() }()
 
-	ext := pickExtension(mimeType, fileHeader.Filename)
+	return u.writeImage(src, mimeType, fileHeader.Filename, maxBytes)
+}
+
+// SaveImageStream validates and stores an image read directly from src (e.g., a multipart part)
+// without buffering it in memory. contentType and filename are used to determine the mime type.
+// Return values match SaveMultipartImage.
+func (u *LocalUploader) SaveImageStream(src io.Reader, filename, contentType string, maxBytes int64) (string, func() error, string, error) {
+	if src == nil {
+		return "", nil, "", fmt.Errorf("no file provided")
+	}
+	mimeType := resolveMime(contentType, filename)
+	if !isAllowedImageMime(mimeType) {
+		return "", nil, "", fmt.Errorf("unsupported content type: %s", mimeType)
+	}
+	return u.writeImage(src, mimeType, filename, maxBytes)
+}
+
+// SaveBase64Image decodes a standard base64 encoded image of mimeType and stores it
+// through u like SaveImageStream. Return values match SaveMultipartImage.
+func SaveBase64Image(u Uploader, data, mimeType string, maxBytes int64) (string, func() error, string, error) {
+	if !isAllowedImageMime(mimeType) {
+		return "", nil, "", fmt.Errorf("unsupported content type: %s", mimeType)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return "", nil, "", fmt.Errorf("invalid base64: %w", err)
+	}
+	if len(raw) == 0 {
+		return "", nil, "", fmt.Errorf("no file provided")
+	}
+	if int64(len(raw)) > maxBytes {
+		return "", nil, "", fmt.Errorf("image exceeds %d bytes", maxBytes)
+	}
+	return u.SaveImageStream(bytes.NewReader(raw), "", mimeType, maxBytes)
+}
+
+// CheckImageType returns the error SaveImageStream would return for an upload named
+// filename with contentType, so callers can refuse it before receiving the data.
+func CheckImageType(filename, contentType string) error {
+	if mimeType := resolveMime(contentType, filename); !isAllowedImageMime(mimeType) {
+		return fmt.Errorf("unsupported content type: %s", mimeType)
+	}
+	return nil
+}
+
+// resolveMime returns the declared content type, falling back to the file extension
+// when it is missing or generic.
+func resolveMime(contentType, filename string) string {
+	mimeType := contentType
+	// Some clients set application/octet-stream for uploads; treat it as unknown and fall back to extension.
+	if mimeType == "" || strings.EqualFold(strings.TrimSpace(mimeType), "application/octet-stream") {
+		// Fallback: try to detect by extension
+		ext := strings.ToLower(filepath.Ext(filename))
+		mimeType = mime.TypeByExtension(ext)
+	}
+	return mimeType
+}
+
+func (u *LocalUploader) writeImage(src io.Reader, mimeType, original string, maxBytes int64) (string, func() error, string, error) {
+	if err := os.MkdirAll(u.baseDir, 0o750); err != nil {
+		return "", nil, "", fmt.Errorf("ensure uploads dir: %w", err)
+	}
+
+	ext := pickExtension(mimeType, original)
 	filename := fmt.Sprintf("%s%s", randomHex(16), ext)
 	dstPath := filepath.Join(u.baseDir, filename)
 	// Ensure the destination path stays within the base uploads directory to prevent path traversal.
@@ -107,6 +208,34 @@ func pickExtension(mimeType, original string) string {
 	return ext
 }
 
+// RemoveAll deletes all stored uploads and returns how many files were removed.
+func (u *LocalUploader) RemoveAll() (int, error) {
+	return RemoveFiles(u.baseDir)
+}
+
+// RemoveFiles deletes the regular files directly in dir and returns how many were
+// removed. A missing dir counts as empty.
+func RemoveFiles(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read dir: %w", err)
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return n, fmt.Errorf("remove %s: %w", e.Name(), err)
+		}
+		n++
+	}
+	return n, nil
+}
+
 func randomHex(n int) string {
 	b := make([]byte, n)
 	_, _ = rand.Read(b)
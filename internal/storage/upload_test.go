@@ -47,7 +47,7 @@ func makeMultipartFile(t *testing.T, filename string, contentType string, conten
 
 func TestUploader_SaveMultipartImage_PNG(t *testing.T) {
 	tmp := t.TempDir()
-	up := NewUploader(tmp)
+	up := NewLocalUploader(tmp)
 
 	_, fh := makeMultipartFile(t, "image.png", "image/png", []byte("pngdata"))
 	path, cleanup, mime, err := up.SaveMultipartImage(fh, 10*1024*1024)
@@ -74,7 +74,7 @@ func TestUploader_SaveMultipartImage_PNG(t *testing.T) {
 
 func TestUploader_SaveMultipartImage_JPEG_ByExtension(t *testing.T) {
 	tmp := t.TempDir()
-	up := NewUploader(tmp)
+	up := NewLocalUploader(tmp)
 
 	// No explicit content-type header; rely on extension detection
 	req, fh := makeMultipartFile(t, "photo.jpg", "", []byte("jpgdata"))
@@ -100,7 +100,7 @@ func TestUploader_SaveMultipartImage_JPEG_ByExtension(t *testing.T) {
 
 func TestUploader_SaveMultipartImage_RejectsUnsupported(t *testing.T) {
 	tmp := t.TempDir()
-	up := NewUploader(tmp)
+	up := NewLocalUploader(tmp)
 
 	_, fh := makeMultipartFile(t, "doc.txt", "text/plain", []byte("text"))
 	_, _, _, err := up.SaveMultipartImage(fh, 1024)
@@ -111,7 +111,7 @@ func TestUploader_SaveMultipartImage_RejectsUnsupported(t *testing.T) {
 
 func TestUploader_RespectsMaxBytes(t *testing.T) {
 	tmp := t.TempDir()
-	up := NewUploader(tmp)
+	up := NewLocalUploader(tmp)
 
 	// Create file larger than limit
 	large := bytes.Repeat([]byte("x"), 4096)
@@ -135,7 +135,7 @@ func TestUploader_RespectsMaxBytes(t *testing.T) {
 
 func TestUploader_CleanupRemovesFile(t *testing.T) {
 	tmp := t.TempDir()
-	up := NewUploader(tmp)
+	up := NewLocalUploader(tmp)
 
 	_, fh := makeMultipartFile(t, "keep.png", "image/png", []byte("png"))
 	path, cleanup, _, err := up.SaveMultipartImage(fh, 10*1024*1024)
@@ -155,3 +155,64 @@ func TestUploader_CleanupRemovesFile(t *testing.T) {
 		t.Fatalf("file still exists after cleanup")
 	}
 }
+
+func TestUploader_SaveImageStream(t *testing.T) {
+	tmp := t.TempDir()
+	up := NewLocalUploader(tmp)
+
+	path, cleanup, mime, err := up.SaveImageStream(bytes.NewReader([]byte("pngdata")), "scan.png", "", 10*1024*1024)
+	if err != nil {
+		t.Fatalf("SaveImageStream: %v", err)
+	}
+	defer func() { _ = cleanup() }()
+	if mime != "image/png" {
+		t.Fatalf("mime = %q", mime)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "pngdata" {
+		t.Fatalf("stored content mismatch: %q, %v", data, err)
+	}
+
+	if _, _, _, err := up.SaveImageStream(bytes.NewReader([]byte("x")), "doc.txt", "text/plain", 1024); err == nil {
+		t.Fatalf("expected error for unsupported mime")
+	}
+}
+
+func TestCheckImageType(t *testing.T) {
+	if err := CheckImageType("scan.jpg", "application/octet-stream"); err != nil {
+		t.Fatalf("jpg by extension: %v", err)
+	}
+	if err := CheckImageType("", "image/png"); err != nil {
+		t.Fatalf("png by content type: %v", err)
+	}
+	if err := CheckImageType("doc.pdf", ""); err == nil {
+		t.Fatalf("expected pdf to be rejected")
+	}
+}
+
+func TestSaveBase64Image(t *testing.T) {
+	up := NewLocalUploader(t.TempDir())
+	path, cleanup, mime, err := SaveBase64Image(up, "cG5nZGF0YQ==", "image/png", 1024)
+	if err != nil {
+		t.Fatalf("SaveBase64Image: %v", err)
+	}
+	defer func() { _ = cleanup() }()
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "pngdata" || mime != "image/png" {
+		t.Fatalf("stored %q (%s), %v", data, mime, err)
+	}
+
+	for _, tc := range []struct{ data, mime string }{
+		{"not base64!", "image/png"},
+		{"cG5nZGF0YQ==", "image/gif"},
+		{"cG5nZGF0YQ==", ""},
+		{"", "image/png"},
+	} {
+		if _, _, _, err := SaveBase64Image(up, tc.data, tc.mime, 1024); err == nil {
+			t.Fatalf("expected %q (%s) to be rejected", tc.data, tc.mime)
+		}
+	}
+	if _, _, _, err := SaveBase64Image(up, "cG5nZGF0YQ==", "image/png", 4); err == nil {
+		t.Fatalf("expected image above maxBytes to be rejected")
+	}
+}
@@ -0,0 +1,304 @@
+package confluence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+)
+
+// Target implements a Confluence target that publishes the transcription as a page
+// using the Confluence REST API. A page with the same title in the configured space
+// is updated (new version) instead of creating a duplicate.
+type Target struct {
+	name string
+	cfg  appcfg.ConfluenceTargetConfig
+	http *http.Client
+
+	// a successful validation is cached so repeated checks do not hit the API again
+	validated targets.ValidationCache
+}
+
+var (
+	_ targets.Validator = (*Target)(nil)
+	_ targets.Viewer    = (*Target)(nil)
+)
+
+// New creates a Confluence Target with the provided config.
+// Uses http.DefaultClient unless a custom client is provided via WithHTTPClient.
+func New(name string, cfg appcfg.ConfluenceTargetConfig) (*Target, error) {
+	if strings.TrimSpace(cfg.Auth.Token) == "" {
+		return nil, fmt.Errorf("confluence token must not be empty")
+	}
+	if strings.TrimSpace(cfg.BaseURL) == "" {
+		return nil, fmt.Errorf("confluence base url must not be empty")
+	}
+	if strings.TrimSpace(cfg.SpaceKey) == "" {
+		return nil, fmt.Errorf("confluence space key must not be empty")
+	}
+	cfg.BaseURL = strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	return &Target{
+		name: name,
+		cfg:  cfg,
+		http: http.DefaultClient,
+	}, nil
+}
+
+// WithHTTPClient allows tests to inject a custom HTTP client (e.g., pointing to httptest.Server).
+func (t *Target) WithHTTPClient(c *http.Client) *Target {
+	t.http = c
+	return t
+}
+
+func (t *Target) Name() string { return t.name }
+
+// Post creates the page, or adds a new version when a page with the rendered title
+// already exists in the space. Location is the page URL; Commit is "<page id>@v<version>".
+func (t *Target) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
+	title, err := t.renderTitle(req)
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+
+	existing, err := t.findPage(ctx, title)
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+
+	payload := pagePayload{
+		Type:  "page",
+		Title: title,
+		Space: spaceRef{Key: t.cfg.SpaceKey},
+		Body: pageBody{Storage: storageValue{
+			Value:          toStorageFormat(req.Markdown),
+			Representation: "storage",
+		}},
+	}
+	if t.cfg.ParentPageID != "" {
+		payload.Ancestors = []ancestorRef{{ID: t.cfg.ParentPageID}}
+	}
+
+	method, u := http.MethodPost, t.cfg.BaseURL+"/rest/api/content"
+	if existing != nil {
+		// Updates must carry the next version number or Confluence rejects them with 409.
+		method, u = http.MethodPut, t.cfg.BaseURL+"/rest/api/content/"+url.PathEscape(existing.ID)
+		payload.ID = existing.ID
+		payload.Version = &versionRef{Number: existing.Version.Number + 1}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return targets.TargetResult{}, fmt.Errorf("marshal payload: %w", err)
+	}
+	httpReq, err := t.newAPIRequest(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	var out contentResponse
+	if err := t.do(httpReq, &out); err != nil {
+		return targets.TargetResult{}, err
+	}
+
+	return targets.TargetResult{
+		TargetName: t.name,
+		Location:   t.pageURL(out.Links),
+		Commit:     fmt.Sprintf("%s@v%d", out.ID, out.Version.Number),
+	}, nil
+}
+
+// ViewURL returns the location itself, which already is the page URL.
+func (t *Target) ViewURL(location string) (string, bool) {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return "", false
+	}
+	return location, true
+}
+
+// Validate checks that the configured space exists and is reachable with the configured
+// credentials. A success is cached; transient failures are tried again.
+func (t *Target) Validate(ctx context.Context) error {
+	return t.validated.Check(ctx, func() error {
+		req, err := t.newAPIRequest(ctx, http.MethodGet, t.cfg.BaseURL+"/rest/api/space/"+url.PathEscape(t.cfg.SpaceKey), nil)
+		if err != nil {
+			return err
+		}
+		if err := t.do(req, nil); err != nil {
+			return fmt.Errorf("space %s: %w", t.cfg.SpaceKey, err)
+		}
+		return nil
+	})
+}
+
+// findPage looks up a page by exact title in the configured space; nil if none exists.
+func (t *Target) findPage(ctx context.Context, title string) (*contentResponse, error) {
+	q := url.Values{}
+	q.Set("spaceKey", t.cfg.SpaceKey)
+	q.Set("title", title)
+	q.Set("type", "page")
+	q.Set("expand", "version")
+	req, err := t.newAPIRequest(ctx, http.MethodGet, t.cfg.BaseURL+"/rest/api/content?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out searchResponse
+	if err := t.do(req, &out); err != nil {
+		return nil, fmt.Errorf("find page: %w", err)
+	}
+	if len(out.Results) == 0 {
+		return nil, nil
+	}
+	return &out.Results[0], nil
+}
+
+// do performs req and decodes a successful JSON response into out (if non-nil).
+func (t *Target) do(req *http.Request, out any) error {
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return targets.Transient(fmt.Errorf("confluence request: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr apiError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		err := fmt.Errorf("confluence api: status %d", resp.StatusCode)
+		if apiErr.Message != "" {
+			err = fmt.Errorf("confluence api: status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		if targets.IsTransientStatus(resp.StatusCode) {
+			return targets.Transient(err)
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// newAPIRequest builds a request carrying the auth headers. With an email configured
+// basic auth is used (Confluence Cloud API tokens); otherwise the token is sent as a
+// bearer token (Data Center personal access tokens).
+func (t *Target) newAPIRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	if t.cfg.Auth.Email != "" {
+		req.SetBasicAuth(t.cfg.Auth.Email, t.cfg.Auth.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+t.cfg.Auth.Token)
+	}
+	req.Header.Set("Accept", "application/json")
+	tracing.Inject(ctx, req.Header)
+	return req, nil
+}
+
+// pageURL builds the browser URL of a page from the response links, falling back to
+// the configured base URL when the response carries no base.
+func (t *Target) pageURL(l links) string {
+	base := l.Base
+	if base == "" {
+		base = t.cfg.BaseURL
+	}
+	return strings.TrimRight(base, "/") + l.WebUI
+}
+
+func (t *Target) renderTitle(req targets.TargetRequest) (string, error) {
+	title := ""
+	if req.SuggestedTitle != nil {
+		title = strings.TrimSpace(*req.SuggestedTitle)
+	}
+	if title == "" {
+		title = fmt.Sprintf("Transcription %s", req.JobID)
+	}
+	s := strings.TrimSpace(t.cfg.TitleTemplate)
+	if s == "" {
+		return title, nil
+	}
+	tpl, err := template.New("title").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("parse title template: %w", err)
+	}
+	var buf bytes.Buffer
+	data := map[string]any{
+		"JobID":          req.JobID,
+		"Timestamp":      req.Timestamp,
+		"SuggestedTitle": req.SuggestedTitle,
+		"Title":          title,
+		"Actor":          req.Actor,
+		"Metadata":       req.Metadata,
+	}
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render title: %w", err)
+	}
+	if out := strings.TrimSpace(buf.String()); out != "" {
+		return out, nil
+	}
+	return title, nil
+}
+
+// Payload and response structures
+
+type spaceRef struct {
+	Key string `json:"key"`
+}
+
+type ancestorRef struct {
+	ID string `json:"id"`
+}
+
+type versionRef struct {
+	Number int `json:"number"`
+}
+
+type storageValue struct {
+	Value          string `json:"value"`
+	Representation string `json:"representation"`
+}
+
+type pageBody struct {
+	Storage storageValue `json:"storage"`
+}
+
+type pagePayload struct {
+	ID        string        `json:"id,omitempty"`
+	Type      string        `json:"type"`
+	Title     string        `json:"title"`
+	Space     spaceRef      `json:"space"`
+	Ancestors []ancestorRef `json:"ancestors,omitempty"`
+	Body      pageBody      `json:"body"`
+	Version   *versionRef   `json:"version,omitempty"`
+}
+
+type links struct {
+	Base  string `json:"base"`
+	WebUI string `json:"webui"`
+}
+
+type contentResponse struct {
+	ID      string     `json:"id"`
+	Version versionRef `json:"version"`
+	Links   links      `json:"_links"`
+}
+
+type searchResponse struct {
+	Results []contentResponse `json:"results"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+}
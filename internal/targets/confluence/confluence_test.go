@@ -0,0 +1,143 @@
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+func newTestTarget(t *testing.T, srv *httptest.Server) *Target {
+	t.Helper()
+	tg, err := New("confluence", appcfg.ConfluenceTargetConfig{
+		BaseURL:      srv.URL,
+		SpaceKey:     "DOC",
+		ParentPageID: "42",
+		Auth:         appcfg.ConfluenceAuthConfig{Email: "me@example.com", Token: "tok"},
+	})
+	if err != nil {
+		t.Fatalf("New confluence target: %v", err)
+	}
+	return tg.WithHTTPClient(srv.Client())
+}
+
+func TestPost_CreatesPage(t *testing.T) {
+	var created map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "me@example.com" || pass != "tok" {
+			t.Errorf("missing basic auth")
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/content":
+			if r.URL.Query().Get("title") != "Notes" || r.URL.Query().Get("spaceKey") != "DOC" {
+				t.Errorf("unexpected search query: %s", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"results": []any{}})
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/content":
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id":      "1001",
+				"version": map[string]any{"number": 1},
+				"_links":  map[string]any{"base": "https://wiki.example.com", "webui": "/spaces/DOC/pages/1001"},
+			})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	title := "Notes"
+	res, err := newTestTarget(t, srv).Post(context.Background(), targets.TargetRequest{
+		JobID:          "job-1",
+		Markdown:       "# Notes\n\n- a",
+		SuggestedTitle: &title,
+		Timestamp:      time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if res.Location != "https://wiki.example.com/spaces/DOC/pages/1001" || res.Commit != "1001@v1" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if created["title"] != "Notes" || created["version"] != nil {
+		t.Fatalf("unexpected create payload: %v", created)
+	}
+	ancestors, _ := created["ancestors"].([]any)
+	if len(ancestors) != 1 || ancestors[0].(map[string]any)["id"] != "42" {
+		t.Fatalf("parent page not set: %v", created["ancestors"])
+	}
+	body := created["body"].(map[string]any)["storage"].(map[string]any)
+	if body["representation"] != "storage" || body["value"] != "<h1>Notes</h1><ul><li>a</li></ul>" {
+		t.Fatalf("unexpected body: %v", body)
+	}
+}
+
+func TestPost_UpdatesExistingPageWithNextVersion(t *testing.T) {
+	var updated map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/content":
+			_ = json.NewEncoder(w).Encode(map[string]any{"results": []any{
+				map[string]any{"id": "7", "version": map[string]any{"number": 3}},
+			}})
+		case r.Method == http.MethodPut && r.URL.Path == "/rest/api/content/7":
+			_ = json.NewDecoder(r.Body).Decode(&updated)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id":      "7",
+				"version": map[string]any{"number": 4},
+				"_links":  map[string]any{"webui": "/pages/7"},
+			})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	res, err := newTestTarget(t, srv).Post(context.Background(), targets.TargetRequest{JobID: "job-2", Markdown: "text"})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if v := updated["version"].(map[string]any)["number"]; v != float64(4) {
+		t.Fatalf("expected version 4, got %v", v)
+	}
+	if updated["title"] != "Transcription job-2" {
+		t.Fatalf("unexpected default title: %v", updated["title"])
+	}
+	if res.Location != srv.URL+"/pages/7" || res.Commit != "7@v4" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestPost_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]any{"message": "no permission"})
+	}))
+	defer srv.Close()
+
+	_, err := newTestTarget(t, srv).Post(context.Background(), targets.TargetRequest{JobID: "job-3", Markdown: "x"})
+	if err == nil || err.Error() != "find page: confluence api: status 403: no permission" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestViewURL(t *testing.T) {
+	tg, err := New("confluence", appcfg.ConfluenceTargetConfig{BaseURL: "https://wiki", SpaceKey: "DOC", Auth: appcfg.ConfluenceAuthConfig{Token: "t"}})
+	if err != nil {
+		t.Fatalf("New confluence target: %v", err)
+	}
+	if u, ok := tg.ViewURL("https://wiki/spaces/DOC/pages/1"); !ok || u != "https://wiki/spaces/DOC/pages/1" {
+		t.Fatalf("unexpected view url %q %v", u, ok)
+	}
+	if _, ok := tg.ViewURL("1@v1"); ok {
+		t.Fatalf("expected non-URL location to be rejected")
+	}
+}
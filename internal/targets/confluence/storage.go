@@ -0,0 +1,157 @@
+package confluence
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Minimal Markdown to Confluence storage format converter. It understands the constructs
+// the transcription prompt produces: ATX headings, unordered/ordered lists, fenced code
+// blocks, block quotes, horizontal rules and paragraphs with basic inline formatting.
+// Anything else is emitted as an escaped paragraph so no content is lost.
+
+var (
+	headingRe     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	unorderedRe   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRe     = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	fenceRe       = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+#.-]*)\\s*$")
+	inlineCodeRe  = regexp.MustCompile("`([^`]+)`")
+	boldRe        = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicRe      = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	linkRe        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	placeholderRe = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// toStorageFormat converts Markdown to Confluence storage format (XHTML).
+func toStorageFormat(md string) string {
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	var para []string
+	listTag := ""
+
+	flushPara := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + inline(strings.Join(para, " ")) + "</p>")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			b.WriteString("</" + listTag + ">")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			b.WriteString("<" + tag + ">")
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			flushPara()
+			closeList()
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.TrimSpace(lines[i]) == m[1] {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			b.WriteString(codeMacro(m[2], strings.Join(code, "\n")))
+			continue
+		}
+		if trimmed == "" {
+			flushPara()
+			closeList()
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(trimmed); m != nil {
+			flushPara()
+			closeList()
+			lvl := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + lvl + ">" + inline(m[2]) + "</h" + lvl + ">")
+			continue
+		}
+		if isRule(trimmed) {
+			flushPara()
+			closeList()
+			b.WriteString("<hr />")
+			continue
+		}
+		if m := unorderedRe.FindStringSubmatch(line); m != nil {
+			flushPara()
+			openList("ul")
+			b.WriteString("<li>" + inline(m[1]) + "</li>")
+			continue
+		}
+		if m := orderedRe.FindStringSubmatch(line); m != nil {
+			flushPara()
+			openList("ol")
+			b.WriteString("<li>" + inline(m[1]) + "</li>")
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			flushPara()
+			closeList()
+			b.WriteString("<blockquote><p>" + inline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</p></blockquote>")
+			continue
+		}
+		closeList()
+		para = append(para, trimmed)
+	}
+	flushPara()
+	closeList()
+	return b.String()
+}
+
+// isRule reports whether s is a thematic break: three or more of the same -, * or _
+// characters, optionally separated by spaces.
+func isRule(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 3 || !strings.ContainsRune("-*_", rune(s[0])) {
+		return false
+	}
+	return strings.Count(s, s[:1]) == len(s)
+}
+
+// codeMacro renders a code block using the Confluence code macro.
+func codeMacro(lang, code string) string {
+	var b strings.Builder
+	b.WriteString(`<ac:structured-macro ac:name="code">`)
+	if lang != "" {
+		b.WriteString(`<ac:parameter ac:name="language">` + html.EscapeString(lang) + `</ac:parameter>`)
+	}
+	// CDATA cannot contain "]]>"; split it across two sections.
+	b.WriteString(`<ac:plain-text-body><![CDATA[` + strings.ReplaceAll(code, "]]>", "]]]]><![CDATA[>") + `]]></ac:plain-text-body>`)
+	b.WriteString(`</ac:structured-macro>`)
+	return b.String()
+}
+
+// inline escapes text and converts inline code, links, bold and italic.
+// Code spans are replaced by placeholders first so their content is not formatted.
+func inline(s string) string {
+	var codes []string
+	s = inlineCodeRe.ReplaceAllStringFunc(s, func(m string) string {
+		codes = append(codes, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00" + strconv.Itoa(len(codes)-1) + "\x00"
+	})
+	s = html.EscapeString(s)
+	s = linkRe.ReplaceAllString(s, `<a href="$2">$1</a>`)
+	s = boldRe.ReplaceAllString(s, "<strong>$1$2</strong>")
+	s = italicRe.ReplaceAllString(s, "<em>$1$2</em>")
+	return placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		idx, err := strconv.Atoi(m[1 : len(m)-1])
+		if err == nil && idx < len(codes) {
+			return codes[idx]
+		}
+		return m
+	})
+}
@@ -0,0 +1,51 @@
+package confluence
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToStorageFormat(t *testing.T) {
+	md := strings.Join([]string{
+		"# Title",
+		"",
+		"Some **bold** and *italic* text with `a<b` and [link](https://example.com/?a=1&b=2).",
+		"",
+		"- one",
+		"- two",
+		"",
+		"1. first",
+		"2. second",
+		"",
+		"```go",
+		"if a < b { fmt.Println(\"]]>\") }",
+		"```",
+		"",
+		"---",
+		"> quoted",
+	}, "\n")
+
+	got := toStorageFormat(md)
+
+	want := []string{
+		"<h1>Title</h1>",
+		"<p>Some <strong>bold</strong> and <em>italic</em> text with <code>a&lt;b</code> and <a href=\"https://example.com/?a=1&amp;b=2\">link</a>.</p>",
+		"<ul><li>one</li><li>two</li></ul>",
+		"<ol><li>first</li><li>second</li></ol>",
+		`<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">go</ac:parameter><ac:plain-text-body><![CDATA[if a < b { fmt.Println("]]]]><![CDATA[>") }]]></ac:plain-text-body></ac:structured-macro>`,
+		"<hr />",
+		"<blockquote><p>quoted</p></blockquote>",
+	}
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("missing %q in output:\n%s", w, got)
+		}
+	}
+}
+
+func TestToStorageFormat_EscapesText(t *testing.T) {
+	got := toStorageFormat("a <script> & b")
+	if got != "<p>a &lt;script&gt; &amp; b</p>" {
+		t.Fatalf("unexpected output: %s", got)
+	}
+}
@@ -0,0 +1,155 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/util"
+)
+
+const defaultFilenameTemplate = "{{ .Timestamp.Format \"20060102-150405\" }}-{{ .JobID }}.md"
+
+// Target implements a target writing each transcription as a Markdown file below a
+// local directory, e.g. for air-gapped setups and testing.
+type Target struct {
+	name        string
+	cfg         appcfg.FSTargetConfig
+	filenameTpl *template.Template
+
+	// a successful validation is cached so repeated checks do not touch the disk again
+	validated targets.ValidationCache
+}
+
+var _ targets.Validator = (*Target)(nil)
+
+// New creates a filesystem Target writing below cfg.RootDir, which is made absolute.
+func New(name string, cfg appcfg.FSTargetConfig) (*Target, error) {
+	if strings.TrimSpace(cfg.RootDir) == "" {
+		return nil, fmt.Errorf("root dir must not be empty")
+	}
+	root, err := filepath.Abs(cfg.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root dir: %w", err)
+	}
+	cfg.RootDir = root
+	s := strings.TrimSpace(cfg.FilenameTemplate)
+	if s == "" {
+		s = defaultFilenameTemplate
+	}
+	tpl, err := template.New("filename").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse filename template: %w", err)
+	}
+	return &Target{name: name, cfg: cfg, filenameTpl: tpl}, nil
+}
+
+func (t *Target) Name() string { return t.name }
+
+// Post writes the Markdown to the rendered path below the root directory, replacing a
+// file already there. Location is the file:// URL of the file; there is no commit.
+func (t *Target) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
+	dst, err := t.path(req)
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return targets.TargetResult{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return targets.TargetResult{}, fmt.Errorf("create directory: %w", err)
+	}
+	if err := writeFile(dst, []byte(req.Markdown)); err != nil {
+		return targets.TargetResult{}, err
+	}
+	return targets.TargetResult{
+		TargetName: t.name,
+		Location:   "file://" + filepath.ToSlash(dst),
+	}, nil
+}
+
+// Validate checks that the root directory exists or can be created. A success is cached.
+func (t *Target) Validate(ctx context.Context) error {
+	return t.validated.Check(ctx, func() error {
+		if err := os.MkdirAll(t.cfg.RootDir, 0o750); err != nil {
+			return fmt.Errorf("root dir %s: %w", t.cfg.RootDir, err)
+		}
+		return nil
+	})
+}
+
+// path renders the file path of req below the root directory. Rendered names that
+// would leave the root directory, e.g. through ".." or an absolute path, are rejected.
+func (t *Target) path(req targets.TargetRequest) (string, error) {
+	tpl := t.filenameTpl
+	if s := strings.TrimSpace(req.FilenameTemplate); s != "" {
+		var err error
+		if tpl, err = template.New("filename").Parse(s); err != nil {
+			return "", fmt.Errorf("parse filename template: %w", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, templateData(req)); err != nil {
+		return "", fmt.Errorf("render filename: %w", err)
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		name = fmt.Sprintf("%s-%s.md", req.Timestamp.Format("20060102-150405"), req.JobID)
+	}
+	basePath := t.cfg.BasePath
+	if req.BasePath != "" {
+		basePath = req.BasePath
+	}
+	rel := util.TruncateFilename(filepath.ToSlash(filepath.Join(basePath, name)), util.MaxFilenameLength)
+
+	dst := filepath.Join(t.cfg.RootDir, filepath.FromSlash(rel))
+	if r, err := filepath.Rel(t.cfg.RootDir, dst); err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) || filepath.IsAbs(r) {
+		return "", fmt.Errorf("file path %q escapes the root directory", rel)
+	}
+	return dst, nil
+}
+
+// writeFile writes data to a temporary file next to dst and renames it into place, so
+// readers never see a partially written file.
+func writeFile(dst string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".gostwriter-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o640); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("move file into place: %w", err)
+	}
+	return nil
+}
+
+func templateData(req targets.TargetRequest) map[string]any {
+	return map[string]any{
+		"JobID":          req.JobID,
+		"Timestamp":      req.Timestamp,
+		"SuggestedTitle": req.SuggestedTitle,
+		"Actor":          req.Actor,
+		"Metadata":       req.Metadata,
+		"Model":          req.Model,
+		"TokenUsage":     req.TokenUsage,
+		"DurationMs":     req.DurationMs,
+		"Language":       req.Language,
+		"Flavor":         req.Flavor,
+	}
+}
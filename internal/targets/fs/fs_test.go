@@ -0,0 +1,71 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+func TestPost_WritesBelowRootDir(t *testing.T) {
+	root := t.TempDir()
+	tg, err := New("local", appcfg.FSTargetConfig{RootDir: root, BasePath: "inbox/2024/", FilenameTemplate: "{{ .JobID }}.md"})
+	if err != nil {
+		t.Fatalf("New fs target: %v", err)
+	}
+
+	req := targets.TargetRequest{JobID: "job-1", Markdown: "# Notes\n", Timestamp: time.Now().UTC()}
+	res, err := tg.Post(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	want := filepath.Join(root, "inbox", "2024", "job-1.md")
+	if res.TargetName != "local" || res.Location != "file://"+filepath.ToSlash(want) || res.Commit != "" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	b, err := os.ReadFile(want)
+	if err != nil || string(b) != "# Notes\n" {
+		t.Fatalf("file content %q, err %v", b, err)
+	}
+
+	// A second post to the same path replaces the file.
+	req.Markdown = "# Updated\n"
+	if _, err := tg.Post(context.Background(), req); err != nil {
+		t.Fatalf("second Post: %v", err)
+	}
+	if b, _ := os.ReadFile(want); string(b) != "# Updated\n" {
+		t.Fatalf("file not replaced: %q", b)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(want))
+	if len(entries) != 1 {
+		t.Fatalf("expected only the written file, got %v", entries)
+	}
+}
+
+func TestPost_RejectsPathsEscapingRootDir(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	tg, err := New("local", appcfg.FSTargetConfig{RootDir: root, FilenameTemplate: "{{ .Metadata.name }}"})
+	if err != nil {
+		t.Fatalf("New fs target: %v", err)
+	}
+	for _, name := range []string{"../outside.md", "a/../../outside.md", ".."} {
+		_, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Metadata: map[string]any{"name": name}})
+		if err == nil || !strings.Contains(err.Error(), "escapes the root directory") {
+			t.Errorf("%q: expected escape to be rejected, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "outside.md")); !os.IsNotExist(err) {
+		t.Fatalf("file written outside the root directory: %v", err)
+	}
+
+	// Names staying inside the root after cleaning are fine.
+	res, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Metadata: map[string]any{"name": "a/../b.md"}})
+	if err != nil || res.Location != "file://"+filepath.ToSlash(filepath.Join(root, "b.md")) {
+		t.Fatalf("unexpected result %+v, err %v", res, err)
+	}
+}
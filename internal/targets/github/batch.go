@@ -0,0 +1,384 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/util"
+)
+
+// batchFlushTimeout bounds the API calls that create the commit of one batch.
+const batchFlushTimeout = time.Minute
+
+// refUpdateAttempts is how often a batch commit is rebuilt when the branch moved
+// between reading and updating its ref.
+const refUpdateAttempts = 3
+
+// batchFile holds the files of one post waiting in a batch: the Markdown and, with
+// writeManifest, its manifest.
+type batchFile struct {
+	files   []repoFile
+	message string
+	author  *gitIdentity
+	done    chan batchResult // receives the outcome of the batch commit
+}
+
+// repoFile is a file to write into the repository.
+type repoFile struct {
+	path    string
+	content string
+}
+
+type batchResult struct {
+	commit string
+	err    error
+}
+
+// batch accumulates the files for one branch until BatchWindow elapses or BatchSize
+// files are collected.
+type batch struct {
+	files []*batchFile
+	timer *time.Timer
+}
+
+// postBatched adds the file to the batch of its branch and waits until the batch is
+// committed, so a job only counts as posted once its file is in the repository. When
+// ctx ends first the file is still committed with its batch.
+func (t *Target) postBatched(ctx context.Context, branch string, f *batchFile) (string, error) {
+	f.done = make(chan batchResult, 1)
+
+	t.batchMu.Lock()
+	if t.batches == nil {
+		t.batches = map[string]*batch{}
+	}
+	b := t.batches[branch]
+	if b == nil {
+		b = &batch{}
+		t.batches[branch] = b
+		b.timer = time.AfterFunc(t.cfg.BatchWindow, func() { t.flush(branch, b) })
+	}
+	b.files = append(b.files, f)
+	full := len(b.files) >= t.cfg.BatchSize
+	t.batchMu.Unlock()
+	if full {
+		go t.flush(branch, b)
+	}
+
+	select {
+	case res := <-f.done:
+		return res.commit, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// flush commits the files of b unless another trigger already did.
+func (t *Target) flush(branch string, b *batch) {
+	t.batchMu.Lock()
+	if t.batches[branch] != b {
+		t.batchMu.Unlock()
+		return
+	}
+	delete(t.batches, branch)
+	b.timer.Stop()
+	files := t.resolveCollisions(b.files)
+	t.batchMu.Unlock()
+	if len(files) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchFlushTimeout)
+	defer cancel()
+	sha, err := t.commitFiles(ctx, branch, files)
+	for _, f := range files {
+		f.done <- batchResult{commit: sha, err: err}
+	}
+}
+
+// resolveCollisions handles posts of a batch that render a path already taken by an
+// earlier post of the same batch, which would otherwise silently replace it in the tree.
+// With the suffix strategy the later post is renamed to name-2.md, name-3.md, ...; with
+// fail it is answered with an error and left out. It returns the posts to commit.
+func (t *Target) resolveCollisions(posts []*batchFile) []*batchFile {
+	used := make(map[string]bool)
+	kept := make([]*batchFile, 0, len(posts))
+	for _, f := range posts {
+		if taken(used, f.files) {
+			if t.cfg.BatchPathCollision == appcfg.PathCollisionFail {
+				f.done <- batchResult{err: fmt.Errorf("path %s is already written by another file of the batch", f.files[0].path)}
+				continue
+			}
+			for n := 2; ; n++ {
+				if renamed := t.suffixed(f.files, n); !taken(used, renamed) {
+					f.files = renamed
+					break
+				}
+			}
+		}
+		for _, rf := range f.files {
+			used[rf.path] = true
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// taken reports whether any of files has a path in used.
+func taken(used map[string]bool, files []repoFile) bool {
+	for _, f := range files {
+		if used[f.path] {
+			return true
+		}
+	}
+	return false
+}
+
+// suffixed returns the files of a post with -n appended to the name of its Markdown file
+// and its manifest, if any, following the new name.
+func (t *Target) suffixed(files []repoFile, n int) []repoFile {
+	md := files[0].path
+	ext := path.Ext(md)
+	limit := t.cfg.MaxFilenameLength
+	if limit <= 0 {
+		limit = util.MaxFilenameLength
+	}
+	name := util.TruncateFilename(fmt.Sprintf("%s-%d%s", strings.TrimSuffix(md, ext), n, ext), limit)
+	out := make([]repoFile, len(files))
+	for i, f := range files {
+		switch {
+		case i == 0:
+			f.path = name
+		case f.path == targets.ManifestPath(md):
+			f.path = targets.ManifestPath(name)
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// commitFiles creates a single commit with the files of all posts on top of the branch
+// head using the Git Data API: blobs, a tree, a commit and the ref update. Unlike the
+// Contents API used for single files, existing files at the same paths are replaced.
+func (t *Target) commitFiles(ctx context.Context, branch string, files []*batchFile) (string, error) {
+	base := fmt.Sprintf("%s/repos/%s/%s/git", strings.TrimRight(t.cfg.APIBaseURL, "/"), t.cfg.RepositoryOwner, t.cfg.RepositoryName)
+	refPath := "/refs/heads/" + escapeSegments(branch)
+	token := t.currentToken()
+
+	var all []repoFile
+	for _, f := range files {
+		all = append(all, f.files...)
+	}
+	// Blobs do not depend on the branch head, so a rebuild after a moved ref reuses them.
+	entries, err := t.createBlobs(ctx, token, base, all)
+	if err != nil {
+		return "", err
+	}
+	message, author := batchCommitInfo(files)
+	var committer *gitIdentity
+	if t.cfg.AuthorName != "" || t.cfg.AuthorEmail != "" {
+		committer = &gitIdentity{Name: t.cfg.AuthorName, Email: t.cfg.AuthorEmail}
+	}
+
+	for attempt := 1; ; attempt++ {
+		var ref gitRef
+		if err := t.gitAPI(ctx, token, http.MethodGet, base+"/ref/heads/"+escapeSegments(branch), nil, http.StatusOK, &ref); err != nil {
+			return "", fmt.Errorf("get branch %s: %w", branch, err)
+		}
+		var head gitCommit
+		if err := t.gitAPI(ctx, token, http.MethodGet, base+"/commits/"+url.PathEscape(ref.Object.SHA), nil, http.StatusOK, &head); err != nil {
+			return "", fmt.Errorf("get head commit: %w", err)
+		}
+		var tree gitObject
+		if err := t.gitAPI(ctx, token, http.MethodPost, base+"/trees", createTreePayload{BaseTree: head.Tree.SHA, Tree: entries}, http.StatusCreated, &tree); err != nil {
+			return "", fmt.Errorf("create tree: %w", err)
+		}
+		var commit gitObject
+		if err := t.gitAPI(ctx, token, http.MethodPost, base+"/commits", createCommitPayload{
+			Message: message, Tree: tree.SHA, Parents: []string{ref.Object.SHA}, Author: author, Committer: committer,
+		}, http.StatusCreated, &commit); err != nil {
+			return "", fmt.Errorf("create commit: %w", err)
+		}
+		err := t.gitAPI(ctx, token, http.MethodPatch, base+refPath, updateRefPayload{SHA: commit.SHA}, http.StatusOK, nil)
+		if err == nil {
+			return commit.SHA, nil
+		}
+		// 422 means the update is not a fast-forward: the branch moved, so rebuild on the new head.
+		var se *statusError
+		if !errors.As(err, &se) || se.status != http.StatusUnprocessableEntity || attempt == refUpdateAttempts {
+			return "", fmt.Errorf("update branch %s: %w", branch, err)
+		}
+	}
+}
+
+// createBlobs uploads the files as blobs, at most cfg.BlobConcurrency at a time, and
+// returns their tree entries in the order of files.
+func (t *Target) createBlobs(ctx context.Context, token, base string, files []repoFile) ([]treeEntry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	entries := make([]treeEntry, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, max(t.cfg.BlobConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			var blob gitObject
+			payload := createBlobPayload{Content: base64.StdEncoding.EncodeToString([]byte(f.content)), Encoding: "base64"}
+			if err := t.gitAPI(ctx, token, http.MethodPost, base+"/blobs", payload, http.StatusCreated, &blob); err != nil {
+				errs[i] = fmt.Errorf("create blob for %s: %w", f.path, err)
+				cancel() // no point in uploading the rest
+				return
+			}
+			entries[i] = treeEntry{Path: f.path, Mode: "100644", Type: "blob", SHA: blob.SHA}
+		}()
+	}
+	wg.Wait()
+	// Report the error that caused the cancellation rather than the ones it caused.
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// batchCommitInfo returns the message and author of a batch commit. A single file keeps
+// its own message; several files get a summary listing the subject of each message.
+// The author is only set when all files agree on it.
+func batchCommitInfo(files []*batchFile) (string, *gitIdentity) {
+	author := files[0].author
+	for _, f := range files[1:] {
+		if f.author == nil || author == nil || *f.author != *author {
+			author = nil
+			break
+		}
+	}
+	if author != nil && author.Name == "" && author.Email == "" {
+		author = nil
+	}
+	if len(files) == 1 {
+		return files[0].message, author
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Add %d transcriptions\n", len(files))
+	for _, f := range files {
+		subject, _, _ := strings.Cut(f.message, "\n")
+		fmt.Fprintf(&sb, "\n- %s", subject)
+	}
+	return sb.String(), author
+}
+
+// statusError is an unexpected response status of the GitHub API.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("github api: status %d: %s", e.status, e.message)
+	}
+	return fmt.Sprintf("github api: status %d", e.status)
+}
+
+// gitAPI sends payload (if any) as JSON and decodes the response into out (if any).
+func (t *Target) gitAPI(ctx context.Context, token, method, u string, payload any, want int, out any) error {
+	var body []byte
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("marshal payload: %w", err)
+		}
+		body = b
+	}
+	resp, err := t.do(ctx, func() (*http.Request, error) {
+		if body == nil {
+			return t.newAPIRequest(ctx, token, method, u, nil)
+		}
+		req, err := t.newAPIRequest(ctx, token, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != want {
+		var apiErr apiError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return &statusError{status: resp.StatusCode, message: apiErr.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// Git Data API structures
+
+type gitObject struct {
+	SHA string `json:"sha"`
+}
+
+type gitRef struct {
+	Object gitObject `json:"object"`
+}
+
+type gitCommit struct {
+	SHA  string    `json:"sha"`
+	Tree gitObject `json:"tree"`
+}
+
+type createBlobPayload struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+type treeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+}
+
+type createTreePayload struct {
+	BaseTree string      `json:"base_tree"`
+	Tree     []treeEntry `json:"tree"`
+}
+
+type createCommitPayload struct {
+	Message   string       `json:"message"`
+	Tree      string       `json:"tree"`
+	Parents   []string     `json:"parents"`
+	Author    *gitIdentity `json:"author,omitempty"`
+	Committer *gitIdentity `json:"committer,omitempty"`
+}
+
+type updateRefPayload struct {
+	SHA   string `json:"sha"`
+	Force bool   `json:"force"`
+}
@@ -0,0 +1,357 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// fakeGitData implements the Git Data API endpoints used for batch commits.
+type fakeGitData struct {
+	mu       sync.Mutex
+	head     string
+	blobs    map[string]string // content by sha
+	commits  []createCommitPayload
+	trees    [][]treeEntry
+	calls    []string // endpoints in call order, blobs as "blob"
+	moveOnce bool     // answer the first ref update with 422, as if the branch moved
+	failBlob string   // answer blob uploads with this content with 500
+
+	inflight, maxInflight atomic.Int32 // concurrent blob uploads
+	blobDelay             time.Duration
+}
+
+func (f *fakeGitData) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && r.URL.Path == "/repos/org/repo/git/blobs" {
+		f.serveBlob(w, r)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/repos/org/repo/git/"))
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/org/repo/git/ref/heads/main":
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": map[string]string{"sha": f.head}})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/repos/org/repo/git/commits/"):
+		_ = json.NewEncoder(w).Encode(map[string]any{"sha": f.head, "tree": map[string]string{"sha": "tree-" + f.head}})
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/org/repo/git/trees":
+		var p createTreePayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		f.trees = append(f.trees, p.Tree)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"sha": fmt.Sprintf("tree-%d", len(f.trees))})
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/org/repo/git/commits":
+		var p createCommitPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		f.commits = append(f.commits, p)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"sha": fmt.Sprintf("commit-%d", len(f.commits))})
+	case r.Method == http.MethodPatch && r.URL.Path == "/repos/org/repo/git/refs/heads/main":
+		if f.moveOnce {
+			f.moveOnce = false
+			f.head = "moved"
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Update is not a fast forward"})
+			return
+		}
+		var p updateRefPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		f.head = p.SHA
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": map[string]string{"sha": p.SHA}})
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+// serveBlob answers a blob upload outside the lock, so uploads can overlap.
+func (f *fakeGitData) serveBlob(w http.ResponseWriter, r *http.Request) {
+	n := f.inflight.Add(1)
+	defer f.inflight.Add(-1)
+	for m := f.maxInflight.Load(); n > m && !f.maxInflight.CompareAndSwap(m, n); m = f.maxInflight.Load() {
+	}
+	time.Sleep(f.blobDelay)
+
+	var p createBlobPayload
+	_ = json.NewDecoder(r.Body).Decode(&p)
+	b, err := base64.StdEncoding.DecodeString(p.Content)
+	if err != nil || p.Encoding != "base64" {
+		http.Error(w, "bad blob", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "blob")
+	if f.failBlob != "" && string(b) == f.failBlob {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "boom"})
+		return
+	}
+	if f.blobs == nil {
+		f.blobs = make(map[string]string)
+	}
+	sha := fmt.Sprintf("blob-%d", len(f.blobs)+1)
+	f.blobs[sha] = string(b)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"sha": sha})
+}
+
+func newBatchTarget(t *testing.T, window time.Duration, size int, api *fakeGitData) *Target {
+	t.Helper()
+	ts := httptest.NewServer(api)
+	t.Cleanup(ts.Close)
+	tg, err := New("docs", appcfg.GitHubTargetConfig{
+		RepositoryOwner:       "org",
+		RepositoryName:        "repo",
+		Branch:                "main",
+		FilenameTemplate:      "{{ .JobID }}.md",
+		CommitMessageTemplate: "Add {{ .JobID }}",
+		AuthorName:            "Bot",
+		AuthorEmail:           "bot@example.com",
+		APIBaseURL:            ts.URL,
+		BatchWindow:           window,
+		BatchSize:             size,
+		Auth:                  appcfg.GitHubAuthConfig{Token: "x"},
+	})
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	return tg.WithHTTPClient(ts.Client())
+}
+
+func TestPost_BatchSizeFlushesOneCommit(t *testing.T) {
+	api := &fakeGitData{head: "base"}
+	// The window is far longer than the test, so only the size can trigger the flush.
+	tg := newBatchTarget(t, time.Hour, 3, api)
+
+	var wg sync.WaitGroup
+	results := make([]targets.TargetResult, 3)
+	errs := make([]error, 3)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = tg.Post(context.Background(), targets.TargetRequest{
+				JobID: fmt.Sprintf("job-%d", i), Markdown: "md", Timestamp: time.Now().UTC(),
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("post %d: %v", i, err)
+		}
+		if results[i].Commit != "commit-1" || results[i].Location != fmt.Sprintf("github:org/repo@main:job-%d.md", i) {
+			t.Fatalf("post %d: unexpected result %+v", i, results[i])
+		}
+	}
+	if len(api.commits) != 1 || len(api.trees[0]) != 3 {
+		t.Fatalf("expected one commit with three files, got %d commits, trees %v", len(api.commits), api.trees)
+	}
+	c := api.commits[0]
+	if !strings.HasPrefix(c.Message, "Add 3 transcriptions\n") || c.Parents[0] != "base" || c.Tree != "tree-1" {
+		t.Fatalf("unexpected commit %+v", c)
+	}
+	if c.Author == nil || c.Author.Name != "Bot" || c.Committer == nil || c.Committer.Email != "bot@example.com" {
+		t.Fatalf("unexpected identities %+v %+v", c.Author, c.Committer)
+	}
+	if api.head != "commit-1" {
+		t.Fatalf("branch not updated: %s", api.head)
+	}
+}
+
+func TestPost_BatchWindowFlushesPartialBatch(t *testing.T) {
+	api := &fakeGitData{head: "base", moveOnce: true}
+	tg := newBatchTarget(t, 10*time.Millisecond, 10, api)
+
+	res, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	// The first ref update is rejected as not fast-forward, so the commit is rebuilt on the new head.
+	if res.Commit != "commit-2" || len(api.commits) != 2 || api.commits[1].Parents[0] != "moved" {
+		t.Fatalf("unexpected result %+v, commits %+v", res, api.commits)
+	}
+	if api.commits[1].Message != "Add job-1" {
+		t.Fatalf("single file batch should keep its message: %q", api.commits[1].Message)
+	}
+	if e := api.trees[1][0]; e.Path != "job-1.md" || api.blobs[e.SHA] != "md" || e.Mode != "100644" {
+		t.Fatalf("unexpected tree entry %+v", e)
+	}
+}
+
+func TestPost_WriteManifestInSameCommit(t *testing.T) {
+	api := &fakeGitData{head: "base"}
+	tg := newBatchTarget(t, 0, 0, api)
+	tg.cfg.WriteManifest = true
+	tg.cfg.BasePath = "inbox"
+
+	title := "Receipt"
+	ts := time.Date(2025, 4, 2, 18, 30, 0, 0, time.UTC)
+	res, err := tg.Post(context.Background(), targets.TargetRequest{
+		JobID: "job-1", Markdown: "# Receipt", Timestamp: ts, SuggestedTitle: &title,
+		Model: "gpt-5", TokenUsage: 1234, Metadata: map[string]any{"source": "scanner"},
+	})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if res.Commit != "commit-1" || len(api.commits) != 1 || len(api.trees[0]) != 2 {
+		t.Fatalf("expected one commit with two files, got %+v, trees %v", res, api.trees)
+	}
+	if md := api.trees[0][0]; md.Path != "inbox/job-1.md" || api.blobs[md.SHA] != "# Receipt" {
+		t.Fatalf("unexpected markdown entry %+v", md)
+	}
+	mf := api.trees[0][1]
+	if mf.Path != "inbox/job-1.json" {
+		t.Fatalf("manifest path = %q", mf.Path)
+	}
+	var m targets.Manifest
+	if err := json.Unmarshal([]byte(api.blobs[mf.SHA]), &m); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	if m.SchemaVersion != targets.ManifestSchemaVersion || m.JobID != "job-1" || m.File != "inbox/job-1.md" || m.Title != title ||
+		!m.Timestamp.Equal(ts) || m.Model != "gpt-5" || m.TokenUsage != 1234 || m.Metadata["source"] != "scanner" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	if api.commits[0].Message != "Add job-1" {
+		t.Fatalf("commit message = %q", api.commits[0].Message)
+	}
+	want := []string{"blob", "blob", "GET ref/heads/main", "GET commits/base", "POST trees", "POST commits", "PATCH refs/heads/main"}
+	if strings.Join(api.calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("calls = %v, want %v", api.calls, want)
+	}
+}
+
+func TestPost_BlobConcurrencyIsLimited(t *testing.T) {
+	api := &fakeGitData{head: "base", blobDelay: 5 * time.Millisecond}
+	tg := newBatchTarget(t, time.Hour, 6, api)
+	tg.cfg.BlobConcurrency = 2
+
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tg.Post(context.Background(), targets.TargetRequest{
+				JobID: fmt.Sprintf("job-%d", i), Markdown: fmt.Sprintf("md %d", i), Timestamp: time.Now().UTC(),
+			}); err != nil {
+				t.Errorf("post %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := api.maxInflight.Load(); n > 2 {
+		t.Fatalf("%d blobs uploaded at once, want at most 2", n)
+	}
+	if len(api.commits) != 1 || len(api.trees[0]) != 6 {
+		t.Fatalf("expected one commit with six files, got %d commits, trees %v", len(api.commits), api.trees)
+	}
+	for i, e := range api.trees[0] {
+		if api.blobs[e.SHA] != fmt.Sprintf("md %s", strings.TrimSuffix(strings.TrimPrefix(e.Path, "job-"), ".md")) {
+			t.Fatalf("entry %d: %s points to %q", i, e.Path, api.blobs[e.SHA])
+		}
+	}
+}
+
+func TestPost_BlobFailureCreatesNoCommit(t *testing.T) {
+	api := &fakeGitData{head: "base", failBlob: "# Receipt"}
+	tg := newBatchTarget(t, 0, 0, api)
+	tg.cfg.WriteManifest = true
+
+	_, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "# Receipt", Timestamp: time.Now().UTC()})
+	if err == nil || !strings.Contains(err.Error(), "create blob for job-1.md") {
+		t.Fatalf("expected blob error, got %v", err)
+	}
+	if len(api.trees) != 0 || len(api.commits) != 0 || api.head != "base" {
+		t.Fatalf("nothing should be committed: trees %v, commits %v, head %s", api.trees, api.commits, api.head)
+	}
+}
+
+func TestPost_BatchPathCollisions(t *testing.T) {
+	postAll := func(t *testing.T, tg *Target) ([]targets.TargetResult, []error) {
+		t.Helper()
+		var wg sync.WaitGroup
+		results := make([]targets.TargetResult, 3)
+		errs := make([]error, 3)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// All three render the same file name.
+				results[i], errs[i] = tg.Post(context.Background(), targets.TargetRequest{
+					JobID: fmt.Sprintf("job-%d", i), Markdown: fmt.Sprintf("md %d", i), Timestamp: time.Now().UTC(),
+					FilenameTemplate: "notes/receipt.md",
+				})
+			}()
+		}
+		wg.Wait()
+		return results, errs
+	}
+
+	t.Run("suffix", func(t *testing.T) {
+		api := &fakeGitData{head: "base"}
+		tg := newBatchTarget(t, time.Hour, 3, api)
+		tg.cfg.WriteManifest = true
+
+		results, errs := postAll(t, tg)
+		locations := map[string]bool{}
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("post %d: %v", i, err)
+			}
+			locations[results[i].Location] = true
+		}
+		for _, p := range []string{"notes/receipt.md", "notes/receipt-2.md", "notes/receipt-3.md"} {
+			if !locations["github:org/repo@main:"+p] {
+				t.Fatalf("missing location %s in %v", p, locations)
+			}
+		}
+		if len(api.commits) != 1 || len(api.trees[0]) != 6 {
+			t.Fatalf("expected one commit with six files, got %d commits, trees %v", len(api.commits), api.trees)
+		}
+		paths := map[string]bool{}
+		for _, e := range api.trees[0] {
+			paths[e.Path] = true
+		}
+		for _, p := range []string{"notes/receipt.json", "notes/receipt-2.json", "notes/receipt-3.json"} {
+			if !paths[p] {
+				t.Fatalf("missing manifest %s in %v", p, api.trees[0])
+			}
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		api := &fakeGitData{head: "base"}
+		tg := newBatchTarget(t, time.Hour, 3, api)
+		tg.cfg.BatchPathCollision = appcfg.PathCollisionFail
+
+		results, errs := postAll(t, tg)
+		var ok int
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				ok++
+				if results[i].Location != "github:org/repo@main:notes/receipt.md" {
+					t.Fatalf("unexpected location %s", results[i].Location)
+				}
+			case !strings.Contains(err.Error(), "already written by another file of the batch"):
+				t.Fatalf("post %d: unexpected error %v", i, err)
+			}
+		}
+		if ok != 1 || len(api.commits) != 1 || len(api.trees[0]) != 1 {
+			t.Fatalf("expected one post committed, got %d ok, %d commits, trees %v", ok, len(api.commits), api.trees)
+		}
+	})
+}
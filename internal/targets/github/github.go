@@ -6,23 +6,52 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
 
 	appcfg "github.com/jo-hoe/gostwriter/internal/config"
 	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+	"github.com/jo-hoe/gostwriter/internal/util"
 )
 
+// DefaultBlobConcurrency is the number of blobs uploaded at once for a multi-file commit
+// when not configured.
+const DefaultBlobConcurrency = 4
+
 // Target implements a GitHub markdown post target using the GitHub REST API
 // to create file contents without cloning the repository.
 type Target struct {
 	name string
 	cfg  appcfg.GitHubTargetConfig
 	http *http.Client
+
+	// a successful validation is cached so repeated checks do not hit the API again
+	validated targets.ValidationCache
+
+	// parsed configured templates keyed by name and text; per-request templates are not cached
+	templates sync.Map
+
+	// token is cfg.Auth.Token, replaced by SetToken when the secret is rotated
+	tokenMu sync.RWMutex
+	token   string
+
+	// pending batches by branch when cfg.BatchWindow is set
+	batchMu sync.Mutex
+	batches map[string]*batch
 }
 
+var (
+	_ targets.Validator    = (*Target)(nil)
+	_ targets.Viewer       = (*Target)(nil)
+	_ targets.TokenUpdater = (*Target)(nil)
+)
+
 // New creates a GitHub Target with the provided config.
 // Uses http.DefaultClient unless a custom client is provided via WithHTTPClient.
 func New(name string, cfg appcfg.GitHubTargetConfig) (*Target, error) {
@@ -38,10 +67,26 @@ func New(name string, cfg appcfg.GitHubTargetConfig) (*Target, error) {
 	if strings.TrimSpace(cfg.APIBaseURL) == "" {
 		cfg.APIBaseURL = "https://api.github.com"
 	}
+	if cfg.BatchWindow > 0 && cfg.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive when batching")
+	}
+	if cfg.BlobConcurrency <= 0 {
+		cfg.BlobConcurrency = DefaultBlobConcurrency
+	}
+	if cfg.BatchPathCollision == "" {
+		cfg.BatchPathCollision = appcfg.PathCollisionSuffix
+	}
+	if cfg.RateLimitRetries == 0 {
+		cfg.RateLimitRetries = DefaultRateLimitRetries
+	}
+	if cfg.RateLimitMaxWait == 0 {
+		cfg.RateLimitMaxWait = DefaultRateLimitMaxWait
+	}
 	return &Target{
-		name: name,
-		cfg:  cfg,
-		http: http.DefaultClient,
+		name:  name,
+		cfg:   cfg,
+		http:  http.DefaultClient,
+		token: cfg.Auth.Token,
 	}, nil
 }
 
@@ -53,6 +98,21 @@ func (t *Target) WithHTTPClient(c *http.Client) *Target {
 
 func (t *Target) Name() string { return t.name }
 
+// SetToken replaces the API token, e.g. after the token file was rotated. Operations
+// already running finish with the token they started with.
+func (t *Target) SetToken(token string) {
+	t.tokenMu.Lock()
+	t.token = token
+	t.tokenMu.Unlock()
+}
+
+// currentToken returns the token for a new operation.
+func (t *Target) currentToken() string {
+	t.tokenMu.RLock()
+	defer t.tokenMu.RUnlock()
+	return t.token
+}
+
 func (t *Target) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
 	// Render filename/path
 	filename, err := t.renderFilename(req)
@@ -60,6 +120,7 @@ func (t *Target) Post(ctx context.Context, req targets.TargetRequest) (targets.T
 		return targets.TargetResult{}, err
 	}
 	path := filepath.ToSlash(filename)
+	branch := t.branch(req)
 
 	// Render commit message
 	commitMsg, err := t.renderCommitMessage(req)
@@ -67,102 +128,306 @@ func (t *Target) Post(ctx context.Context, req targets.TargetRequest) (targets.T
 		return targets.TargetResult{}, err
 	}
 
+	post := &batchFile{files: []repoFile{{path: path, content: req.Markdown}}, message: commitMsg, author: t.author(req)}
+	if t.cfg.WriteManifest {
+		b, err := targets.NewManifest(req, path).Marshal()
+		if err != nil {
+			return targets.TargetResult{}, fmt.Errorf("marshal manifest: %w", err)
+		}
+		post.files = append(post.files, repoFile{path: targets.ManifestPath(path), content: string(b)})
+	}
+	commit, err := t.write(ctx, branch, post)
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+	path = post.files[0].path // renamed if it collided with another file of its batch
+	res := targets.TargetResult{TargetName: t.name, Location: t.location(branch, path), Commit: commit}
+
+	// Mirror the files to the additional branches, each with a commit of its own.
+	for _, b := range t.cfg.AdditionalBranches {
+		if b == branch {
+			continue
+		}
+		c, err := t.write(ctx, b, &batchFile{files: post.files, message: post.message, author: post.author})
+		if err != nil {
+			return targets.TargetResult{}, fmt.Errorf("additional branch %s (already committed %s to %s): %w", b, commit, branch, err)
+		}
+		if res.BranchCommits == nil {
+			res.BranchCommits = make(map[string]string)
+		}
+		res.BranchCommits[b] = c
+	}
+	return res, nil
+}
+
+// write commits the files of post to branch and returns the commit SHA: with the batch
+// of the branch when batching is on, in a single Git Data API commit when there are
+// several files (the Contents API writes one file per commit), and with the Contents
+// API otherwise.
+func (t *Target) write(ctx context.Context, branch string, post *batchFile) (string, error) {
+	switch {
+	case t.cfg.BatchWindow > 0:
+		return t.postBatched(ctx, branch, post)
+	case len(post.files) > 1:
+		return t.commitFiles(ctx, branch, []*batchFile{post})
+	default:
+		return t.putFile(ctx, branch, post)
+	}
+}
+
+// putFile creates the single file of post on branch with the Contents API, or updates it
+// if the path already exists, so re-running a job with a deterministic filename works.
+func (t *Target) putFile(ctx context.Context, branch string, post *batchFile) (string, error) {
+	f := post.files[0]
+	token := t.currentToken()
+	contentsURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s", strings.TrimRight(t.cfg.APIBaseURL, "/"), t.cfg.RepositoryOwner, t.cfg.RepositoryName, f.path)
+	sha, err := t.existingSHA(ctx, token, contentsURL, branch)
+	if err != nil {
+		return "", err
+	}
+
 	// Build payload per GitHub API: Create or update file contents
 	// https://docs.github.com/en/rest/repos/contents?apiVersion=2022-11-28#create-or-update-file-contents
 	payload := createFilePayload{
-		Message: commitMsg,
-		Content: base64.StdEncoding.EncodeToString([]byte(req.Markdown)),
-		Branch:  t.cfg.Branch,
+		Message: post.message,
+		Content: base64.StdEncoding.EncodeToString([]byte(f.content)),
+		Branch:  branch,
 		Committer: &gitIdentity{
 			Name:  t.cfg.AuthorName,
 			Email: t.cfg.AuthorEmail,
 		},
-		Author: &gitIdentity{
-			Name:  t.cfg.AuthorName,
-			Email: t.cfg.AuthorEmail,
-		},
+		Author: post.author,
+		SHA:    sha,
 	}
 
 	// Marshal JSON
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return targets.TargetResult{}, fmt.Errorf("marshal payload: %w", err)
+		return "", fmt.Errorf("marshal payload: %w", err)
 	}
 
-	// Construct URL: {apiBase}/repos/{owner}/{repo}/contents/{path}
-	url := fmt.Sprintf("%s/repos/%s/%s/contents/%s", strings.TrimRight(t.cfg.APIBaseURL, "/"), t.cfg.RepositoryOwner, t.cfg.RepositoryName, path)
-
-	// Prepare request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
-	if err != nil {
-		return targets.TargetResult{}, fmt.Errorf("new request: %w", err)
-	}
-	httpReq.Header.Set("Authorization", "Bearer "+t.cfg.Auth.Token)
-	httpReq.Header.Set("Accept", "application/vnd.github+json")
-	// Use the API version mentioned in docs
-	httpReq.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	// Perform request
-	resp, err := t.http.Do(httpReq)
+	// Perform request, retrying after secondary rate limits
+	resp, err := t.do(ctx, func() (*http.Request, error) {
+		httpReq, err := t.newAPIRequest(ctx, token, http.MethodPut, contentsURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		return httpReq, nil
+	})
 	if err != nil {
-		return targets.TargetResult{}, fmt.Errorf("github request: %w", err)
+		return "", err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// Successful create returns 201; update returns 200. We expect create.
+	// Successful create returns 201; update returns 200.
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
 		// Attempt to read error details
 		var apiErr apiError
 		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
 		if apiErr.Message != "" {
-			return targets.TargetResult{}, fmt.Errorf("github api: status %d: %s", resp.StatusCode, apiErr.Message)
+			return "", fmt.Errorf("github api: status %d: %s", resp.StatusCode, apiErr.Message)
 		}
-		return targets.TargetResult{}, fmt.Errorf("github api: status %d", resp.StatusCode)
+		return "", fmt.Errorf("github api: status %d", resp.StatusCode)
 	}
 
 	var out createFileResponse
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return targets.TargetResult{}, fmt.Errorf("decode response: %w", err)
+		return "", fmt.Errorf("decode response: %w", err)
 	}
+	return out.Commit.SHA, nil
+}
 
-	commitSHA := ""
-	if out.Commit.SHA != "" {
-		commitSHA = out.Commit.SHA
+// existingSHA returns the blob SHA of the file at contentsURL on branch, which the
+// Contents API requires to update it, or "" if the file does not exist yet.
+func (t *Target) existingSHA(ctx context.Context, token, contentsURL, branch string) (string, error) {
+	u := contentsURL + "?ref=" + url.QueryEscape(branch)
+	resp, err := t.do(ctx, func() (*http.Request, error) {
+		return t.newAPIRequest(ctx, token, http.MethodGet, u, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var out struct {
+			SHA string `json:"sha"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return "", fmt.Errorf("decode existing file: %w", err)
+		}
+		return out.SHA, nil
+	case http.StatusNotFound:
+		return "", nil
+	}
+	var apiErr apiError
+	_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+	if apiErr.Message != "" {
+		return "", fmt.Errorf("github api: get existing file: status %d: %s", resp.StatusCode, apiErr.Message)
 	}
+	return "", fmt.Errorf("github api: get existing file: status %d", resp.StatusCode)
+}
 
-	loc := fmt.Sprintf("github:%s/%s@%s:%s", t.cfg.RepositoryOwner, t.cfg.RepositoryName, t.cfg.Branch, path)
-	return targets.TargetResult{
-		TargetName: t.name,
-		Location:   loc,
-		Commit:     commitSHA,
-	}, nil
+// location formats the result location "github:owner/repo@branch:path".
+func (t *Target) location(branch, path string) string {
+	return fmt.Sprintf("github:%s/%s@%s:%s", t.cfg.RepositoryOwner, t.cfg.RepositoryName, branch, path)
+}
+
+// ViewURL converts a location of the form "github:owner/repo@branch:path" into the
+// file's blob URL on the GitHub web UI (or the GitHub Enterprise host).
+func (t *Target) ViewURL(location string) (string, bool) {
+	rest, ok := strings.CutPrefix(location, "github:")
+	if !ok {
+		return "", false
+	}
+	repo, rest, ok := strings.Cut(rest, "@")
+	if !ok {
+		return "", false
+	}
+	branch, path, ok := strings.Cut(rest, ":")
+	if !ok || repo == "" || branch == "" || path == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%s/%s/blob/%s/%s", t.webBaseURL(), repo, escapeSegments(branch), escapeSegments(path)), true
+}
+
+// webBaseURL derives the web UI base from the API base URL: api.github.com maps to
+// github.com, GitHub Enterprise API URLs (https://host/api/v3) to https://host.
+func (t *Target) webBaseURL() string {
+	u, err := url.Parse(strings.TrimRight(t.cfg.APIBaseURL, "/"))
+	if err != nil || u.Host == "" {
+		return "https://github.com"
+	}
+	if strings.EqualFold(u.Host, "api.github.com") {
+		return "https://github.com"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/api/v3")
+	return strings.TrimRight(u.String(), "/")
+}
+
+// escapeSegments path-escapes each segment of a slash separated path.
+func escapeSegments(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// Validate checks that the configured repository and branch exist and are reachable
+// with the configured token. A success is cached; transient failures are tried again.
+func (t *Target) Validate(ctx context.Context) error {
+	return t.validated.Check(ctx, func() error {
+		token := t.currentToken()
+		base := fmt.Sprintf("%s/repos/%s/%s", strings.TrimRight(t.cfg.APIBaseURL, "/"), t.cfg.RepositoryOwner, t.cfg.RepositoryName)
+		if err := t.checkExists(ctx, token, base); err != nil {
+			return fmt.Errorf("repository %s/%s: %w", t.cfg.RepositoryOwner, t.cfg.RepositoryName, err)
+		}
+		for _, branch := range append([]string{t.cfg.Branch}, t.cfg.AdditionalBranches...) {
+			if err := t.checkExists(ctx, token, base+"/branches/"+url.PathEscape(branch)); err != nil {
+				return fmt.Errorf("branch %s: %w", branch, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (t *Target) checkExists(ctx context.Context, token, u string) error {
+	resp, err := t.do(ctx, func() (*http.Request, error) {
+		return t.newAPIRequest(ctx, token, http.MethodGet, u, nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr apiError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		err := fmt.Errorf("github api: status %d", resp.StatusCode)
+		if apiErr.Message != "" {
+			err = fmt.Errorf("github api: status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		if targets.IsTransientStatus(resp.StatusCode) {
+			return targets.Transient(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// newAPIRequest builds a request carrying the auth and API version headers. Operations
+// with several requests pass the same token to all of them.
+func (t *Target) newAPIRequest(ctx context.Context, token, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	// Use the API version mentioned in docs
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	tracing.Inject(ctx, req.Header)
+	return req, nil
 }
 
 func (t *Target) renderFilename(req targets.TargetRequest) (string, error) {
 	data := t.templateData(req)
-	name, err := t.render(t.cfg.FilenameTemplate, "{{ .Timestamp.Format \"20060102-150405\" }}-{{ .JobID }}.md", "filename", data)
+	name, err := t.render(req.FilenameTemplate, t.cfg.FilenameTemplate, "{{ .Timestamp.Format \"20060102-150405\" }}-{{ .JobID }}.md", "filename", data)
 	if err != nil {
 		return "", err
 	}
 	if name == "" {
 		name = fmt.Sprintf("%s-%s.md", req.Timestamp.Format("20060102-150405"), req.JobID)
 	}
-	if t.cfg.BasePath != "" {
-		name = filepath.Join(t.cfg.BasePath, name)
+	basePath := t.cfg.BasePath
+	if req.BasePath != "" {
+		basePath = req.BasePath
 	}
-	return name, nil
+	if basePath != "" {
+		name = filepath.Join(basePath, name)
+	}
+	// Long suggested titles can exceed the path component limit of the repository host.
+	limit := t.cfg.MaxFilenameLength
+	if limit <= 0 {
+		limit = util.MaxFilenameLength
+	}
+	return util.TruncateFilename(filepath.ToSlash(name), limit), nil
+}
+
+// author returns the commit author: the requesting user when useRequestIdentity is set
+// and the request carries an identity, the configured author otherwise. Missing parts
+// fall back to the configured values. The committer always stays the configured bot.
+func (t *Target) author(req targets.TargetRequest) *gitIdentity {
+	id := &gitIdentity{Name: t.cfg.AuthorName, Email: t.cfg.AuthorEmail}
+	if !t.cfg.UseRequestIdentity || (req.AuthorName == "" && req.AuthorEmail == "") {
+		return id
+	}
+	id.Name = firstNonEmpty(req.AuthorName, req.AuthorEmail, id.Name)
+	id.Email = firstNonEmpty(req.AuthorEmail, id.Email)
+	return id
+}
+
+// branch returns the per-request branch override or the configured branch.
+func (t *Target) branch(req targets.TargetRequest) string {
+	if req.Branch != "" {
+		return req.Branch
+	}
+	return t.cfg.Branch
 }
 
 func (t *Target) renderCommitMessage(req targets.TargetRequest) (string, error) {
 	data := t.templateData(req)
-	msg, err := t.render(t.cfg.CommitMessageTemplate, "Add transcription {{ .JobID }}", "commit", data)
+	msg, err := t.render(req.CommitTemplate, t.cfg.CommitMessageTemplate, "Add transcription {{ .JobID }}", "commit", data)
 	if err != nil {
 		return "", err
 	}
 	if msg == "" {
 		msg = "Add transcription"
 	}
+	if t.cfg.CommitActorPrefix && req.Actor != "" {
+		msg = fmt.Sprintf("[%s] %s", req.Actor, msg)
+	}
 	return msg, nil
 }
 
@@ -171,18 +436,22 @@ func (t *Target) templateData(req targets.TargetRequest) map[string]any {
 		"JobID":          req.JobID,
 		"Timestamp":      req.Timestamp,
 		"SuggestedTitle": req.SuggestedTitle,
+		"Actor":          req.Actor,
 		"Metadata":       req.Metadata,
+		"Model":          req.Model,
+		"TokenUsage":     req.TokenUsage,
+		"DurationMs":     req.DurationMs,
+		"Language":       req.Language,
+		"Flavor":         req.Flavor,
 	}
 }
 
-func (t *Target) render(tplStr, defaultTpl, name string, data map[string]any) (string, error) {
-	s := strings.TrimSpace(tplStr)
-	if s == "" {
-		s = defaultTpl
-	}
-	tpl, err := template.New(name).Parse(s)
+// render executes the per-request template override, or else the configured template, or
+// else defaultTpl.
+func (t *Target) render(override, configured, defaultTpl, name string, data map[string]any) (string, error) {
+	tpl, err := t.template(override, configured, defaultTpl, name)
 	if err != nil {
-		return "", fmt.Errorf("parse %s template: %w", name, err)
+		return "", err
 	}
 	var buf bytes.Buffer
 	if err := tpl.Execute(&buf, data); err != nil {
@@ -191,6 +460,47 @@ func (t *Target) render(tplStr, defaultTpl, name string, data map[string]any) (s
 	return strings.TrimSpace(buf.String()), nil
 }
 
+// template returns the parsed template for render. Configured and default templates are
+// parsed once and shared, which is safe as execution does not modify them. Per-request
+// overrides are parsed on each use so arbitrary client input does not grow the cache.
+func (t *Target) template(override, configured, defaultTpl, name string) (*template.Template, error) {
+	if s := strings.TrimSpace(override); s != "" {
+		return parseTemplate(name, s)
+	}
+	s := strings.TrimSpace(configured)
+	if s == "" {
+		s = defaultTpl
+	}
+	key := name + "\x00" + s
+	if tpl, ok := t.templates.Load(key); ok {
+		return tpl.(*template.Template), nil
+	}
+	tpl, err := parseTemplate(name, s)
+	if err != nil {
+		return nil, err
+	}
+	t.templates.Store(key, tpl)
+	return tpl, nil
+}
+
+func parseTemplate(name, s string) (*template.Template, error) {
+	tpl, err := template.New(name).Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s template: %w", name, err)
+	}
+	return tpl, nil
+}
+
+// firstNonEmpty returns the first value that is not blank.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // Payload and response structures
 
 type gitIdentity struct {
@@ -204,6 +514,7 @@ type createFilePayload struct {
 	Branch    string       `json:"branch,omitempty"`
 	Committer *gitIdentity `json:"committer,omitempty"`
 	Author    *gitIdentity `json:"author,omitempty"`
+	SHA       string       `json:"sha,omitempty"` // of the file being replaced
 }
 
 type createFileResponse struct {
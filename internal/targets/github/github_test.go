@@ -66,6 +66,10 @@ func TestNameAndPost(t *testing.T) {
 		Body   map[string]any
 	}
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		received.Method = r.Method
 		received.URL = r.URL.Path
 		defer func() { _ = r.Body.Close() }()
@@ -145,3 +149,506 @@ func TestNameAndPost(t *testing.T) {
 		t.Fatalf("payload content missing")
 	}
 }
+
+func TestValidate_ChecksRepoAndBranchAndCaches(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		branchCode int
+		wantErr    bool
+	}{
+		{name: "branch exists", branchCode: http.StatusOK, wantErr: false},
+		{name: "branch missing", branchCode: http.StatusNotFound, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				if r.Header.Get("Authorization") != "Bearer token123" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				switch r.URL.Path {
+				case "/repos/org/repo":
+					w.WriteHeader(http.StatusOK)
+				case "/repos/org/repo/branches/main":
+					w.WriteHeader(tc.branchCode)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			tg, err := New("docs", appcfg.GitHubTargetConfig{
+				RepositoryOwner: "org",
+				RepositoryName:  "repo",
+				Branch:          "main",
+				APIBaseURL:      srv.URL,
+				Auth:            appcfg.GitHubAuthConfig{Token: "token123"},
+			})
+			if err != nil {
+				t.Fatalf("New github target: %v", err)
+			}
+			tg.WithHTTPClient(srv.Client())
+
+			err = tg.Validate(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Validate error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if len(calls) != 2 || calls[0] != "GET /repos/org/repo" || calls[1] != "GET /repos/org/repo/branches/main" {
+				t.Fatalf("unexpected calls: %v", calls)
+			}
+			// A success is served from cache; a failure is checked again.
+			_ = tg.Validate(context.Background())
+			want := 2
+			if tc.wantErr {
+				want = 4
+			}
+			if len(calls) != want {
+				t.Fatalf("expected %d calls after the second validation, got %v", want, calls)
+			}
+		})
+	}
+}
+
+func TestTemplates_Actor(t *testing.T) {
+	cfg := appcfg.GitHubTargetConfig{
+		FilenameTemplate:      "{{ with .Actor }}{{ . }}/{{ end }}{{ .JobID }}.md",
+		CommitMessageTemplate: "Add {{ .JobID }}{{ with .Actor }} by {{ . }}{{ end }}",
+		RepositoryOwner:       "org",
+		RepositoryName:        "repo",
+		Branch:                "main",
+		Auth:                  appcfg.GitHubAuthConfig{Token: "x"},
+	}
+	tg, err := New("docs", cfg)
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+
+	req := targets.TargetRequest{JobID: "job-1", Actor: "mobile-app", Timestamp: time.Now().UTC()}
+	fn, _ := tg.renderFilename(req)
+	if fn != "mobile-app/job-1.md" {
+		t.Fatalf("filename with actor = %q", fn)
+	}
+	msg, _ := tg.renderCommitMessage(req)
+	if msg != "Add job-1 by mobile-app" {
+		t.Fatalf("commit message with actor = %q", msg)
+	}
+
+	// Empty actor renders nothing
+	req.Actor = ""
+	fn, _ = tg.renderFilename(req)
+	msg, _ = tg.renderCommitMessage(req)
+	if fn != "job-1.md" || msg != "Add job-1" {
+		t.Fatalf("unexpected rendering without actor: %q, %q", fn, msg)
+	}
+
+	// Prefix option
+	tg.cfg.CommitActorPrefix = true
+	tg.cfg.CommitMessageTemplate = "Add {{ .JobID }}"
+	msg, _ = tg.renderCommitMessage(targets.TargetRequest{JobID: "job-1", Actor: "mobile-app"})
+	if msg != "[mobile-app] Add job-1" {
+		t.Fatalf("prefixed commit message = %q", msg)
+	}
+	msg, _ = tg.renderCommitMessage(targets.TargetRequest{JobID: "job-1"})
+	if msg != "Add job-1" {
+		t.Fatalf("no prefix expected without actor, got %q", msg)
+	}
+}
+
+func TestRenderFilename_TruncatesLongTitle(t *testing.T) {
+	cfg := appcfg.GitHubTargetConfig{
+		BasePath:          "inbox/",
+		FilenameTemplate:  "{{ .SuggestedTitle }}.md",
+		MaxFilenameLength: 100,
+		RepositoryOwner:   "org",
+		RepositoryName:    "repo",
+		Branch:            "main",
+		Auth:              appcfg.GitHubAuthConfig{Token: "x"},
+	}
+	tg, err := New("docs", cfg)
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	title := strings.Repeat("Meeting notes about the quarterly planning ", 10)
+	fn, err := tg.renderFilename(targets.TargetRequest{JobID: "job-1", SuggestedTitle: &title})
+	if err != nil {
+		t.Fatalf("renderFilename: %v", err)
+	}
+	if !strings.HasPrefix(fn, "inbox/Meeting notes") || !strings.HasSuffix(fn, ".md") {
+		t.Fatalf("unexpected filename: %q", fn)
+	}
+	if base := strings.TrimPrefix(fn, "inbox/"); len(base) != 100 {
+		t.Fatalf("basename length = %d, want 100: %q", len(base), base)
+	}
+
+	// Without an explicit limit the common 255 byte limit applies.
+	tg.cfg.MaxFilenameLength = 0
+	fn, _ = tg.renderFilename(targets.TargetRequest{JobID: "job-1", SuggestedTitle: &title})
+	if base := strings.TrimPrefix(fn, "inbox/"); len(base) > 255 || !strings.HasSuffix(base, ".md") {
+		t.Fatalf("default limit not applied: %d bytes %q", len(base), base)
+	}
+}
+
+func TestAuthor_RequestIdentity(t *testing.T) {
+	cfg := appcfg.GitHubTargetConfig{
+		RepositoryOwner: "org",
+		RepositoryName:  "repo",
+		Branch:          "main",
+		AuthorName:      "Gostwriter Bot",
+		AuthorEmail:     "bot@example.com",
+		Auth:            appcfg.GitHubAuthConfig{Token: "x"},
+	}
+	tg, err := New("docs", cfg)
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	withID := targets.TargetRequest{AuthorName: "Jane Doe", AuthorEmail: "jane@example.com"}
+
+	if got := *tg.author(withID); got != (gitIdentity{Name: "Gostwriter Bot", Email: "bot@example.com"}) {
+		t.Fatalf("identity must be ignored unless enabled, got %+v", got)
+	}
+	tg.cfg.UseRequestIdentity = true
+	cases := []struct {
+		req  targets.TargetRequest
+		want gitIdentity
+	}{
+		{withID, gitIdentity{Name: "Jane Doe", Email: "jane@example.com"}},
+		{targets.TargetRequest{AuthorName: "jane"}, gitIdentity{Name: "jane", Email: "bot@example.com"}},
+		{targets.TargetRequest{AuthorEmail: "jane@example.com"}, gitIdentity{Name: "jane@example.com", Email: "jane@example.com"}},
+		{targets.TargetRequest{}, gitIdentity{Name: "Gostwriter Bot", Email: "bot@example.com"}},
+	}
+	for _, tc := range cases {
+		if got := *tg.author(tc.req); got != tc.want {
+			t.Errorf("author(%+v) = %+v, want %+v", tc.req, got, tc.want)
+		}
+	}
+}
+
+func TestTemplates_ProcessingMetrics(t *testing.T) {
+	cfg := appcfg.GitHubTargetConfig{
+		CommitMessageTemplate: "Add {{ .JobID }}\n\nGostwriter-Model: {{ .Model }}\nGostwriter-Tokens: {{ .TokenUsage }}\nGostwriter-Duration-Ms: {{ .DurationMs }}\nGostwriter-Language: {{ .Language }}",
+		RepositoryOwner:       "org",
+		RepositoryName:        "repo",
+		Branch:                "main",
+		Auth:                  appcfg.GitHubAuthConfig{Token: "x"},
+	}
+	tg, err := New("docs", cfg)
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	msg, err := tg.renderCommitMessage(targets.TargetRequest{JobID: "job-1", Model: "gpt-5", TokenUsage: 1234, DurationMs: 5678, Language: "de"})
+	if err != nil {
+		t.Fatalf("renderCommitMessage: %v", err)
+	}
+	want := "Add job-1\n\nGostwriter-Model: gpt-5\nGostwriter-Tokens: 1234\nGostwriter-Duration-Ms: 5678\nGostwriter-Language: de"
+	if msg != want {
+		t.Fatalf("commit message = %q, want %q", msg, want)
+	}
+}
+
+func TestPost_BranchAndBasePathOverrides(t *testing.T) {
+	var gotPath string
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"commit": map[string]any{"sha": "abc"}})
+	}))
+	defer srv.Close()
+
+	tg, err := New("docs", appcfg.GitHubTargetConfig{
+		RepositoryOwner:  "org",
+		RepositoryName:   "repo",
+		Branch:           "main",
+		BasePath:         "inbox/",
+		FilenameTemplate: "{{ .JobID }}.md",
+		APIBaseURL:       srv.URL,
+		Auth:             appcfg.GitHubAuthConfig{Token: "x"},
+	})
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	tg.WithHTTPClient(srv.Client())
+
+	res, err := tg.Post(context.Background(), targets.TargetRequest{
+		JobID:     "job-1",
+		Markdown:  "md",
+		Timestamp: time.Now().UTC(),
+		Branch:    "drafts",
+		BasePath:  "notes/",
+	})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if gotPath != "/repos/org/repo/contents/notes/job-1.md" {
+		t.Fatalf("base path override not applied: %s", gotPath)
+	}
+	if body["branch"] != "drafts" {
+		t.Fatalf("branch override not applied: %v", body["branch"])
+	}
+	if res.Location != "github:org/repo@drafts:notes/job-1.md" {
+		t.Fatalf("Location mismatch: %s", res.Location)
+	}
+}
+
+func TestRenderFilenameAndCommitMessage_PerRequestTemplates(t *testing.T) {
+	tg, err := New("docs", appcfg.GitHubTargetConfig{
+		FilenameTemplate:      "{{ .JobID }}.md",
+		CommitMessageTemplate: "Add {{ .JobID }}",
+		RepositoryOwner:       "org",
+		RepositoryName:        "repo",
+		Branch:                "main",
+		Auth:                  appcfg.GitHubAuthConfig{Token: "x"},
+	})
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	req := targets.TargetRequest{
+		JobID:            "job-1",
+		Timestamp:        time.Now().UTC(),
+		FilenameTemplate: "custom-{{ .JobID }}.md",
+		CommitTemplate:   "Custom {{ .JobID }}",
+	}
+	fn, err := tg.renderFilename(req)
+	if err != nil || fn != "custom-job-1.md" {
+		t.Fatalf("per-request filename template not used: %q, %v", fn, err)
+	}
+	msg, err := tg.renderCommitMessage(req)
+	if err != nil || msg != "Custom job-1" {
+		t.Fatalf("per-request commit template not used: %q, %v", msg, err)
+	}
+
+	// Blank per-request templates fall back to the configured ones.
+	req.FilenameTemplate, req.CommitTemplate = " ", ""
+	if fn, _ := tg.renderFilename(req); fn != "job-1.md" {
+		t.Fatalf("configured filename template not used: %q", fn)
+	}
+	if msg, _ := tg.renderCommitMessage(req); msg != "Add job-1" {
+		t.Fatalf("configured commit template not used: %q", msg)
+	}
+
+	// Only the configured templates are cached; overrides are parsed per request.
+	n := 0
+	tg.templates.Range(func(_, _ any) bool { n++; return true })
+	if n != 2 {
+		t.Fatalf("cached templates = %d, want 2", n)
+	}
+}
+
+// BenchmarkRenderFilename compares configured templates, which are parsed once, with
+// per-request overrides, which are parsed on every call.
+func BenchmarkRenderFilename(b *testing.B) {
+	tg, err := New("docs", appcfg.GitHubTargetConfig{
+		FilenameTemplate: "{{ .Timestamp.Format \"20060102-150405\" }}-{{ .JobID }}.md",
+		RepositoryOwner:  "org",
+		RepositoryName:   "repo",
+		Branch:           "main",
+		Auth:             appcfg.GitHubAuthConfig{Token: "x"},
+	})
+	if err != nil {
+		b.Fatalf("New github target: %v", err)
+	}
+	req := targets.TargetRequest{JobID: "job-1", Timestamp: time.Now().UTC()}
+	b.Run("configured", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := tg.renderFilename(req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	override := req
+	override.FilenameTemplate = tg.cfg.FilenameTemplate
+	b.Run("per-request", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := tg.renderFilename(override); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestViewURL(t *testing.T) {
+	for _, tc := range []struct {
+		apiBase, location, want string
+		ok                      bool
+	}{
+		{"https://api.github.com", "github:org/repo@main:inbox/a b.md", "https://github.com/org/repo/blob/main/inbox/a%20b.md", true},
+		{"https://ghe.example.com/api/v3/", "github:org/repo@feature/x:a.md", "https://ghe.example.com/org/repo/blob/feature/x/a.md", true},
+		{"https://api.github.com", "confluence:whatever", "", false},
+		{"https://api.github.com", "github:org/repo", "", false},
+	} {
+		tg, err := New("docs", appcfg.GitHubTargetConfig{
+			RepositoryOwner: "org", RepositoryName: "repo", Branch: "main",
+			APIBaseURL: tc.apiBase, Auth: appcfg.GitHubAuthConfig{Token: "x"},
+		})
+		if err != nil {
+			t.Fatalf("New github target: %v", err)
+		}
+		got, ok := tg.ViewURL(tc.location)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("ViewURL(%q) with %s = %q, %v; want %q, %v", tc.location, tc.apiBase, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestPost_AdditionalBranches(t *testing.T) {
+	var branches []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body createFilePayload
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != http.MethodPut || r.URL.Path != "/repos/org/repo/contents/job-1.md" || body.Message != "Add job-1" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		branches = append(branches, body.Branch)
+		if body.Branch == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Branch missing not found"})
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"commit": map[string]string{"sha": "sha-" + body.Branch}})
+	}))
+	defer srv.Close()
+
+	tg, err := New("docs", appcfg.GitHubTargetConfig{
+		RepositoryOwner:       "org",
+		RepositoryName:        "repo",
+		Branch:                "main",
+		AdditionalBranches:    []string{"published", "main", "archive"},
+		FilenameTemplate:      "{{ .JobID }}.md",
+		CommitMessageTemplate: "Add {{ .JobID }}",
+		APIBaseURL:            srv.URL,
+		Auth:                  appcfg.GitHubAuthConfig{Token: "x"},
+	})
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	tg.WithHTTPClient(srv.Client())
+
+	res, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	// The primary branch is not written twice.
+	if strings.Join(branches, ",") != "main,published,archive" {
+		t.Fatalf("committed to %v", branches)
+	}
+	if res.Commit != "sha-main" || res.Location != "github:org/repo@main:job-1.md" ||
+		len(res.BranchCommits) != 2 || res.BranchCommits["published"] != "sha-published" || res.BranchCommits["archive"] != "sha-archive" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	branches = nil
+	tg.cfg.AdditionalBranches = []string{"missing"}
+	_, err = tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now().UTC()})
+	if err == nil || !strings.Contains(err.Error(), "additional branch missing") || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing branch error, got %v", err)
+	}
+}
+
+func TestPost_CreatesOrUpdatesExistingFile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		existing string // sha of the file already on the branch, "" if absent
+	}{
+		{name: "create", existing: ""},
+		{name: "update", existing: "blob-1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var lookup string
+			var body createFilePayload
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/org/repo/contents/notes/job-1.md" {
+					http.Error(w, "unexpected path", http.StatusBadRequest)
+					return
+				}
+				if r.Method == http.MethodGet {
+					lookup = r.URL.Query().Get("ref")
+					if tc.existing == "" {
+						w.WriteHeader(http.StatusNotFound)
+						_ = json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+						return
+					}
+					_ = json.NewEncoder(w).Encode(map[string]string{"path": "notes/job-1.md", "sha": tc.existing})
+					return
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				if body.SHA != "" {
+					w.WriteHeader(http.StatusOK)
+				} else {
+					w.WriteHeader(http.StatusCreated)
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"commit": map[string]string{"sha": "commit-1"}})
+			}))
+			defer srv.Close()
+
+			tg, err := New("docs", appcfg.GitHubTargetConfig{
+				RepositoryOwner:  "org",
+				RepositoryName:   "repo",
+				Branch:           "main",
+				BasePath:         "notes",
+				FilenameTemplate: "{{ .JobID }}.md",
+				APIBaseURL:       srv.URL,
+				Auth:             appcfg.GitHubAuthConfig{Token: "x"},
+			})
+			if err != nil {
+				t.Fatalf("New github target: %v", err)
+			}
+			tg.WithHTTPClient(srv.Client())
+
+			res, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now().UTC()})
+			if err != nil {
+				t.Fatalf("Post: %v", err)
+			}
+			if lookup != "main" {
+				t.Fatalf("existing file looked up on ref %q", lookup)
+			}
+			if body.SHA != tc.existing || body.Branch != "main" {
+				t.Fatalf("PUT payload sha %q branch %q, want sha %q", body.SHA, body.Branch, tc.existing)
+			}
+			if res.Commit != "commit-1" {
+				t.Fatalf("Commit mismatch: %s", res.Commit)
+			}
+		})
+	}
+}
+
+func TestPost_ExistingFileLookupError(t *testing.T) {
+	var puts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Bad credentials"})
+			return
+		}
+		puts++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	tg, err := New("docs", appcfg.GitHubTargetConfig{
+		RepositoryOwner: "org", RepositoryName: "repo", Branch: "main", APIBaseURL: srv.URL,
+		Auth: appcfg.GitHubAuthConfig{Token: "x"},
+	})
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	tg.WithHTTPClient(srv.Client())
+
+	_, err = tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now().UTC()})
+	if err == nil || !strings.Contains(err.Error(), "status 401: Bad credentials") || puts != 0 {
+		t.Fatalf("expected the lookup error without a PUT, got %v after %d PUTs", err, puts)
+	}
+}
@@ -0,0 +1,79 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// secondaryLimitWait is the wait GitHub recommends after a secondary rate limit
+// response without Retry-After.
+const secondaryLimitWait = time.Minute
+
+// Defaults for GitHubTargetConfig.RateLimitRetries and RateLimitMaxWait.
+const (
+	DefaultRateLimitRetries = 3
+	DefaultRateLimitMaxWait = time.Minute
+)
+
+// isSecondaryRateLimit reports whether resp is a secondary rate limit response: 403 or
+// 429 with a Retry-After header or a message about the secondary rate limit. Unlike the
+// primary limit it lifts after a short wait, so the request is worth retrying. The body
+// stays readable for the caller.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	if resp.Header.Get("Retry-After") != "" {
+		return true
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
+
+// retryAfter returns the wait requested by the Retry-After header in seconds, or
+// secondaryLimitWait if there is none.
+func retryAfter(resp *http.Response) time.Duration {
+	if s, err := strconv.Atoi(strings.TrimSpace(resp.Header.Get("Retry-After"))); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second
+	}
+	return secondaryLimitWait
+}
+
+// do sends the request built by newReq. After a secondary rate limit it waits as asked
+// and retries up to RateLimitRetries times, giving up early when the wait would exceed
+// RateLimitMaxWait. newReq is called for every attempt so the body can be resent.
+func (t *Target) do(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.http.Do(req)
+		if err != nil {
+			return nil, targets.Transient(fmt.Errorf("github request: %w", err))
+		}
+		if attempt >= t.cfg.RateLimitRetries || !isSecondaryRateLimit(resp) {
+			return resp, nil
+		}
+		wait := retryAfter(resp)
+		if wait > t.cfg.RateLimitMaxWait {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package github
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// newLimitedTarget returns a target whose Contents API first answers limited times with
+// limit and then creates the file. calls counts all requests writing the file; lookups
+// of an existing file always find none.
+func newLimitedTarget(t *testing.T, limited int32, limit http.HandlerFunc, calls *atomic.Int32) *Target {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if n := calls.Add(1); n <= limited {
+			limit(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"content"`) {
+			t.Errorf("retried request lost its body: %s", body)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"commit":{"sha":"abc"}}`)
+	}))
+	t.Cleanup(ts.Close)
+	tg, err := New("docs", appcfg.GitHubTargetConfig{
+		RepositoryOwner: "org", RepositoryName: "repo", Branch: "main", APIBaseURL: ts.URL,
+		FilenameTemplate: "{{ .JobID }}.md", CommitMessageTemplate: "Add {{ .JobID }}",
+		Auth: appcfg.GitHubAuthConfig{Token: "x"},
+	})
+	if err != nil {
+		t.Fatalf("New github target: %v", err)
+	}
+	return tg.WithHTTPClient(ts.Client())
+}
+
+func post(tg *Target) (targets.TargetResult, error) {
+	return tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now().UTC()})
+}
+
+func TestPost_RetriesAfterSecondaryRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	tg := newLimitedTarget(t, 2, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"message":"You have exceeded a secondary rate limit."}`)
+	}, &calls)
+
+	res, err := post(tg)
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if res.Commit != "abc" || calls.Load() != 3 {
+		t.Fatalf("unexpected result %+v after %d calls", res, calls.Load())
+	}
+}
+
+func TestPost_SecondaryRateLimitWithoutRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	tg := newLimitedTarget(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`)
+	}, &calls)
+	// The implied one minute wait exceeds the limit, so the error is returned without retrying.
+	tg.cfg.RateLimitMaxWait = time.Second
+
+	_, err := post(tg)
+	if err == nil || !strings.Contains(err.Error(), "status 403: You have exceeded a secondary rate limit") {
+		t.Fatalf("expected the 403 with its message, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected no retry, got %d calls", calls.Load())
+	}
+}
+
+func TestPost_PermissionDeniedIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	tg := newLimitedTarget(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"message":"Resource not accessible by personal access token"}`)
+	}, &calls)
+
+	if _, err := post(tg); err == nil || calls.Load() != 1 {
+		t.Fatalf("expected an error without retry, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestPost_SecondaryRateLimitRetriesExhausted(t *testing.T) {
+	var calls atomic.Int32
+	tg := newLimitedTarget(t, 10, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}, &calls)
+	tg.cfg.RateLimitRetries = 1
+
+	if _, err := post(tg); err == nil || !strings.Contains(err.Error(), "status 429") {
+		t.Fatalf("expected status 429, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected one retry, got %d calls", calls.Load())
+	}
+}
@@ -0,0 +1,377 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+	"github.com/jo-hoe/gostwriter/internal/util"
+)
+
+const (
+	defaultFilenameTemplate = "{{ .Timestamp.Format \"20060102-150405\" }}-{{ .JobID }}.md"
+	defaultCommitTemplate   = "Add transcription {{ .JobID }}"
+)
+
+// Target implements a GitLab markdown post target using the Repository Files API,
+// committing one file per post without cloning the repository.
+type Target struct {
+	name string
+	cfg  appcfg.GitLabTargetConfig
+	http *http.Client
+
+	filenameTpl *template.Template
+	commitTpl   *template.Template
+
+	// a successful validation is cached so repeated checks do not hit the API again
+	validated targets.ValidationCache
+}
+
+var (
+	_ targets.Validator = (*Target)(nil)
+	_ targets.Viewer    = (*Target)(nil)
+)
+
+// New creates a GitLab Target with the provided config.
+// Uses http.DefaultClient unless a custom client is provided via WithHTTPClient.
+func New(name string, cfg appcfg.GitLabTargetConfig) (*Target, error) {
+	if strings.TrimSpace(cfg.Auth.Token) == "" {
+		return nil, fmt.Errorf("gitlab token must not be empty")
+	}
+	cfg.ProjectID = strings.Trim(strings.TrimSpace(cfg.ProjectID), "/")
+	if cfg.ProjectID == "" {
+		return nil, fmt.Errorf("gitlab project id must not be empty")
+	}
+	if strings.TrimSpace(cfg.Branch) == "" {
+		return nil, fmt.Errorf("branch must not be empty")
+	}
+	if strings.TrimSpace(cfg.BaseURL) == "" {
+		cfg.BaseURL = "https://gitlab.com"
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	filenameTpl, err := parseTemplate("filename", cfg.FilenameTemplate, defaultFilenameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	commitTpl, err := parseTemplate("commit", cfg.CommitMessageTemplate, defaultCommitTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &Target{
+		name:        name,
+		cfg:         cfg,
+		http:        http.DefaultClient,
+		filenameTpl: filenameTpl,
+		commitTpl:   commitTpl,
+	}, nil
+}
+
+// WithHTTPClient allows tests to inject a custom HTTP client (e.g., pointing to httptest.Server).
+func (t *Target) WithHTTPClient(c *http.Client) *Target {
+	t.http = c
+	return t
+}
+
+func (t *Target) Name() string { return t.name }
+
+// Post creates the rendered file on the branch, or updates it if the path already
+// exists. Location is "gitlab:<project>@<branch>:<path>"; Commit is the id of the
+// commit that wrote the file.
+func (t *Target) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
+	filePath, err := t.renderFilename(req)
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+	msg, err := t.render(req.CommitTemplate, t.commitTpl, "commit", req)
+	if err != nil {
+		return targets.TargetResult{}, err
+	}
+	if msg == "" {
+		msg = "Add transcription"
+	}
+	branch := t.branch(req)
+
+	existing, err := t.file(ctx, filePath, branch)
+	if err != nil {
+		return targets.TargetResult{}, fmt.Errorf("look up %s: %w", filePath, err)
+	}
+	// https://docs.gitlab.com/api/repository_files/#create-new-file-in-repository
+	method := http.MethodPost
+	if existing != nil {
+		method = http.MethodPut
+	}
+	payload := writeFilePayload{
+		Branch:        branch,
+		Content:       req.Markdown,
+		CommitMessage: msg,
+		AuthorName:    t.cfg.AuthorName,
+		AuthorEmail:   t.cfg.AuthorEmail,
+	}
+	if err := t.call(ctx, method, t.fileURL(filePath, ""), payload, nil); err != nil {
+		return targets.TargetResult{}, err
+	}
+
+	// The write response only echoes the path and branch; the commit id comes from the file.
+	written, err := t.file(ctx, filePath, branch)
+	if err != nil {
+		return targets.TargetResult{}, fmt.Errorf("read back %s: %w", filePath, err)
+	}
+	if written == nil {
+		return targets.TargetResult{}, fmt.Errorf("read back %s: file not found after write", filePath)
+	}
+	return targets.TargetResult{
+		TargetName: t.name,
+		Location:   fmt.Sprintf("gitlab:%s@%s:%s", t.cfg.ProjectID, branch, filePath),
+		Commit:     written.LastCommitID,
+	}, nil
+}
+
+// ViewURL converts a location of the form "gitlab:project@branch:path" into the file's
+// blob URL on the GitLab web UI. Projects configured by numeric id have no such URL.
+func (t *Target) ViewURL(location string) (string, bool) {
+	rest, ok := strings.CutPrefix(location, "gitlab:")
+	if !ok {
+		return "", false
+	}
+	project, rest, ok := strings.Cut(rest, "@")
+	if !ok || !strings.Contains(project, "/") {
+		return "", false
+	}
+	branch, filePath, ok := strings.Cut(rest, ":")
+	if !ok || branch == "" || filePath == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%s/%s/-/blob/%s/%s", t.cfg.BaseURL, project, escapeSegments(branch), escapeSegments(filePath)), true
+}
+
+// Validate checks that the configured project and branch exist and are reachable with
+// the configured token. A success is cached; transient failures are tried again.
+func (t *Target) Validate(ctx context.Context) error {
+	return t.validated.Check(ctx, func() error {
+		project := t.projectURL()
+		if err := t.call(ctx, http.MethodGet, project, nil, nil); err != nil {
+			return fmt.Errorf("project %s: %w", t.cfg.ProjectID, err)
+		}
+		if err := t.call(ctx, http.MethodGet, project+"/repository/branches/"+url.PathEscape(t.cfg.Branch), nil, nil); err != nil {
+			return fmt.Errorf("branch %s: %w", t.cfg.Branch, err)
+		}
+		return nil
+	})
+}
+
+// file returns the metadata of the file at filePath on branch, or nil if it does not exist.
+func (t *Target) file(ctx context.Context, filePath, branch string) (*fileResponse, error) {
+	var out fileResponse
+	err := t.call(ctx, http.MethodGet, t.fileURL(filePath, branch), nil, &out)
+	if errorStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// projectURL returns the API URL of the project; a path like group/project is encoded
+// into a single segment as the API requires.
+func (t *Target) projectURL() string {
+	return t.cfg.BaseURL + "/api/v4/projects/" + url.PathEscape(t.cfg.ProjectID)
+}
+
+// fileURL returns the Repository Files API URL of filePath, with the ref query when set.
+func (t *Target) fileURL(filePath, ref string) string {
+	u := t.projectURL() + "/repository/files/" + url.PathEscape(filePath)
+	if ref != "" {
+		u += "?ref=" + url.QueryEscape(ref)
+	}
+	return u
+}
+
+// call performs an API request with a JSON body (if non-nil) and decodes a successful
+// response into out (if non-nil). Unsuccessful responses are returned as *statusError.
+func (t *Target) call(ctx context.Context, method, u string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal payload: %w", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", t.cfg.Auth.Token)
+	tracing.Inject(ctx, req.Header)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return targets.Transient(fmt.Errorf("gitlab request: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr apiError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		err := &statusError{code: resp.StatusCode, message: apiErr.text()}
+		if targets.IsTransientStatus(resp.StatusCode) {
+			return targets.Transient(err)
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func (t *Target) renderFilename(req targets.TargetRequest) (string, error) {
+	name, err := t.render(req.FilenameTemplate, t.filenameTpl, "filename", req)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s-%s.md", req.Timestamp.Format("20060102-150405"), req.JobID)
+	}
+	basePath := t.cfg.BasePath
+	if req.BasePath != "" {
+		basePath = req.BasePath
+	}
+	if basePath != "" {
+		name = path.Join(basePath, name)
+	}
+	return util.TruncateFilename(strings.TrimPrefix(path.Clean(name), "/"), util.MaxFilenameLength), nil
+}
+
+// branch returns the per-request branch override or the configured branch.
+func (t *Target) branch(req targets.TargetRequest) string {
+	if req.Branch != "" {
+		return req.Branch
+	}
+	return t.cfg.Branch
+}
+
+// render executes the per-request template override, or else the configured template.
+func (t *Target) render(override string, configured *template.Template, name string, req targets.TargetRequest) (string, error) {
+	tpl := configured
+	if s := strings.TrimSpace(override); s != "" {
+		var err error
+		if tpl, err = parseTemplate(name, s, ""); err != nil {
+			return "", err
+		}
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, templateData(req)); err != nil {
+		return "", fmt.Errorf("render %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func templateData(req targets.TargetRequest) map[string]any {
+	return map[string]any{
+		"JobID":          req.JobID,
+		"Timestamp":      req.Timestamp,
+		"SuggestedTitle": req.SuggestedTitle,
+		"Actor":          req.Actor,
+		"Metadata":       req.Metadata,
+		"Model":          req.Model,
+		"TokenUsage":     req.TokenUsage,
+		"DurationMs":     req.DurationMs,
+		"Language":       req.Language,
+		"Flavor":         req.Flavor,
+	}
+}
+
+// parseTemplate parses s, or defaultTpl if s is blank.
+func parseTemplate(name, s, defaultTpl string) (*template.Template, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		s = defaultTpl
+	}
+	tpl, err := template.New(name).Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s template: %w", name, err)
+	}
+	return tpl, nil
+}
+
+// escapeSegments path-escapes each segment of a slash separated path.
+func escapeSegments(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// statusError is an unsuccessful API response.
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("gitlab api: status %d: %s", e.code, e.message)
+	}
+	return fmt.Sprintf("gitlab api: status %d", e.code)
+}
+
+// errorStatus returns the status code of a *statusError, or 0 for any other error.
+func errorStatus(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code
+	}
+	return 0
+}
+
+// Payload and response structures
+
+type writeFilePayload struct {
+	Branch        string `json:"branch"`
+	Content       string `json:"content"`
+	CommitMessage string `json:"commit_message"`
+	AuthorName    string `json:"author_name,omitempty"`
+	AuthorEmail   string `json:"author_email,omitempty"`
+}
+
+type fileResponse struct {
+	FilePath     string `json:"file_path"`
+	BlobID       string `json:"blob_id"`
+	LastCommitID string `json:"last_commit_id"`
+}
+
+// apiError is the error body of the GitLab API: message is a string or, for validation
+// errors, an object of messages by field; some endpoints use error instead.
+type apiError struct {
+	Message json.RawMessage `json:"message"`
+	Error   string          `json:"error"`
+}
+
+func (e apiError) text() string {
+	var s string
+	if json.Unmarshal(e.Message, &s) == nil && s != "" {
+		return s
+	}
+	if len(e.Message) > 0 && string(e.Message) != "null" {
+		return string(e.Message)
+	}
+	return e.Error
+}
@@ -0,0 +1,173 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+// fakeFiles serves the Repository Files API of project group/notes for the single file
+// inbox/job-1.md, which is created by the first write.
+type fakeFiles struct {
+	t        *testing.T
+	exists   bool
+	commit   string   // last commit of the file
+	writes   []string // methods of the write requests
+	lastBody writeFilePayload
+}
+
+func (f *fakeFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("PRIVATE-TOKEN") != "tok" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "401 Unauthorized"})
+		return
+	}
+	if r.URL.EscapedPath() != "/api/v4/projects/group%2Fnotes/repository/files/inbox%2Fjob-1.md" {
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.EscapedPath())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("ref") != "main" {
+			f.t.Errorf("unexpected ref %q", r.URL.Query().Get("ref"))
+		}
+		if !f.exists {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "404 File Not Found"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"file_path": "inbox/job-1.md", "last_commit_id": f.commit})
+	case http.MethodPost, http.MethodPut:
+		f.writes = append(f.writes, r.Method)
+		_ = json.NewDecoder(r.Body).Decode(&f.lastBody)
+		if r.Method == http.MethodPost && f.exists {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "A file with this name already exists"})
+			return
+		}
+		f.exists = true
+		f.commit = "commit-" + r.Method
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"file_path": "inbox/job-1.md", "branch": "main"})
+	}
+}
+
+func newTestTarget(t *testing.T, h http.Handler) *Target {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	tg, err := New("gl", appcfg.GitLabTargetConfig{
+		BaseURL:               srv.URL,
+		ProjectID:             "group/notes",
+		Branch:                "main",
+		BasePath:              "inbox/",
+		FilenameTemplate:      "{{ .JobID }}.md",
+		CommitMessageTemplate: "Add {{ .JobID }}",
+		AuthorName:            "Bot",
+		AuthorEmail:           "bot@example.com",
+		Auth:                  appcfg.GitLabAuthConfig{Token: "tok"},
+	})
+	if err != nil {
+		t.Fatalf("New gitlab target: %v", err)
+	}
+	return tg.WithHTTPClient(srv.Client())
+}
+
+func TestPost_CreatesThenUpdates(t *testing.T) {
+	files := &fakeFiles{t: t}
+	tg := newTestTarget(t, files)
+	req := targets.TargetRequest{JobID: "job-1", Markdown: "# Notes", Timestamp: time.Now().UTC()}
+
+	res, err := tg.Post(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if res.TargetName != "gl" || res.Location != "gitlab:group/notes@main:inbox/job-1.md" || res.Commit != "commit-POST" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	b := files.lastBody
+	if b.Branch != "main" || b.Content != "# Notes" || b.CommitMessage != "Add job-1" || b.AuthorName != "Bot" || b.AuthorEmail != "bot@example.com" {
+		t.Fatalf("unexpected payload %+v", b)
+	}
+
+	// Posting the same path again updates the file.
+	res, err = tg.Post(context.Background(), req)
+	if err != nil {
+		t.Fatalf("second Post: %v", err)
+	}
+	if strings.Join(files.writes, ",") != "POST,PUT" || res.Commit != "commit-PUT" {
+		t.Fatalf("writes %v, result %+v", files.writes, res)
+	}
+}
+
+func TestPost_APIError(t *testing.T) {
+	tg := newTestTarget(t, &fakeFiles{t: t})
+	tg.cfg.Auth.Token = "wrong"
+
+	_, err := tg.Post(context.Background(), targets.TargetRequest{JobID: "job-1", Markdown: "md", Timestamp: time.Now().UTC()})
+	if err == nil || !strings.Contains(err.Error(), "status 401: 401 Unauthorized") {
+		t.Fatalf("expected the 401 with its message, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var calls []string
+	branchCreated := false
+	tg := newTestTarget(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.EscapedPath())
+		switch {
+		case r.URL.EscapedPath() == "/api/v4/projects/group%2Fnotes":
+			_, _ = w.Write([]byte(`{"id":1}`))
+		case branchCreated:
+			_, _ = w.Write([]byte(`{"name":"main"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "404 Branch Not Found"})
+		}
+	}))
+
+	err := tg.Validate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "branch main") || !strings.Contains(err.Error(), "404 Branch Not Found") {
+		t.Fatalf("expected missing branch error, got %v", err)
+	}
+	if len(calls) != 2 || calls[1] != "/api/v4/projects/group%2Fnotes/repository/branches/main" {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+
+	// The failure is not cached: once the branch exists, validation passes and that is cached.
+	branchCreated = true
+	if err := tg.Validate(context.Background()); err != nil {
+		t.Fatalf("Validate after creating the branch: %v", err)
+	}
+	_ = tg.Validate(context.Background())
+	if len(calls) != 4 {
+		t.Fatalf("unexpected calls (a success must be cached): %v", calls)
+	}
+}
+
+func TestViewURL(t *testing.T) {
+	tg := newTestTarget(t, http.NotFoundHandler())
+	tg.cfg.BaseURL = "https://gitlab.example.com"
+
+	for _, tc := range []struct {
+		location string
+		want     string
+	}{
+		{location: "gitlab:group/notes@main:inbox/a b.md", want: "https://gitlab.example.com/group/notes/-/blob/main/inbox/a%20b.md"},
+		{location: "gitlab:42@main:inbox/a.md", want: ""},
+		{location: "github:o/r@main:a.md", want: ""},
+	} {
+		got, ok := tg.ViewURL(tc.location)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("ViewURL(%q) = %q, %v; want %q", tc.location, got, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package targets
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+)
+
+// ManifestSchemaVersion is the version of the Manifest layout. Fields are only ever
+// added; a renamed or removed field increments the version.
+const ManifestSchemaVersion = 1
+
+// Manifest is the machine-readable sidecar written next to a transcription, for
+// pipelines that consume the committed files. The JSON field names are stable.
+type Manifest struct {
+	SchemaVersion int            `json:"schema_version"`
+	JobID         string         `json:"job_id"`
+	File          string         `json:"file"`            // path of the Markdown file in the target
+	Title         string         `json:"title,omitempty"` // suggested title, if any
+	Timestamp     time.Time      `json:"timestamp"`       // job timestamp used in templates (UTC)
+	Model         string         `json:"model,omitempty"`
+	TokenUsage    int            `json:"token_usage"` // total LLM tokens; 0 if not reported
+	DurationMs    int64          `json:"duration_ms"` // time spent transcribing
+	Language      string         `json:"language,omitempty"`
+	Actor         string         `json:"actor,omitempty"`    // API key name that submitted the job
+	Metadata      map[string]any `json:"metadata,omitempty"` // metadata submitted with the job
+}
+
+// NewManifest describes req, whose Markdown is stored at file.
+func NewManifest(req TargetRequest, file string) Manifest {
+	m := Manifest{
+		SchemaVersion: ManifestSchemaVersion,
+		JobID:         req.JobID,
+		File:          file,
+		Timestamp:     req.Timestamp.UTC(),
+		Model:         req.Model,
+		TokenUsage:    req.TokenUsage,
+		DurationMs:    req.DurationMs,
+		Language:      req.Language,
+		Actor:         req.Actor,
+		Metadata:      req.Metadata,
+	}
+	if req.SuggestedTitle != nil {
+		m.Title = *req.SuggestedTitle
+	}
+	return m
+}
+
+// Marshal returns the indented JSON of m with a trailing newline.
+func (m Manifest) Marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// ManifestPath returns the sidecar path for a Markdown file: its extension (if any) is
+// replaced with .json, e.g. notes/a.md becomes notes/a.json. A file already ending in
+// .json gets a second extension so the manifest does not replace it.
+func ManifestPath(file string) string {
+	ext := path.Ext(file)
+	if ext == ".json" {
+		return file + ".json"
+	}
+	return strings.TrimSuffix(file, ext) + ".json"
+}
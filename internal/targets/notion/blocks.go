@@ -0,0 +1,195 @@
+package notion
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Markdown to Notion block conversion. Covers ATX headings, bulleted/numbered lists,
+// fenced code blocks, block quotes, dividers and paragraphs; inline code, bold, italic
+// and links become rich text annotations. Other constructs are kept as paragraph text.
+
+// maxRichTextLen is the Notion limit for the content of a single rich text object.
+const maxRichTextLen = 2000
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	unorderedRe = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRe   = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	fenceRe     = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+#.-]*)\\s*$")
+	inlineRe    = regexp.MustCompile("`([^`]+)`|\\*\\*([^*]+)\\*\\*|\\*([^*]+)\\*|\\[([^\\]]+)\\]\\(([^)\\s]+)\\)")
+)
+
+// codeLanguages maps common fence info strings to Notion code block languages.
+// Unknown languages fall back to "plain text".
+var codeLanguages = map[string]string{
+	"bash": "bash", "sh": "shell", "shell": "shell", "c": "c", "cpp": "c++", "c++": "c++",
+	"cs": "c#", "csharp": "c#", "c#": "c#", "css": "css", "go": "go", "html": "html",
+	"java": "java", "js": "javascript", "javascript": "javascript", "json": "json",
+	"kotlin": "kotlin", "markdown": "markdown", "md": "markdown", "php": "php",
+	"py": "python", "python": "python", "ruby": "ruby", "rust": "rust", "sql": "sql",
+	"ts": "typescript", "typescript": "typescript", "xml": "xml", "yaml": "yaml", "yml": "yaml",
+}
+
+type block map[string]any
+
+type richText struct {
+	Type        string       `json:"type"`
+	Text        textContent  `json:"text"`
+	Annotations *annotations `json:"annotations,omitempty"`
+}
+
+type textContent struct {
+	Content string    `json:"content"`
+	Link    *linkInfo `json:"link,omitempty"`
+}
+
+type linkInfo struct {
+	URL string `json:"url"`
+}
+
+type annotations struct {
+	Bold   bool `json:"bold,omitempty"`
+	Italic bool `json:"italic,omitempty"`
+	Code   bool `json:"code,omitempty"`
+}
+
+// toBlocks converts Markdown into Notion block objects.
+func toBlocks(md string) []block {
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	var out []block
+	var para []string
+
+	flushPara := func() {
+		if len(para) > 0 {
+			out = append(out, textBlock("paragraph", strings.Join(para, " ")))
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			flushPara()
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.TrimSpace(lines[i]) == m[1] {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			out = append(out, codeBlock(m[2], strings.Join(code, "\n")))
+			continue
+		}
+		switch {
+		case trimmed == "":
+			flushPara()
+		case headingRe.MatchString(trimmed):
+			flushPara()
+			m := headingRe.FindStringSubmatch(trimmed)
+			// Notion only has three heading levels.
+			lvl := len(m[1])
+			if lvl > 3 {
+				lvl = 3
+			}
+			out = append(out, textBlock("heading_"+strconv.Itoa(lvl), m[2]))
+		case isRule(trimmed):
+			flushPara()
+			out = append(out, block{"object": "block", "type": "divider", "divider": map[string]any{}})
+		case unorderedRe.MatchString(line):
+			flushPara()
+			out = append(out, textBlock("bulleted_list_item", unorderedRe.FindStringSubmatch(line)[1]))
+		case orderedRe.MatchString(line):
+			flushPara()
+			out = append(out, textBlock("numbered_list_item", orderedRe.FindStringSubmatch(line)[1]))
+		case strings.HasPrefix(trimmed, ">"):
+			flushPara()
+			out = append(out, textBlock("quote", strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))))
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+	return out
+}
+
+func textBlock(typ, text string) block {
+	return block{
+		"object": "block",
+		"type":   typ,
+		typ:      map[string]any{"rich_text": inlineRichText(text)},
+	}
+}
+
+func codeBlock(lang, code string) block {
+	language, ok := codeLanguages[strings.ToLower(lang)]
+	if !ok {
+		language = "plain text"
+	}
+	return block{
+		"object": "block",
+		"type":   "code",
+		"code": map[string]any{
+			"rich_text": plainRichText(code, nil, nil),
+			"language":  language,
+		},
+	}
+}
+
+// isRule reports whether s is a thematic break: three or more of the same -, * or _
+// characters, optionally separated by spaces.
+func isRule(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 3 || !strings.ContainsRune("-*_", rune(s[0])) {
+		return false
+	}
+	return strings.Count(s, s[:1]) == len(s)
+}
+
+// inlineRichText splits text into rich text objects carrying inline formatting.
+func inlineRichText(s string) []richText {
+	out := []richText{}
+	last := 0
+	for _, m := range inlineRe.FindAllStringSubmatchIndex(s, -1) {
+		out = append(out, plainRichText(s[last:m[0]], nil, nil)...)
+		switch {
+		case m[2] >= 0:
+			out = append(out, plainRichText(s[m[2]:m[3]], &annotations{Code: true}, nil)...)
+		case m[4] >= 0:
+			out = append(out, plainRichText(s[m[4]:m[5]], &annotations{Bold: true}, nil)...)
+		case m[6] >= 0:
+			out = append(out, plainRichText(s[m[6]:m[7]], &annotations{Italic: true}, nil)...)
+		case m[8] >= 0:
+			out = append(out, plainRichText(s[m[8]:m[9]], nil, &linkInfo{URL: s[m[10]:m[11]]})...)
+		}
+		last = m[1]
+	}
+	return append(out, plainRichText(s[last:], nil, nil)...)
+}
+
+// plainRichText returns text as rich text objects, split to respect maxRichTextLen.
+// The result is never nil because the API rejects a null rich_text array.
+func plainRichText(s string, ann *annotations, link *linkInfo) []richText {
+	out := []richText{}
+	for _, chunk := range chunkRunes(s, maxRichTextLen) {
+		out = append(out, richText{Type: "text", Text: textContent{Content: chunk, Link: link}, Annotations: ann})
+	}
+	return out
+}
+
+// chunkRunes splits s into pieces of at most n runes without breaking UTF-8 sequences.
+func chunkRunes(s string, n int) []string {
+	var out []string
+	r := []rune(s)
+	for len(r) > n {
+		out = append(out, string(r[:n]))
+		r = r[n:]
+	}
+	if len(r) > 0 {
+		out = append(out, string(r))
+	}
+	return out
+}
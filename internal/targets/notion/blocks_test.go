@@ -0,0 +1,74 @@
+package notion
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestToBlocks(t *testing.T) {
+	md := strings.Join([]string{
+		"# Title",
+		"#### Deep",
+		"",
+		"Some **bold** text and `code` with a [link](https://example.com).",
+		"continued",
+		"",
+		"- one",
+		"* two",
+		"1. first",
+		"",
+		"```py",
+		"print('x')",
+		"```",
+		"---",
+		"> quote",
+	}, "\n")
+
+	blocks := toBlocks(md)
+	var types []string
+	for _, b := range blocks {
+		types = append(types, b["type"].(string))
+	}
+	want := "heading_1,heading_3,paragraph,bulleted_list_item,bulleted_list_item,numbered_list_item,code,divider,quote"
+	if got := strings.Join(types, ","); got != want {
+		t.Fatalf("block types:\n got %s\nwant %s", got, want)
+	}
+
+	para := blocks[2]["paragraph"].(map[string]any)["rich_text"].([]richText)
+	if len(para) != 7 {
+		t.Fatalf("expected 7 rich text segments, got %d: %+v", len(para), para)
+	}
+	if para[1].Text.Content != "bold" || para[1].Annotations == nil || !para[1].Annotations.Bold {
+		t.Fatalf("bold segment mismatch: %+v", para[1])
+	}
+	if para[3].Text.Content != "code" || !para[3].Annotations.Code {
+		t.Fatalf("code segment mismatch: %+v", para[3])
+	}
+	if para[5].Text.Link == nil || para[5].Text.Link.URL != "https://example.com" {
+		t.Fatalf("link segment mismatch: %+v", para[5])
+	}
+	if para[6].Text.Content != ". continued" {
+		t.Fatalf("paragraph lines not joined: %q", para[6].Text.Content)
+	}
+
+	code := blocks[6]["code"].(map[string]any)
+	if code["language"] != "python" || code["rich_text"].([]richText)[0].Text.Content != "print('x')" {
+		t.Fatalf("code block mismatch: %+v", code)
+	}
+}
+
+func TestToBlocks_SplitsLongTextAndNeverNull(t *testing.T) {
+	blocks := toBlocks(strings.Repeat("ä", maxRichTextLen+10) + "\n\n```\n```")
+	rt := blocks[0]["paragraph"].(map[string]any)["rich_text"].([]richText)
+	if len(rt) != 2 || len([]rune(rt[0].Text.Content)) != maxRichTextLen {
+		t.Fatalf("expected text split at %d runes, got %d segments", maxRichTextLen, len(rt))
+	}
+	b, err := json.Marshal(blocks[1])
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(b), `"rich_text":[]`) {
+		t.Fatalf("empty code block should have an empty rich_text array: %s", b)
+	}
+}
@@ -0,0 +1,213 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+	"github.com/jo-hoe/gostwriter/internal/tracing"
+)
+
+const (
+	// notionVersion is the API version sent with every request.
+	notionVersion = "2022-06-28"
+	// maxChildrenPerRequest is the Notion limit for blocks in a single create or append call.
+	maxChildrenPerRequest = 100
+)
+
+// Target implements a Notion target that creates one page per transcription in a
+// database. The Markdown becomes the page content; title and selected metadata are
+// written to database properties.
+type Target struct {
+	name string
+	cfg  appcfg.NotionTargetConfig
+	http *http.Client
+
+	// a successful validation is cached so repeated checks do not hit the API again
+	validated targets.ValidationCache
+}
+
+var (
+	_ targets.Validator = (*Target)(nil)
+	_ targets.Viewer    = (*Target)(nil)
+)
+
+// New creates a Notion Target with the provided config.
+// Uses http.DefaultClient unless a custom client is provided via WithHTTPClient.
+func New(name string, cfg appcfg.NotionTargetConfig) (*Target, error) {
+	if strings.TrimSpace(cfg.Auth.Token) == "" {
+		return nil, fmt.Errorf("notion token must not be empty")
+	}
+	if strings.TrimSpace(cfg.DatabaseID) == "" {
+		return nil, fmt.Errorf("notion database id must not be empty")
+	}
+	if strings.TrimSpace(cfg.APIBaseURL) == "" {
+		cfg.APIBaseURL = "https://api.notion.com"
+	}
+	if strings.TrimSpace(cfg.TitleProperty) == "" {
+		cfg.TitleProperty = "Name"
+	}
+	cfg.APIBaseURL = strings.TrimRight(cfg.APIBaseURL, "/")
+	return &Target{
+		name: name,
+		cfg:  cfg,
+		http: http.DefaultClient,
+	}, nil
+}
+
+// WithHTTPClient allows tests to inject a custom HTTP client (e.g., pointing to httptest.Server).
+func (t *Target) WithHTTPClient(c *http.Client) *Target {
+	t.http = c
+	return t
+}
+
+func (t *Target) Name() string { return t.name }
+
+// Post creates the database page. Content beyond the per-request block limit is
+// appended in further calls. Location is the page URL; Commit is the page id.
+func (t *Target) Post(ctx context.Context, req targets.TargetRequest) (targets.TargetResult, error) {
+	blocks := toBlocks(req.Markdown)
+	first := blocks
+	if len(first) > maxChildrenPerRequest {
+		first = first[:maxChildrenPerRequest]
+	}
+
+	payload := map[string]any{
+		"parent":     map[string]any{"database_id": t.cfg.DatabaseID},
+		"properties": t.properties(req),
+		"children":   first,
+	}
+	var page pageResponse
+	if err := t.call(ctx, http.MethodPost, "/v1/pages", payload, &page); err != nil {
+		return targets.TargetResult{}, err
+	}
+
+	for i := len(first); i < len(blocks); i += maxChildrenPerRequest {
+		end := min(i+maxChildrenPerRequest, len(blocks))
+		path := "/v1/blocks/" + url.PathEscape(page.ID) + "/children"
+		if err := t.call(ctx, http.MethodPatch, path, map[string]any{"children": blocks[i:end]}, nil); err != nil {
+			return targets.TargetResult{}, fmt.Errorf("append blocks to page %s: %w", page.ID, err)
+		}
+	}
+
+	return targets.TargetResult{
+		TargetName: t.name,
+		Location:   page.URL,
+		Commit:     page.ID,
+	}, nil
+}
+
+// ViewURL returns the location itself, which already is the page URL.
+func (t *Target) ViewURL(location string) (string, bool) {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return "", false
+	}
+	return location, true
+}
+
+// Validate checks that the configured database exists and is shared with the integration.
+// A success is cached; transient failures are tried again.
+func (t *Target) Validate(ctx context.Context) error {
+	return t.validated.Check(ctx, func() error {
+		if err := t.call(ctx, http.MethodGet, "/v1/databases/"+url.PathEscape(t.cfg.DatabaseID), nil, nil); err != nil {
+			return fmt.Errorf("database %s: %w", t.cfg.DatabaseID, err)
+		}
+		return nil
+	})
+}
+
+// properties maps the title and configured metadata keys to database properties.
+// Metadata values are written as rich text; keys without a mapping are ignored.
+func (t *Target) properties(req targets.TargetRequest) map[string]any {
+	title := ""
+	if req.SuggestedTitle != nil {
+		title = strings.TrimSpace(*req.SuggestedTitle)
+	}
+	if title == "" {
+		title = fmt.Sprintf("Transcription %s", req.JobID)
+	}
+	props := map[string]any{
+		t.cfg.TitleProperty: map[string]any{"title": plainRichText(title, nil, nil)},
+	}
+	keys := make([]string, 0, len(t.cfg.MetadataProperties))
+	for k := range t.cfg.MetadataProperties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := req.Metadata[k]
+		if !ok || v == nil {
+			continue
+		}
+		props[t.cfg.MetadataProperties[k]] = map[string]any{"rich_text": plainRichText(fmt.Sprint(v), nil, nil)}
+	}
+	return props
+}
+
+// call performs an API request with a JSON body (if non-nil) and decodes a successful
+// response into out (if non-nil).
+func (t *Target) call(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal payload: %w", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, t.cfg.APIBaseURL+path, r)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.cfg.Auth.Token)
+	req.Header.Set("Notion-Version", notionVersion)
+	tracing.Inject(ctx, req.Header)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return targets.Transient(fmt.Errorf("notion request: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr apiError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		err := fmt.Errorf("notion api: status %d", resp.StatusCode)
+		if apiErr.Message != "" {
+			err = fmt.Errorf("notion api: status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		if targets.IsTransientStatus(resp.StatusCode) {
+			return targets.Transient(err)
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// Response structures
+
+type pageResponse struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
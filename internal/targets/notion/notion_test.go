@@ -0,0 +1,116 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appcfg "github.com/jo-hoe/gostwriter/internal/config"
+	"github.com/jo-hoe/gostwriter/internal/targets"
+)
+
+func TestPost_CreatesPageAndAppendsOverflow(t *testing.T) {
+	var created map[string]any
+	var appended []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Notion-Version") != notionVersion || r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("missing headers: %v", r.Header)
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/pages":
+			created = body
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": "page-1", "url": "https://www.notion.so/page-1"})
+		case r.Method == http.MethodPatch && r.URL.Path == "/v1/blocks/page-1/children":
+			appended = append(appended, len(body["children"].([]any)))
+			_ = json.NewEncoder(w).Encode(map[string]any{})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tg, err := New("notion", appcfg.NotionTargetConfig{
+		DatabaseID:         "db-1",
+		TitleProperty:      "Title",
+		MetadataProperties: map[string]string{"author": "Author"},
+		APIBaseURL:         srv.URL,
+		Auth:               appcfg.NotionAuthConfig{Token: "tok"},
+	})
+	if err != nil {
+		t.Fatalf("New notion target: %v", err)
+	}
+	tg.WithHTTPClient(srv.Client())
+
+	var md []string
+	for i := 0; i < 150; i++ {
+		md = append(md, fmt.Sprintf("- item %d", i))
+	}
+	title := "My notes"
+	res, err := tg.Post(context.Background(), targets.TargetRequest{
+		JobID:          "job-1",
+		Markdown:       strings.Join(md, "\n"),
+		SuggestedTitle: &title,
+		Metadata:       map[string]any{"author": "ann", "ignored": "x"},
+	})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if res.Location != "https://www.notion.so/page-1" || res.Commit != "page-1" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if parent := created["parent"].(map[string]any); parent["database_id"] != "db-1" {
+		t.Fatalf("unexpected parent: %v", parent)
+	}
+	if n := len(created["children"].([]any)); n != maxChildrenPerRequest {
+		t.Fatalf("expected %d children on create, got %d", maxChildrenPerRequest, n)
+	}
+	if len(appended) != 1 || appended[0] != 50 {
+		t.Fatalf("expected one append of 50 blocks, got %v", appended)
+	}
+	props := created["properties"].(map[string]any)
+	titleText := props["Title"].(map[string]any)["title"].([]any)[0].(map[string]any)["text"].(map[string]any)["content"]
+	if titleText != "My notes" {
+		t.Fatalf("unexpected title property: %v", props["Title"])
+	}
+	if _, ok := props["Author"]; !ok || len(props) != 2 {
+		t.Fatalf("unexpected properties: %v", props)
+	}
+}
+
+func TestPost_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{"code": "validation_error", "message": "Title is not a property"})
+	}))
+	defer srv.Close()
+
+	tg, err := New("notion", appcfg.NotionTargetConfig{DatabaseID: "db", APIBaseURL: srv.URL, Auth: appcfg.NotionAuthConfig{Token: "tok"}})
+	if err != nil {
+		t.Fatalf("New notion target: %v", err)
+	}
+	tg.WithHTTPClient(srv.Client())
+	_, err = tg.Post(context.Background(), targets.TargetRequest{JobID: "j", Markdown: "x"})
+	if err == nil || !strings.Contains(err.Error(), "status 400: Title is not a property") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestViewURL(t *testing.T) {
+	tg, err := New("notion", appcfg.NotionTargetConfig{DatabaseID: "db", Auth: appcfg.NotionAuthConfig{Token: "t"}})
+	if err != nil {
+		t.Fatalf("New notion target: %v", err)
+	}
+	if u, ok := tg.ViewURL("https://www.notion.so/page-1"); !ok || u != "https://www.notion.so/page-1" {
+		t.Fatalf("unexpected view url %q %v", u, ok)
+	}
+	if _, ok := tg.ViewURL("page-1"); ok {
+		t.Fatalf("expected non-URL location to be rejected")
+	}
+}
@@ -11,23 +11,51 @@ type Target interface {
 	Post(ctx context.Context, req TargetRequest) (TargetResult, error)
 }
 
+// Validator is optionally implemented by targets that can check their configuration
+// against the remote without writing anything (e.g., repository and branch exist).
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// Viewer is optionally implemented by targets that can turn a TargetResult.Location
+// they produced into a browsable URL.
+type Viewer interface {
+	ViewURL(location string) (string, bool)
+}
+
+// TokenUpdater is optionally implemented by targets whose API token can be replaced
+// at runtime, e.g. when a rotated token file is reloaded.
+type TokenUpdater interface {
+	SetToken(token string)
+}
+
 // TargetRequest contains data needed to post content.
 type TargetRequest struct {
 	JobID            string
 	Markdown         string
 	SuggestedTitle   *string
+	Actor            string // name of the API key that submitted the job; empty if unnamed
+	AuthorName       string // requesting user's name (identity proxy or JWT); empty if unknown
+	AuthorEmail      string // requesting user's email (identity proxy or JWT); empty if unknown
 	Metadata         map[string]any
 	Timestamp        time.Time
-	FilenameTemplate string
-	CommitTemplate   string
-	BasePath         string
+	FilenameTemplate string // overrides the configured filename template when non-empty
+	CommitTemplate   string // overrides the configured commit message template when non-empty
+	BasePath         string // overrides the configured base path when non-empty
+	Branch           string // overrides the configured branch when non-empty
+	Model            string // LLM model that produced the Markdown, if known
+	TokenUsage       int    // total LLM tokens spent on the transcription; 0 if not reported
+	DurationMs       int64  // time spent transcribing in milliseconds
+	Language         string // detected document language (ISO 639-1); empty if unknown
+	Flavor           string // Markdown flavor of the transcription (commonmark, gfm, mdx); empty if none
 }
 
 // TargetResult describes where the content landed.
 type TargetResult struct {
-	TargetName string
-	Location   string
-	Commit     string
+	TargetName    string
+	Location      string
+	Commit        string
+	BranchCommits map[string]string // commits of the same content on additional branches, by branch
 }
 
 // Registry holds initialized targets by name.
@@ -55,3 +83,35 @@ func (r *Registry) Names() []string {
 	}
 	return out
 }
+
+// Validate runs Validator.Validate for every registered target that supports it and
+// returns the outcome by target name. Targets without validation support are omitted.
+func (r *Registry) Validate(ctx context.Context) map[string]error {
+	out := make(map[string]error)
+	for name, t := range r.byName {
+		v, ok := t.(Validator)
+		if !ok {
+			continue
+		}
+		out[name] = v.Validate(ctx)
+	}
+	return out
+}
+
+// ViewURL returns a browsable URL for a location produced by the named target,
+// or "" if the target is unknown or cannot derive one.
+func (r *Registry) ViewURL(name, location string) string {
+	t, ok := r.byName[name]
+	if !ok || location == "" {
+		return ""
+	}
+	v, ok := t.(Viewer)
+	if !ok {
+		return ""
+	}
+	u, ok := v.ViewURL(location)
+	if !ok {
+		return ""
+	}
+	return u
+}
@@ -2,6 +2,7 @@ package targets
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -48,3 +49,72 @@ func TestRegistry_AddGetNames(t *testing.T) {
 		t.Fatalf("dummy post returned error: %v", err)
 	}
 }
+
+type validatingTarget struct {
+	dummyTarget
+	err error
+}
+
+func (v *validatingTarget) Validate(ctx context.Context) error { return v.err }
+
+func TestRegistry_Validate(t *testing.T) {
+	reg := NewRegistry()
+	reg.Add(&dummyTarget{name: "plain"})
+	reg.Add(&validatingTarget{dummyTarget: dummyTarget{name: "ok"}})
+	reg.Add(&validatingTarget{dummyTarget: dummyTarget{name: "bad"}, err: errors.New("branch missing")})
+
+	res := reg.Validate(context.Background())
+	if _, ok := res["plain"]; ok {
+		t.Fatalf("targets without Validator should be omitted")
+	}
+	if err, ok := res["ok"]; !ok || err != nil {
+		t.Fatalf("expected ok target to validate, got %v (present=%v)", err, ok)
+	}
+	if res["bad"] == nil {
+		t.Fatalf("expected bad target to report an error")
+	}
+}
+
+func TestValidationCache_CachesOnlySuccess(t *testing.T) {
+	old := validationBackoff
+	validationBackoff = time.Millisecond
+	defer func() { validationBackoff = old }()
+
+	var c ValidationCache
+	calls := 0
+	permanent := errors.New("branch not found")
+	if err := c.Check(context.Background(), func() error { calls++; return permanent }); !errors.Is(err, permanent) || calls != 1 {
+		t.Fatalf("permanent failure = %v after %d calls, want it returned without retry", err, calls)
+	}
+
+	// Failures are not cached; transient ones are tried again within the check.
+	calls = 0
+	err := c.Check(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return Transient(errors.New("status 503"))
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("transient failures = %v after %d calls, want success on the third", err, calls)
+	}
+
+	if err := c.Check(context.Background(), func() error { t.Fatal("check ran after a success"); return nil }); err != nil {
+		t.Fatalf("cached success = %v", err)
+	}
+}
+
+func TestManifestPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"inbox/a.md":    "inbox/a.json",
+		"inbox/a":       "inbox/a.json",
+		"a.b/c.txt":     "a.b/c.json",
+		"inbox/a.json":  "inbox/a.json.json",
+		"20250402-x.md": "20250402-x.json",
+	} {
+		if got := ManifestPath(in); got != want {
+			t.Errorf("ManifestPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
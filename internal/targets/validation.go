@@ -0,0 +1,72 @@
+package targets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// validationAttempts is how often a validation failing with a transient error is tried.
+const validationAttempts = 3
+
+// validationBackoff is the pause before the second attempt, growing with each attempt.
+var validationBackoff = time.Second
+
+// ErrTransient marks target errors that may not recur when the request is repeated,
+// e.g. network errors, rate limits and server errors. Targets wrap it with Transient.
+var ErrTransient = errors.New("transient target error")
+
+// Transient wraps err so that errors.Is(err, ErrTransient) holds. The message of err is
+// kept unchanged. Transient(nil) is nil.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err: err}
+}
+
+type transientError struct{ err error }
+
+func (e transientError) Error() string   { return e.err.Error() }
+func (e transientError) Unwrap() []error { return []error{e.err, ErrTransient} }
+
+// IsTransientStatus reports whether a response with the HTTP status code is worth
+// repeating: request timeouts, rate limits and server errors.
+func IsTransientStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// ValidationCache remembers a successful validation so repeated checks do not hit the
+// remote again. Failures are not cached: a target that was unreachable or misconfigured
+// is checked again next time. The zero value is ready to use.
+type ValidationCache struct {
+	mu sync.Mutex
+	ok bool
+}
+
+// Check returns nil if an earlier check passed. Otherwise it runs check, trying again
+// with a growing pause while it fails with a transient error, and remembers a success.
+func (c *ValidationCache) Check(ctx context.Context, check func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ok {
+		return nil
+	}
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			c.ok = true
+			return nil
+		}
+		if !errors.Is(err, ErrTransient) || attempt == validationAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * validationBackoff):
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+)
+
+// LogHandler wraps h so records logged with a context carrying a span get trace_id and
+// span_id attributes, linking log lines to exported spans.
+func LogHandler(h slog.Handler) slog.Handler {
+	return logHandler{h}
+}
+
+type logHandler struct {
+	slog.Handler
+}
+
+func (h logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc, ok := SpanContextFrom(ctx); ok {
+		r = r.Clone()
+		r.AddAttrs(
+			slog.String("trace_id", hex.EncodeToString(sc.TraceID[:])),
+			slog.String("span_id", hex.EncodeToString(sc.SpanID[:])),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h logHandler) WithGroup(name string) slog.Handler {
+	return logHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,267 @@
+// Package tracing records OpenTelemetry-style spans for requests and jobs and writes
+// them as JSON lines shaped like OTLP/JSON spans. Trace context is propagated with W3C
+// traceparent headers and added to log records. A nil *Tracer records nothing, so
+// callers need no checks when tracing is off.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderTraceparent is the W3C trace context header.
+const HeaderTraceparent = "traceparent"
+
+// Kind describes the role of a span, as in OTLP.
+type Kind string
+
+const (
+	KindInternal Kind = "SPAN_KIND_INTERNAL"
+	KindServer   Kind = "SPAN_KIND_SERVER"
+)
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Valid reports whether sc has non-zero trace and span IDs.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header value. Unknown versions are accepted as
+// long as the version 00 fields can be read, as the W3C spec asks.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags&1 == 1
+	return sc, sc.Valid()
+}
+
+type spanContextKey struct{}
+
+// SpanContextFrom returns the span context of the current span in ctx, if any.
+func SpanContextFrom(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// WithTraceparent returns ctx with the span described by the traceparent value v as the
+// current span, so spans started from it continue that trace. Invalid values leave ctx
+// unchanged.
+func WithTraceparent(ctx context.Context, v string) context.Context {
+	sc, ok := ParseTraceparent(v)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// Traceparent returns the traceparent value of the current span in ctx, or "".
+func Traceparent(ctx context.Context) string {
+	if sc, ok := SpanContextFrom(ctx); ok {
+		return sc.Traceparent()
+	}
+	return ""
+}
+
+// Inject sets the traceparent header for the current span in ctx on an outgoing request.
+func Inject(ctx context.Context, h http.Header) {
+	if v := Traceparent(ctx); v != "" {
+		h.Set(HeaderTraceparent, v)
+	}
+}
+
+// Tracer starts spans and exports them when they end.
+type Tracer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// New creates a Tracer writing one JSON span per line to out.
+func New(out io.Writer) *Tracer {
+	return &Tracer{out: out}
+}
+
+// Start starts a span as a child of the current span in ctx, or as the root of a new
+// trace, and returns ctx with the new span as current. Spans of unsampled traces are
+// propagated but not exported. On a nil Tracer it returns ctx and a nil span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent, ok := SpanContextFrom(ctx); ok {
+		s.sc.TraceID, s.sc.Sampled = parent.TraceID, parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	_, _ = rand.Read(s.sc.SpanID[:])
+	return context.WithValue(ctx, spanContextKey{}, s.sc), s
+}
+
+// Span is a timed operation within a trace. All methods are safe on a nil Span.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   Kind
+	sc     SpanContext
+	parent [8]byte
+	start  time.Time
+
+	mu    sync.Mutex
+	attrs []attribute
+	ended bool
+}
+
+// SpanContext returns the identity of s.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttr records an attribute. Strings, bools and integers keep their type; other
+// values are recorded as strings.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attribute{Key: key, Value: attrValue(value)})
+	s.mu.Unlock()
+}
+
+// End ends s and exports it. A non-nil err marks the span as failed. Only the first
+// call has an effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	rec := spanRecord{
+		TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        s.attrs,
+		Status:            spanStatus{Code: "STATUS_CODE_OK"},
+	}
+	s.mu.Unlock()
+	if !s.sc.Sampled {
+		return
+	}
+	if s.parent != [8]byte{} {
+		rec.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if err != nil {
+		rec.Status = spanStatus{Code: "STATUS_CODE_ERROR", Message: err.Error()}
+	}
+	s.tracer.export(rec)
+}
+
+func (t *Tracer) export(rec spanRecord) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = t.out.Write(append(b, '\n'))
+}
+
+// spanRecord is the exported form of a span, following the OTLP/JSON field names.
+type spanRecord struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              Kind        `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes,omitempty"`
+	Status            spanStatus  `json:"status"`
+}
+
+type spanStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+// attributeValue holds exactly one typed value; OTLP/JSON encodes integers as strings.
+type attributeValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func attrValue(v any) attributeValue {
+	switch x := v.(type) {
+	case string:
+		return attributeValue{StringValue: &x}
+	case bool:
+		return attributeValue{BoolValue: &x}
+	case int:
+		s := strconv.Itoa(x)
+		return attributeValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		return attributeValue{IntValue: &s}
+	default:
+		s := fmt.Sprint(x)
+		return attributeValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const remote = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func decodeSpans(t *testing.T, b *bytes.Buffer) []spanRecord {
+	t.Helper()
+	var out []spanRecord
+	dec := json.NewDecoder(b)
+	for dec.More() {
+		var s spanRecord
+		if err := dec.Decode(&s); err != nil {
+			t.Fatalf("decode span: %v", err)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent(remote)
+	if !ok || !sc.Sampled || sc.Traceparent() != remote {
+		t.Fatalf("round trip failed: %+v %v", sc, ok)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",          // missing flags
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",       // forbidden version
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",       // zero trace ID
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",       // zero span ID
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",       // not hex
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", // extra field in version 00
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"); !ok {
+		t.Errorf("expected a later version with extra fields to be accepted")
+	}
+}
+
+func TestTracer_ChildSpansContinueRemoteTrace(t *testing.T) {
+	var out bytes.Buffer
+	tr := New(&out)
+
+	ctx := WithTraceparent(context.Background(), remote)
+	ctx, parent := tr.Start(ctx, "HTTP POST", KindServer)
+	childCtx, child := tr.Start(ctx, "transcribe", KindInternal)
+	child.SetAttr("job.id", "job-1")
+	child.SetAttr("tokens", 42)
+	child.End(errors.New("llm unavailable"))
+	child.End(nil) // ignored
+	parent.End(nil)
+
+	h := http.Header{}
+	Inject(childCtx, h)
+	if got, want := h.Get(HeaderTraceparent), child.SpanContext().Traceparent(); got != want {
+		t.Fatalf("injected %q, want %q", got, want)
+	}
+
+	spans := decodeSpans(t, &out)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if p.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || p.ParentSpanID != "00f067aa0ba902b7" || p.Kind != KindServer {
+		t.Fatalf("unexpected parent span %+v", p)
+	}
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID || c.Name != "transcribe" {
+		t.Fatalf("unexpected child span %+v", c)
+	}
+	if c.Status.Code != "STATUS_CODE_ERROR" || c.Status.Message != "llm unavailable" || p.Status.Code != "STATUS_CODE_OK" {
+		t.Fatalf("unexpected statuses %+v %+v", c.Status, p.Status)
+	}
+	if len(c.Attributes) != 2 || *c.Attributes[0].Value.StringValue != "job-1" || *c.Attributes[1].Value.IntValue != "42" {
+		t.Fatalf("unexpected attributes %+v", c.Attributes)
+	}
+}
+
+func TestTracer_UnsampledTraceIsPropagatedNotExported(t *testing.T) {
+	var out bytes.Buffer
+	ctx := WithTraceparent(context.Background(), strings.TrimSuffix(remote, "01")+"00")
+	ctx, span := New(&out).Start(ctx, "HTTP GET", KindServer)
+	span.End(nil)
+	if out.Len() != 0 {
+		t.Fatalf("unsampled span exported: %s", out.String())
+	}
+	if v := Traceparent(ctx); !strings.HasPrefix(v, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || !strings.HasSuffix(v, "-00") {
+		t.Fatalf("unexpected traceparent %q", v)
+	}
+}
+
+func TestTracer_NilIsNoop(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "x", KindInternal)
+	span.SetAttr("k", "v")
+	span.End(nil)
+	if Traceparent(ctx) != "" {
+		t.Fatalf("nil tracer must not start a trace")
+	}
+}
+
+func TestLogHandler_AddsTraceIDs(t *testing.T) {
+	var logs bytes.Buffer
+	log := slog.New(LogHandler(slog.NewTextHandler(&logs, nil))).With("component", "test")
+
+	ctx, span := New(&bytes.Buffer{}).Start(WithTraceparent(context.Background(), remote), "op", KindInternal)
+	log.InfoContext(ctx, "inside")
+	log.Info("outside")
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", logs.String())
+	}
+	sc := span.SpanContext()
+	if !strings.Contains(lines[0], "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") || !strings.Contains(lines[0], "span_id="+sc.Traceparent()[36:52]) {
+		t.Fatalf("missing trace IDs: %s", lines[0])
+	}
+	if strings.Contains(lines[1], "trace_id") {
+		t.Fatalf("untraced line has trace IDs: %s", lines[1])
+	}
+}
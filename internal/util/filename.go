@@ -0,0 +1,46 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"unicode/utf8"
+)
+
+const (
+	// MaxFilenameLength is the common path component limit of filesystems and git hosts, in bytes.
+	MaxFilenameLength = 255
+	// MinFilenameLength leaves room for a short prefix, the hash suffix and an extension.
+	MinFilenameLength = 32
+
+	filenameHashLen = 8
+)
+
+// TruncateFilename shortens the last path component of name to at most limit bytes.
+// The extension is kept and a short hash of the original component is appended so
+// different long names stay distinct. Names within the limit are returned unchanged;
+// limit <= 0 disables truncation.
+func TruncateFilename(name string, limit int) string {
+	dir, base := path.Split(name)
+	if limit <= 0 || len(base) <= limit {
+		return name
+	}
+	ext := path.Ext(base)
+	// An "extension" that eats most of the budget is part of the name.
+	if len(ext) > limit/4 {
+		ext = ""
+	}
+	sum := sha256.Sum256([]byte(base))
+	suffix := "-" + hex.EncodeToString(sum[:])[:filenameHashLen] + ext
+	stem := base[:len(base)-len(ext)]
+	keep := limit - len(suffix)
+	if keep < 0 {
+		keep = 0
+	}
+	stem = stem[:keep]
+	// Do not cut a multi-byte character in half.
+	for len(stem) > 0 && !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return dir + stem + suffix
+}
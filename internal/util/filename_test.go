@@ -0,0 +1,56 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateFilename(t *testing.T) {
+	long := strings.Repeat("a very long suggested title ", 20) + ".md"
+	got := TruncateFilename("inbox/"+long, 64)
+	if !strings.HasPrefix(got, "inbox/") {
+		t.Fatalf("directory lost: %q", got)
+	}
+	base := strings.TrimPrefix(got, "inbox/")
+	if len(base) != 64 {
+		t.Fatalf("basename length = %d, want 64: %q", len(base), base)
+	}
+	if !strings.HasSuffix(base, ".md") {
+		t.Fatalf("extension lost: %q", base)
+	}
+	if !strings.HasPrefix(base, "a very long suggested title") {
+		t.Fatalf("prefix lost: %q", base)
+	}
+
+	// Names sharing the same prefix stay distinct.
+	other := TruncateFilename("inbox/"+strings.Replace(long, "title .md", "titel .md", 1), 64)
+	if other == got {
+		t.Fatalf("different names truncated to the same result: %q", got)
+	}
+	// Deterministic.
+	if again := TruncateFilename("inbox/"+long, 64); again != got {
+		t.Fatalf("not deterministic: %q vs %q", again, got)
+	}
+}
+
+func TestTruncateFilename_Unchanged(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		max  int
+	}{
+		{"short.md", 64},
+		{strings.Repeat("x", 300) + ".md", 0},
+	} {
+		if got := TruncateFilename(tc.name, tc.max); got != tc.name {
+			t.Fatalf("TruncateFilename(%q, %d) = %q, want unchanged", tc.name, tc.max, got)
+		}
+	}
+}
+
+func TestTruncateFilename_MultiByte(t *testing.T) {
+	got := TruncateFilename(strings.Repeat("ü", 100)+".md", 40)
+	if len(got) > 40 || !utf8.ValidString(got) || !strings.HasSuffix(got, ".md") {
+		t.Fatalf("bad truncation: %q (%d bytes)", got, len(got))
+	}
+}
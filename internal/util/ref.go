@@ -0,0 +1,57 @@
+package util
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ValidateBranchName checks name against the git ref naming rules (git check-ref-format)
+// so user supplied branch names cannot smuggle in ref syntax or path traversal.
+func ValidateBranchName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("branch name is empty")
+	case name == "@":
+		return fmt.Errorf("branch name %q is reserved", name)
+	case len(name) > 255:
+		return fmt.Errorf("branch name is too long")
+	case strings.HasPrefix(name, "-"), strings.HasPrefix(name, "/"), strings.HasSuffix(name, "/"):
+		return fmt.Errorf("branch name %q must not start with '-' or '/' or end with '/'", name)
+	case strings.HasSuffix(name, "."), strings.HasSuffix(name, ".lock"):
+		return fmt.Errorf("branch name %q must not end with '.' or '.lock'", name)
+	case strings.Contains(name, ".."), strings.Contains(name, "//"), strings.Contains(name, "@{"):
+		return fmt.Errorf("branch name %q contains an invalid sequence", name)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("branch name %q contains invalid character %q", name, r)
+		}
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return fmt.Errorf("branch name %q has a component starting with '.'", name)
+		}
+	}
+	return nil
+}
+
+// CleanRelativePath normalizes a user supplied directory path to slash form with a
+// trailing slash (e.g. "notes/2024/") and rejects absolute paths and ".." segments.
+// An empty or root-only input yields "".
+func CleanRelativePath(p string) (string, error) {
+	p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "", fmt.Errorf("path %q must be relative", p)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("path %q must not contain '..'", p)
+		}
+	}
+	p = path.Clean(p)
+	if p == "." {
+		return "", nil
+	}
+	return p + "/", nil
+}
@@ -0,0 +1,39 @@
+package util
+
+import "testing"
+
+func TestValidateBranchName(t *testing.T) {
+	valid := []string{"main", "feature/notes", "release-1.2", "user/jo/inbox"}
+	for _, b := range valid {
+		if err := ValidateBranchName(b); err != nil {
+			t.Errorf("ValidateBranchName(%q) = %v, want nil", b, err)
+		}
+	}
+	invalid := []string{"", "@", "-x", "/x", "x/", "x.", "x.lock", "a..b", "a//b", "a@{1}", "a b", "a~1", "a^", "a:b", "a?", "a*", "a[b", `a\b`, "a/.hidden", "a\x00b"}
+	for _, b := range invalid {
+		if err := ValidateBranchName(b); err == nil {
+			t.Errorf("ValidateBranchName(%q) = nil, want error", b)
+		}
+	}
+}
+
+func TestCleanRelativePath(t *testing.T) {
+	cases := map[string]string{
+		"":              "",
+		"notes":         "notes/",
+		"notes/2024/":   "notes/2024/",
+		`notes\sub`:     "notes/sub/",
+		"./notes//sub/": "notes/sub/",
+	}
+	for in, want := range cases {
+		got, err := CleanRelativePath(in)
+		if err != nil || got != want {
+			t.Errorf("CleanRelativePath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"/etc", "../x", "a/../../b", `C:\x`} {
+		if _, err := CleanRelativePath(in); err == nil {
+			t.Errorf("CleanRelativePath(%q) = nil error, want error", in)
+		}
+	}
+}